@@ -0,0 +1,303 @@
+// Package bulk sends the same kind of request to many charge points at once, e.g. a configuration change
+// for a whole fleet, and aggregates the outcome for every charge point into a single report.
+//
+// The package is used by the CentralSystem (OCPP 1.6) and CSMS (OCPP 2.0.1) implementations,
+// which expose it via their SendBulkRequest method.
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ocppj"
+	"github.com/xBlaz3kx/ocpp-go/ws"
+)
+
+const defaultConcurrency = 50
+
+// Outcome describes the result of a request sent to a single charge point.
+type Outcome string
+
+const (
+	// The charge point accepted the request.
+	Accepted Outcome = "Accepted"
+	// The charge point responded, but didn't accept the request.
+	Rejected Outcome = "Rejected"
+	// The request couldn't be created or sent, or the charge point responded with an error.
+	Errored Outcome = "Errored"
+	// No response was received in time.
+	TimedOut Outcome = "TimedOut"
+	// The charge point wasn't connected.
+	Offline Outcome = "Offline"
+)
+
+// Result is the outcome of a request sent to a single charge point.
+type Result struct {
+	ClientID string
+	Outcome  Outcome
+	// The request sent to the charge point. Nil if the request factory failed.
+	Request ocpp.Request
+	// The response of the charge point, if any.
+	Response ocpp.Response
+	// The error, which caused the request to fail, if any.
+	Err error
+	// The time from sending the request to receiving the response or error.
+	Duration time.Duration
+}
+
+// Report contains the results for all targets of a bulk request, grouped by outcome.
+type Report struct {
+	Accepted []Result
+	Rejected []Result
+	Errored  []Result
+	TimedOut []Result
+	Offline  []Result
+}
+
+func (r *Report) add(result Result) {
+	switch result.Outcome {
+	case Accepted:
+		r.Accepted = append(r.Accepted, result)
+	case Rejected:
+		r.Rejected = append(r.Rejected, result)
+	case TimedOut:
+		r.TimedOut = append(r.TimedOut, result)
+	case Offline:
+		r.Offline = append(r.Offline, result)
+	default:
+		r.Errored = append(r.Errored, result)
+	}
+}
+
+// Total returns the number of targets, for which a result was reported.
+func (r Report) Total() int {
+	return len(r.Accepted) + len(r.Rejected) + len(r.Errored) + len(r.TimedOut) + len(r.Offline)
+}
+
+// Targets selects the charge points, to which a bulk request is sent.
+type Targets struct {
+	clientIDs []string
+	selector  func(client ws.Channel) bool
+	connected bool
+}
+
+// ClientIDs targets the charge points with the given IDs.
+// Charge points, which aren't connected, are reported as Offline.
+func ClientIDs(clientIDs ...string) Targets {
+	return Targets{clientIDs: clientIDs}
+}
+
+// Connected targets all connected charge points, for which the selector returns true.
+// If selector is nil, all connected charge points are targeted.
+//
+// If the server is part of a cluster, only charge points connected to this node are targeted.
+func Connected(selector func(client ws.Channel) bool) Targets {
+	return Targets{selector: selector, connected: true}
+}
+
+// RequestFactory creates the request for a single charge point.
+// If an error is returned, no request is sent and the charge point is reported as Errored.
+type RequestFactory func(clientID string) (ocpp.Request, error)
+
+// Option configures a bulk request.
+type Option func(*options)
+
+type options struct {
+	concurrency int
+	timeout     time.Duration
+	onResult    func(Result)
+	isAccepted  func(response ocpp.Response) bool
+}
+
+// WithConcurrency sets the maximum number of charge points, to which requests are in flight at the same time.
+// Defaults to 50.
+func WithConcurrency(concurrency int) Option {
+	return func(o *options) {
+		o.concurrency = concurrency
+	}
+}
+
+// WithTimeout sets the maximum time to wait for the response of a single charge point.
+// By default, only the timeout of the dispatcher applies.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithResultHandler registers a handler, which is invoked with the result of every charge point as soon as it is available.
+// The handler may be invoked concurrently.
+func WithResultHandler(handler func(result Result)) Option {
+	return func(o *options) {
+		o.onResult = handler
+	}
+}
+
+// WithAcceptance sets the function deciding whether a response means that the request was accepted.
+// By default, see IsAccepted.
+func WithAcceptance(isAccepted func(response ocpp.Response) bool) Option {
+	return func(o *options) {
+		o.isAccepted = isAccepted
+	}
+}
+
+// Status values, which are considered as accepted by IsAccepted.
+var acceptedStatuses = map[string]bool{
+	"Accepted":         true,
+	"AcceptedCanceled": true,
+	"RebootRequired":   true,
+	"Scheduled":        true,
+	"Unlocked":         true,
+}
+
+// IsAccepted is the default acceptance function. Responses without a Status field are considered accepted.
+// Otherwise, the response is accepted if the status is Accepted, or another status signaling that the request
+// will be carried out, e.g. RebootRequired, Scheduled or Unlocked.
+func IsAccepted(response ocpp.Response) bool {
+	value := reflect.ValueOf(response)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return true
+	}
+	status := value.FieldByName("Status")
+	if !status.IsValid() || status.Kind() != reflect.String {
+		return true
+	}
+	return acceptedStatuses[status.String()]
+}
+
+// Sender sends requests to charge points asynchronously, e.g. a CentralSystem or CSMS.
+type Sender interface {
+	SendRequestAsyncCtx(ctx context.Context, clientID string, request ocpp.Request, callback func(ocpp.Response, error)) error
+}
+
+// Clients provides the connected charge points, e.g. an ocppj.Server.
+type Clients interface {
+	ConnectedClients() []ws.Channel
+	IsClientConnected(clientID string) bool
+}
+
+// Send sends a request created by factory to all targets, and waits for all of them to complete.
+//
+// If ctx is done, requests which weren't sent yet are reported as Errored, and requests in flight are canceled.
+func Send(ctx context.Context, sender Sender, clients Clients, targets Targets, factory RequestFactory, opts ...Option) Report {
+	o := options{concurrency: defaultConcurrency, isAccepted: IsAccepted}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.concurrency <= 0 {
+		o.concurrency = defaultConcurrency
+	}
+
+	clientIDs := targets.clientIDs
+	if targets.connected {
+		clientIDs = nil
+		for _, client := range clients.ConnectedClients() {
+			if targets.selector == nil || targets.selector(client) {
+				clientIDs = append(clientIDs, client.ID())
+			}
+		}
+	}
+
+	var report Report
+	var mutex sync.Mutex
+	clientC := make(chan string)
+	var wg sync.WaitGroup
+	workers := min(o.concurrency, len(clientIDs))
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for clientID := range clientC {
+				result := sendOne(ctx, sender, clients, clientID, factory, &o)
+				if o.onResult != nil {
+					o.onResult(result)
+				}
+				mutex.Lock()
+				report.add(result)
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, clientID := range clientIDs {
+		clientC <- clientID
+	}
+	close(clientC)
+	wg.Wait()
+	return report
+}
+
+// sendOne sends a request to a single charge point and waits for the outcome.
+func sendOne(ctx context.Context, sender Sender, clients Clients, clientID string, factory RequestFactory, o *options) Result {
+	result := Result{ClientID: clientID}
+	if err := ctx.Err(); err != nil {
+		result.Outcome, result.Err = Errored, err
+		return result
+	}
+	if !clients.IsClientConnected(clientID) {
+		result.Outcome = Offline
+		result.Err = fmt.Errorf("client %s is not connected", clientID)
+		return result
+	}
+	request, err := factory(clientID)
+	if err != nil {
+		result.Outcome, result.Err = Errored, err
+		return result
+	}
+	result.Request = request
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		response ocpp.Response
+		err      error
+	}
+	outcomeC := make(chan outcome, 1)
+	start := time.Now()
+	err = sender.SendRequestAsyncCtx(ctx, clientID, request, func(response ocpp.Response, err error) {
+		outcomeC <- outcome{response, err}
+	})
+	if err == nil {
+		var r outcome
+		select {
+		case r = <-outcomeC:
+		case <-ctx.Done():
+			// The sender may not invoke the callback once ctx is done, unless it did so concurrently
+			select {
+			case r = <-outcomeC:
+			default:
+				r.err = ctx.Err()
+			}
+		}
+		result.Response, err = r.response, r.err
+	}
+	result.Duration = time.Since(start)
+	switch {
+	case err == nil && o.isAccepted(result.Response):
+		result.Outcome = Accepted
+	case err == nil:
+		result.Outcome = Rejected
+	case errors.Is(err, context.DeadlineExceeded) || ocppj.IsRequestTimeout(err):
+		result.Outcome, result.Err = TimedOut, err
+	case errors.Is(err, context.Canceled):
+		result.Outcome, result.Err = Errored, err
+	case !clients.IsClientConnected(clientID):
+		result.Outcome, result.Err = Offline, err
+	default:
+		result.Outcome, result.Err = Errored, err
+	}
+	return result
+}
@@ -0,0 +1,277 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/core"
+	"github.com/xBlaz3kx/ocpp-go/ocppj"
+	"github.com/xBlaz3kx/ocpp-go/ws"
+)
+
+// ---------------------- FAKES ----------------------
+type fakeChannel struct {
+	ws.Channel
+	id string
+}
+
+func (c fakeChannel) ID() string {
+	return c.id
+}
+
+// fakeServer answers requests with the configured behavior of each client.
+// Clients without a behavior respond with the error of ctx, once it is done.
+type fakeServer struct {
+	mutex     sync.Mutex
+	connected map[string]bool
+	behavior  map[string]func(callback func(ocpp.Response, error))
+	inFlight  int32
+	maxFlight int32
+}
+
+func newFakeServer(clientIDs ...string) *fakeServer {
+	s := &fakeServer{connected: map[string]bool{}, behavior: map[string]func(func(ocpp.Response, error)){}}
+	for _, clientID := range clientIDs {
+		s.connected[clientID] = true
+	}
+	return s
+}
+
+func (s *fakeServer) respond(clientID string, status core.ConfigurationStatus) {
+	s.behavior[clientID] = func(callback func(ocpp.Response, error)) {
+		callback(core.NewChangeConfigurationConfirmation(status), nil)
+	}
+}
+
+func (s *fakeServer) ConnectedClients() []ws.Channel {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var channels []ws.Channel
+	for clientID, connected := range s.connected {
+		if connected {
+			channels = append(channels, fakeChannel{id: clientID})
+		}
+	}
+	return channels
+}
+
+func (s *fakeServer) IsClientConnected(clientID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connected[clientID]
+}
+
+func (s *fakeServer) SendRequestAsyncCtx(ctx context.Context, clientID string, request ocpp.Request, callback func(ocpp.Response, error)) error {
+	inFlight := atomic.AddInt32(&s.inFlight, 1)
+	for {
+		max := atomic.LoadInt32(&s.maxFlight)
+		if inFlight <= max || atomic.CompareAndSwapInt32(&s.maxFlight, max, inFlight) {
+			break
+		}
+	}
+	done := func(response ocpp.Response, err error) {
+		atomic.AddInt32(&s.inFlight, -1)
+		callback(response, err)
+	}
+	s.mutex.Lock()
+	behavior := s.behavior[clientID]
+	s.mutex.Unlock()
+	if behavior == nil {
+		go func() {
+			<-ctx.Done()
+			done(nil, ctx.Err())
+		}()
+		return nil
+	}
+	go behavior(done)
+	return nil
+}
+
+func newChangeConfiguration(clientID string) (ocpp.Request, error) {
+	return core.NewChangeConfigurationRequest("HeartbeatInterval", "60"), nil
+}
+
+func clientIDs(results []Result) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ClientID)
+	}
+	return ids
+}
+
+// ---------------------- TESTS ----------------------
+type BulkTestSuite struct {
+	suite.Suite
+}
+
+func (suite *BulkTestSuite) TestReport() {
+	server := newFakeServer("cp1", "cp2", "cp3", "cp4", "cp5")
+	server.respond("cp1", core.ConfigurationStatusAccepted)
+	server.respond("cp2", core.ConfigurationStatusRebootRequired)
+	server.respond("cp3", core.ConfigurationStatusRejected)
+	server.behavior["cp4"] = func(callback func(ocpp.Response, error)) {
+		callback(nil, ocpp.NewError(ocppj.InternalError, "failure", "1234"))
+	}
+	server.behavior["cp5"] = func(callback func(ocpp.Response, error)) {
+		callback(nil, ocpp.NewError(ocppj.GenericError, "Request timed out", "1234"))
+	}
+
+	report := Send(context.Background(), server, server, ClientIDs("cp1", "cp2", "cp3", "cp4", "cp5", "cp6"), newChangeConfiguration)
+	suite.Equal(6, report.Total())
+	suite.ElementsMatch([]string{"cp1", "cp2"}, clientIDs(report.Accepted))
+	suite.Equal([]string{"cp3"}, clientIDs(report.Rejected))
+	suite.Equal([]string{"cp4"}, clientIDs(report.Errored))
+	suite.Equal([]string{"cp5"}, clientIDs(report.TimedOut))
+	suite.Equal([]string{"cp6"}, clientIDs(report.Offline))
+	rejected := report.Rejected[0]
+	suite.IsType(&core.ChangeConfigurationRequest{}, rejected.Request)
+	suite.Equal(core.ConfigurationStatusRejected, rejected.Response.(*core.ChangeConfigurationConfirmation).Status)
+	suite.NoError(rejected.Err)
+	suite.Error(report.Errored[0].Err)
+	suite.Nil(report.Offline[0].Request)
+}
+
+func (suite *BulkTestSuite) TestConnectedSelector() {
+	server := newFakeServer("cp1", "cp2", "other")
+	for clientID := range server.connected {
+		server.respond(clientID, core.ConfigurationStatusAccepted)
+	}
+	report := Send(context.Background(), server, server, Connected(func(client ws.Channel) bool {
+		return client.ID() != "other"
+	}), newChangeConfiguration)
+	suite.ElementsMatch([]string{"cp1", "cp2"}, clientIDs(report.Accepted))
+	suite.Equal(2, report.Total())
+
+	report = Send(context.Background(), server, server, Connected(nil), newChangeConfiguration)
+	suite.ElementsMatch([]string{"cp1", "cp2", "other"}, clientIDs(report.Accepted))
+}
+
+func (suite *BulkTestSuite) TestFactoryError() {
+	server := newFakeServer("cp1", "cp2")
+	server.respond("cp1", core.ConfigurationStatusAccepted)
+	server.respond("cp2", core.ConfigurationStatusAccepted)
+	factoryErr := errors.New("no configuration for client")
+	report := Send(context.Background(), server, server, ClientIDs("cp1", "cp2"), func(clientID string) (ocpp.Request, error) {
+		if clientID == "cp2" {
+			return nil, factoryErr
+		}
+		return newChangeConfiguration(clientID)
+	})
+	suite.Equal([]string{"cp1"}, clientIDs(report.Accepted))
+	suite.Require().Len(report.Errored, 1)
+	suite.Equal("cp2", report.Errored[0].ClientID)
+	suite.ErrorIs(report.Errored[0].Err, factoryErr)
+}
+
+func (suite *BulkTestSuite) TestTimeout() {
+	server := newFakeServer("cp1", "cp2")
+	server.respond("cp1", core.ConfigurationStatusAccepted)
+	// cp2 never responds
+	report := Send(context.Background(), server, server, ClientIDs("cp1", "cp2"), newChangeConfiguration, WithTimeout(50*time.Millisecond))
+	suite.Equal([]string{"cp1"}, clientIDs(report.Accepted))
+	suite.Require().Len(report.TimedOut, 1)
+	suite.Equal("cp2", report.TimedOut[0].ClientID)
+	suite.ErrorIs(report.TimedOut[0].Err, context.DeadlineExceeded)
+	suite.GreaterOrEqual(report.TimedOut[0].Duration, 50*time.Millisecond)
+}
+
+func (suite *BulkTestSuite) TestSenderIgnoresContext() {
+	server := newFakeServer("cp1", "cp2")
+	// Neither client ever invokes the callback, not even when ctx is done
+	server.behavior["cp1"] = func(callback func(ocpp.Response, error)) {}
+	server.behavior["cp2"] = func(callback func(ocpp.Response, error)) {}
+	report := Send(context.Background(), server, server, ClientIDs("cp1"), newChangeConfiguration, WithTimeout(50*time.Millisecond))
+	suite.Require().Len(report.TimedOut, 1)
+	suite.ErrorIs(report.TimedOut[0].Err, context.DeadlineExceeded)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	report = Send(ctx, server, server, ClientIDs("cp2"), newChangeConfiguration)
+	suite.Require().Len(report.Errored, 1)
+	suite.Equal("cp2", report.Errored[0].ClientID)
+	suite.ErrorIs(report.Errored[0].Err, context.Canceled)
+}
+
+func (suite *BulkTestSuite) TestDisconnectedWhileInFlight() {
+	server := newFakeServer("cp1")
+	server.behavior["cp1"] = func(callback func(ocpp.Response, error)) {
+		server.mutex.Lock()
+		server.connected["cp1"] = false
+		server.mutex.Unlock()
+		callback(nil, ocpp.NewError(ocppj.GenericError, "client disconnected, no response received from client", ""))
+	}
+	report := Send(context.Background(), server, server, ClientIDs("cp1"), newChangeConfiguration)
+	suite.Equal([]string{"cp1"}, clientIDs(report.Offline))
+	suite.Error(report.Offline[0].Err)
+}
+
+func (suite *BulkTestSuite) TestConcurrency() {
+	var ids []string
+	server := newFakeServer()
+	release := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		clientID := fmt.Sprintf("cp%d", i)
+		ids = append(ids, clientID)
+		server.connected[clientID] = true
+		server.behavior[clientID] = func(callback func(ocpp.Response, error)) {
+			<-release
+			callback(core.NewChangeConfigurationConfirmation(core.ConfigurationStatusAccepted), nil)
+		}
+	}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	var streamed int32
+	report := Send(context.Background(), server, server, ClientIDs(ids...), newChangeConfiguration,
+		WithConcurrency(5),
+		WithResultHandler(func(result Result) {
+			suite.Equal(Accepted, result.Outcome)
+			atomic.AddInt32(&streamed, 1)
+		}))
+	suite.Len(report.Accepted, 20)
+	suite.Equal(int32(20), atomic.LoadInt32(&streamed))
+	suite.Equal(int32(5), atomic.LoadInt32(&server.maxFlight))
+}
+
+func (suite *BulkTestSuite) TestContextCanceled() {
+	server := newFakeServer("cp1", "cp2")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report := Send(ctx, server, server, ClientIDs("cp1", "cp2"), newChangeConfiguration)
+	suite.ElementsMatch([]string{"cp1", "cp2"}, clientIDs(report.Errored))
+	for _, result := range report.Errored {
+		suite.ErrorIs(result.Err, context.Canceled)
+	}
+}
+
+func (suite *BulkTestSuite) TestAcceptance() {
+	suite.True(IsAccepted(core.NewChangeConfigurationConfirmation(core.ConfigurationStatusAccepted)))
+	suite.True(IsAccepted(core.NewUnlockConnectorConfirmation(core.UnlockStatusUnlocked)))
+	suite.False(IsAccepted(core.NewChangeConfigurationConfirmation(core.ConfigurationStatusNotSupported)))
+	suite.True(IsAccepted(core.NewGetConfigurationConfirmation(nil)))
+	suite.False(IsAccepted((*core.ChangeConfigurationConfirmation)(nil)))
+
+	server := newFakeServer("cp1")
+	server.respond("cp1", core.ConfigurationStatusRebootRequired)
+	report := Send(context.Background(), server, server, ClientIDs("cp1"), newChangeConfiguration,
+		WithAcceptance(func(response ocpp.Response) bool {
+			return response.(*core.ChangeConfigurationConfirmation).Status == core.ConfigurationStatusAccepted
+		}))
+	suite.Equal([]string{"cp1"}, clientIDs(report.Rejected))
+}
+
+func TestBulk(t *testing.T) {
+	suite.Run(t, new(BulkTestSuite))
+}
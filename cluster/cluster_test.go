@@ -0,0 +1,420 @@
+package cluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ocppj"
+	"github.com/xBlaz3kx/ocpp-go/ws"
+)
+
+// ---------------------- TEST FEATURE ----------------------
+const (
+	testFeatureName = "Test"
+	testSubProtocol = "ocpp1.6"
+)
+
+type testRequest struct {
+	Value string `json:"value"`
+}
+
+type testResponse struct {
+	Value string `json:"value"`
+}
+
+type testFeature struct{}
+
+func (f testFeature) GetFeatureName() string {
+	return testFeatureName
+}
+
+func (f testFeature) GetRequestType() reflect.Type {
+	return reflect.TypeOf(testRequest{})
+}
+
+func (f testFeature) GetResponseType() reflect.Type {
+	return reflect.TypeOf(testResponse{})
+}
+
+func (r *testRequest) GetFeatureName() string {
+	return testFeatureName
+}
+
+func (r *testResponse) GetFeatureName() string {
+	return testFeatureName
+}
+
+var testProfile = ocpp.NewProfile("test", testFeature{})
+
+// ---------------------- REGISTRY ----------------------
+type RedisRegistrySuite struct {
+	suite.Suite
+	redis    *miniredis.Miniredis
+	registry *RedisRegistry
+}
+
+func (s *RedisRegistrySuite) SetupTest() {
+	s.redis = miniredis.RunT(s.T())
+	s.redis.RequireAuth("secret")
+	s.registry = NewRedisRegistry(s.redis.Addr(), WithRedisAuth("", "secret"), WithKeyPrefix("test"))
+}
+
+func (s *RedisRegistrySuite) TearDownTest() {
+	_ = s.registry.Close()
+}
+
+func (s *RedisRegistrySuite) TestRegisterAndLookup() {
+	ctx := context.Background()
+	nodeID, found, err := s.registry.Lookup(ctx, "cp1")
+	s.Require().NoError(err)
+	s.False(found)
+	s.Empty(nodeID)
+
+	s.Require().NoError(s.registry.Register(ctx, "cp1", "node1"))
+	value, err := s.redis.Get("test:client:cp1")
+	s.Require().NoError(err)
+	s.Equal("node1", value)
+	nodeID, found, err = s.registry.Lookup(ctx, "cp1")
+	s.Require().NoError(err)
+	s.True(found)
+	s.Equal("node1", nodeID)
+
+	// Reconnecting to another node replaces the record
+	s.Require().NoError(s.registry.Register(ctx, "cp1", "node2"))
+	nodeID, _, _ = s.registry.Lookup(ctx, "cp1")
+	s.Equal("node2", nodeID)
+}
+
+func (s *RedisRegistrySuite) TestUnregisterOnlyOwnRecord() {
+	ctx := context.Background()
+	s.Require().NoError(s.registry.Register(ctx, "cp1", "node2"))
+	// A late disconnect from the previous node doesn't remove the record
+	s.Require().NoError(s.registry.Unregister(ctx, "cp1", "node1"))
+	nodeID, found, _ := s.registry.Lookup(ctx, "cp1")
+	s.True(found)
+	s.Equal("node2", nodeID)
+	s.Require().NoError(s.registry.Unregister(ctx, "cp1", "node2"))
+	_, found, _ = s.registry.Lookup(ctx, "cp1")
+	s.False(found)
+}
+
+func (s *RedisRegistrySuite) TestInvalidCredentials() {
+	registry := NewRedisRegistry(s.redis.Addr(), WithRedisAuth("", "invalid"))
+	defer registry.Close()
+	err := registry.Register(context.Background(), "cp1", "node1")
+	s.ErrorContains(err, "WRONGPASS")
+}
+
+func (s *RedisRegistrySuite) TestReconnectAfterConnectionLoss() {
+	ctx := context.Background()
+	s.Require().NoError(s.registry.Register(ctx, "cp1", "node1"))
+	s.redis.Close()
+	s.Require().NoError(s.redis.Restart())
+	// The first command may fail on the broken connection, the next one reconnects
+	_, _, _ = s.registry.Lookup(ctx, "cp1")
+	nodeID, found, err := s.registry.Lookup(ctx, "cp1")
+	s.Require().NoError(err)
+	s.True(found)
+	s.Equal("node1", nodeID)
+}
+
+func (s *RedisRegistrySuite) TestRegistrationTTL() {
+	ctx := context.Background()
+	registry := NewRedisRegistry(s.redis.Addr(), WithRedisAuth("", "secret"), WithRegistrationTTL(300*time.Millisecond))
+	s.Require().NoError(registry.Register(ctx, "cp1", "node1"))
+	s.Require().NoError(registry.Register(ctx, "cp2", "node1"))
+	s.Require().NoError(registry.Unregister(ctx, "cp2", "node1"))
+	s.Equal(300*time.Millisecond, s.redis.TTL("ocpp:client:cp1"))
+	// Records of connected clients are refreshed, before they expire
+	for i := 0; i < 3; i++ {
+		s.redis.FastForward(200 * time.Millisecond)
+		s.Eventually(func() bool {
+			return s.redis.TTL("ocpp:client:cp1") == 300*time.Millisecond
+		}, time.Second, 10*time.Millisecond)
+	}
+	nodeID, found, err := registry.Lookup(ctx, "cp1")
+	s.Require().NoError(err)
+	s.True(found)
+	s.Equal("node1", nodeID)
+	_, found, _ = registry.Lookup(ctx, "cp2")
+	s.False(found)
+	// Records expire once the registry is closed, e.g. because the node crashed
+	s.Require().NoError(registry.Close())
+	s.redis.FastForward(300 * time.Millisecond)
+	s.False(s.redis.Exists("ocpp:client:cp1"))
+}
+
+// ---------------------- TRANSPORT ----------------------
+type RedisTransportSuite struct {
+	suite.Suite
+	redis *miniredis.Miniredis
+}
+
+func (s *RedisTransportSuite) SetupTest() {
+	s.redis = miniredis.RunT(s.T())
+}
+
+func (s *RedisTransportSuite) TestSendAndReceive() {
+	receiver := NewRedisTransport(s.redis.Addr())
+	sender := NewRedisTransport(s.redis.Addr())
+	receivedC := make(chan string, 2)
+	s.Require().NoError(receiver.Start("node1", func(data []byte) {
+		receivedC <- string(data)
+	}))
+	defer receiver.Stop()
+	defer sender.Stop()
+	s.Error(receiver.Start("node1", func(data []byte) {}))
+
+	ctx := context.Background()
+	s.Require().NoError(sender.Send(ctx, "node1", []byte("first")))
+	s.Require().NoError(sender.Send(ctx, "node1", []byte("second")))
+	s.Equal("first", <-receivedC)
+	s.Equal("second", <-receivedC)
+}
+
+func (s *RedisTransportSuite) TestSendToUnreachableNode() {
+	sender := NewRedisTransport(s.redis.Addr())
+	defer sender.Stop()
+	err := sender.Send(context.Background(), "node1", []byte("message"))
+	s.ErrorContains(err, "node node1 is not reachable")
+}
+
+func (s *RedisTransportSuite) TestResubscribeAfterConnectionLoss() {
+	receiver := NewRedisTransport(s.redis.Addr())
+	sender := NewRedisTransport(s.redis.Addr())
+	receivedC := make(chan string, 1)
+	s.Require().NoError(receiver.Start("node1", func(data []byte) {
+		receivedC <- string(data)
+	}))
+	defer receiver.Stop()
+	defer sender.Stop()
+	s.redis.Close()
+	s.Require().NoError(s.redis.Restart())
+	s.Eventually(func() bool {
+		return sender.Send(context.Background(), "node1", []byte("message")) == nil
+	}, 3*time.Second, 100*time.Millisecond)
+	s.Equal("message", <-receivedC)
+}
+
+func (s *RedisTransportSuite) TestStop() {
+	receiver := NewRedisTransport(s.redis.Addr())
+	s.Require().NoError(receiver.Start("node1", func(data []byte) {}))
+	s.Require().NoError(receiver.Stop())
+	s.Require().NoError(receiver.Stop())
+	sender := NewRedisTransport(s.redis.Addr())
+	defer sender.Stop()
+	s.Eventually(func() bool {
+		return sender.Send(context.Background(), "node1", []byte("message")) != nil
+	}, time.Second, 50*time.Millisecond)
+}
+
+// ---------------------- CLUSTER ----------------------
+type clusterNode struct {
+	server     *ocppj.Server
+	registry   *RedisRegistry
+	httpServer *httptest.Server
+	url        string
+	connected  chan string
+}
+
+type ClusterSuite struct {
+	suite.Suite
+	redis *miniredis.Miniredis
+	nodeA *clusterNode
+	nodeB *clusterNode
+}
+
+func (s *ClusterSuite) newNode(nodeID string) *clusterNode {
+	wsServer := ws.NewServer()
+	wsServer.AddSupportedSubprotocol(testSubProtocol)
+	server, err := ocppj.NewServer(wsServer, nil, nil, nil, testProfile)
+	s.Require().NoError(err)
+	registry := NewRedisRegistry(s.redis.Addr())
+	server.SetCluster(ocppj.ClusterConfig{
+		NodeID:         nodeID,
+		Registry:       registry,
+		Transport:      NewRedisTransport(s.redis.Addr()),
+		RequestTimeout: 2 * time.Second,
+	})
+	node := &clusterNode{server: server, registry: registry, connected: make(chan string, 1)}
+	server.SetNewClientHandler(func(client ws.Channel) {
+		node.connected <- client.ID()
+	})
+	handler, err := server.Handler()
+	s.Require().NoError(err)
+	mux := http.NewServeMux()
+	mux.Handle("/ws/{id}", handler)
+	node.httpServer = httptest.NewServer(mux)
+	node.url = "ws" + strings.TrimPrefix(node.httpServer.URL, "http") + "/ws"
+	return node
+}
+
+func (s *ClusterSuite) SetupTest() {
+	s.redis = miniredis.RunT(s.T())
+	s.nodeA = s.newNode("nodeA")
+	s.nodeB = s.newNode("nodeB")
+}
+
+func (s *ClusterSuite) TearDownTest() {
+	s.nodeA.server.Stop()
+	s.nodeB.server.Stop()
+	s.nodeA.httpServer.Close()
+	s.nodeB.httpServer.Close()
+	_ = s.nodeA.registry.Close()
+	_ = s.nodeB.registry.Close()
+}
+
+// connectClient connects a client to node B, which handles incoming requests with the given handler.
+func (s *ClusterSuite) connectClient(id string, handler func(client *ocppj.Client, request ocpp.Request, requestID string)) *ocppj.Client {
+	wsClient := ws.NewClient()
+	wsClient.SetRequestedSubProtocol(testSubProtocol)
+	client, err := ocppj.NewClient(id, wsClient, nil, nil, nil, testProfile)
+	s.Require().NoError(err)
+	client.SetRequestHandler(func(request ocpp.Request, requestID string, action string) {
+		handler(client, request, requestID)
+	})
+	s.Require().NoError(client.Start(s.nodeB.url))
+	s.Equal(id, <-s.nodeB.connected)
+	return client
+}
+
+func (s *ClusterSuite) TestForwardRequest() {
+	client := s.connectClient("cp1", func(client *ocppj.Client, request ocpp.Request, requestID string) {
+		_ = client.SendResponse(requestID, &testResponse{Value: request.(*testRequest).Value + "-response"})
+	})
+	defer client.Stop()
+	type result struct {
+		clientID  string
+		response  ocpp.Response
+		requestID string
+	}
+	resultC := make(chan result, 1)
+	s.nodeA.server.SetResponseHandler(func(client ws.Channel, response ocpp.Response, requestID string) {
+		resultC <- result{client.ID(), response, requestID}
+	})
+	s.nodeB.server.SetResponseHandler(func(client ws.Channel, response ocpp.Response, requestID string) {
+		s.Fail("unexpected response on node B")
+	})
+
+	requestID, err := s.nodeA.server.SendRequest("cp1", &testRequest{Value: "hello"})
+	s.Require().NoError(err)
+	s.NotEmpty(requestID)
+	r := <-resultC
+	s.Equal("cp1", r.clientID)
+	s.Equal(requestID, r.requestID)
+	s.Equal(&testResponse{Value: "hello-response"}, r.response)
+}
+
+func (s *ClusterSuite) TestForwardError() {
+	client := s.connectClient("cp1", func(client *ocppj.Client, request ocpp.Request, requestID string) {
+		_ = client.SendError(requestID, ocppj.GenericError, "failed", map[string]interface{}{"reason": "test"})
+	})
+	defer client.Stop()
+	errC := make(chan *ocpp.Error, 1)
+	detailsC := make(chan interface{}, 1)
+	s.nodeA.server.SetErrorHandler(func(client ws.Channel, err *ocpp.Error, details interface{}) {
+		errC <- err
+		detailsC <- details
+	})
+
+	requestID, err := s.nodeA.server.SendRequest("cp1", &testRequest{Value: "hello"})
+	s.Require().NoError(err)
+	ocppErr := <-errC
+	s.Equal(ocppj.GenericError, ocppErr.Code)
+	s.Equal("failed", ocppErr.Description)
+	s.Equal(requestID, ocppErr.MessageId)
+	s.Equal(map[string]interface{}{"reason": "test"}, <-detailsC)
+}
+
+func (s *ClusterSuite) TestForwardToUnknownClient() {
+	_, err := s.nodeA.server.SendRequest("cp1", &testRequest{Value: "hello"})
+	s.ErrorContains(err, "client cp1 is not connected to any node")
+}
+
+func (s *ClusterSuite) TestClientDisconnected() {
+	receivedC := make(chan struct{}, 1)
+	client := s.connectClient("cp1", func(client *ocppj.Client, request ocpp.Request, requestID string) {
+		receivedC <- struct{}{}
+	})
+	canceledC := make(chan *ocpp.Error, 1)
+	s.nodeA.server.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		s.Equal("cp1", clientID)
+		canceledC <- err
+	})
+
+	_, err := s.nodeA.server.SendRequest("cp1", &testRequest{Value: "hello"})
+	s.Require().NoError(err)
+	<-receivedC
+	client.Stop()
+	select {
+	case ocppErr := <-canceledC:
+		s.Equal(ocppj.GenericError, ocppErr.Code)
+	case <-time.After(3 * time.Second):
+		s.Fail("request wasn't canceled")
+	}
+	s.Eventually(func() bool {
+		_, found, _ := s.nodeA.registry.Lookup(context.Background(), "cp1")
+		return !found
+	}, time.Second, 50*time.Millisecond)
+}
+
+func (s *ClusterSuite) TestCancelForwardedRequest() {
+	receivedC := make(chan struct{}, 1)
+	client := s.connectClient("cp1", func(client *ocppj.Client, request ocpp.Request, requestID string) {
+		receivedC <- struct{}{}
+	})
+	defer client.Stop()
+	canceledC := make(chan string, 1)
+	s.nodeA.server.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		canceledC <- requestID
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := s.nodeA.server.SendRequestCtx(ctx, "cp1", &testRequest{Value: "hello"})
+	s.Require().NoError(err)
+	<-receivedC
+	cancel()
+	// The pending request on node B is canceled as well, so a new request can be sent to the client right away
+	_, err = s.nodeA.server.SendRequest("cp1", &testRequest{Value: "again"})
+	s.Require().NoError(err)
+	select {
+	case <-receivedC:
+	case <-time.After(3 * time.Second):
+		s.Fail("second request wasn't sent")
+	}
+	// No handler is invoked for requests canceled via context
+	s.Len(canceledC, 0)
+}
+
+func (s *ClusterSuite) TestForwardedRequestTimeout() {
+	client := s.connectClient("cp1", func(client *ocppj.Client, request ocpp.Request, requestID string) {})
+	defer client.Stop()
+	canceledC := make(chan *ocpp.Error, 1)
+	s.nodeA.server.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		canceledC <- err
+	})
+	// Shorter than the timeout of the dispatcher of node B
+	requestID, err := s.nodeA.server.SendRequest("cp1", &testRequest{Value: "hello"})
+	s.Require().NoError(err)
+	select {
+	case ocppErr := <-canceledC:
+		s.Equal(requestID, ocppErr.MessageId)
+	case <-time.After(5 * time.Second):
+		s.Fail("request didn't time out")
+	}
+}
+
+func TestCluster(t *testing.T) {
+	suite.Run(t, new(RedisRegistrySuite))
+	suite.Run(t, new(RedisTransportSuite))
+	suite.Run(t, new(ClusterSuite))
+}
@@ -0,0 +1,128 @@
+// Package cluster contains reference implementations of the ocppj.ConnectionRegistry and ocppj.ClusterTransport
+// interfaces, which allow running multiple OCPP servers as a cluster.
+//
+// The implementations only require a Redis-compatible server (e.g. Redis, Valkey or KeyDB),
+// which is accessed via the go-redis client.
+package cluster
+
+import (
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultKeyPrefix   = "ocpp"
+	defaultDialTimeout = 5 * time.Second
+)
+
+// RedisOption configures the connection to a Redis-compatible server.
+type RedisOption func(*redisOptions)
+
+type redisOptions struct {
+	username        string
+	password        string
+	db              int
+	tlsConfig       *tls.Config
+	dialTimeout     time.Duration
+	keyPrefix       string
+	registrationTTL time.Duration
+}
+
+func newRedisOptions(opts []RedisOption) redisOptions {
+	options := redisOptions{
+		dialTimeout: defaultDialTimeout,
+		keyPrefix:   defaultKeyPrefix,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithRedisAuth sets the credentials for authenticating with the server.
+// The username may be empty, if the server doesn't use ACLs.
+func WithRedisAuth(username string, password string) RedisOption {
+	return func(o *redisOptions) {
+		o.username = username
+		o.password = password
+	}
+}
+
+// WithRedisDB selects the database to use. Defaults to 0.
+func WithRedisDB(db int) RedisOption {
+	return func(o *redisOptions) {
+		o.db = db
+	}
+}
+
+// WithRedisTLS enables TLS for the connection to the server.
+func WithRedisTLS(config *tls.Config) RedisOption {
+	return func(o *redisOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithRedisDialTimeout sets the timeout for connecting to the server. Defaults to 5 seconds.
+func WithRedisDialTimeout(timeout time.Duration) RedisOption {
+	return func(o *redisOptions) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithKeyPrefix sets the prefix of all keys and channels used on the server. Defaults to "ocpp".
+//
+// Multiple clusters may share the same server, as long as they use different prefixes.
+func WithKeyPrefix(prefix string) RedisOption {
+	return func(o *redisOptions) {
+		o.keyPrefix = prefix
+	}
+}
+
+// WithRegistrationTTL sets the time-to-live of the records of a RedisRegistry.
+// Records of connected clients are refreshed periodically, so records of crashed nodes expire after the given time.
+// By default, records never expire.
+func WithRegistrationTTL(ttl time.Duration) RedisOption {
+	return func(o *redisOptions) {
+		o.registrationTTL = ttl
+	}
+}
+
+// redisClient creates the client for the server lazily, so that it can be created again after it was closed.
+// The go-redis client maintains a pool of connections, which are re-established after errors.
+type redisClient struct {
+	addr    string
+	options redisOptions
+	mutex   sync.Mutex
+	client  *redis.Client
+}
+
+// get returns the client, creating it if needed.
+func (c *redisClient) get() *redis.Client {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client == nil {
+		c.client = redis.NewClient(&redis.Options{
+			Addr:        c.addr,
+			Username:    c.options.username,
+			Password:    c.options.password,
+			DB:          c.options.db,
+			TLSConfig:   c.options.tlsConfig,
+			DialTimeout: c.options.dialTimeout,
+		})
+	}
+	return c.client
+}
+
+func (c *redisClient) close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Close()
+	c.client = nil
+	return err
+}
@@ -0,0 +1,170 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/xBlaz3kx/ocpp-go/ocppj"
+)
+
+// RedisRegistry is an ocppj.ConnectionRegistry, which stores the node of every client in a Redis-compatible server.
+//
+// Each client is stored as a separate key, containing the ID of the node.
+// If a registration TTL is set, the keys of clients registered by this registry are refreshed periodically,
+// until the clients are unregistered or the registry is closed.
+type RedisRegistry struct {
+	client     *redisClient
+	mutex      sync.Mutex
+	registered map[string]string // client ID -> node ID, only tracked if a TTL is set
+	stopC      chan struct{}
+}
+
+// NewRedisRegistry creates a registry, using the Redis-compatible server at the given address (host:port).
+// The connection is established lazily.
+func NewRedisRegistry(addr string, opts ...RedisOption) *RedisRegistry {
+	return &RedisRegistry{
+		client:     &redisClient{addr: addr, options: newRedisOptions(opts)},
+		registered: map[string]string{},
+	}
+}
+
+var _ ocppj.ConnectionRegistry = (*RedisRegistry)(nil)
+
+func (r *RedisRegistry) key(clientID string) string {
+	return r.client.options.keyPrefix + ":client:" + clientID
+}
+
+func (r *RedisRegistry) Register(ctx context.Context, clientID string, nodeID string) error {
+	// A zero TTL keeps the record forever
+	if err := r.client.get().Set(ctx, r.key(clientID), nodeID, r.client.options.registrationTTL).Err(); err != nil {
+		return err
+	}
+	if r.client.options.registrationTTL > 0 {
+		r.mutex.Lock()
+		r.registered[clientID] = nodeID
+		if r.stopC == nil {
+			r.stopC = make(chan struct{})
+			go r.refresh(r.stopC)
+		}
+		r.mutex.Unlock()
+	}
+	return nil
+}
+
+func (r *RedisRegistry) Unregister(ctx context.Context, clientID string, nodeID string) error {
+	r.mutex.Lock()
+	if r.registered[clientID] == nodeID {
+		delete(r.registered, clientID)
+	}
+	r.mutex.Unlock()
+	key := r.key(clientID)
+	_, err := r.compareAndDo(ctx, clientID, nodeID, func(pipe redis.Pipeliner) {
+		pipe.Del(ctx, key)
+	})
+	return err
+}
+
+func (r *RedisRegistry) Lookup(ctx context.Context, clientID string) (string, bool, error) {
+	nodeID, err := r.client.get().Get(ctx, r.key(clientID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return nodeID, true, nil
+}
+
+// compareAndDo queues commands in a transaction, which is only executed if the client is registered to the given node.
+// Returns the node, to which the client is registered, or an empty string if it isn't registered.
+//
+// The transaction is discarded by the client on errors, so the connection is always returned in a clean state.
+func (r *RedisRegistry) compareAndDo(ctx context.Context, clientID string, nodeID string, queue func(pipe redis.Pipeliner)) (string, error) {
+	key := r.key(clientID)
+	var current string
+	err := r.client.get().Watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		current, err = tx.Get(ctx, key).Result()
+		if errors.Is(err, redis.Nil) {
+			current = ""
+		} else if err != nil {
+			return err
+		}
+		if current != nodeID {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			queue(pipe)
+			return nil
+		})
+		return err
+	}, key)
+	if errors.Is(err, redis.TxFailedErr) {
+		// The key was modified concurrently, so the commands weren't run
+		err = nil
+	}
+	return current, err
+}
+
+// refresh periodically extends the TTL of all clients registered by this registry.
+func (r *RedisRegistry) refresh(stopC chan struct{}) {
+	ttl := r.client.options.registrationTTL
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopC:
+			return
+		case <-ticker.C:
+		}
+		r.mutex.Lock()
+		registered := make(map[string]string, len(r.registered))
+		for clientID, nodeID := range r.registered {
+			registered[clientID] = nodeID
+		}
+		r.mutex.Unlock()
+		for clientID, nodeID := range registered {
+			r.refreshClient(clientID, nodeID, ttl)
+		}
+	}
+}
+
+func (r *RedisRegistry) refreshClient(clientID string, nodeID string, ttl time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), ttl/3)
+	defer cancel()
+	key := r.key(clientID)
+	current, err := r.compareAndDo(ctx, clientID, nodeID, func(pipe redis.Pipeliner) {
+		pipe.PExpire(ctx, key, ttl)
+	})
+	switch {
+	case err != nil:
+		// Retried on the next tick
+	case current == "":
+		// The record expired in the meantime, e.g. due to a network partition
+		_ = r.client.get().SetNX(ctx, key, nodeID, ttl).Err()
+	case current != nodeID:
+		// The client connected to another node in the meantime
+		r.mutex.Lock()
+		if r.registered[clientID] == nodeID {
+			delete(r.registered, clientID)
+		}
+		r.mutex.Unlock()
+	}
+}
+
+// Close stops refreshing the registered clients and closes the connection to the server.
+// Records of clients registered with a TTL expire eventually.
+func (r *RedisRegistry) Close() error {
+	r.mutex.Lock()
+	if r.stopC != nil {
+		close(r.stopC)
+		r.stopC = nil
+	}
+	r.registered = map[string]string{}
+	r.mutex.Unlock()
+	return r.client.close()
+}
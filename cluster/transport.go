@@ -0,0 +1,86 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/xBlaz3kx/ocpp-go/ocppj"
+)
+
+// RedisTransport is an ocppj.ClusterTransport, which delivers messages between nodes via Redis Pub/Sub.
+//
+// Every node subscribes to its own channel. Messages sent to a node without subscribers fail right away,
+// e.g. if the node crashed. Messages published while a node is reconnecting to the server are lost;
+// the sending node then eventually times out the affected requests.
+type RedisTransport struct {
+	client *redisClient
+	mutex  sync.Mutex
+	pubSub *redis.PubSub
+	doneC  chan struct{}
+}
+
+// NewRedisTransport creates a transport, using the Redis-compatible server at the given address (host:port).
+func NewRedisTransport(addr string, opts ...RedisOption) *RedisTransport {
+	return &RedisTransport{client: &redisClient{addr: addr, options: newRedisOptions(opts)}}
+}
+
+var _ ocppj.ClusterTransport = (*RedisTransport)(nil)
+
+func (t *RedisTransport) channel(nodeID string) string {
+	return t.client.options.keyPrefix + ":node:" + nodeID
+}
+
+func (t *RedisTransport) Start(nodeID string, handler func(data []byte)) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.pubSub != nil {
+		return fmt.Errorf("transport already started")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.client.options.dialTimeout)
+	defer cancel()
+	// Messages are received on a dedicated connection, which is re-established and re-subscribed by the client
+	pubSub := t.client.get().Subscribe(ctx, t.channel(nodeID))
+	if _, err := pubSub.Receive(ctx); err != nil {
+		_ = pubSub.Close()
+		return err
+	}
+	t.pubSub = pubSub
+	t.doneC = make(chan struct{})
+	go t.receive(pubSub.Channel(), handler, t.doneC)
+	return nil
+}
+
+func (t *RedisTransport) receive(messageC <-chan *redis.Message, handler func(data []byte), doneC chan struct{}) {
+	defer close(doneC)
+	// The channel is closed, once the subscription is closed
+	for message := range messageC {
+		handler([]byte(message.Payload))
+	}
+}
+
+func (t *RedisTransport) Send(ctx context.Context, nodeID string, data []byte) error {
+	receivers, err := t.client.get().Publish(ctx, t.channel(nodeID), data).Result()
+	if err != nil {
+		return err
+	}
+	if receivers == 0 {
+		return fmt.Errorf("node %s is not reachable", nodeID)
+	}
+	return nil
+}
+
+func (t *RedisTransport) Stop() error {
+	t.mutex.Lock()
+	pubSub, doneC := t.pubSub, t.doneC
+	t.pubSub, t.doneC = nil, nil
+	t.mutex.Unlock()
+	if pubSub == nil {
+		return nil
+	}
+	_ = pubSub.Close()
+	<-doneC
+	return t.client.close()
+}
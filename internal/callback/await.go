@@ -0,0 +1,54 @@
+package callback
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+)
+
+// SendFunc sends a request bound to ctx, and invokes callback once a response or error is available.
+// The callback must not be invoked, if an error is returned.
+type SendFunc func(ctx context.Context, callback func(confirmation ocpp.Response, err error)) error
+
+// Await sends a request via send and blocks until its callback was invoked, or ctx is done.
+// Senders should be built on Registry.RegisterCallbackCtx, so that requests are canceled together with ctx.
+//
+// The response is returned as *Resp. If the response has a different type, an error is returned.
+func Await[Resp any](ctx context.Context, send SendFunc) (*Resp, error) {
+	type result struct {
+		confirmation ocpp.Response
+		err          error
+	}
+	// Buffered, so the callback never blocks after Await returned early
+	resultC := make(chan result, 1)
+	err := send(ctx, func(confirmation ocpp.Response, err error) {
+		resultC <- result{confirmation, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	var r result
+	select {
+	case r = <-resultC:
+	case <-ctx.Done():
+		// The callback may have been invoked concurrently, in which case its result wins
+		select {
+		case r = <-resultC:
+		default:
+			return nil, ctx.Err()
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if r.confirmation == nil {
+		return nil, nil
+	}
+	typed, ok := any(r.confirmation).(*Resp)
+	if !ok {
+		var expected *Resp
+		return nil, fmt.Errorf("unexpected response type %T, expected %T", r.confirmation, expected)
+	}
+	return typed, nil
+}
@@ -1,6 +1,7 @@
 package callback
 
 import (
+	"context"
 	"sync"
 
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
@@ -17,6 +18,13 @@ type RequestID string
 type Registry struct {
 	mutex     sync.RWMutex
 	callbacks map[ClientID]map[RequestID]func(confirmation ocpp.Response, err error)
+	// registered mirrors the keys of callbacks, so that IsRegistered doesn't need to acquire mutex
+	registered sync.Map
+}
+
+type registryKey struct {
+	clientID  ClientID
+	requestID RequestID
 }
 
 // New creates a new CallbackRegistry instance.
@@ -49,10 +57,69 @@ func (cr *Registry) RegisterCallback(clientID string, try func() (string, error)
 
 	// Register the callback
 	cr.callbacks[ClientID(clientID)][RequestID(requestId)] = callback
+	cr.registered.Store(registryKey{ClientID(clientID), RequestID(requestId)}, struct{}{})
 
 	return nil
 }
 
+// RegisterCallbackCtx registers a callback like RegisterCallback, but additionally binds it to ctx.
+// If ctx is already done, ctx.Err() is returned and try is never invoked.
+//
+// If ctx is done before the callback was retrieved, the callback is removed from the registry,
+// onCancel is invoked with the request ID (so the request can be canceled as well),
+// and finally the callback is invoked with ctx.Err().
+func (cr *Registry) RegisterCallbackCtx(ctx context.Context, clientID string, try func() (string, error), callback func(confirmation ocpp.Response, err error), onCancel func(requestID string)) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Contexts that can never be done don't need to be watched
+	if ctx.Done() == nil {
+		return cr.RegisterCallback(clientID, try, callback)
+	}
+
+	var (
+		mutex     sync.Mutex
+		requestID string
+		completed bool
+		stop      func() bool
+	)
+	wrapped := func(confirmation ocpp.Response, err error) {
+		mutex.Lock()
+		completed = true
+		stopWatching := stop
+		mutex.Unlock()
+		if stopWatching != nil {
+			stopWatching()
+		}
+		callback(confirmation, err)
+	}
+	trackedTry := func() (string, error) {
+		id, err := try()
+		requestID = id
+		return id, err
+	}
+	if err := cr.RegisterCallback(clientID, trackedTry, wrapped); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if completed {
+		return nil
+	}
+	stop = context.AfterFunc(ctx, func() {
+		if !cr.RemoveCallback(clientID, requestID) {
+			// Callback was already retrieved and is being invoked
+			return
+		}
+		if onCancel != nil {
+			onCancel(requestID)
+		}
+		callback(nil, ctx.Err())
+	})
+	return nil
+}
+
 // GetCallback retrieves and removes the callback for a specific client ID and request ID.
 // Returns the callback and true if found, nil and false otherwise.
 func (cr *Registry) GetCallback(clientID string, requestID string) (func(confirmation ocpp.Response, err error), bool) {
@@ -71,6 +138,7 @@ func (cr *Registry) GetCallback(clientID string, requestID string) (func(confirm
 
 	// Remove the callback after retrieving it
 	delete(clientCallbacks, RequestID(requestID))
+	cr.registered.Delete(registryKey{ClientID(clientID), RequestID(requestID)})
 	// Clean up empty client maps
 	if len(clientCallbacks) == 0 {
 		delete(cr.callbacks, ClientID(clientID))
@@ -96,6 +164,7 @@ func (cr *Registry) RemoveCallback(clientID string, requestID string) bool {
 	}
 
 	delete(clientCallbacks, RequestID(requestID))
+	cr.registered.Delete(registryKey{ClientID(clientID), RequestID(requestID)})
 	// Clean up empty client maps
 	if len(clientCallbacks) == 0 {
 		delete(cr.callbacks, ClientID(clientID))
@@ -121,6 +190,7 @@ func (cr *Registry) GetAllCallbacks(clientID string) (map[RequestID]func(confirm
 	result := make(map[RequestID]func(confirmation ocpp.Response, err error), len(clientCallbacks))
 	for requestID, callback := range clientCallbacks {
 		result[requestID] = callback
+		cr.registered.Delete(registryKey{clientId, requestID})
 	}
 
 	// Remove all callbacks for this client
@@ -140,6 +210,18 @@ func (cr *Registry) ClearCallbacks(clientID string) int {
 	}
 
 	count := len(clientCallbacks)
+	for requestID := range clientCallbacks {
+		cr.registered.Delete(registryKey{ClientID(clientID), requestID})
+	}
 	delete(cr.callbacks, ClientID(clientID))
 	return count
 }
+
+// IsRegistered returns true if a callback for a specific client ID and request ID is registered.
+//
+// Unlike the other methods, it may be invoked from within the try function passed to RegisterCallback,
+// e.g. to check whether a newly generated request ID collides with a registered one.
+func (cr *Registry) IsRegistered(clientID string, requestID string) bool {
+	_, ok := cr.registered.Load(registryKey{ClientID(clientID), RequestID(requestID)})
+	return ok
+}
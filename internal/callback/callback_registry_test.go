@@ -1,11 +1,13 @@
 package callback
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/suite"
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
@@ -246,6 +248,31 @@ func (suite *CallbackRegistryTestSuite) TestGetCallbackRemovesFromRegistry() {
 	suite.Assert().Equal(1, int(callbackCalled.Load()), "Callback should only be called once")
 }
 
+// TestIsRegistered verifies that IsRegistered tracks registered callbacks, and may be invoked from within try()
+func (suite *CallbackRegistryTestSuite) TestIsRegistered() {
+	clientID := "client-1"
+	callback := func(confirmation ocpp.Response, err error) {}
+	err := suite.registry.RegisterCallback(clientID, func() (string, error) {
+		return "req-1", nil
+	}, callback)
+	suite.Require().NoError(err)
+	suite.Assert().True(suite.registry.IsRegistered(clientID, "req-1"))
+	suite.Assert().False(suite.registry.IsRegistered("client-2", "req-1"))
+
+	// Invoked from within try, e.g. to skip colliding request IDs
+	err = suite.registry.RegisterCallback(clientID, func() (string, error) {
+		suite.Assert().True(suite.registry.IsRegistered(clientID, "req-1"))
+		return "req-2", nil
+	}, callback)
+	suite.Require().NoError(err)
+
+	_, ok := suite.registry.GetCallback(clientID, "req-1")
+	suite.Require().True(ok)
+	suite.Assert().False(suite.registry.IsRegistered(clientID, "req-1"))
+	suite.Assert().True(suite.registry.RemoveCallback(clientID, "req-2"))
+	suite.Assert().False(suite.registry.IsRegistered(clientID, "req-2"))
+}
+
 // TestRegisterCallbackFailureDoesNotAffectOthers verifies that failure doesn't affect other callbacks
 func (suite *CallbackRegistryTestSuite) TestRegisterCallbackFailureDoesNotAffectOthers() {
 	clientID := "client-1"
@@ -736,6 +763,164 @@ func (suite *CallbackRegistryTestSuite) TestRegisterCallbackEmptyIDAfterFailure(
 	suite.Assert().False(ok)
 }
 
+// TestRegisterCallbackCtxCanceled verifies that a canceled context removes the callback and invokes it with the context error
+func (suite *CallbackRegistryTestSuite) TestRegisterCallbackCtxCanceled() {
+	clientID := "client-1"
+	requestID := "req-1"
+	errC := make(chan error, 1)
+	canceledC := make(chan string, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	try := func() (string, error) {
+		return requestID, nil
+	}
+	err := suite.registry.RegisterCallbackCtx(ctx, clientID, try, func(confirmation ocpp.Response, err error) {
+		suite.Assert().Nil(confirmation)
+		errC <- err
+	}, func(rID string) {
+		canceledC <- rID
+	})
+	suite.Require().NoError(err)
+
+	cancel()
+	select {
+	case rID := <-canceledC:
+		suite.Assert().Equal(requestID, rID)
+	case <-time.After(time.Second):
+		suite.Fail("onCancel was not invoked")
+	}
+	select {
+	case err = <-errC:
+		suite.Assert().ErrorIs(err, context.Canceled)
+	case <-time.After(time.Second):
+		suite.Fail("callback was not invoked")
+	}
+	// Callback must be gone
+	_, ok := suite.registry.GetCallback(clientID, requestID)
+	suite.Assert().False(ok)
+}
+
+// TestRegisterCallbackCtxCompleted verifies that a callback retrieved before the context is done isn't canceled
+func (suite *CallbackRegistryTestSuite) TestRegisterCallbackCtxCompleted() {
+	clientID := "client-1"
+	requestID := "req-1"
+	callbackCount := atomic.Int32{}
+	canceled := atomic.Bool{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	try := func() (string, error) {
+		return requestID, nil
+	}
+	err := suite.registry.RegisterCallbackCtx(ctx, clientID, try, func(confirmation ocpp.Response, err error) {
+		suite.Assert().NoError(err)
+		callbackCount.Add(1)
+	}, func(rID string) {
+		canceled.Store(true)
+	})
+	suite.Require().NoError(err)
+
+	cb, ok := suite.registry.GetCallback(clientID, requestID)
+	suite.Require().True(ok)
+	cb(&MockResponse{Value: "test"}, nil)
+	cancel()
+
+	time.Sleep(50 * time.Millisecond)
+	suite.Assert().EqualValues(1, callbackCount.Load())
+	suite.Assert().False(canceled.Load())
+}
+
+// TestRegisterCallbackCtxAlreadyDone verifies that nothing is attempted if the context is already done
+func (suite *CallbackRegistryTestSuite) TestRegisterCallbackCtxAlreadyDone() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tryCalled := atomic.Bool{}
+	err := suite.registry.RegisterCallbackCtx(ctx, "client-1", func() (string, error) {
+		tryCalled.Store(true)
+		return "req-1", nil
+	}, func(confirmation ocpp.Response, err error) {}, nil)
+	suite.Assert().ErrorIs(err, context.Canceled)
+	suite.Assert().False(tryCalled.Load())
+}
+
+// awaitSender returns a SendFunc registering the callback in the registry, as done by the central system and CSMS
+func (suite *CallbackRegistryTestSuite) awaitSender(clientID string, requestID string, canceledC chan string) SendFunc {
+	return func(ctx context.Context, callback func(confirmation ocpp.Response, err error)) error {
+		return suite.registry.RegisterCallbackCtx(ctx, clientID, func() (string, error) {
+			return requestID, nil
+		}, callback, func(rID string) {
+			canceledC <- rID
+		})
+	}
+}
+
+// TestAwait verifies that Await blocks until the callback is invoked and returns the typed response
+func (suite *CallbackRegistryTestSuite) TestAwait() {
+	clientID := "client-1"
+	requestID := "req-1"
+	go func() {
+		for {
+			if cb, ok := suite.registry.GetCallback(clientID, requestID); ok {
+				cb(&MockResponse{Value: "test"}, nil)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	response, err := Await[MockResponse](context.Background(), suite.awaitSender(clientID, requestID, nil))
+	suite.Require().NoError(err)
+	suite.Require().NotNil(response)
+	suite.Assert().Equal("test", response.Value)
+}
+
+// TestAwaitError verifies that errors returned by the sender or passed to the callback are returned by Await
+func (suite *CallbackRegistryTestSuite) TestAwaitError() {
+	sendErr := errors.New("send failed")
+	response, err := Await[MockResponse](context.Background(), func(ctx context.Context, callback func(confirmation ocpp.Response, err error)) error {
+		return sendErr
+	})
+	suite.Assert().Nil(response)
+	suite.Assert().ErrorIs(err, sendErr)
+
+	protoErr := ocpp.NewError("GenericError", "failure", "req-1")
+	response, err = Await[MockResponse](context.Background(), func(ctx context.Context, callback func(confirmation ocpp.Response, err error)) error {
+		go callback(nil, protoErr)
+		return nil
+	})
+	suite.Assert().Nil(response)
+	suite.Assert().Equal(protoErr, err)
+}
+
+// TestAwaitUnexpectedType verifies that a response of the wrong type is reported as an error
+func (suite *CallbackRegistryTestSuite) TestAwaitUnexpectedType() {
+	type otherResponse struct{}
+	response, err := Await[otherResponse](context.Background(), func(ctx context.Context, callback func(confirmation ocpp.Response, err error)) error {
+		callback(&MockResponse{Value: "test"}, nil)
+		return nil
+	})
+	suite.Assert().Nil(response)
+	suite.Assert().ErrorContains(err, "unexpected response type *callback.MockResponse")
+}
+
+// TestAwaitCanceled verifies that Await returns once the context is done, canceling the request
+func (suite *CallbackRegistryTestSuite) TestAwaitCanceled() {
+	clientID := "client-1"
+	requestID := "req-1"
+	canceledC := make(chan string, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	response, err := Await[MockResponse](ctx, suite.awaitSender(clientID, requestID, canceledC))
+	suite.Assert().Nil(response)
+	suite.Assert().ErrorIs(err, context.DeadlineExceeded)
+	select {
+	case rID := <-canceledC:
+		suite.Assert().Equal(requestID, rID)
+	case <-time.After(time.Second):
+		suite.Fail("onCancel was not invoked")
+	}
+	_, ok := suite.registry.GetCallback(clientID, requestID)
+	suite.Assert().False(ok)
+}
+
 func TestCallbackRegistry(t *testing.T) {
 	suite.Run(t, new(CallbackRegistryTestSuite))
 }
@@ -1,10 +1,14 @@
 package ocpp16
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"reflect"
 
+	"github.com/xBlaz3kx/ocpp-go/bulk"
 	"github.com/xBlaz3kx/ocpp-go/internal/callback"
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/certificates"
@@ -44,9 +48,12 @@ func newCentralSystem(server *ocppj.Server) (centralSystem, error) {
 	}
 
 	server.SetDialect(ocpp.V16)
+	registry := callback.New()
+	// Message IDs of requests awaiting a callback must not be reused
+	server.SetMessageIdInUseHandler(registry.IsRegistered)
 	return centralSystem{
 		server:           server,
-		callbackRegistry: callback.New(),
+		callbackRegistry: registry,
 	}, nil
 }
 
@@ -516,6 +523,10 @@ func (cs *centralSystem) SetChargePointDisconnectedHandler(handler ChargePointCo
 }
 
 func (cs *centralSystem) SendRequestAsync(clientId string, request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
+	return cs.SendRequestAsyncCtx(context.Background(), clientId, request, callback)
+}
+
+func (cs *centralSystem) SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cs.server.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on central system (missing profile), cannot send request", featureName)
@@ -540,7 +551,14 @@ func (cs *centralSystem) SendRequestAsync(clientId string, request ocpp.Request,
 	send := func() (string, error) {
 		return cs.server.SendRequest(clientId, request)
 	}
-	return cs.callbackRegistry.RegisterCallback(clientId, send, callback)
+	cancel := func(requestID string) {
+		cs.server.CancelRequest(clientId, requestID)
+	}
+	return cs.callbackRegistry.RegisterCallbackCtx(ctx, clientId, send, callback, cancel)
+}
+
+func (cs *centralSystem) SendBulkRequest(ctx context.Context, targets bulk.Targets, factory bulk.RequestFactory, opts ...bulk.Option) bulk.Report {
+	return bulk.Send(ctx, cs, cs.server, targets, factory, opts...)
 }
 
 func (cs *centralSystem) Start(listenPort int, listenPath string) {
@@ -548,10 +566,22 @@ func (cs *centralSystem) Start(listenPort int, listenPath string) {
 	cs.server.Start(listenPort, listenPath)
 }
 
+func (cs *centralSystem) Serve(listener net.Listener, listenPath string) error {
+	return cs.server.Serve(listener, listenPath)
+}
+
+func (cs *centralSystem) Handler() (http.Handler, error) {
+	return cs.server.Handler()
+}
+
 func (cs *centralSystem) Stop() {
 	cs.server.Stop()
 }
 
+func (cs *centralSystem) Shutdown(ctx context.Context) (ocppj.ShutdownReport, error) {
+	return cs.server.Shutdown(ctx)
+}
+
 func (cs *centralSystem) sendResponse(chargePointId string, confirmation ocpp.Response, err error, requestId string) {
 	if err != nil {
 		// Send error response
@@ -1,6 +1,7 @@
 package ocpp16
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -72,11 +73,15 @@ func (cp *chargePoint) Errors() <-chan error {
 }
 
 func (cp *chargePoint) BootNotification(chargePointModel string, chargePointVendor string, props ...func(request *core.BootNotificationRequest)) (*core.BootNotificationConfirmation, error) {
+	return cp.BootNotificationCtx(context.Background(), chargePointModel, chargePointVendor, props...)
+}
+
+func (cp *chargePoint) BootNotificationCtx(ctx context.Context, chargePointModel string, chargePointVendor string, props ...func(request *core.BootNotificationRequest)) (*core.BootNotificationConfirmation, error) {
 	request := core.NewBootNotificationRequest(chargePointModel, chargePointVendor)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -85,11 +90,15 @@ func (cp *chargePoint) BootNotification(chargePointModel string, chargePointVend
 }
 
 func (cp *chargePoint) Authorize(idTag string, props ...func(request *core.AuthorizeRequest)) (*core.AuthorizeConfirmation, error) {
+	return cp.AuthorizeCtx(context.Background(), idTag, props...)
+}
+
+func (cp *chargePoint) AuthorizeCtx(ctx context.Context, idTag string, props ...func(request *core.AuthorizeRequest)) (*core.AuthorizeConfirmation, error) {
 	request := core.NewAuthorizationRequest(idTag)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -98,11 +107,15 @@ func (cp *chargePoint) Authorize(idTag string, props ...func(request *core.Autho
 }
 
 func (cp *chargePoint) DataTransfer(vendorId string, props ...func(request *core.DataTransferRequest)) (*core.DataTransferConfirmation, error) {
+	return cp.DataTransferCtx(context.Background(), vendorId, props...)
+}
+
+func (cp *chargePoint) DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *core.DataTransferRequest)) (*core.DataTransferConfirmation, error) {
 	request := core.NewDataTransferRequest(vendorId)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -111,11 +124,15 @@ func (cp *chargePoint) DataTransfer(vendorId string, props ...func(request *core
 }
 
 func (cp *chargePoint) Heartbeat(props ...func(request *core.HeartbeatRequest)) (*core.HeartbeatConfirmation, error) {
+	return cp.HeartbeatCtx(context.Background(), props...)
+}
+
+func (cp *chargePoint) HeartbeatCtx(ctx context.Context, props ...func(request *core.HeartbeatRequest)) (*core.HeartbeatConfirmation, error) {
 	request := core.NewHeartbeatRequest()
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -124,11 +141,15 @@ func (cp *chargePoint) Heartbeat(props ...func(request *core.HeartbeatRequest))
 }
 
 func (cp *chargePoint) MeterValues(connectorId int, meterValues []types.MeterValue, props ...func(request *core.MeterValuesRequest)) (*core.MeterValuesConfirmation, error) {
+	return cp.MeterValuesCtx(context.Background(), connectorId, meterValues, props...)
+}
+
+func (cp *chargePoint) MeterValuesCtx(ctx context.Context, connectorId int, meterValues []types.MeterValue, props ...func(request *core.MeterValuesRequest)) (*core.MeterValuesConfirmation, error) {
 	request := core.NewMeterValuesRequest(connectorId, meterValues)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -137,11 +158,15 @@ func (cp *chargePoint) MeterValues(connectorId int, meterValues []types.MeterVal
 }
 
 func (cp *chargePoint) StartTransaction(connectorId int, idTag string, meterStart int, timestamp *types.DateTime, props ...func(request *core.StartTransactionRequest)) (*core.StartTransactionConfirmation, error) {
+	return cp.StartTransactionCtx(context.Background(), connectorId, idTag, meterStart, timestamp, props...)
+}
+
+func (cp *chargePoint) StartTransactionCtx(ctx context.Context, connectorId int, idTag string, meterStart int, timestamp *types.DateTime, props ...func(request *core.StartTransactionRequest)) (*core.StartTransactionConfirmation, error) {
 	request := core.NewStartTransactionRequest(connectorId, idTag, meterStart, timestamp)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -150,11 +175,15 @@ func (cp *chargePoint) StartTransaction(connectorId int, idTag string, meterStar
 }
 
 func (cp *chargePoint) StopTransaction(meterStop int, timestamp *types.DateTime, transactionId int, props ...func(request *core.StopTransactionRequest)) (*core.StopTransactionConfirmation, error) {
+	return cp.StopTransactionCtx(context.Background(), meterStop, timestamp, transactionId, props...)
+}
+
+func (cp *chargePoint) StopTransactionCtx(ctx context.Context, meterStop int, timestamp *types.DateTime, transactionId int, props ...func(request *core.StopTransactionRequest)) (*core.StopTransactionConfirmation, error) {
 	request := core.NewStopTransactionRequest(meterStop, timestamp, transactionId)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -163,11 +192,15 @@ func (cp *chargePoint) StopTransaction(meterStop int, timestamp *types.DateTime,
 }
 
 func (cp *chargePoint) StatusNotification(connectorId int, errorCode core.ChargePointErrorCode, status core.ChargePointStatus, props ...func(request *core.StatusNotificationRequest)) (*core.StatusNotificationConfirmation, error) {
+	return cp.StatusNotificationCtx(context.Background(), connectorId, errorCode, status, props...)
+}
+
+func (cp *chargePoint) StatusNotificationCtx(ctx context.Context, connectorId int, errorCode core.ChargePointErrorCode, status core.ChargePointStatus, props ...func(request *core.StatusNotificationRequest)) (*core.StatusNotificationConfirmation, error) {
 	request := core.NewStatusNotificationRequest(connectorId, errorCode, status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -176,11 +209,15 @@ func (cp *chargePoint) StatusNotification(connectorId int, errorCode core.Charge
 }
 
 func (cp *chargePoint) DiagnosticsStatusNotification(status firmware.DiagnosticsStatus, props ...func(request *firmware.DiagnosticsStatusNotificationRequest)) (*firmware.DiagnosticsStatusNotificationConfirmation, error) {
+	return cp.DiagnosticsStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cp *chargePoint) DiagnosticsStatusNotificationCtx(ctx context.Context, status firmware.DiagnosticsStatus, props ...func(request *firmware.DiagnosticsStatusNotificationRequest)) (*firmware.DiagnosticsStatusNotificationConfirmation, error) {
 	request := firmware.NewDiagnosticsStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -189,11 +226,15 @@ func (cp *chargePoint) DiagnosticsStatusNotification(status firmware.Diagnostics
 }
 
 func (cp *chargePoint) FirmwareStatusNotification(status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationConfirmation, error) {
+	return cp.FirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cp *chargePoint) FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationConfirmation, error) {
 	request := firmware.NewFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	} else {
@@ -202,11 +243,15 @@ func (cp *chargePoint) FirmwareStatusNotification(status firmware.FirmwareStatus
 }
 
 func (cp *chargePoint) SecurityEventNotification(typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
+	return cp.SecurityEventNotificationCtx(context.Background(), typ, timestamp, props...)
+}
+
+func (cp *chargePoint) SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
 	request := security.NewSecurityEventNotificationRequest(typ, timestamp)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -214,11 +259,15 @@ func (cp *chargePoint) SecurityEventNotification(typ string, timestamp *types.Da
 }
 
 func (cp *chargePoint) SignCertificate(CSR string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
+	return cp.SignCertificateCtx(context.Background(), CSR, props...)
+}
+
+func (cp *chargePoint) SignCertificateCtx(ctx context.Context, CSR string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
 	request := security.NewSignCertificateRequest(CSR)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -226,11 +275,15 @@ func (cp *chargePoint) SignCertificate(CSR string, props ...func(request *securi
 }
 
 func (cp *chargePoint) SignedUpdateFirmwareStatusNotification(status securefirmware.FirmwareStatus, props ...func(request *securefirmware.SignedFirmwareStatusNotificationRequest)) (*securefirmware.SignedFirmwareStatusNotificationResponse, error) {
+	return cp.SignedUpdateFirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cp *chargePoint) SignedUpdateFirmwareStatusNotificationCtx(ctx context.Context, status securefirmware.FirmwareStatus, props ...func(request *securefirmware.SignedFirmwareStatusNotificationRequest)) (*securefirmware.SignedFirmwareStatusNotificationResponse, error) {
 	request := securefirmware.NewFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -238,11 +291,15 @@ func (cp *chargePoint) SignedUpdateFirmwareStatusNotification(status securefirmw
 }
 
 func (cp *chargePoint) LogStatusNotification(status logging.UploadLogStatus, requestId int, props ...func(request *logging.LogStatusNotificationRequest)) (*logging.LogStatusNotificationResponse, error) {
+	return cp.LogStatusNotificationCtx(context.Background(), status, requestId, props...)
+}
+
+func (cp *chargePoint) LogStatusNotificationCtx(ctx context.Context, status logging.UploadLogStatus, requestId int, props ...func(request *logging.LogStatusNotificationRequest)) (*logging.LogStatusNotificationResponse, error) {
 	request := logging.NewLogStatusNotificationRequest(status, requestId)
 	for _, fn := range props {
 		fn(request)
 	}
-	confirmation, err := cp.SendRequest(request)
+	confirmation, err := cp.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -294,6 +351,10 @@ func (cp *chargePoint) SetCertificateHandler(handler certificates.ChargePointHan
 }
 
 func (cp *chargePoint) SendRequest(request ocpp.Request) (ocpp.Response, error) {
+	return cp.SendRequestCtx(context.Background(), request)
+}
+
+func (cp *chargePoint) SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error) {
 	featureName := request.GetFeatureName()
 	if _, found := cp.client.GetProfileForFeature(featureName); !found {
 		return nil, fmt.Errorf("feature %v is unsupported on charge point (missing profile), cannot send request", featureName)
@@ -310,9 +371,9 @@ func (cp *chargePoint) SendRequest(request ocpp.Request) (ocpp.Response, error)
 	send := func() (string, error) {
 		return cp.client.SendRequest(request)
 	}
-	err := cp.callbacks.RegisterCallback(cp.client.Id, send, func(confirmation ocpp.Response, err error) {
+	err := cp.callbacks.RegisterCallbackCtx(ctx, cp.client.Id, send, func(confirmation ocpp.Response, err error) {
 		asyncResponseC <- asyncResponse{r: confirmation, e: err}
-	})
+	}, cp.cancelRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -330,6 +391,10 @@ func (cp *chargePoint) SendRequest(request ocpp.Request) (ocpp.Response, error)
 }
 
 func (cp *chargePoint) SendRequestAsync(request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
+	return cp.SendRequestAsyncCtx(context.Background(), request, callback)
+}
+
+func (cp *chargePoint) SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(confirmation ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cp.client.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on charge point (missing profile), cannot send request", featureName)
@@ -349,10 +414,15 @@ func (cp *chargePoint) SendRequestAsync(request ocpp.Request, callback func(conf
 	send := func() (string, error) {
 		return cp.client.SendRequest(request)
 	}
-	err := cp.callbacks.RegisterCallback(cp.client.Id, send, callback)
+	err := cp.callbacks.RegisterCallbackCtx(ctx, cp.client.Id, send, callback, cp.cancelRequest)
 	return err
 }
 
+// cancelRequest drops a request from the outgoing queue, after its context is done.
+func (cp *chargePoint) cancelRequest(requestID string) {
+	cp.client.CancelRequest(requestID)
+}
+
 func (cp *chargePoint) asyncCallbackHandler() {
 	for {
 		select {
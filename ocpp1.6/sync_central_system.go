@@ -0,0 +1,282 @@
+package ocpp16
+
+import (
+	"context"
+
+	"github.com/xBlaz3kx/ocpp-go/internal/callback"
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/certificates"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/core"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/extendedtriggermessage"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/firmware"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/localauth"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/logging"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/remotetrigger"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/reservation"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/securefirmware"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/security"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/smartcharging"
+	"github.com/xBlaz3kx/ocpp-go/ocpp1.6/types"
+)
+
+// Call sends a request to a charge point and blocks until the response was received, or ctx is done.
+// It is the blocking counterpart of CentralSystem.SendRequestAsyncCtx: if ctx is done before a response was received,
+// the request is canceled and ctx.Err() is returned.
+//
+// Resp is the response type matching the request, e.g. for a *core.ChangeAvailabilityRequest request:
+//
+//	response, err := ocpp16.Call[*core.ChangeAvailabilityRequest, core.ChangeAvailabilityConfirmation](ctx, cs, clientId, request)
+func Call[Req ocpp.Request, Resp any](ctx context.Context, cs CentralSystem, clientId string, request Req) (*Resp, error) {
+	return callback.Await[Resp](ctx, func(ctx context.Context, cb func(ocpp.Response, error)) error {
+		return cs.SendRequestAsyncCtx(ctx, clientId, request, cb)
+	})
+}
+
+// SyncCentralSystem offers blocking variants of all requests, which a central system may send to a charge point.
+// Every request is bound to a context, and returns the typed response of the charge point directly, instead of invoking a callback.
+//
+// Use NewSyncCentralSystem to create an instance.
+type SyncCentralSystem struct {
+	cs CentralSystem
+}
+
+// NewSyncCentralSystem wraps cs, to send requests to charge points in a blocking fashion.
+func NewSyncCentralSystem(cs CentralSystem) *SyncCentralSystem {
+	return &SyncCentralSystem{cs: cs}
+}
+
+// Instructs a charge point to change its availability. The target availability can be set for a single connector of for the whole charge point.
+func (s *SyncCentralSystem) ChangeAvailability(ctx context.Context, clientId string, connectorId int, availabilityType core.AvailabilityType, props ...func(request *core.ChangeAvailabilityRequest)) (*core.ChangeAvailabilityConfirmation, error) {
+	request := core.NewChangeAvailabilityRequest(connectorId, availabilityType)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.ChangeAvailabilityRequest, core.ChangeAvailabilityConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Changes the configuration of a charge point, by setting a specific key-value pair.
+// The configuration key must be supported by the target charge point, in order for the configuration to be accepted.
+func (s *SyncCentralSystem) ChangeConfiguration(ctx context.Context, clientId string, key string, value string, props ...func(request *core.ChangeConfigurationRequest)) (*core.ChangeConfigurationConfirmation, error) {
+	request := core.NewChangeConfigurationRequest(key, value)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.ChangeConfigurationRequest, core.ChangeConfigurationConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Instructs the charge point to clear its current authorization cache. All authorization saved locally will be invalidated.
+func (s *SyncCentralSystem) ClearCache(ctx context.Context, clientId string, props ...func(request *core.ClearCacheRequest)) (*core.ClearCacheConfirmation, error) {
+	request := core.NewClearCacheRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.ClearCacheRequest, core.ClearCacheConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Starts a custom data transfer request. Every vendor may implement their own proprietary logic for this message.
+func (s *SyncCentralSystem) DataTransfer(ctx context.Context, clientId string, vendorId string, props ...func(request *core.DataTransferRequest)) (*core.DataTransferConfirmation, error) {
+	request := core.NewDataTransferRequest(vendorId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.DataTransferRequest, core.DataTransferConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Retrieves the configuration values for the provided configuration keys.
+func (s *SyncCentralSystem) GetConfiguration(ctx context.Context, clientId string, keys []string, props ...func(request *core.GetConfigurationRequest)) (*core.GetConfigurationConfirmation, error) {
+	request := core.NewGetConfigurationRequest(keys)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.GetConfigurationRequest, core.GetConfigurationConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charge point to start a transaction for a specified client on a provided connector.
+// Depending on the configuration, an explicit authorization message may still be required, before the transaction can start.
+func (s *SyncCentralSystem) RemoteStartTransaction(ctx context.Context, clientId string, idTag string, props ...func(request *core.RemoteStartTransactionRequest)) (*core.RemoteStartTransactionConfirmation, error) {
+	request := core.NewRemoteStartTransactionRequest(idTag)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.RemoteStartTransactionRequest, core.RemoteStartTransactionConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charge point to stop an ongoing transaction, given the transaction's ID.
+func (s *SyncCentralSystem) RemoteStopTransaction(ctx context.Context, clientId string, transactionId int, props ...func(request *core.RemoteStopTransactionRequest)) (*core.RemoteStopTransactionConfirmation, error) {
+	request := core.NewRemoteStopTransactionRequest(transactionId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.RemoteStopTransactionRequest, core.RemoteStopTransactionConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Forces a charge point to perform an internal hard or soft reset. In both cases, all ongoing transactions are stopped.
+func (s *SyncCentralSystem) Reset(ctx context.Context, clientId string, resetType core.ResetType, props ...func(request *core.ResetRequest)) (*core.ResetConfirmation, error) {
+	request := core.NewResetRequest(resetType)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.ResetRequest, core.ResetConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Attempts to unlock a specific connector on a charge point. Used for remote support purposes.
+func (s *SyncCentralSystem) UnlockConnector(ctx context.Context, clientId string, connectorId int, props ...func(request *core.UnlockConnectorRequest)) (*core.UnlockConnectorConfirmation, error) {
+	request := core.NewUnlockConnectorRequest(connectorId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*core.UnlockConnectorRequest, core.UnlockConnectorConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Queries the current version of the local authorization list from a charge point.
+func (s *SyncCentralSystem) GetLocalListVersion(ctx context.Context, clientId string, props ...func(request *localauth.GetLocalListVersionRequest)) (*localauth.GetLocalListVersionConfirmation, error) {
+	request := localauth.NewGetLocalListVersionRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*localauth.GetLocalListVersionRequest, localauth.GetLocalListVersionConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Sends or updates a local authorization list on a charge point. Versioning rules must be followed.
+func (s *SyncCentralSystem) SendLocalList(ctx context.Context, clientId string, version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) (*localauth.SendLocalListConfirmation, error) {
+	request := localauth.NewSendLocalListRequest(version, updateType)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*localauth.SendLocalListRequest, localauth.SendLocalListConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Requests diagnostics data from a charge point. The data will be uploaded out-of-band to the provided URL location.
+func (s *SyncCentralSystem) GetDiagnostics(ctx context.Context, clientId string, location string, props ...func(request *firmware.GetDiagnosticsRequest)) (*firmware.GetDiagnosticsConfirmation, error) {
+	request := firmware.NewGetDiagnosticsRequest(location)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*firmware.GetDiagnosticsRequest, firmware.GetDiagnosticsConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Instructs the charge point to download and install a new firmware version. The firmware binary will be downloaded out-of-band from the provided URL location.
+func (s *SyncCentralSystem) UpdateFirmware(ctx context.Context, clientId string, location string, retrieveDate *types.DateTime, props ...func(request *firmware.UpdateFirmwareRequest)) (*firmware.UpdateFirmwareConfirmation, error) {
+	request := firmware.NewUpdateFirmwareRequest(location, retrieveDate)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*firmware.UpdateFirmwareRequest, firmware.UpdateFirmwareConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Instructs the charge point to reserve a connector for a specific IdTag (client). The connector, or the entire charge point, will be reserved until the provided expiration time.
+func (s *SyncCentralSystem) ReserveNow(ctx context.Context, clientId string, connectorId int, expiryDate *types.DateTime, idTag string, reservationId int, props ...func(request *reservation.ReserveNowRequest)) (*reservation.ReserveNowConfirmation, error) {
+	request := reservation.NewReserveNowRequest(connectorId, expiryDate, idTag, reservationId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*reservation.ReserveNowRequest, reservation.ReserveNowConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Cancels a previously reserved charge point or connector, given the reservation ID.
+func (s *SyncCentralSystem) CancelReservation(ctx context.Context, clientId string, reservationId int, props ...func(request *reservation.CancelReservationRequest)) (*reservation.CancelReservationConfirmation, error) {
+	request := reservation.NewCancelReservationRequest(reservationId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*reservation.CancelReservationRequest, reservation.CancelReservationConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charge point to send a specific message to the central system. This is used for forcefully triggering status updates, when the last known state is either too old or not clear to the central system.
+func (s *SyncCentralSystem) TriggerMessage(ctx context.Context, clientId string, requestedMessage remotetrigger.MessageTrigger, props ...func(request *remotetrigger.TriggerMessageRequest)) (*remotetrigger.TriggerMessageConfirmation, error) {
+	request := remotetrigger.NewTriggerMessageRequest(requestedMessage)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*remotetrigger.TriggerMessageRequest, remotetrigger.TriggerMessageConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Sends a smart charging profile to a charge point. Refer to the smart charging documentation for more information.
+func (s *SyncCentralSystem) SetChargingProfile(ctx context.Context, clientId string, connectorId int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) (*smartcharging.SetChargingProfileConfirmation, error) {
+	request := smartcharging.NewSetChargingProfileRequest(connectorId, chargingProfile)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*smartcharging.SetChargingProfileRequest, smartcharging.SetChargingProfileConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Removes one or more charging profiles from a charge point.
+func (s *SyncCentralSystem) ClearChargingProfile(ctx context.Context, clientId string, props ...func(request *smartcharging.ClearChargingProfileRequest)) (*smartcharging.ClearChargingProfileConfirmation, error) {
+	request := smartcharging.NewClearChargingProfileRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*smartcharging.ClearChargingProfileRequest, smartcharging.ClearChargingProfileConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Queries a charge point to the composite smart charging schedules and rules for a specified time interval.
+func (s *SyncCentralSystem) GetCompositeSchedule(ctx context.Context, clientId string, connectorId int, duration int, props ...func(request *smartcharging.GetCompositeScheduleRequest)) (*smartcharging.GetCompositeScheduleConfirmation, error) {
+	request := smartcharging.NewGetCompositeScheduleRequest(connectorId, duration)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*smartcharging.GetCompositeScheduleRequest, smartcharging.GetCompositeScheduleConfirmation](ctx, s.cs, clientId, request)
+}
+
+// Requests a charge point to send a specific message, e.g. a security-related notification.
+func (s *SyncCentralSystem) TriggerMessageExtended(ctx context.Context, clientId string, requestedMessage extendedtriggermessage.ExtendedTriggerMessageType, props ...func(request *extendedtriggermessage.ExtendedTriggerMessageRequest)) (*extendedtriggermessage.ExtendedTriggerMessageResponse, error) {
+	request := extendedtriggermessage.NewExtendedTriggerMessageRequest(requestedMessage)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*extendedtriggermessage.ExtendedTriggerMessageRequest, extendedtriggermessage.ExtendedTriggerMessageResponse](ctx, s.cs, clientId, request)
+}
+
+// Sends a signed certificate to a charge point, in response to a previous SignCertificate request.
+func (s *SyncCentralSystem) CertificateSigned(ctx context.Context, clientId string, csr string, props ...func(request *security.CertificateSignedRequest)) (*security.CertificateSignedResponse, error) {
+	request := security.NewCertificateSignedRequest(csr)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*security.CertificateSignedRequest, security.CertificateSignedResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charge point to download and install a signed firmware update.
+func (s *SyncCentralSystem) SignedUpdateFirmware(ctx context.Context, clientId string, requestId int, firmware securefirmware.Firmware, props ...func(request *securefirmware.SignedUpdateFirmwareRequest)) (*securefirmware.SignedUpdateFirmwareResponse, error) {
+	request := securefirmware.NewSignedUpdateFirmwareRequest(requestId, firmware)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*securefirmware.SignedUpdateFirmwareRequest, securefirmware.SignedUpdateFirmwareResponse](ctx, s.cs, clientId, request)
+}
+
+// Retrieves the hashes of the certificates of a specific type, which are installed on a charge point.
+func (s *SyncCentralSystem) GetInstalledCertificateIds(ctx context.Context, clientId string, certificateType types.CertificateUse, props ...func(request *certificates.GetInstalledCertificateIdsRequest)) (*certificates.GetInstalledCertificateIdsResponse, error) {
+	request := certificates.NewGetInstalledCertificateIdsRequest(certificateType)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*certificates.GetInstalledCertificateIdsRequest, certificates.GetInstalledCertificateIdsResponse](ctx, s.cs, clientId, request)
+}
+
+// Installs a new root certificate on a charge point.
+func (s *SyncCentralSystem) InstallCertificate(ctx context.Context, clientId string, certificateType types.CertificateUse, certificate string, props ...func(request *certificates.InstallCertificateRequest)) (*certificates.InstallCertificateResponse, error) {
+	request := certificates.NewInstallCertificateRequest(certificateType, certificate)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*certificates.InstallCertificateRequest, certificates.InstallCertificateResponse](ctx, s.cs, clientId, request)
+}
+
+// Deletes an installed certificate from a charge point.
+func (s *SyncCentralSystem) DeleteCertificate(ctx context.Context, clientId string, certificateHashData types.CertificateHashData, props ...func(request *certificates.DeleteCertificateRequest)) (*certificates.DeleteCertificateResponse, error) {
+	request := certificates.NewDeleteCertificateRequest(certificateHashData)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*certificates.DeleteCertificateRequest, certificates.DeleteCertificateResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a charge point to upload a diagnostics or security log.
+func (s *SyncCentralSystem) GetLog(ctx context.Context, clientId string, logType logging.LogType, requestID int, logParameters logging.LogParameters, props ...func(request *logging.GetLogRequest)) (*logging.GetLogResponse, error) {
+	request := logging.NewGetLogRequest(logType, requestID, logParameters)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*logging.GetLogRequest, logging.GetLogResponse](ctx, s.cs, clientId, request)
+}
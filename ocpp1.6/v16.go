@@ -2,9 +2,12 @@
 package ocpp16
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
+	"net/http"
 
+	"github.com/xBlaz3kx/ocpp-go/bulk"
 	"github.com/xBlaz3kx/ocpp-go/internal/callback"
 	log "github.com/xBlaz3kx/ocpp-go/logging"
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
@@ -81,6 +84,24 @@ type ChargePoint interface {
 
 	LogStatusNotification(status logging.UploadLogStatus, requestId int, props ...func(request *logging.LogStatusNotificationRequest)) (*logging.LogStatusNotificationResponse, error)
 
+	// Context-aware variants of the messages above.
+	// If ctx is done before a response is received, the request is dropped from the outgoing queue
+	// and ctx.Err() is returned. Refer to SendRequestCtx for details.
+	BootNotificationCtx(ctx context.Context, chargePointModel string, chargePointVendor string, props ...func(request *core.BootNotificationRequest)) (*core.BootNotificationConfirmation, error)
+	AuthorizeCtx(ctx context.Context, idTag string, props ...func(request *core.AuthorizeRequest)) (*core.AuthorizeConfirmation, error)
+	DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *core.DataTransferRequest)) (*core.DataTransferConfirmation, error)
+	HeartbeatCtx(ctx context.Context, props ...func(request *core.HeartbeatRequest)) (*core.HeartbeatConfirmation, error)
+	MeterValuesCtx(ctx context.Context, connectorId int, meterValues []types.MeterValue, props ...func(request *core.MeterValuesRequest)) (*core.MeterValuesConfirmation, error)
+	StartTransactionCtx(ctx context.Context, connectorId int, idTag string, meterStart int, timestamp *types.DateTime, props ...func(request *core.StartTransactionRequest)) (*core.StartTransactionConfirmation, error)
+	StopTransactionCtx(ctx context.Context, meterStop int, timestamp *types.DateTime, transactionId int, props ...func(request *core.StopTransactionRequest)) (*core.StopTransactionConfirmation, error)
+	StatusNotificationCtx(ctx context.Context, connectorId int, errorCode core.ChargePointErrorCode, status core.ChargePointStatus, props ...func(request *core.StatusNotificationRequest)) (*core.StatusNotificationConfirmation, error)
+	DiagnosticsStatusNotificationCtx(ctx context.Context, status firmware.DiagnosticsStatus, props ...func(request *firmware.DiagnosticsStatusNotificationRequest)) (*firmware.DiagnosticsStatusNotificationConfirmation, error)
+	FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationConfirmation, error)
+	SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error)
+	SignCertificateCtx(ctx context.Context, CSR string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error)
+	SignedUpdateFirmwareStatusNotificationCtx(ctx context.Context, status securefirmware.FirmwareStatus, props ...func(request *securefirmware.SignedFirmwareStatusNotificationRequest)) (*securefirmware.SignedFirmwareStatusNotificationResponse, error)
+	LogStatusNotificationCtx(ctx context.Context, status logging.UploadLogStatus, requestId int, props ...func(request *logging.LogStatusNotificationRequest)) (*logging.LogStatusNotificationResponse, error)
+
 	// Registers a handler for incoming core profile messages
 	SetCoreHandler(listener core.ChargePointHandler)
 	// Registers a handler for incoming local authorization profile messages
@@ -116,6 +137,19 @@ type ChargePoint interface {
 	// This result is propagated via a callback, called asynchronously.
 	// In case of network issues (i.e. the remote host couldn't be reached), the function returns an error directly. In this case, the callback is never called.
 	SendRequestAsync(request ocpp.Request, callback func(confirmation ocpp.Response, protoError error)) error
+	// Sends a request to the central system, bound to the given context.
+	// If ctx is done before a response is received, the request is removed from the outgoing queue
+	// (or its pending slot is released, if it was already sent) and ctx.Err() is returned.
+	// A late response to the request is discarded.
+	//
+	// The request is synchronous blocking.
+	SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error)
+	// Sends an asynchronous request to the central system, bound to the given context.
+	// If ctx is done before a response is received, the request is removed from the outgoing queue
+	// and the callback is invoked with ctx.Err().
+	//
+	// If ctx is already done, ctx.Err() is returned directly. In this case, the callback is never invoked.
+	SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(confirmation ocpp.Response, protoError error)) error
 	// Connects to the central system and starts the charge point routine.
 	// The function doesn't block and returns right away, after having attempted to open a connection to the central system.
 	// If the connection couldn't be opened, an error is returned.
@@ -204,6 +238,8 @@ func NewChargePoint(id string, endpoint *ocppj.Client, client ws.Client, logger
 
 	// Callback invoked by dispatcher, whenever a queued request is canceled, due to timeout.
 	endpoint.SetOnRequestCanceled(cp.onRequestTimeout)
+	// Message IDs of requests awaiting a callback must not be reused
+	endpoint.SetMessageIdInUseHandler(cp.callbacks.IsRegistered)
 
 	cp.client.SetResponseHandler(func(confirmation ocpp.Response, requestId string) {
 		cp.confirmationHandler <- responseWithID{response: confirmation, requestID: requestId}
@@ -239,6 +275,7 @@ func NewChargePoint(id string, endpoint *ocppj.Client, client ws.Client, logger
 //	changeAvailabilityConf, err := server.ChangeAvailability("cs0001", callback, 1, AvailabilityTypeOperative)
 //
 // All messages are sent asynchronously and do not block the caller.
+// For blocking variants returning the typed response directly, see SyncCentralSystem and Call.
 type CentralSystem interface {
 	// Instructs a charge point to change its availability. The target availability can be set for a single connector of for the whole charge point.
 	ChangeAvailability(clientId string, callback func(*core.ChangeAvailabilityConfirmation, error), connectorId int, availabilityType core.AvailabilityType, props ...func(*core.ChangeAvailabilityRequest)) error
@@ -325,13 +362,44 @@ type CentralSystem interface {
 	// This result is propagated via a callback, called asynchronously.
 	// In case of network issues (i.e. the remote host couldn't be reached), the function returns an error directly. In this case, the callback is never called.
 	SendRequestAsync(clientId string, request ocpp.Request, callback func(ocpp.Response, error)) error
+	// Sends an asynchronous request to a charge point, bound to the given context.
+	// If ctx is done before a response is received, the request is removed from the client's outgoing queue
+	// (or its pending slot is released, if it was already sent) and the callback is invoked with ctx.Err().
+	// A late response to the request is discarded.
+	//
+	// If ctx is already done, ctx.Err() is returned directly. In this case, the callback is never invoked.
+	SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(ocpp.Response, error)) error
+	// Sends a request created by factory to all targets concurrently, e.g. to change the configuration of many charge points at once.
+	// Targets are either a list of client IDs (see bulk.ClientIDs), or the connected charge points matching a selector (see bulk.Connected).
+	//
+	// The function blocks until all requests completed, and returns a report of accepted, rejected, errored, timed out
+	// and offline targets. Concurrency, per-target timeouts and streaming of results are configured via opts.
+	SendBulkRequest(ctx context.Context, targets bulk.Targets, factory bulk.RequestFactory, opts ...bulk.Option) bulk.Report
 	// Starts running the central system on the specified port and URL.
 	// The central system runs as a daemon and handles incoming charge point connections and messages.
 
 	// The function blocks forever, so it is suggested to wrap it in a goroutine, in case other functionality needs to be executed on the main program thread.
 	Start(listenPort int, listenPath string)
+	// Serve is like Start, but accepts incoming charge point connections on the given listener,
+	// e.g. a Unix socket or a systemd-activated listener.
+	//
+	// The function blocks until the central system is stopped. It returns nil if it was stopped via Stop or Shutdown,
+	// or the error that caused the websocket server to fail otherwise.
+	Serve(listener net.Listener, listenPath string) error
+	// Handler starts the central system without listening for connections on its own, and returns the websocket upgrade handler.
+	//
+	// The handler may be mounted on an existing HTTP server or router, on one or more paths.
+	// Call Stop or Shutdown to close all charge point connections, once the handler is not needed anymore.
+	// An error is returned, if the websocket server doesn't implement http.Handler.
+	Handler() (http.Handler, error)
 	// Stops the central system, clearing all pending requests.
 	Stop()
+	// Shutdown gracefully shuts down the central system, allowing ongoing message exchanges to complete.
+	//
+	// New connections and outgoing requests are rejected right away. Once all pending requests completed and all incoming
+	// requests were answered, or ctx is done, all connections are closed, so clients may reconnect to another instance.
+	// The returned report contains the outcome for every connected client. See ocppj.Server.Shutdown for details.
+	Shutdown(ctx context.Context) (ocppj.ShutdownReport, error)
 	// Errors returns a channel for error messages. If it doesn't exist it es created.
 	Errors() <-chan error
 }
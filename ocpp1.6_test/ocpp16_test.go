@@ -105,10 +105,11 @@ func (websocketServer *MockWebsocketServer) SetCheckClientHandler(handler ws.Che
 type MockWebsocketClient struct {
 	mock.Mock
 	ws.Client
-	MessageHandler      func(data []byte) error
-	ReconnectedHandler  func()
-	DisconnectedHandler func(err error)
-	errC                chan error
+	MessageHandler        func(data []byte) error
+	ReconnectedHandler    func()
+	DisconnectedHandler   func(err error)
+	ActiveEndpointHandler func(endpoint ws.Endpoint, index int)
+	errC                  chan error
 }
 
 func (websocketClient *MockWebsocketClient) Start(url string) error {
@@ -116,6 +117,10 @@ func (websocketClient *MockWebsocketClient) Start(url string) error {
 	return args.Error(0)
 }
 
+func (websocketClient *MockWebsocketClient) StartWithEndpoints(endpoints []ws.Endpoint) {
+	websocketClient.MethodCalled("StartWithEndpoints", endpoints)
+}
+
 func (websocketClient *MockWebsocketClient) Stop() {
 	websocketClient.MethodCalled("Stop")
 }
@@ -132,6 +137,10 @@ func (websocketClient *MockWebsocketClient) SetDisconnectedHandler(handler func(
 	websocketClient.DisconnectedHandler = handler
 }
 
+func (websocketClient *MockWebsocketClient) SetActiveEndpointHandler(handler func(endpoint ws.Endpoint, index int)) {
+	websocketClient.ActiveEndpointHandler = handler
+}
+
 func (websocketClient *MockWebsocketClient) Write(data []byte) error {
 	args := websocketClient.MethodCalled("Write", data)
 	return args.Error(0)
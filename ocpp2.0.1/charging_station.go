@@ -1,6 +1,7 @@
 package ocpp2
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/transactions"
 	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/types"
 	"github.com/xBlaz3kx/ocpp-go/ocppj"
+	"github.com/xBlaz3kx/ocpp-go/ws"
 )
 
 // responseWithID holds a response along with its associated request ID
@@ -82,11 +84,15 @@ func (cs *chargingStation) onRequestTimeout(_ string, _ ocpp.Request, err *ocpp.
 }
 
 func (cs *chargingStation) BootNotification(reason provisioning.BootReason, model string, vendor string, props ...func(request *provisioning.BootNotificationRequest)) (*provisioning.BootNotificationResponse, error) {
+	return cs.BootNotificationCtx(context.Background(), reason, model, vendor, props...)
+}
+
+func (cs *chargingStation) BootNotificationCtx(ctx context.Context, reason provisioning.BootReason, model string, vendor string, props ...func(request *provisioning.BootNotificationRequest)) (*provisioning.BootNotificationResponse, error) {
 	request := provisioning.NewBootNotificationRequest(reason, model, vendor)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -95,11 +101,15 @@ func (cs *chargingStation) BootNotification(reason provisioning.BootReason, mode
 }
 
 func (cs *chargingStation) Authorize(idToken string, tokenType types.IdTokenType, props ...func(request *authorization.AuthorizeRequest)) (*authorization.AuthorizeResponse, error) {
+	return cs.AuthorizeCtx(context.Background(), idToken, tokenType, props...)
+}
+
+func (cs *chargingStation) AuthorizeCtx(ctx context.Context, idToken string, tokenType types.IdTokenType, props ...func(request *authorization.AuthorizeRequest)) (*authorization.AuthorizeResponse, error) {
 	request := authorization.NewAuthorizationRequest(idToken, tokenType)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -108,11 +118,15 @@ func (cs *chargingStation) Authorize(idToken string, tokenType types.IdTokenType
 }
 
 func (cs *chargingStation) ClearedChargingLimit(chargingLimitSource types.ChargingLimitSourceType, props ...func(request *smartcharging.ClearedChargingLimitRequest)) (*smartcharging.ClearedChargingLimitResponse, error) {
+	return cs.ClearedChargingLimitCtx(context.Background(), chargingLimitSource, props...)
+}
+
+func (cs *chargingStation) ClearedChargingLimitCtx(ctx context.Context, chargingLimitSource types.ChargingLimitSourceType, props ...func(request *smartcharging.ClearedChargingLimitRequest)) (*smartcharging.ClearedChargingLimitResponse, error) {
 	request := smartcharging.NewClearedChargingLimitRequest(chargingLimitSource)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -121,11 +135,15 @@ func (cs *chargingStation) ClearedChargingLimit(chargingLimitSource types.Chargi
 }
 
 func (cs *chargingStation) DataTransfer(vendorId string, props ...func(request *data.DataTransferRequest)) (*data.DataTransferResponse, error) {
+	return cs.DataTransferCtx(context.Background(), vendorId, props...)
+}
+
+func (cs *chargingStation) DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *data.DataTransferRequest)) (*data.DataTransferResponse, error) {
 	request := data.NewDataTransferRequest(vendorId)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -134,11 +152,15 @@ func (cs *chargingStation) DataTransfer(vendorId string, props ...func(request *
 }
 
 func (cs *chargingStation) FirmwareStatusNotification(status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationResponse, error) {
+	return cs.FirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cs *chargingStation) FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationResponse, error) {
 	request := firmware.NewFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -147,11 +169,15 @@ func (cs *chargingStation) FirmwareStatusNotification(status firmware.FirmwareSt
 }
 
 func (cs *chargingStation) Get15118EVCertificate(schemaVersion string, action iso15118.CertificateAction, exiRequest string, props ...func(request *iso15118.Get15118EVCertificateRequest)) (*iso15118.Get15118EVCertificateResponse, error) {
+	return cs.Get15118EVCertificateCtx(context.Background(), schemaVersion, action, exiRequest, props...)
+}
+
+func (cs *chargingStation) Get15118EVCertificateCtx(ctx context.Context, schemaVersion string, action iso15118.CertificateAction, exiRequest string, props ...func(request *iso15118.Get15118EVCertificateRequest)) (*iso15118.Get15118EVCertificateResponse, error) {
 	request := iso15118.NewGet15118EVCertificateRequest(schemaVersion, action, exiRequest)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -160,11 +186,15 @@ func (cs *chargingStation) Get15118EVCertificate(schemaVersion string, action is
 }
 
 func (cs *chargingStation) GetCertificateStatus(ocspRequestData types.OCSPRequestDataType, props ...func(request *iso15118.GetCertificateStatusRequest)) (*iso15118.GetCertificateStatusResponse, error) {
+	return cs.GetCertificateStatusCtx(context.Background(), ocspRequestData, props...)
+}
+
+func (cs *chargingStation) GetCertificateStatusCtx(ctx context.Context, ocspRequestData types.OCSPRequestDataType, props ...func(request *iso15118.GetCertificateStatusRequest)) (*iso15118.GetCertificateStatusResponse, error) {
 	request := iso15118.NewGetCertificateStatusRequest(ocspRequestData)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -173,11 +203,15 @@ func (cs *chargingStation) GetCertificateStatus(ocspRequestData types.OCSPReques
 }
 
 func (cs *chargingStation) Heartbeat(props ...func(request *availability.HeartbeatRequest)) (*availability.HeartbeatResponse, error) {
+	return cs.HeartbeatCtx(context.Background(), props...)
+}
+
+func (cs *chargingStation) HeartbeatCtx(ctx context.Context, props ...func(request *availability.HeartbeatRequest)) (*availability.HeartbeatResponse, error) {
 	request := availability.NewHeartbeatRequest()
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -186,11 +220,15 @@ func (cs *chargingStation) Heartbeat(props ...func(request *availability.Heartbe
 }
 
 func (cs *chargingStation) LogStatusNotification(status diagnostics.UploadLogStatus, requestID int, props ...func(request *diagnostics.LogStatusNotificationRequest)) (*diagnostics.LogStatusNotificationResponse, error) {
+	return cs.LogStatusNotificationCtx(context.Background(), status, requestID, props...)
+}
+
+func (cs *chargingStation) LogStatusNotificationCtx(ctx context.Context, status diagnostics.UploadLogStatus, requestID int, props ...func(request *diagnostics.LogStatusNotificationRequest)) (*diagnostics.LogStatusNotificationResponse, error) {
 	request := diagnostics.NewLogStatusNotificationRequest(status, requestID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -199,11 +237,15 @@ func (cs *chargingStation) LogStatusNotification(status diagnostics.UploadLogSta
 }
 
 func (cs *chargingStation) MeterValues(evseID int, meterValues []types.MeterValue, props ...func(request *meter.MeterValuesRequest)) (*meter.MeterValuesResponse, error) {
+	return cs.MeterValuesCtx(context.Background(), evseID, meterValues, props...)
+}
+
+func (cs *chargingStation) MeterValuesCtx(ctx context.Context, evseID int, meterValues []types.MeterValue, props ...func(request *meter.MeterValuesRequest)) (*meter.MeterValuesResponse, error) {
 	request := meter.NewMeterValuesRequest(evseID, meterValues)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -212,11 +254,15 @@ func (cs *chargingStation) MeterValues(evseID int, meterValues []types.MeterValu
 }
 
 func (cs *chargingStation) NotifyChargingLimit(chargingLimit smartcharging.ChargingLimit, props ...func(request *smartcharging.NotifyChargingLimitRequest)) (*smartcharging.NotifyChargingLimitResponse, error) {
+	return cs.NotifyChargingLimitCtx(context.Background(), chargingLimit, props...)
+}
+
+func (cs *chargingStation) NotifyChargingLimitCtx(ctx context.Context, chargingLimit smartcharging.ChargingLimit, props ...func(request *smartcharging.NotifyChargingLimitRequest)) (*smartcharging.NotifyChargingLimitResponse, error) {
 	request := smartcharging.NewNotifyChargingLimitRequest(chargingLimit)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -225,11 +271,15 @@ func (cs *chargingStation) NotifyChargingLimit(chargingLimit smartcharging.Charg
 }
 
 func (cs *chargingStation) NotifyCustomerInformation(data string, seqNo int, generatedAt types.DateTime, requestID int, props ...func(request *diagnostics.NotifyCustomerInformationRequest)) (*diagnostics.NotifyCustomerInformationResponse, error) {
+	return cs.NotifyCustomerInformationCtx(context.Background(), data, seqNo, generatedAt, requestID, props...)
+}
+
+func (cs *chargingStation) NotifyCustomerInformationCtx(ctx context.Context, data string, seqNo int, generatedAt types.DateTime, requestID int, props ...func(request *diagnostics.NotifyCustomerInformationRequest)) (*diagnostics.NotifyCustomerInformationResponse, error) {
 	request := diagnostics.NewNotifyCustomerInformationRequest(data, seqNo, generatedAt, requestID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -238,11 +288,15 @@ func (cs *chargingStation) NotifyCustomerInformation(data string, seqNo int, gen
 }
 
 func (cs *chargingStation) NotifyDisplayMessages(requestID int, props ...func(request *display.NotifyDisplayMessagesRequest)) (*display.NotifyDisplayMessagesResponse, error) {
+	return cs.NotifyDisplayMessagesCtx(context.Background(), requestID, props...)
+}
+
+func (cs *chargingStation) NotifyDisplayMessagesCtx(ctx context.Context, requestID int, props ...func(request *display.NotifyDisplayMessagesRequest)) (*display.NotifyDisplayMessagesResponse, error) {
 	request := display.NewNotifyDisplayMessagesRequest(requestID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -251,11 +305,15 @@ func (cs *chargingStation) NotifyDisplayMessages(requestID int, props ...func(re
 }
 
 func (cs *chargingStation) NotifyEVChargingNeeds(evseID int, chargingNeeds smartcharging.ChargingNeeds, props ...func(request *smartcharging.NotifyEVChargingNeedsRequest)) (*smartcharging.NotifyEVChargingNeedsResponse, error) {
+	return cs.NotifyEVChargingNeedsCtx(context.Background(), evseID, chargingNeeds, props...)
+}
+
+func (cs *chargingStation) NotifyEVChargingNeedsCtx(ctx context.Context, evseID int, chargingNeeds smartcharging.ChargingNeeds, props ...func(request *smartcharging.NotifyEVChargingNeedsRequest)) (*smartcharging.NotifyEVChargingNeedsResponse, error) {
 	request := smartcharging.NewNotifyEVChargingNeedsRequest(evseID, chargingNeeds)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -264,11 +322,15 @@ func (cs *chargingStation) NotifyEVChargingNeeds(evseID int, chargingNeeds smart
 }
 
 func (cs *chargingStation) NotifyEVChargingSchedule(timeBase *types.DateTime, evseID int, schedule types.ChargingSchedule, props ...func(request *smartcharging.NotifyEVChargingScheduleRequest)) (*smartcharging.NotifyEVChargingScheduleResponse, error) {
+	return cs.NotifyEVChargingScheduleCtx(context.Background(), timeBase, evseID, schedule, props...)
+}
+
+func (cs *chargingStation) NotifyEVChargingScheduleCtx(ctx context.Context, timeBase *types.DateTime, evseID int, schedule types.ChargingSchedule, props ...func(request *smartcharging.NotifyEVChargingScheduleRequest)) (*smartcharging.NotifyEVChargingScheduleResponse, error) {
 	request := smartcharging.NewNotifyEVChargingScheduleRequest(timeBase, evseID, schedule)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -277,11 +339,15 @@ func (cs *chargingStation) NotifyEVChargingSchedule(timeBase *types.DateTime, ev
 }
 
 func (cs *chargingStation) NotifyEvent(generatedAt *types.DateTime, seqNo int, eventData []diagnostics.EventData, props ...func(request *diagnostics.NotifyEventRequest)) (*diagnostics.NotifyEventResponse, error) {
+	return cs.NotifyEventCtx(context.Background(), generatedAt, seqNo, eventData, props...)
+}
+
+func (cs *chargingStation) NotifyEventCtx(ctx context.Context, generatedAt *types.DateTime, seqNo int, eventData []diagnostics.EventData, props ...func(request *diagnostics.NotifyEventRequest)) (*diagnostics.NotifyEventResponse, error) {
 	request := diagnostics.NewNotifyEventRequest(generatedAt, seqNo, eventData)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -290,11 +356,15 @@ func (cs *chargingStation) NotifyEvent(generatedAt *types.DateTime, seqNo int, e
 }
 
 func (cs *chargingStation) NotifyMonitoringReport(requestID int, seqNo int, generatedAt *types.DateTime, monitorData []diagnostics.MonitoringData, props ...func(request *diagnostics.NotifyMonitoringReportRequest)) (*diagnostics.NotifyMonitoringReportResponse, error) {
+	return cs.NotifyMonitoringReportCtx(context.Background(), requestID, seqNo, generatedAt, monitorData, props...)
+}
+
+func (cs *chargingStation) NotifyMonitoringReportCtx(ctx context.Context, requestID int, seqNo int, generatedAt *types.DateTime, monitorData []diagnostics.MonitoringData, props ...func(request *diagnostics.NotifyMonitoringReportRequest)) (*diagnostics.NotifyMonitoringReportResponse, error) {
 	request := diagnostics.NewNotifyMonitoringReportRequest(requestID, seqNo, generatedAt, monitorData)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -303,11 +373,15 @@ func (cs *chargingStation) NotifyMonitoringReport(requestID int, seqNo int, gene
 }
 
 func (cs *chargingStation) NotifyReport(requestID int, generatedAt *types.DateTime, seqNo int, props ...func(request *provisioning.NotifyReportRequest)) (*provisioning.NotifyReportResponse, error) {
+	return cs.NotifyReportCtx(context.Background(), requestID, generatedAt, seqNo, props...)
+}
+
+func (cs *chargingStation) NotifyReportCtx(ctx context.Context, requestID int, generatedAt *types.DateTime, seqNo int, props ...func(request *provisioning.NotifyReportRequest)) (*provisioning.NotifyReportResponse, error) {
 	request := provisioning.NewNotifyReportRequest(requestID, generatedAt, seqNo)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -316,11 +390,15 @@ func (cs *chargingStation) NotifyReport(requestID int, generatedAt *types.DateTi
 }
 
 func (cs *chargingStation) PublishFirmwareStatusNotification(status firmware.PublishFirmwareStatus, props ...func(request *firmware.PublishFirmwareStatusNotificationRequest)) (*firmware.PublishFirmwareStatusNotificationResponse, error) {
+	return cs.PublishFirmwareStatusNotificationCtx(context.Background(), status, props...)
+}
+
+func (cs *chargingStation) PublishFirmwareStatusNotificationCtx(ctx context.Context, status firmware.PublishFirmwareStatus, props ...func(request *firmware.PublishFirmwareStatusNotificationRequest)) (*firmware.PublishFirmwareStatusNotificationResponse, error) {
 	request := firmware.NewPublishFirmwareStatusNotificationRequest(status)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -329,11 +407,15 @@ func (cs *chargingStation) PublishFirmwareStatusNotification(status firmware.Pub
 }
 
 func (cs *chargingStation) ReportChargingProfiles(requestID int, chargingLimitSource types.ChargingLimitSourceType, evseID int, chargingProfile []types.ChargingProfile, props ...func(request *smartcharging.ReportChargingProfilesRequest)) (*smartcharging.ReportChargingProfilesResponse, error) {
+	return cs.ReportChargingProfilesCtx(context.Background(), requestID, chargingLimitSource, evseID, chargingProfile, props...)
+}
+
+func (cs *chargingStation) ReportChargingProfilesCtx(ctx context.Context, requestID int, chargingLimitSource types.ChargingLimitSourceType, evseID int, chargingProfile []types.ChargingProfile, props ...func(request *smartcharging.ReportChargingProfilesRequest)) (*smartcharging.ReportChargingProfilesResponse, error) {
 	request := smartcharging.NewReportChargingProfilesRequest(requestID, chargingLimitSource, evseID, chargingProfile)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -342,11 +424,15 @@ func (cs *chargingStation) ReportChargingProfiles(requestID int, chargingLimitSo
 }
 
 func (cs *chargingStation) ReservationStatusUpdate(reservationID int, status reservation.ReservationUpdateStatus, props ...func(request *reservation.ReservationStatusUpdateRequest)) (*reservation.ReservationStatusUpdateResponse, error) {
+	return cs.ReservationStatusUpdateCtx(context.Background(), reservationID, status, props...)
+}
+
+func (cs *chargingStation) ReservationStatusUpdateCtx(ctx context.Context, reservationID int, status reservation.ReservationUpdateStatus, props ...func(request *reservation.ReservationStatusUpdateRequest)) (*reservation.ReservationStatusUpdateResponse, error) {
 	request := reservation.NewReservationStatusUpdateRequest(reservationID, status)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -355,11 +441,15 @@ func (cs *chargingStation) ReservationStatusUpdate(reservationID int, status res
 }
 
 func (cs *chargingStation) SecurityEventNotification(typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
+	return cs.SecurityEventNotificationCtx(context.Background(), typ, timestamp, props...)
+}
+
+func (cs *chargingStation) SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error) {
 	request := security.NewSecurityEventNotificationRequest(typ, timestamp)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -368,11 +458,15 @@ func (cs *chargingStation) SecurityEventNotification(typ string, timestamp *type
 }
 
 func (cs *chargingStation) SignCertificate(csr string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
+	return cs.SignCertificateCtx(context.Background(), csr, props...)
+}
+
+func (cs *chargingStation) SignCertificateCtx(ctx context.Context, csr string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error) {
 	request := security.NewSignCertificateRequest(csr)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -381,11 +475,15 @@ func (cs *chargingStation) SignCertificate(csr string, props ...func(request *se
 }
 
 func (cs *chargingStation) StatusNotification(timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error) {
+	return cs.StatusNotificationCtx(context.Background(), timestamp, status, evseID, connectorID, props...)
+}
+
+func (cs *chargingStation) StatusNotificationCtx(ctx context.Context, timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error) {
 	request := availability.NewStatusNotificationRequest(timestamp, status, evseID, connectorID)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -394,11 +492,15 @@ func (cs *chargingStation) StatusNotification(timestamp *types.DateTime, status
 }
 
 func (cs *chargingStation) TransactionEvent(t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error) {
+	return cs.TransactionEventCtx(context.Background(), t, timestamp, reason, seqNo, info, props...)
+}
+
+func (cs *chargingStation) TransactionEventCtx(ctx context.Context, t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error) {
 	request := transactions.NewTransactionEventRequest(t, timestamp, reason, seqNo, info)
 	for _, fn := range props {
 		fn(request)
 	}
-	response, err := cs.SendRequest(request)
+	response, err := cs.SendRequestCtx(ctx, request)
 	if err != nil {
 		return nil, err
 	}
@@ -471,6 +573,10 @@ func (cs *chargingStation) SetDataHandler(handler data.ChargingStationHandler) {
 }
 
 func (cs *chargingStation) SendRequest(request ocpp.Request) (ocpp.Response, error) {
+	return cs.SendRequestCtx(context.Background(), request)
+}
+
+func (cs *chargingStation) SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error) {
 	featureName := request.GetFeatureName()
 	if _, found := cs.client.GetProfileForFeature(featureName); !found {
 		return nil, fmt.Errorf("feature %v is unsupported on charging station (missing profile), cannot send request", featureName)
@@ -486,9 +592,9 @@ func (cs *chargingStation) SendRequest(request ocpp.Request) (ocpp.Response, err
 	send := func() (string, error) {
 		return cs.client.SendRequest(request)
 	}
-	err := cs.callbacks.RegisterCallback(cs.client.Id, send, func(confirmation ocpp.Response, err error) {
+	err := cs.callbacks.RegisterCallbackCtx(ctx, cs.client.Id, send, func(confirmation ocpp.Response, err error) {
 		asyncResponseC <- asyncResponse{r: confirmation, e: err}
-	})
+	}, cs.cancelRequest)
 	if err != nil {
 		return nil, err
 	}
@@ -506,6 +612,10 @@ func (cs *chargingStation) SendRequest(request ocpp.Request) (ocpp.Response, err
 }
 
 func (cs *chargingStation) SendRequestAsync(request ocpp.Request, callback func(response ocpp.Response, err error)) error {
+	return cs.SendRequestAsyncCtx(context.Background(), request, callback)
+}
+
+func (cs *chargingStation) SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(response ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cs.client.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on charging station (missing profile), cannot send request", featureName)
@@ -545,10 +655,15 @@ func (cs *chargingStation) SendRequestAsync(request ocpp.Request, callback func(
 	send := func() (string, error) {
 		return cs.client.SendRequest(request)
 	}
-	err := cs.callbacks.RegisterCallback(cs.client.Id, send, callback)
+	err := cs.callbacks.RegisterCallbackCtx(ctx, cs.client.Id, send, callback, cs.cancelRequest)
 	return err
 }
 
+// cancelRequest drops a request from the outgoing queue, after its context is done.
+func (cs *chargingStation) cancelRequest(requestID string) {
+	cs.client.CancelRequest(requestID)
+}
+
 func (cs *chargingStation) asyncCallbackHandler() {
 	for {
 		select {
@@ -630,6 +745,18 @@ func (cs *chargingStation) StartWithRetries(csmsUrl string) {
 	go cs.asyncCallbackHandler()
 }
 
+func (cs *chargingStation) StartWithEndpoints(endpoints []ws.Endpoint) {
+	// Start client
+	cs.stopC = make(chan struct{}, 1)
+	cs.client.StartWithEndpoints(endpoints)
+	// Async response handler receives incoming responses/errors and triggers callbacks
+	go cs.asyncCallbackHandler()
+}
+
+func (cs *chargingStation) SetActiveEndpointHandler(handler func(endpoint ws.Endpoint, index int)) {
+	cs.client.SetOnActiveEndpointHandler(handler)
+}
+
 func (cs *chargingStation) Stop() {
 	cs.client.Stop()
 }
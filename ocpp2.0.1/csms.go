@@ -1,10 +1,14 @@
 package ocpp2
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
 	"reflect"
 
+	"github.com/xBlaz3kx/ocpp-go/bulk"
 	"github.com/xBlaz3kx/ocpp-go/internal/callback"
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/authorization"
@@ -56,10 +60,13 @@ func newCSMS(server *ocppj.Server) (csms, error) {
 	}
 
 	server.SetDialect(ocpp.V2)
+	registry := callback.New()
+	// Message IDs of requests awaiting a callback must not be reused
+	server.SetMessageIdInUseHandler(registry.IsRegistered)
 
 	return csms{
 		server:   server,
-		registry: callback.New(),
+		registry: registry,
 	}, nil
 }
 
@@ -766,6 +773,10 @@ func (cs *csms) SetChargingStationDisconnectedHandler(handler ChargingStationCon
 }
 
 func (cs *csms) SendRequestAsync(clientId string, request ocpp.Request, callback func(response ocpp.Response, err error)) error {
+	return cs.SendRequestAsyncCtx(context.Background(), clientId, request, callback)
+}
+
+func (cs *csms) SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(response ocpp.Response, err error)) error {
 	featureName := request.GetFeatureName()
 	if _, found := cs.server.GetProfileForFeature(featureName); !found {
 		return fmt.Errorf("feature %v is unsupported on CSMS (missing profile), cannot send request", featureName)
@@ -819,7 +830,14 @@ func (cs *csms) SendRequestAsync(clientId string, request ocpp.Request, callback
 	send := func() (string, error) {
 		return cs.server.SendRequest(clientId, request)
 	}
-	return cs.registry.RegisterCallback(clientId, send, callback)
+	cancel := func(requestID string) {
+		cs.server.CancelRequest(clientId, requestID)
+	}
+	return cs.registry.RegisterCallbackCtx(ctx, clientId, send, callback, cancel)
+}
+
+func (cs *csms) SendBulkRequest(ctx context.Context, targets bulk.Targets, factory bulk.RequestFactory, opts ...bulk.Option) bulk.Report {
+	return bulk.Send(ctx, cs, cs.server, targets, factory, opts...)
 }
 
 func (cs *csms) Start(listenPort int, listenPath string) {
@@ -827,10 +845,22 @@ func (cs *csms) Start(listenPort int, listenPath string) {
 	cs.server.Start(listenPort, listenPath)
 }
 
+func (cs *csms) Serve(listener net.Listener, listenPath string) error {
+	return cs.server.Serve(listener, listenPath)
+}
+
+func (cs *csms) Handler() (http.Handler, error) {
+	return cs.server.Handler()
+}
+
 func (cs *csms) Stop() {
 	cs.server.Stop()
 }
 
+func (cs *csms) Shutdown(ctx context.Context) (ocppj.ShutdownReport, error) {
+	return cs.server.Shutdown(ctx)
+}
+
 func (cs *csms) sendResponse(chargingStationID string, response ocpp.Response, err error, requestId string) {
 	if err != nil {
 		// Send error response
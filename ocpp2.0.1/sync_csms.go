@@ -0,0 +1,410 @@
+package ocpp2
+
+import (
+	"context"
+
+	"github.com/xBlaz3kx/ocpp-go/internal/callback"
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/authorization"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/availability"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/data"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/diagnostics"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/display"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/firmware"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/iso15118"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/localauth"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/provisioning"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/remotecontrol"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/reservation"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/security"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/smartcharging"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/tariffcost"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/transactions"
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/types"
+)
+
+// Call sends a request to a charging station and blocks until the response was received, or ctx is done.
+// It is the blocking counterpart of CSMS.SendRequestAsyncCtx: if ctx is done before a response was received,
+// the request is canceled and ctx.Err() is returned.
+//
+// Resp is the response type matching the request, e.g. for a *reservation.CancelReservationRequest request:
+//
+//	response, err := ocpp2.Call[*reservation.CancelReservationRequest, reservation.CancelReservationResponse](ctx, cs, clientId, request)
+func Call[Req ocpp.Request, Resp any](ctx context.Context, cs CSMS, clientId string, request Req) (*Resp, error) {
+	return callback.Await[Resp](ctx, func(ctx context.Context, cb func(ocpp.Response, error)) error {
+		return cs.SendRequestAsyncCtx(ctx, clientId, request, cb)
+	})
+}
+
+// SyncCSMS offers blocking variants of all requests, which a CSMS may send to a charging station.
+// Every request is bound to a context, and returns the typed response of the charging station directly, instead of invoking a callback.
+//
+// Use NewSyncCSMS to create an instance.
+type SyncCSMS struct {
+	cs CSMS
+}
+
+// NewSyncCSMS wraps cs, to send requests to charging stations in a blocking fashion.
+func NewSyncCSMS(cs CSMS) *SyncCSMS {
+	return &SyncCSMS{cs: cs}
+}
+
+// Cancel a pending reservation, provided the reservationId, on a charging station.
+func (s *SyncCSMS) CancelReservation(ctx context.Context, clientId string, reservationId int, props ...func(request *reservation.CancelReservationRequest)) (*reservation.CancelReservationResponse, error) {
+	request := reservation.NewCancelReservationRequest(reservationId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*reservation.CancelReservationRequest, reservation.CancelReservationResponse](ctx, s.cs, clientId, request)
+}
+
+// Installs a new certificate (chain), signed by the CA, on the charging station. This typically follows a SignCertificate message, initiated by the charging station.
+func (s *SyncCSMS) CertificateSigned(ctx context.Context, clientId string, certificateChain string, props ...func(request *security.CertificateSignedRequest)) (*security.CertificateSignedResponse, error) {
+	request := security.NewCertificateSignedRequest(certificateChain)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*security.CertificateSignedRequest, security.CertificateSignedResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charging station to change its availability to the desired operational status.
+func (s *SyncCSMS) ChangeAvailability(ctx context.Context, clientId string, operationalStatus availability.OperationalStatus, props ...func(request *availability.ChangeAvailabilityRequest)) (*availability.ChangeAvailabilityResponse, error) {
+	request := availability.NewChangeAvailabilityRequest(operationalStatus)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*availability.ChangeAvailabilityRequest, availability.ChangeAvailabilityResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charging station to clear its current authorization cache. All authorization saved locally will be invalidated.
+func (s *SyncCSMS) ClearCache(ctx context.Context, clientId string, props ...func(request *authorization.ClearCacheRequest)) (*authorization.ClearCacheResponse, error) {
+	request := authorization.NewClearCacheRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*authorization.ClearCacheRequest, authorization.ClearCacheResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charging station to clear some or all charging profiles, previously sent to the charging station.
+func (s *SyncCSMS) ClearChargingProfile(ctx context.Context, clientId string, props ...func(request *smartcharging.ClearChargingProfileRequest)) (*smartcharging.ClearChargingProfileResponse, error) {
+	request := smartcharging.NewClearChargingProfileRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*smartcharging.ClearChargingProfileRequest, smartcharging.ClearChargingProfileResponse](ctx, s.cs, clientId, request)
+}
+
+// Removes a specific display message, currently configured in a charging station.
+func (s *SyncCSMS) ClearDisplay(ctx context.Context, clientId string, id int, props ...func(request *display.ClearDisplayRequest)) (*display.ClearDisplayResponse, error) {
+	request := display.NewClearDisplayRequest(id)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*display.ClearDisplayRequest, display.ClearDisplayResponse](ctx, s.cs, clientId, request)
+}
+
+// Removes one or more monitoring settings from a charging station for the given variable IDs.
+func (s *SyncCSMS) ClearVariableMonitoring(ctx context.Context, clientId string, id []int, props ...func(request *diagnostics.ClearVariableMonitoringRequest)) (*diagnostics.ClearVariableMonitoringResponse, error) {
+	request := diagnostics.NewClearVariableMonitoringRequest(id)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*diagnostics.ClearVariableMonitoringRequest, diagnostics.ClearVariableMonitoringResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charging station to display the updated current total cost of an ongoing transaction.
+func (s *SyncCSMS) CostUpdated(ctx context.Context, clientId string, totalCost float64, transactionId string, props ...func(request *tariffcost.CostUpdatedRequest)) (*tariffcost.CostUpdatedResponse, error) {
+	request := tariffcost.NewCostUpdatedRequest(totalCost, transactionId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*tariffcost.CostUpdatedRequest, tariffcost.CostUpdatedResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charging station to send one or more reports, containing raw customer information.
+func (s *SyncCSMS) CustomerInformation(ctx context.Context, clientId string, requestId int, report bool, clear bool, props ...func(request *diagnostics.CustomerInformationRequest)) (*diagnostics.CustomerInformationResponse, error) {
+	request := diagnostics.NewCustomerInformationRequest(requestId, report, clear)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*diagnostics.CustomerInformationRequest, diagnostics.CustomerInformationResponse](ctx, s.cs, clientId, request)
+}
+
+// Performs a custom data transfer to a charging station. The message payload is not pre-defined and must be supported by the charging station. Every vendor may implement their own proprietary logic for this message.
+func (s *SyncCSMS) DataTransfer(ctx context.Context, clientId string, vendorId string, props ...func(request *data.DataTransferRequest)) (*data.DataTransferResponse, error) {
+	request := data.NewDataTransferRequest(vendorId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*data.DataTransferRequest, data.DataTransferResponse](ctx, s.cs, clientId, request)
+}
+
+// Deletes a previously installed certificate on a charging station.
+func (s *SyncCSMS) DeleteCertificate(ctx context.Context, clientId string, data types.CertificateHashData, props ...func(request *iso15118.DeleteCertificateRequest)) (*iso15118.DeleteCertificateResponse, error) {
+	request := iso15118.NewDeleteCertificateRequest(data)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*iso15118.DeleteCertificateRequest, iso15118.DeleteCertificateResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a report from a charging station. The charging station will asynchronously send the report in chunks using NotifyReportRequest messages.
+func (s *SyncCSMS) GetBaseReport(ctx context.Context, clientId string, requestId int, reportBase provisioning.ReportBaseType, props ...func(request *provisioning.GetBaseReportRequest)) (*provisioning.GetBaseReportResponse, error) {
+	request := provisioning.NewGetBaseReportRequest(requestId, reportBase)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*provisioning.GetBaseReportRequest, provisioning.GetBaseReportResponse](ctx, s.cs, clientId, request)
+}
+
+// Request a charging station to report some or all installed charging profiles. The charging station will report these asynchronously using ReportChargingProfiles messages.
+func (s *SyncCSMS) GetChargingProfiles(ctx context.Context, clientId string, chargingProfile smartcharging.ChargingProfileCriterion, props ...func(request *smartcharging.GetChargingProfilesRequest)) (*smartcharging.GetChargingProfilesResponse, error) {
+	request := smartcharging.NewGetChargingProfilesRequest(chargingProfile)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*smartcharging.GetChargingProfilesRequest, smartcharging.GetChargingProfilesResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a charging station to report the composite charging schedule for the indicated duration and evseID.
+func (s *SyncCSMS) GetCompositeSchedule(ctx context.Context, clientId string, duration int, evseId int, props ...func(request *smartcharging.GetCompositeScheduleRequest)) (*smartcharging.GetCompositeScheduleResponse, error) {
+	request := smartcharging.NewGetCompositeScheduleRequest(duration, evseId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*smartcharging.GetCompositeScheduleRequest, smartcharging.GetCompositeScheduleResponse](ctx, s.cs, clientId, request)
+}
+
+// Retrieves all messages currently configured on a charging station.
+func (s *SyncCSMS) GetDisplayMessages(ctx context.Context, clientId string, requestId int, props ...func(request *display.GetDisplayMessagesRequest)) (*display.GetDisplayMessagesResponse, error) {
+	request := display.NewGetDisplayMessagesRequest(requestId)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*display.GetDisplayMessagesRequest, display.GetDisplayMessagesResponse](ctx, s.cs, clientId, request)
+}
+
+// Retrieves all installed certificates on a charging station.
+func (s *SyncCSMS) GetInstalledCertificateIds(ctx context.Context, clientId string, props ...func(request *iso15118.GetInstalledCertificateIdsRequest)) (*iso15118.GetInstalledCertificateIdsResponse, error) {
+	request := iso15118.NewGetInstalledCertificateIdsRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*iso15118.GetInstalledCertificateIdsRequest, iso15118.GetInstalledCertificateIdsResponse](ctx, s.cs, clientId, request)
+}
+
+// Queries a charging station for version number of the Local Authorization List.
+func (s *SyncCSMS) GetLocalListVersion(ctx context.Context, clientId string, props ...func(request *localauth.GetLocalListVersionRequest)) (*localauth.GetLocalListVersionResponse, error) {
+	request := localauth.NewGetLocalListVersionRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*localauth.GetLocalListVersionRequest, localauth.GetLocalListVersionResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a charging station to upload a diagnostics or security logfile to the CSMS.
+func (s *SyncCSMS) GetLog(ctx context.Context, clientId string, logType diagnostics.LogType, requestID int, logParameters diagnostics.LogParameters, props ...func(request *diagnostics.GetLogRequest)) (*diagnostics.GetLogResponse, error) {
+	request := diagnostics.NewGetLogRequest(logType, requestID, logParameters)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*diagnostics.GetLogRequest, diagnostics.GetLogResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a report about configured monitoring settings per component and variable from a charging station. The reports will be uploaded asynchronously using NotifyMonitoringReport messages.
+func (s *SyncCSMS) GetMonitoringReport(ctx context.Context, clientId string, props ...func(request *diagnostics.GetMonitoringReportRequest)) (*diagnostics.GetMonitoringReportResponse, error) {
+	request := diagnostics.NewGetMonitoringReportRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*diagnostics.GetMonitoringReportRequest, diagnostics.GetMonitoringReportResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a custom report about configured monitoring settings per criteria, component and variable from a charging station. The reports will be uploaded asynchronously using NotifyMonitoringReport messages.
+func (s *SyncCSMS) GetReport(ctx context.Context, clientId string, props ...func(request *provisioning.GetReportRequest)) (*provisioning.GetReportResponse, error) {
+	request := provisioning.NewGetReportRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*provisioning.GetReportRequest, provisioning.GetReportResponse](ctx, s.cs, clientId, request)
+}
+
+// Asks a Charging Station whether it has transaction-related messages waiting to be delivered to the CSMS. When a transactionId is provided, only messages for a specific transaction are asked for.
+func (s *SyncCSMS) GetTransactionStatus(ctx context.Context, clientId string, props ...func(request *transactions.GetTransactionStatusRequest)) (*transactions.GetTransactionStatusResponse, error) {
+	request := transactions.NewGetTransactionStatusRequest()
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*transactions.GetTransactionStatusRequest, transactions.GetTransactionStatusResponse](ctx, s.cs, clientId, request)
+}
+
+// Retrieves from a Charging Station the value of an attribute for one or more Variable of one or more Components.
+func (s *SyncCSMS) GetVariables(ctx context.Context, clientId string, variableData []provisioning.GetVariableData, props ...func(request *provisioning.GetVariablesRequest)) (*provisioning.GetVariablesResponse, error) {
+	request := provisioning.NewGetVariablesRequest(variableData)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*provisioning.GetVariablesRequest, provisioning.GetVariablesResponse](ctx, s.cs, clientId, request)
+}
+
+// Installs a new CA certificate on a Charging station.
+func (s *SyncCSMS) InstallCertificate(ctx context.Context, clientId string, certificateType types.CertificateUse, certificate string, props ...func(request *iso15118.InstallCertificateRequest)) (*iso15118.InstallCertificateResponse, error) {
+	request := iso15118.NewInstallCertificateRequest(certificateType, certificate)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*iso15118.InstallCertificateRequest, iso15118.InstallCertificateResponse](ctx, s.cs, clientId, request)
+}
+
+// Publishes a firmware to a local controller, allowing charging stations to download the same firmware from the local controller directly.
+func (s *SyncCSMS) PublishFirmware(ctx context.Context, clientId string, location string, checksum string, requestID int, props ...func(request *firmware.PublishFirmwareRequest)) (*firmware.PublishFirmwareResponse, error) {
+	request := firmware.NewPublishFirmwareRequest(location, checksum, requestID)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*firmware.PublishFirmwareRequest, firmware.PublishFirmwareResponse](ctx, s.cs, clientId, request)
+}
+
+// Remotely triggers a transaction to be started on a charging station.
+func (s *SyncCSMS) RequestStartTransaction(ctx context.Context, clientId string, remoteStartID int, IdToken types.IdToken, props ...func(request *remotecontrol.RequestStartTransactionRequest)) (*remotecontrol.RequestStartTransactionResponse, error) {
+	request := remotecontrol.NewRequestStartTransactionRequest(remoteStartID, IdToken)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*remotecontrol.RequestStartTransactionRequest, remotecontrol.RequestStartTransactionResponse](ctx, s.cs, clientId, request)
+}
+
+// Remotely triggers an ongoing transaction to be stopped on a charging station.
+func (s *SyncCSMS) RequestStopTransaction(ctx context.Context, clientId string, transactionID string, props ...func(request *remotecontrol.RequestStopTransactionRequest)) (*remotecontrol.RequestStopTransactionResponse, error) {
+	request := remotecontrol.NewRequestStopTransactionRequest(transactionID)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*remotecontrol.RequestStopTransactionRequest, remotecontrol.RequestStopTransactionResponse](ctx, s.cs, clientId, request)
+}
+
+// Attempts to reserve a connector for an EV, on a specific charging station.
+func (s *SyncCSMS) ReserveNow(ctx context.Context, clientId string, id int, expiryDateTime *types.DateTime, idToken types.IdToken, props ...func(request *reservation.ReserveNowRequest)) (*reservation.ReserveNowResponse, error) {
+	request := reservation.NewReserveNowRequest(id, expiryDateTime, idToken)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*reservation.ReserveNowRequest, reservation.ReserveNowResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs the Charging Station to reset itself.
+func (s *SyncCSMS) Reset(ctx context.Context, clientId string, t provisioning.ResetType, props ...func(request *provisioning.ResetRequest)) (*provisioning.ResetResponse, error) {
+	request := provisioning.NewResetRequest(t)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*provisioning.ResetRequest, provisioning.ResetResponse](ctx, s.cs, clientId, request)
+}
+
+// Sends a local authorization list to a charging station, which can be used for the authorization of idTokens.
+func (s *SyncCSMS) SendLocalList(ctx context.Context, clientId string, version int, updateType localauth.UpdateType, props ...func(request *localauth.SendLocalListRequest)) (*localauth.SendLocalListResponse, error) {
+	request := localauth.NewSendLocalListRequest(version, updateType)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*localauth.SendLocalListRequest, localauth.SendLocalListResponse](ctx, s.cs, clientId, request)
+}
+
+// Sends a charging profile to a charging station, to influence the power/current drawn by EVs.
+func (s *SyncCSMS) SetChargingProfile(ctx context.Context, clientId string, evseID int, chargingProfile *types.ChargingProfile, props ...func(request *smartcharging.SetChargingProfileRequest)) (*smartcharging.SetChargingProfileResponse, error) {
+	request := smartcharging.NewSetChargingProfileRequest(evseID, chargingProfile)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*smartcharging.SetChargingProfileRequest, smartcharging.SetChargingProfileResponse](ctx, s.cs, clientId, request)
+}
+
+// Asks a charging station to configure a new display message, that should be displayed (in the future).
+func (s *SyncCSMS) SetDisplayMessage(ctx context.Context, clientId string, message display.MessageInfo, props ...func(request *display.SetDisplayMessageRequest)) (*display.SetDisplayMessageResponse, error) {
+	request := display.NewSetDisplayMessageRequest(message)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*display.SetDisplayMessageRequest, display.SetDisplayMessageResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a charging station to activate a set of preconfigured monitoring settings, as denoted by the value of MonitoringBase.
+func (s *SyncCSMS) SetMonitoringBase(ctx context.Context, clientId string, monitoringBase diagnostics.MonitoringBase, props ...func(request *diagnostics.SetMonitoringBaseRequest)) (*diagnostics.SetMonitoringBaseResponse, error) {
+	request := diagnostics.NewSetMonitoringBaseRequest(monitoringBase)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*diagnostics.SetMonitoringBaseRequest, diagnostics.SetMonitoringBaseResponse](ctx, s.cs, clientId, request)
+}
+
+// Restricts a Charging Station to reporting only monitoring events with a severity number lower than or equal to a certain severity.
+func (s *SyncCSMS) SetMonitoringLevel(ctx context.Context, clientId string, severity int, props ...func(request *diagnostics.SetMonitoringLevelRequest)) (*diagnostics.SetMonitoringLevelResponse, error) {
+	request := diagnostics.NewSetMonitoringLevelRequest(severity)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*diagnostics.SetMonitoringLevelRequest, diagnostics.SetMonitoringLevelResponse](ctx, s.cs, clientId, request)
+}
+
+// Updates the connection details on a Charging Station.
+func (s *SyncCSMS) SetNetworkProfile(ctx context.Context, clientId string, configurationSlot int, connectionData provisioning.NetworkConnectionProfile, props ...func(request *provisioning.SetNetworkProfileRequest)) (*provisioning.SetNetworkProfileResponse, error) {
+	request := provisioning.NewSetNetworkProfileRequest(configurationSlot, connectionData)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*provisioning.SetNetworkProfileRequest, provisioning.SetNetworkProfileResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a Charging Station to set monitoring triggers on variables.
+func (s *SyncCSMS) SetVariableMonitoring(ctx context.Context, clientId string, data []diagnostics.SetMonitoringData, props ...func(request *diagnostics.SetVariableMonitoringRequest)) (*diagnostics.SetVariableMonitoringResponse, error) {
+	request := diagnostics.NewSetVariableMonitoringRequest(data)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*diagnostics.SetVariableMonitoringRequest, diagnostics.SetVariableMonitoringResponse](ctx, s.cs, clientId, request)
+}
+
+// Configures/changes the values of a set of variables on a charging station.
+func (s *SyncCSMS) SetVariables(ctx context.Context, clientId string, data []provisioning.SetVariableData, props ...func(request *provisioning.SetVariablesRequest)) (*provisioning.SetVariablesResponse, error) {
+	request := provisioning.NewSetVariablesRequest(data)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*provisioning.SetVariablesRequest, provisioning.SetVariablesResponse](ctx, s.cs, clientId, request)
+}
+
+// Requests a Charging Station to send a charging station-initiated message.
+func (s *SyncCSMS) TriggerMessage(ctx context.Context, clientId string, requestedMessage remotecontrol.MessageTrigger, props ...func(request *remotecontrol.TriggerMessageRequest)) (*remotecontrol.TriggerMessageResponse, error) {
+	request := remotecontrol.NewTriggerMessageRequest(requestedMessage)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*remotecontrol.TriggerMessageRequest, remotecontrol.TriggerMessageResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs the Charging Station to unlock a connector, to help out an EV-driver.
+func (s *SyncCSMS) UnlockConnector(ctx context.Context, clientId string, evseID int, connectorID int, props ...func(request *remotecontrol.UnlockConnectorRequest)) (*remotecontrol.UnlockConnectorResponse, error) {
+	request := remotecontrol.NewUnlockConnectorRequest(evseID, connectorID)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*remotecontrol.UnlockConnectorRequest, remotecontrol.UnlockConnectorResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a Local Controller to stops serving a firmware update to connected Charging Stations.
+func (s *SyncCSMS) UnpublishFirmware(ctx context.Context, clientId string, checksum string, props ...func(request *firmware.UnpublishFirmwareRequest)) (*firmware.UnpublishFirmwareResponse, error) {
+	request := firmware.NewUnpublishFirmwareRequest(checksum)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*firmware.UnpublishFirmwareRequest, firmware.UnpublishFirmwareResponse](ctx, s.cs, clientId, request)
+}
+
+// Instructs a Charging Station to download and install a firmware update.
+func (s *SyncCSMS) UpdateFirmware(ctx context.Context, clientId string, requestID int, f firmware.Firmware, props ...func(request *firmware.UpdateFirmwareRequest)) (*firmware.UpdateFirmwareResponse, error) {
+	request := firmware.NewUpdateFirmwareRequest(requestID, f)
+	for _, fn := range props {
+		fn(request)
+	}
+	return Call[*firmware.UpdateFirmwareRequest, firmware.UpdateFirmwareResponse](ctx, s.cs, clientId, request)
+}
@@ -2,9 +2,12 @@
 package ocpp2
 
 import (
+	"context"
 	"crypto/tls"
 	"net"
+	"net/http"
 
+	"github.com/xBlaz3kx/ocpp-go/bulk"
 	"github.com/xBlaz3kx/ocpp-go/internal/callback"
 	"github.com/xBlaz3kx/ocpp-go/logging"
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
@@ -113,6 +116,35 @@ type ChargingStation interface {
 	StatusNotification(timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error)
 	// Sends information to the CSMS about a transaction, used for billing purposes.
 	TransactionEvent(t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error)
+
+	// Context-aware variants of the messages above.
+	// If ctx is done before a response is received, the request is dropped from the outgoing queue
+	// and ctx.Err() is returned. Refer to SendRequestCtx for details.
+	BootNotificationCtx(ctx context.Context, reason provisioning.BootReason, model string, chargePointVendor string, props ...func(request *provisioning.BootNotificationRequest)) (*provisioning.BootNotificationResponse, error)
+	AuthorizeCtx(ctx context.Context, idToken string, tokenType types.IdTokenType, props ...func(request *authorization.AuthorizeRequest)) (*authorization.AuthorizeResponse, error)
+	ClearedChargingLimitCtx(ctx context.Context, chargingLimitSource types.ChargingLimitSourceType, props ...func(request *smartcharging.ClearedChargingLimitRequest)) (*smartcharging.ClearedChargingLimitResponse, error)
+	DataTransferCtx(ctx context.Context, vendorId string, props ...func(request *data.DataTransferRequest)) (*data.DataTransferResponse, error)
+	FirmwareStatusNotificationCtx(ctx context.Context, status firmware.FirmwareStatus, props ...func(request *firmware.FirmwareStatusNotificationRequest)) (*firmware.FirmwareStatusNotificationResponse, error)
+	Get15118EVCertificateCtx(ctx context.Context, schemaVersion string, action iso15118.CertificateAction, exiRequest string, props ...func(request *iso15118.Get15118EVCertificateRequest)) (*iso15118.Get15118EVCertificateResponse, error)
+	GetCertificateStatusCtx(ctx context.Context, ocspRequestData types.OCSPRequestDataType, props ...func(request *iso15118.GetCertificateStatusRequest)) (*iso15118.GetCertificateStatusResponse, error)
+	HeartbeatCtx(ctx context.Context, props ...func(request *availability.HeartbeatRequest)) (*availability.HeartbeatResponse, error)
+	LogStatusNotificationCtx(ctx context.Context, status diagnostics.UploadLogStatus, requestID int, props ...func(request *diagnostics.LogStatusNotificationRequest)) (*diagnostics.LogStatusNotificationResponse, error)
+	MeterValuesCtx(ctx context.Context, evseID int, meterValues []types.MeterValue, props ...func(request *meter.MeterValuesRequest)) (*meter.MeterValuesResponse, error)
+	NotifyChargingLimitCtx(ctx context.Context, chargingLimit smartcharging.ChargingLimit, props ...func(request *smartcharging.NotifyChargingLimitRequest)) (*smartcharging.NotifyChargingLimitResponse, error)
+	NotifyCustomerInformationCtx(ctx context.Context, data string, seqNo int, generatedAt types.DateTime, requestID int, props ...func(request *diagnostics.NotifyCustomerInformationRequest)) (*diagnostics.NotifyCustomerInformationResponse, error)
+	NotifyDisplayMessagesCtx(ctx context.Context, requestID int, props ...func(request *display.NotifyDisplayMessagesRequest)) (*display.NotifyDisplayMessagesResponse, error)
+	NotifyEVChargingNeedsCtx(ctx context.Context, evseID int, chargingNeeds smartcharging.ChargingNeeds, props ...func(request *smartcharging.NotifyEVChargingNeedsRequest)) (*smartcharging.NotifyEVChargingNeedsResponse, error)
+	NotifyEVChargingScheduleCtx(ctx context.Context, timeBase *types.DateTime, evseID int, schedule types.ChargingSchedule, props ...func(request *smartcharging.NotifyEVChargingScheduleRequest)) (*smartcharging.NotifyEVChargingScheduleResponse, error)
+	NotifyEventCtx(ctx context.Context, generatedAt *types.DateTime, seqNo int, eventData []diagnostics.EventData, props ...func(request *diagnostics.NotifyEventRequest)) (*diagnostics.NotifyEventResponse, error)
+	NotifyMonitoringReportCtx(ctx context.Context, requestID int, seqNo int, generatedAt *types.DateTime, monitorData []diagnostics.MonitoringData, props ...func(request *diagnostics.NotifyMonitoringReportRequest)) (*diagnostics.NotifyMonitoringReportResponse, error)
+	NotifyReportCtx(ctx context.Context, requestID int, generatedAt *types.DateTime, seqNo int, props ...func(request *provisioning.NotifyReportRequest)) (*provisioning.NotifyReportResponse, error)
+	PublishFirmwareStatusNotificationCtx(ctx context.Context, status firmware.PublishFirmwareStatus, props ...func(request *firmware.PublishFirmwareStatusNotificationRequest)) (*firmware.PublishFirmwareStatusNotificationResponse, error)
+	ReportChargingProfilesCtx(ctx context.Context, requestID int, chargingLimitSource types.ChargingLimitSourceType, evseID int, chargingProfile []types.ChargingProfile, props ...func(request *smartcharging.ReportChargingProfilesRequest)) (*smartcharging.ReportChargingProfilesResponse, error)
+	ReservationStatusUpdateCtx(ctx context.Context, reservationID int, status reservation.ReservationUpdateStatus, props ...func(request *reservation.ReservationStatusUpdateRequest)) (*reservation.ReservationStatusUpdateResponse, error)
+	SecurityEventNotificationCtx(ctx context.Context, typ string, timestamp *types.DateTime, props ...func(request *security.SecurityEventNotificationRequest)) (*security.SecurityEventNotificationResponse, error)
+	SignCertificateCtx(ctx context.Context, csr string, props ...func(request *security.SignCertificateRequest)) (*security.SignCertificateResponse, error)
+	StatusNotificationCtx(ctx context.Context, timestamp *types.DateTime, status availability.ConnectorStatus, evseID int, connectorID int, props ...func(request *availability.StatusNotificationRequest)) (*availability.StatusNotificationResponse, error)
+	TransactionEventCtx(ctx context.Context, t transactions.TransactionEvent, timestamp *types.DateTime, reason transactions.TriggerReason, seqNo int, info transactions.Transaction, props ...func(request *transactions.TransactionEventRequest)) (*transactions.TransactionEventResponse, error)
 	// Registers a handler for incoming security profile messages
 	SetSecurityHandler(handler security.ChargingStationHandler)
 	// Registers a handler for incoming provisioning profile messages
@@ -157,6 +189,19 @@ type ChargingStation interface {
 	//
 	// In case of network issues (i.e. the remote host couldn't be reached), the function returns an error directly. In this case, the callback is never invoked.
 	SendRequestAsync(request ocpp.Request, callback func(confirmation ocpp.Response, protoError error)) error
+	// Sends a request to the CSMS, bound to the given context.
+	// If ctx is done before a response is received, the request is removed from the outgoing queue
+	// (or its pending slot is released, if it was already sent) and ctx.Err() is returned.
+	// A late response to the request is discarded.
+	//
+	// The request is synchronous blocking.
+	SendRequestCtx(ctx context.Context, request ocpp.Request) (ocpp.Response, error)
+	// Sends an asynchronous request to the CSMS, bound to the given context.
+	// If ctx is done before a response is received, the request is removed from the outgoing queue
+	// and the callback is invoked with ctx.Err().
+	//
+	// If ctx is already done, ctx.Err() is returned directly. In this case, the callback is never invoked.
+	SendRequestAsyncCtx(ctx context.Context, request ocpp.Request, callback func(confirmation ocpp.Response, protoError error)) error
 	// Connects to the CSMS and starts the charging station routine.
 	// The function doesn't block and returns right away, after having attempted to open a connection to the CSMS.
 	// If the connection couldn't be opened, an error is returned.
@@ -172,6 +217,19 @@ type ChargingStation interface {
 	//
 	// Optional client options must be set before calling this function. Refer to NewChargingStation.
 	StartWithRetries(csmsUrl string)
+	// Connects to the first reachable CSMS out of an ordered list of endpoints, e.g. built from the
+	// NetworkConnectionProfiles of the charging station, sorted by OCPPInterface priority.
+	// The URL of each endpoint is the CSMS URL, to which the charging station ID is appended, just like in Start.
+	//
+	// After ConnectionAttempts failed attempts (see NetworkProfileConnectionAttempts), the charging station
+	// falls back to the next endpoint. The same applies to automatic re-connections.
+	// The function returns only when the connection has been established.
+	//
+	// Optional client options must be set before calling this function. Refer to NewChargingStation.
+	StartWithEndpoints(endpoints []ws.Endpoint)
+	// Registers a handler, which is invoked whenever a connection to one of the endpoints passed to StartWithEndpoints
+	// was established. The handler receives the endpoint along with its index.
+	SetActiveEndpointHandler(handler func(endpoint ws.Endpoint, index int))
 	// Stops the charging station routine, disconnecting it from the CSMS.
 	// Any pending requests are discarded.
 	Stop()
@@ -251,6 +309,8 @@ func NewChargingStation(id string, endpoint *ocppj.Client, client ws.Client, log
 
 	// Callback invoked by dispatcher, whenever a queued request is canceled, due to timeout.
 	endpoint.SetOnRequestCanceled(cs.onRequestTimeout)
+	// Message IDs of requests awaiting a callback must not be reused
+	endpoint.SetMessageIdInUseHandler(cs.callbacks.IsRegistered)
 
 	cs.client.SetResponseHandler(func(confirmation ocpp.Response, requestId string) {
 		cs.responseChan <- responseWithID{response: confirmation, requestID: requestId}
@@ -290,6 +350,7 @@ func NewChargingStation(id string, endpoint *ocppj.Client, client ws.Client, log
 //	clearDisplayConf, err := csms.ClearDisplay("cs0001", callback, 10)
 //
 // All messages are sent asynchronously and do not block the caller.
+// For blocking variants returning the typed response directly, see SyncCSMS and Call.
 type CSMS interface {
 	// Cancel a pending reservation, provided the reservationId, on a charging station.
 	CancelReservation(clientId string, callback func(*reservation.CancelReservationResponse, error), reservationId int, props ...func(*reservation.CancelReservationRequest)) error
@@ -415,13 +476,44 @@ type CSMS interface {
 	// This result is propagated via a callback, called asynchronously.
 	// In case of network issues (i.e. the remote host couldn't be reached), the function returns an error directly. In this case, the callback is never invoked.
 	SendRequestAsync(clientId string, request ocpp.Request, callback func(ocpp.Response, error)) error
+	// Sends an asynchronous request to a Charging Station, bound to the given context.
+	// If ctx is done before a response is received, the request is removed from the client's outgoing queue
+	// (or its pending slot is released, if it was already sent) and the callback is invoked with ctx.Err().
+	// A late response to the request is discarded.
+	//
+	// If ctx is already done, ctx.Err() is returned directly. In this case, the callback is never invoked.
+	SendRequestAsyncCtx(ctx context.Context, clientId string, request ocpp.Request, callback func(ocpp.Response, error)) error
+	// Sends a request created by factory to all targets concurrently, e.g. to change the configuration of many charging stations at once.
+	// Targets are either a list of client IDs (see bulk.ClientIDs), or the connected charging stations matching a selector (see bulk.Connected).
+	//
+	// The function blocks until all requests completed, and returns a report of accepted, rejected, errored, timed out
+	// and offline targets. Concurrency, per-target timeouts and streaming of results are configured via opts.
+	SendBulkRequest(ctx context.Context, targets bulk.Targets, factory bulk.RequestFactory, opts ...bulk.Option) bulk.Report
 	// Starts running the CSMS on the specified port and URL.
 	// The central system runs as a daemon and handles incoming charge point connections and messages.
 
 	// The function blocks forever, so it is suggested to wrap it in a goroutine, in case other functionality needs to be executed on the main program thread.
 	Start(listenPort int, listenPath string)
+	// Serve is like Start, but accepts incoming charge point connections on the given listener,
+	// e.g. a Unix socket or a systemd-activated listener.
+	//
+	// The function blocks until the CSMS is stopped. It returns nil if it was stopped via Stop or Shutdown,
+	// or the error that caused the websocket server to fail otherwise.
+	Serve(listener net.Listener, listenPath string) error
+	// Handler starts the CSMS without listening for connections on its own, and returns the websocket upgrade handler.
+	//
+	// The handler may be mounted on an existing HTTP server or router, on one or more paths.
+	// Call Stop or Shutdown to close all charge point connections, once the handler is not needed anymore.
+	// An error is returned, if the websocket server doesn't implement http.Handler.
+	Handler() (http.Handler, error)
 	// Stops the CSMS, clearing all pending requests.
 	Stop()
+	// Shutdown gracefully shuts down the CSMS, allowing ongoing message exchanges to complete.
+	//
+	// New connections and outgoing requests are rejected right away. Once all pending requests completed and all incoming
+	// requests were answered, or ctx is done, all connections are closed, so clients may reconnect to another instance.
+	// The returned report contains the outcome for every connected client. See ocppj.Server.Shutdown for details.
+	Shutdown(ctx context.Context) (ocppj.ShutdownReport, error)
 	// Errors returns a channel for error messages. If it doesn't exist it es created.
 	Errors() <-chan error
 }
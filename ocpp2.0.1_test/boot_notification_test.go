@@ -1,6 +1,7 @@
 package ocpp2_test
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -82,6 +83,26 @@ func (suite *OcppV2TestSuite) TestBootNotificationE2EMocked() {
 	assertDateTimeEquality(suite, currentTime, confirmation.CurrentTime)
 }
 
+func (suite *OcppV2TestSuite) TestBootNotificationCtxCanceled() {
+	wsId := "test_id"
+	wsUrl := "someUrl"
+	channel := NewMockWebSocket(wsId)
+	// The CSMS never receives the request, hence never responds
+	setupDefaultCSMSHandlers(suite, expectedCSMSOptions{clientId: wsId, forwardWrittenMessage: false})
+	setupDefaultChargingStationHandlers(suite, expectedChargingStationOptions{serverUrl: wsUrl, clientId: wsId, createChannelOnStart: true, channel: channel, forwardWrittenMessage: false})
+	// Run test
+	suite.csms.Start(8887, "somePath")
+	err := suite.chargingStation.Start(wsUrl)
+	suite.Require().Nil(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	confirmation, err := suite.chargingStation.BootNotificationCtx(ctx, provisioning.BootReasonPowerUp, "model1", "ABL")
+	suite.Require().ErrorIs(err, context.DeadlineExceeded)
+	suite.Nil(confirmation)
+	// The pending slot was released
+	suite.False(suite.ocppjClient.RequestState.HasPendingRequest())
+}
+
 func (suite *OcppV2TestSuite) TestBootNotificationInvalidEndpoint() {
 	messageId := defaultMessageId
 	chargePointModel := "model1"
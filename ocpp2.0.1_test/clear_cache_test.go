@@ -1,8 +1,11 @@
 package ocpp2_test
 
 import (
+	"context"
 	"fmt"
+	"time"
 
+	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1"
 	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/authorization"
 	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/types"
 
@@ -66,3 +69,52 @@ func (suite *OcppV2TestSuite) TestClearCacheInvalidEndpoint() {
 	requestJson := fmt.Sprintf(`[2,"%v","%v",{}]`, messageId, authorization.ClearCacheFeatureName)
 	testUnsupportedRequestFromChargingStation(suite, clearCacheRequest, requestJson, messageId)
 }
+
+func (suite *OcppV2TestSuite) TestClearCacheSyncE2EMocked() {
+	wsId := "test_id"
+	messageId := defaultMessageId
+	wsUrl := "someUrl"
+	status := authorization.ClearCacheStatusAccepted
+	requestJson := fmt.Sprintf(`[2,"%v","%v",{}]`, messageId, authorization.ClearCacheFeatureName)
+	responseJson := fmt.Sprintf(`[3,"%v",{"status":"%v"}]`, messageId, status)
+	channel := NewMockWebSocket(wsId)
+
+	handler := &MockChargingStationAuthorizationHandler{}
+	handler.On("OnClearCache", mock.Anything).Return(authorization.NewClearCacheResponse(status), nil)
+	setupDefaultCSMSHandlers(suite, expectedCSMSOptions{clientId: wsId, rawWrittenMessage: []byte(requestJson), forwardWrittenMessage: true})
+	setupDefaultChargingStationHandlers(suite, expectedChargingStationOptions{serverUrl: wsUrl, clientId: wsId, createChannelOnStart: true, channel: channel, rawWrittenMessage: []byte(responseJson), forwardWrittenMessage: true}, handler)
+	// Run Test
+	suite.csms.Start(8887, "somePath")
+	err := suite.chargingStation.Start(wsUrl)
+	suite.Require().Nil(err)
+	response, err := ocpp2.NewSyncCSMS(suite.csms).ClearCache(context.Background(), wsId)
+	suite.Require().Nil(err)
+	suite.Require().NotNil(response)
+	suite.Equal(status, response.Status)
+	// Same request via the generic helper
+	response, err = ocpp2.Call[*authorization.ClearCacheRequest, authorization.ClearCacheResponse](context.Background(), suite.csms, wsId, authorization.NewClearCacheRequest())
+	suite.Require().Nil(err)
+	suite.Require().NotNil(response)
+	suite.Equal(status, response.Status)
+}
+
+func (suite *OcppV2TestSuite) TestClearCacheSyncCanceled() {
+	wsId := "test_id"
+	messageId := defaultMessageId
+	wsUrl := "someUrl"
+	requestJson := fmt.Sprintf(`[2,"%v","%v",{}]`, messageId, authorization.ClearCacheFeatureName)
+	channel := NewMockWebSocket(wsId)
+
+	// The request never reaches the charging station, so no response is received
+	setupDefaultCSMSHandlers(suite, expectedCSMSOptions{clientId: wsId, rawWrittenMessage: []byte(requestJson), forwardWrittenMessage: false})
+	setupDefaultChargingStationHandlers(suite, expectedChargingStationOptions{serverUrl: wsUrl, clientId: wsId, createChannelOnStart: true, channel: channel})
+	// Run Test
+	suite.csms.Start(8887, "somePath")
+	err := suite.chargingStation.Start(wsUrl)
+	suite.Require().Nil(err)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	response, err := ocpp2.NewSyncCSMS(suite.csms).ClearCache(ctx, wsId)
+	suite.Nil(response)
+	suite.ErrorIs(err, context.DeadlineExceeded)
+}
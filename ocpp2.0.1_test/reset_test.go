@@ -1,10 +1,13 @@
 package ocpp2_test
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/provisioning"
 	"github.com/xBlaz3kx/ocpp-go/ocpp2.0.1/types"
 )
@@ -79,6 +82,36 @@ func (suite *OcppV2TestSuite) TestResetE2EMocked() {
 	suite.True(result)
 }
 
+func (suite *OcppV2TestSuite) TestResetCtxCanceled() {
+	wsId := "test_id"
+	wsUrl := "someUrl"
+	channel := NewMockWebSocket(wsId)
+	// The charging station never receives the request, hence never responds
+	setupDefaultCSMSHandlers(suite, expectedCSMSOptions{clientId: wsId, forwardWrittenMessage: false})
+	setupDefaultChargingStationHandlers(suite, expectedChargingStationOptions{serverUrl: wsUrl, clientId: wsId, createChannelOnStart: true, channel: channel, forwardWrittenMessage: false})
+	// Run Test
+	suite.csms.Start(8887, "somePath")
+	err := suite.chargingStation.Start(wsUrl)
+	suite.Require().Nil(err)
+	ctx, cancel := context.WithCancel(context.Background())
+	resultChannel := make(chan error, 1)
+	err = suite.csms.SendRequestAsyncCtx(ctx, wsId, provisioning.NewResetRequest(provisioning.ResetTypeImmediate), func(response ocpp.Response, err error) {
+		suite.Nil(response)
+		resultChannel <- err
+	})
+	suite.Require().Nil(err)
+	time.Sleep(100 * time.Millisecond)
+	suite.Require().True(suite.ocppjServer.RequestState.HasPendingRequest(wsId))
+	cancel()
+	select {
+	case err = <-resultChannel:
+		suite.ErrorIs(err, context.Canceled)
+	case <-time.After(time.Second):
+		suite.Fail("callback wasn't invoked")
+	}
+	suite.False(suite.ocppjServer.RequestState.HasPendingRequest(wsId))
+}
+
 func (suite *OcppV2TestSuite) TestResetInvalidEndpoint() {
 	messageId := defaultMessageId
 	resetType := provisioning.ResetTypeImmediate
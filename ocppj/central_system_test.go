@@ -1,14 +1,22 @@
 package ocppj_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"slices"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ocppj"
@@ -497,6 +505,737 @@ func (suite *OcppJTestSuite) TestCentralSystemErrorHandler() {
 	suite.Assert().Nil(err)
 }
 
+func (suite *OcppJTestSuite) TestCentralSystemMiddleware() {
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"buggyValue"}]`, mockUniqueId, MockFeatureName)
+	var calls []string
+	record := func(name string) ocppj.Middleware {
+		return func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+			return func(msg *ocppj.MessageContext) *ocpp.Error {
+				calls = append(calls, fmt.Sprintf("%v %v %v", name, msg.Direction, msg.MessageType))
+				suite.Assert().Equal(mockChargePointId, msg.ClientID)
+				suite.Assert().Equal(mockUniqueId, msg.UniqueID)
+				suite.Assert().Equal(MockFeatureName, msg.Action)
+				suite.Assert().NotEmpty(msg.Raw)
+				err := next(msg)
+				calls = append(calls, fmt.Sprintf("%v done", name))
+				return err
+			}
+		}
+	}
+	// Rewrite payload of buggy firmware
+	rewrite := func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(msg *ocppj.MessageContext) *ocpp.Error {
+			if request, ok := msg.Payload.(*MockRequest); ok && request.MockValue == "buggyValue" {
+				msg.Payload = newMockRequest("fixedValue")
+			}
+			return next(msg)
+		}
+	}
+	suite.centralSystem.Use(record("first"), record("second"), rewrite)
+	suite.centralSystem.SetRequestHandler(func(chargePoint ws.Channel, request ocpp.Request, requestId string, action string) {
+		suite.Assert().Equal("fixedValue", request.(*MockRequest).MockValue)
+		calls = append(calls, "handler")
+	})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "somePath")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	channel := NewMockWebSocket(mockChargePointId)
+	err := suite.mockServer.MessageHandler(channel, []byte(mockRequest))
+	suite.Require().Nil(err)
+	suite.Assert().Equal([]string{"first inbound 2", "second inbound 2", "second done", "first done", "handler"}, calls)
+	// Outbound messages pass through the chain as well
+	calls = nil
+	err = suite.centralSystem.SendResponse(mockChargePointId, mockUniqueId, newMockConfirmation("someValue"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"first outbound 3", "second outbound 3", "second done", "first done"}, calls)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemMiddlewareShortCircuit() {
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)
+	expectedError := fmt.Sprintf(`[4,"%v","%v","%v",{}]`, mockUniqueId, ocppj.SecurityError, "not authorized")
+	reject := func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(msg *ocppj.MessageContext) *ocpp.Error {
+			if msg.Direction == ocppj.Inbound || msg.MessageType == ocppj.CALL {
+				return ocpp.NewError(ocppj.SecurityError, "not authorized", "")
+			}
+			return next(msg)
+		}
+	}
+	suite.centralSystem.Use(reject)
+	suite.centralSystem.SetRequestHandler(func(chargePoint ws.Channel, request ocpp.Request, requestId string, action string) {
+		suite.Fail("request handler shouldn't be invoked")
+	})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	writeHook := suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		suite.Assert().Equal(expectedError, string(args.Get(1).([]byte)))
+	})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	channel := NewMockWebSocket(mockChargePointId)
+	// Rejected incoming request is answered with an error
+	err := suite.mockServer.MessageHandler(channel, []byte(mockRequest))
+	suite.Require().Error(err)
+	suite.mockServer.AssertNumberOfCalls(suite.T(), "Write", 1)
+	// Rejected outgoing request is never sent
+	_, err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("someValue"))
+	ocppErr, ok := err.(*ocpp.Error)
+	suite.Require().True(ok)
+	suite.Assert().Equal(ocppj.SecurityError, ocppErr.Code)
+	suite.Assert().False(suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+	suite.mockServer.AssertNumberOfCalls(suite.T(), "Write", 1)
+	// Rejected incoming response completes the request with an error
+	writeHook.Run(nil)
+	var handledErr *ocpp.Error
+	suite.centralSystem.SetResponseHandler(func(chargePoint ws.Channel, response ocpp.Response, requestId string) {
+		suite.Fail("response handler shouldn't be invoked")
+	})
+	suite.centralSystem.SetErrorHandler(func(chargePoint ws.Channel, err *ocpp.Error, details interface{}) {
+		handledErr = err
+	})
+	addMockPendingRequest(suite, newMockRequest("someValue"), mockUniqueId, mockChargePointId)
+	err = suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, mockUniqueId)))
+	suite.Require().NoError(err)
+	suite.Require().NotNil(handledErr)
+	suite.Assert().Equal(ocppj.SecurityError, handledErr.Code)
+	suite.Assert().Equal(mockUniqueId, handledErr.MessageId)
+	suite.Assert().False(suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemMiddlewareRawRewrite() {
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	// Value exceeds the maximum length and would fail validation
+	mockRequest := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someTooLongValue"}]`, mockUniqueId, MockFeatureName)
+	var pendingOnResponse []bool
+	rewrite := func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(msg *ocppj.MessageContext) *ocpp.Error {
+			switch msg.MessageType {
+			case ocppj.CALL:
+				suite.Assert().Nil(msg.Payload)
+				suite.Assert().Equal(MockFeatureName, msg.Action)
+				msg.Raw = bytes.Replace(msg.Raw, []byte("someTooLongValue"), []byte("fixedValue"), 1)
+			case ocppj.CALL_RESULT:
+				// Response passes through the chain before the request is completed
+				pendingOnResponse = append(pendingOnResponse, suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+			}
+			return next(msg)
+		}
+	}
+	suite.centralSystem.Use(rewrite)
+	var handledRequest *MockRequest
+	suite.centralSystem.SetRequestHandler(func(chargePoint ws.Channel, request ocpp.Request, requestId string, action string) {
+		handledRequest = request.(*MockRequest)
+	})
+	suite.centralSystem.SetResponseHandler(func(chargePoint ws.Channel, response ocpp.Response, requestId string) {})
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "somePath")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	channel := NewMockWebSocket(mockChargePointId)
+	// Rewritten request is parsed again and passed to the handler
+	err := suite.mockServer.MessageHandler(channel, []byte(mockRequest))
+	suite.Require().NoError(err)
+	suite.Require().NotNil(handledRequest)
+	suite.Assert().Equal("fixedValue", handledRequest.MockValue)
+	suite.mockServer.AssertNotCalled(suite.T(), "Write", mockChargePointId, mock.Anything)
+	// Response passes through the chain before the request is completed
+	addMockPendingRequest(suite, newMockRequest("someValue"), mockUniqueId, mockChargePointId)
+	err = suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, mockUniqueId)))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]bool{true}, pendingOnResponse)
+	suite.Assert().False(suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemTracing() {
+	mockChargePointId := "1234"
+	provider, exporter := newTestTracerProvider()
+	suite.centralSystem.SetTracerProvider(provider)
+	channel := MockTracedWebSocket{MockWebSocket: NewMockWebSocket(mockChargePointId), spanContext: newTestSpanContext()}
+	suite.mockServer.On("GetChannel", mockChargePointId).Return(channel, true)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	suite.centralSystem.Start(8887, "somePath")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	// Outgoing request is a child of the span in the context
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "api")
+	requestID, err := suite.centralSystem.SendRequestCtx(ctx, mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	parent.End()
+	suite.Require().Eventually(func() bool {
+		return suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId)
+	}, time.Second, 10*time.Millisecond)
+	err = suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, requestID)))
+	suite.Require().NoError(err)
+	span, ok := findSpan(exporter, trace.SpanKindClient)
+	suite.Require().True(ok)
+	suite.Assert().Equal(MockFeatureName, span.Name)
+	suite.Assert().Equal(parent.SpanContext().SpanID(), span.Parent.SpanID())
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.charge_point_id", mockChargePointId))
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.action", MockFeatureName))
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.unique_id", requestID))
+	suite.Assert().True(slices.ContainsFunc(span.Attributes, func(attr attribute.KeyValue) bool {
+		return attr.Key == "ocpp.queue_wait_ms"
+	}))
+	suite.Require().Len(span.Links, 1)
+	suite.Assert().Equal(channel.spanContext, span.Links[0].SpanContext)
+	suite.Assert().Equal(codes.Unset, span.Status.Code)
+	// Incoming request is traced until the response is sent
+	mockUniqueId := "5678"
+	err = suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)))
+	suite.Require().NoError(err)
+	_, ok = findSpan(exporter, trace.SpanKindServer)
+	suite.Assert().False(ok)
+	err = suite.centralSystem.SendError(mockChargePointId, mockUniqueId, ocppj.InternalError, "mock error", nil)
+	suite.Require().NoError(err)
+	span, ok = findSpan(exporter, trace.SpanKindServer)
+	suite.Require().True(ok)
+	suite.Assert().Equal(MockFeatureName, span.Name)
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.unique_id", mockUniqueId))
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.error_code", string(ocppj.InternalError)))
+	suite.Assert().Equal(codes.Error, span.Status.Code)
+	suite.Assert().Equal(channel.spanContext, span.Links[0].SpanContext)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemReplacedConnection() {
+	mockChargePointId := "1234"
+	oldChannel := NewMockWebSocket(mockChargePointId)
+	newChannel := NewMockWebSocket(mockChargePointId)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	writeC := make(chan string, 2)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- string(args.Get(1).([]byte))
+	})
+	canceledC := make(chan *ocpp.Error, 1)
+	suite.centralSystem.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		suite.Equal(mockChargePointId, clientID)
+		canceledC <- err
+	})
+	var events []string
+	suite.centralSystem.SetDisconnectedClientHandler(func(client ws.Channel) {
+		events = append(events, "disconnected")
+		suite.Equal(oldChannel, client)
+	})
+	suite.centralSystem.SetNewClientHandler(func(client ws.Channel) {
+		events = append(events, "connected")
+		suite.Equal(newChannel, client)
+	})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.Require().NotNil(suite.mockServer.ReplacedClientHandler)
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	requestID1, err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("request1"))
+	suite.Require().NoError(err)
+	requestID2, err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("request2"))
+	suite.Require().NoError(err)
+	suite.Contains(<-writeC, requestID1)
+	// Request in flight is canceled, while the queued request is sent over the new connection
+	suite.mockServer.ReplacedClientHandler(oldChannel, newChannel)
+	select {
+	case ocppErr := <-canceledC:
+		suite.Equal(ocppj.GenericError, ocppErr.Code)
+		suite.Equal(requestID1, ocppErr.MessageId)
+	case <-time.After(time.Second):
+		suite.FailNow("request in flight wasn't canceled")
+	}
+	suite.Contains(<-writeC, requestID2)
+	suite.Equal([]string{"disconnected", "connected"}, events)
+	_, pending := suite.centralSystem.RequestState.GetClientState(mockChargePointId).GetPendingRequest(requestID2)
+	suite.True(pending)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemClientReplacedInboundCall() {
+	mockChargePointId := "1234"
+	oldChannel := NewMockWebSocket(mockChargePointId)
+	newChannel := NewMockWebSocket(mockChargePointId)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	writeC := make(chan string, 2)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- string(args.Get(1).([]byte))
+	})
+	handledC := make(chan string, 2)
+	releaseC := make(chan struct{})
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		handledC <- requestId
+		if client == oldChannel {
+			<-releaseC
+		}
+	})
+	suite.centralSystem.SetInboundWorkerPool(ocppj.InboundWorkerPoolConfig{Workers: 1})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(oldChannel)
+	err := suite.mockServer.MessageHandler(oldChannel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, "1", MockFeatureName)))
+	suite.Require().NoError(err)
+	suite.Equal("1", <-handledC)
+	// The connection is replaced, while the incoming request is still being handled
+	suite.mockServer.ReplacedClientHandler(oldChannel, newChannel)
+	err = suite.mockServer.MessageHandler(newChannel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, "2", MockFeatureName)))
+	suite.Require().NoError(err)
+	select {
+	case requestID := <-handledC:
+		suite.Failf("unexpected request", "request %s was handled, while the handler of the old connection was running", requestID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The worker is released once the handler returns, while its answer isn't sent over the new connection
+	close(releaseC)
+	suite.Equal("2", <-handledC)
+	err = suite.centralSystem.SendResponse(mockChargePointId, "1", newMockConfirmation("someValue"))
+	suite.Error(err)
+	err = suite.centralSystem.SendResponse(mockChargePointId, "2", newMockConfirmation("someValue"))
+	suite.Require().NoError(err)
+	suite.Contains(<-writeC, `"2"`)
+	suite.Empty(writeC)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemRateLimitedMessage() {
+	mockChargePointId := "1234"
+	mockUniqueId := "5678"
+	channel := NewMockWebSocket(mockChargePointId)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	writeC := make(chan string, 1)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- string(args.Get(1).([]byte))
+	})
+	requestHandled := false
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		requestHandled = true
+	})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.Require().NotNil(suite.mockServer.RateLimitedHandler)
+	// A rejected request is answered with a CallError
+	call := fmt.Sprintf(`[2,"%v","%v",{"mockValue":"somevalue"}]`, mockUniqueId, MockFeatureName)
+	err := suite.mockServer.RateLimitedHandler(channel, []byte(call))
+	suite.Require().NoError(err)
+	suite.Equal(fmt.Sprintf(`[4,"%v","%v","Rate limit exceeded",{}]`, mockUniqueId, ocppj.GenericError), <-writeC)
+	// Other messages are dropped
+	callResult := fmt.Sprintf(`[3,"%v",{"mockValue":"somevalue"}]`, mockUniqueId)
+	err = suite.mockServer.RateLimitedHandler(channel, []byte(callResult))
+	suite.Require().NoError(err)
+	suite.Len(writeC, 0)
+	suite.False(requestHandled)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemInboundWorkerPool() {
+	channel1 := NewMockWebSocket("cp1")
+	channel2 := NewMockWebSocket("cp2")
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	handledC := make(chan string, 4)
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		handledC <- requestId
+	})
+	responseC := make(chan string, 1)
+	suite.centralSystem.SetResponseHandler(func(client ws.Channel, response ocpp.Response, requestId string) {
+		responseC <- requestId
+	})
+	suite.centralSystem.SetInboundWorkerPool(ocppj.InboundWorkerPoolConfig{Workers: 2})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(channel1)
+	suite.mockServer.NewClientHandler(channel2)
+	requestID, err := suite.centralSystem.SendRequest("cp1", newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Eventually(func() bool {
+		return suite.centralSystem.RequestState.HasPendingRequest("cp1")
+	}, time.Second, 10*time.Millisecond)
+	// Requests of the same client are handled in order, requests of other clients concurrently
+	for _, call := range []struct {
+		channel   ws.Channel
+		requestID string
+	}{{channel1, "1"}, {channel1, "2"}, {channel2, "3"}} {
+		err = suite.mockServer.MessageHandler(call.channel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, call.requestID, MockFeatureName)))
+		suite.Require().NoError(err)
+	}
+	suite.ElementsMatch([]string{"1", "3"}, []string{<-handledC, <-handledC})
+	// Responses are processed right away, while requests are still being handled
+	err = suite.mockServer.MessageHandler(channel1, []byte(fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, requestID)))
+	suite.Require().NoError(err)
+	suite.Equal(requestID, <-responseC)
+	suite.Len(handledC, 0)
+	// The next request is handled once the previous one was answered
+	err = suite.centralSystem.SendResponse("cp1", "1", newMockConfirmation("someValue"))
+	suite.Require().NoError(err)
+	suite.Equal("2", <-handledC)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemInboundWorkerPoolUnordered() {
+	channel1 := NewMockWebSocket("cp1")
+	channel2 := NewMockWebSocket("cp2")
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	handledC := make(chan string, 4)
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		handledC <- requestId
+	})
+	suite.centralSystem.SetInboundWorkerPool(ocppj.InboundWorkerPoolConfig{
+		Workers: 2,
+		Ordered: func(action string) bool {
+			return action != MockFeatureName
+		},
+	})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(channel1)
+	suite.mockServer.NewClientHandler(channel2)
+	for _, call := range []struct {
+		channel   ws.Channel
+		requestID string
+	}{{channel1, "1"}, {channel1, "2"}, {channel1, "3"}, {channel2, "4"}} {
+		err := suite.mockServer.MessageHandler(call.channel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, call.requestID, MockFeatureName)))
+		suite.Require().NoError(err)
+	}
+	// Unordered requests of the same client are handled concurrently, up to the number of workers
+	suite.ElementsMatch([]string{"1", "2"}, []string{<-handledC, <-handledC})
+	suite.Len(handledC, 0)
+	// Queued requests are dropped and workers released, when the client disconnects
+	suite.mockServer.DisconnectedClientHandler(channel1)
+	suite.Equal("4", <-handledC)
+	select {
+	case requestID := <-handledC:
+		suite.Failf("unexpected request", "request %s of disconnected client was handled", requestID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemInboundWorkerPoolRelease() {
+	channel1 := NewMockWebSocket("cp1")
+	channel2 := NewMockWebSocket("cp2")
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	handledC := make(chan string, 4)
+	releaseC := make(chan struct{})
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {
+		handledC <- requestId
+		if requestId == "2" {
+			<-releaseC
+		}
+	})
+	suite.centralSystem.SetInboundWorkerPool(ocppj.InboundWorkerPoolConfig{Workers: 1})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(channel1)
+	suite.mockServer.NewClientHandler(channel2)
+	sendCall := func(channel ws.Channel, requestID string) {
+		err := suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, requestID, MockFeatureName)))
+		suite.Require().NoError(err)
+	}
+	sendCall(channel1, "1")
+	sendCall(channel1, "2")
+	sendCall(channel2, "3")
+	suite.Equal("1", <-handledC)
+	// The worker is released, even if the response couldn't be sent
+	err := suite.centralSystem.SendResponse("cp1", "1", newMockConfirmation("bad"))
+	suite.Require().Error(err)
+	suite.Equal("2", <-handledC)
+	// The worker of a disconnected client is released, once its request handler returned
+	suite.mockServer.DisconnectedClientHandler(channel1)
+	select {
+	case requestID := <-handledC:
+		suite.Failf("unexpected request", "request %s was handled, while all workers were busy", requestID)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(releaseC)
+	suite.Equal("3", <-handledC)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemInboundWorkerPoolQueueFull() {
+	mockChargePointId := "1234"
+	channel := NewMockWebSocket(mockChargePointId)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	writeC := make(chan string, 1)
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		writeC <- string(args.Get(1).([]byte))
+	})
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {})
+	suite.centralSystem.SetInboundWorkerPool(ocppj.InboundWorkerPoolConfig{Workers: 1, QueueSize: 1})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(channel)
+	// One request is being handled, one is queued
+	for _, requestID := range []string{"1", "2"} {
+		err := suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, requestID, MockFeatureName)))
+		suite.Require().NoError(err)
+	}
+	// Further requests are rejected
+	err := suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[2,"3","%v",{"mockValue":"someValue"}]`, MockFeatureName)))
+	suite.Error(err)
+	suite.Equal(fmt.Sprintf(`[4,"3","%v","too many pending requests",{}]`, ocppj.InternalError), <-writeC)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemConnectedClients() {
+	channel1 := NewMockWebSocket("1234")
+	channel2 := NewMockWebSocket("5678")
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("GetChannel", "1234").Return(channel1, true)
+	suite.mockServer.On("GetChannel", "5678").Return(channel2, true)
+	suite.mockServer.On("GetChannel", mock.AnythingOfType("string")).Return(nil, false)
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(channel1)
+	suite.mockServer.NewClientHandler(channel2)
+	clientIDs := func() []string {
+		var ids []string
+		for _, channel := range suite.centralSystem.ConnectedClients() {
+			ids = append(ids, channel.ID())
+		}
+		return ids
+	}
+	suite.ElementsMatch([]string{"1234", "5678"}, clientIDs())
+	suite.True(suite.centralSystem.IsClientConnected("1234"))
+	suite.False(suite.centralSystem.IsClientConnected("0000"))
+	suite.mockServer.DisconnectedClientHandler(channel2)
+	suite.ElementsMatch([]string{"1234"}, clientIDs())
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemShutdown() {
+	busyChargePointId := "1234"
+	idleChargePointId := "5678"
+	busyChannel := NewMockWebSocket(busyChargePointId)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	stopAcceptingC := make(chan struct{}, 1)
+	suite.mockServer.On("StopAccepting").Return().Run(func(args mock.Arguments) {
+		stopAcceptingC <- struct{}{}
+	})
+	suite.mockServer.On("Shutdown", mock.Anything).Return(nil)
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(busyChannel)
+	suite.mockServer.NewClientHandler(NewMockWebSocket(idleChargePointId))
+	// Outgoing request awaiting a response, incoming request awaiting an answer
+	requestID, err := suite.centralSystem.SendRequest(busyChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Eventually(func() bool {
+		return suite.centralSystem.RequestState.HasPendingRequest(busyChargePointId)
+	}, time.Second, 10*time.Millisecond)
+	mockUniqueId := "9999"
+	err = suite.mockServer.MessageHandler(busyChannel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, mockUniqueId, MockFeatureName)))
+	suite.Require().NoError(err)
+	type shutdownResult struct {
+		report ocppj.ShutdownReport
+		err    error
+	}
+	resultC := make(chan shutdownResult, 1)
+	go func() {
+		report, err := suite.centralSystem.Shutdown(context.Background())
+		resultC <- shutdownResult{report, err}
+	}()
+	<-stopAcceptingC
+	_, err = suite.centralSystem.SendRequest(busyChargePointId, newMockRequest("somevalue"))
+	suite.Error(err)
+	// Shutdown waits for both exchanges to complete
+	err = suite.mockServer.MessageHandler(busyChannel, []byte(fmt.Sprintf(`[3,"%v",{"mockValue":"someValue"}]`, requestID)))
+	suite.Require().NoError(err)
+	select {
+	case <-resultC:
+		suite.FailNow("shutdown didn't wait for incoming request")
+	case <-time.After(100 * time.Millisecond):
+	}
+	err = suite.centralSystem.SendResponse(busyChargePointId, mockUniqueId, newMockConfirmation("someValue"))
+	suite.Require().NoError(err)
+	select {
+	case result := <-resultC:
+		suite.Require().NoError(result.err)
+		suite.Equal(ocppj.ShutdownReport{
+			busyChargePointId: {Outcome: ocppj.ShutdownDrained},
+			idleChargePointId: {Outcome: ocppj.ShutdownIdle},
+		}, result.report)
+	case <-time.After(time.Second):
+		suite.FailNow("shutdown didn't complete")
+	}
+	suite.mockServer.AssertCalled(suite.T(), "Shutdown", mock.Anything)
+	suite.False(suite.serverDispatcher.IsRunning())
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemShutdownNotGraceful() {
+	mockChargePointId := "1234"
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Stop").Return()
+	server, err := ocppj.NewServer(basicWebsocketServer{suite.mockServer}, nil, nil, nil, ocpp.NewProfile("mock", &MockFeature{}))
+	suite.Require().NoError(err)
+	server.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(NewMockWebSocket(mockChargePointId))
+	// The websocket server doesn't support a graceful shutdown, hence connections are closed via Stop
+	report, err := server.Shutdown(context.Background())
+	suite.Require().NoError(err)
+	suite.Equal(ocppj.ShutdownReport{mockChargePointId: {Outcome: ocppj.ShutdownIdle}}, report)
+	suite.mockServer.AssertCalled(suite.T(), "Stop")
+	suite.mockServer.AssertNotCalled(suite.T(), "StopAccepting")
+	suite.mockServer.AssertNotCalled(suite.T(), "Shutdown", mock.Anything)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemShutdownInterrupted() {
+	mockChargePointId := "1234"
+	idleChargePointId := "5678"
+	idleChannel := NewMockWebSocket(idleChargePointId)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	stopAcceptingC := make(chan struct{}, 1)
+	suite.mockServer.On("StopAccepting").Return().Run(func(args mock.Arguments) {
+		stopAcceptingC <- struct{}{}
+	})
+	suite.mockServer.On("Shutdown", mock.Anything).Return(nil)
+	suite.centralSystem.SetRequestHandler(func(client ws.Channel, request ocpp.Request, requestId string, action string) {})
+	var canceledMutex sync.Mutex
+	canceled := map[string]*ocpp.Error{}
+	suite.centralSystem.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		canceledMutex.Lock()
+		defer canceledMutex.Unlock()
+		canceled[requestID] = err
+	})
+	suite.centralSystem.Start(8887, "somePath")
+	suite.mockServer.NewClientHandler(NewMockWebSocket(mockChargePointId))
+	suite.mockServer.NewClientHandler(idleChannel)
+	var requestIDs []string
+	for i := 0; i < 2; i++ {
+		requestID, err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+		suite.Require().NoError(err)
+		requestIDs = append(requestIDs, requestID)
+	}
+	suite.Require().Eventually(func() bool {
+		return suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId)
+	}, time.Second, 10*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	type shutdownResult struct {
+		report ocppj.ShutdownReport
+		err    error
+	}
+	resultC := make(chan shutdownResult, 1)
+	go func() {
+		report, err := suite.centralSystem.Shutdown(ctx)
+		resultC <- shutdownResult{report, err}
+	}()
+	<-stopAcceptingC
+	// Client, which was idle when the shutdown started, sends a request in the meantime
+	err := suite.mockServer.MessageHandler(idleChannel, []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"someValue"}]`, "9999", MockFeatureName)))
+	suite.Require().NoError(err)
+	result := <-resultC
+	suite.ErrorIs(result.err, context.DeadlineExceeded)
+	suite.Equal(ocppj.ShutdownReport{
+		mockChargePointId: {Outcome: ocppj.ShutdownInterrupted, PendingRequests: 2},
+		idleChargePointId: {Outcome: ocppj.ShutdownInterrupted, UnansweredRequests: 1},
+	}, result.report)
+	// Dropped requests are canceled
+	canceledMutex.Lock()
+	defer canceledMutex.Unlock()
+	suite.Require().Len(canceled, 2)
+	for _, requestID := range requestIDs {
+		suite.Require().NotNil(canceled[requestID])
+		suite.Equal(ocppj.GenericError, canceled[requestID].Code)
+		suite.Equal(requestID, canceled[requestID].MessageId)
+	}
+	suite.False(suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+	_, err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.Error(err)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemServe() {
+	mockChargePointId := "1234"
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer listener.Close()
+	suite.mockServer.On("Serve", listener, "somePath").Return(nil)
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	// Internal ocppj <-> websocket handlers are registered before serving
+	err = suite.centralSystem.Serve(listener, "somePath")
+	suite.Require().NoError(err)
+	suite.mockServer.AssertCalled(suite.T(), "Serve", listener, "somePath")
+	suite.True(suite.serverDispatcher.IsRunning())
+	suite.mockServer.NewClientHandler(NewMockWebSocket(mockChargePointId))
+	_, err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.NoError(err)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemHandler() {
+	mockChargePointId := "1234"
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	handler, err := suite.centralSystem.Handler()
+	suite.Require().NoError(err)
+	suite.Equal(suite.mockServer, handler)
+	suite.True(suite.serverDispatcher.IsRunning())
+	suite.Require().NotNil(suite.mockServer.NewClientHandler)
+	suite.Require().NotNil(suite.mockServer.MessageHandler)
+	// Retrieving the handler again doesn't restart the dispatcher
+	suite.mockServer.NewClientHandler(NewMockWebSocket(mockChargePointId))
+	_, err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	handler, err = suite.centralSystem.Handler()
+	suite.Require().NoError(err)
+	suite.Equal(suite.mockServer, handler)
+	suite.Eventually(func() bool {
+		return suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemServeUnsupported() {
+	server, err := ocppj.NewServer(basicWebsocketServer{suite.mockServer}, nil, nil, nil, ocpp.NewProfile("mock", &MockFeature{}))
+	suite.Require().NoError(err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	suite.Require().NoError(err)
+	defer listener.Close()
+	// The websocket server supports neither listeners nor being mounted as a handler
+	err = server.Serve(listener, "somePath")
+	suite.Error(err)
+	handler, err := server.Handler()
+	suite.Error(err)
+	suite.Nil(handler)
+	suite.Nil(suite.mockServer.NewClientHandler)
+}
+
+func (suite *OcppJTestSuite) TestCentralSystemMetrics() {
+	mockChargePointId := "1234"
+	provider, reader := newTestMeterProvider()
+	suite.Require().NoError(suite.centralSystem.SetMeterProvider(provider))
+	channel := NewMockWebSocket(mockChargePointId)
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return()
+	suite.mockServer.On("Write", mockChargePointId, mock.Anything).Return(nil)
+	canceledC := make(chan *ocpp.Error, 1)
+	suite.centralSystem.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		canceledC <- err
+	})
+	suite.serverDispatcher.SetTimeout(200 * time.Millisecond)
+	suite.centralSystem.Start(8887, "somePath")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	attrs := attribute.NewSet(attribute.String("charge_point_id", mockChargePointId), attribute.String("feature", MockFeatureName))
+	// Request answered with a CallError
+	requestID, err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Eventually(func() bool {
+		return suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId)
+	}, time.Second, 10*time.Millisecond)
+	err = suite.mockServer.MessageHandler(channel, []byte(fmt.Sprintf(`[4,"%v","%v","mock error",{}]`, requestID, ocppj.GenericError)))
+	suite.Require().NoError(err)
+	for _, name := range []string{"ocpp_request_latency", "ocpp_request_queue_wait"} {
+		histogram, ok := collectMetric(reader, name).(metricdata.Histogram[float64])
+		suite.Require().True(ok, name)
+		suite.Require().Len(histogram.DataPoints, 1, name)
+		suite.Assert().Equal(attrs, histogram.DataPoints[0].Attributes, name)
+		suite.Assert().Equal(uint64(1), histogram.DataPoints[0].Count, name)
+	}
+	callErrors, ok := collectMetric(reader, "ocpp_call_errors").(metricdata.Sum[int64])
+	suite.Require().True(ok)
+	suite.Require().Len(callErrors.DataPoints, 1)
+	suite.Assert().Equal(int64(1), callErrors.DataPoints[0].Value)
+	errorCode, _ := callErrors.DataPoints[0].Attributes.Value("error_code")
+	suite.Assert().Equal(string(ocppj.GenericError), errorCode.AsString())
+	suite.Assert().Nil(collectMetric(reader, "ocpp_request_timeouts"))
+	// Request timing out
+	_, err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	select {
+	case <-canceledC:
+	case <-time.After(time.Second):
+		suite.FailNow("request didn't time out")
+	}
+	timeouts, ok := collectMetric(reader, "ocpp_request_timeouts").(metricdata.Sum[int64])
+	suite.Require().True(ok)
+	suite.Require().Len(timeouts.DataPoints, 1)
+	suite.Assert().Equal(attrs, timeouts.DataPoints[0].Attributes)
+	suite.Assert().Equal(int64(1), timeouts.DataPoints[0].Value)
+	canceled, ok := collectMetric(reader, "ocpp_requests_canceled").(metricdata.Sum[int64])
+	suite.Require().True(ok)
+	suite.Require().Len(canceled.DataPoints, 1)
+	suite.Assert().Equal(int64(1), canceled.DataPoints[0].Value)
+}
+
 func addMockPendingRequest(suite *OcppJTestSuite, mockRequest ocpp.Request, mockUniqueID string, mockChargePointID string) {
 	mockCall, _ := suite.centralSystem.CreateCall(mockRequest)
 	mockCall.UniqueId = mockUniqueID
@@ -541,6 +1280,37 @@ func (suite *OcppJTestSuite) TestServerEnqueueRequest() {
 	suite.Assert().Equal(marshaled, bundle.Data)
 }
 
+func (suite *OcppJTestSuite) TestServerSendRequestCtxCanceled() {
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	suite.centralSystem.SetCanceledRequestHandler(func(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+		suite.Fail("unexpected OnRequestCanceled")
+	})
+	suite.centralSystem.Start(8887, "/{ws}")
+	mockChargePointId := "1234"
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	// Already expired context: nothing is sent
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	_, err := suite.centralSystem.SendRequestCtx(ctx, mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().ErrorIs(err, context.DeadlineExceeded)
+	// In-flight and queued requests are removed once their context is done
+	ctx, cancel = context.WithCancel(context.Background())
+	_, err = suite.centralSystem.SendRequestCtx(ctx, mockChargePointId, newMockRequest("first"))
+	suite.Require().Nil(err)
+	_, err = suite.centralSystem.SendRequestCtx(ctx, mockChargePointId, newMockRequest("second"))
+	suite.Require().Nil(err)
+	time.Sleep(100 * time.Millisecond)
+	q, ok := suite.serverRequestMap.Get(mockChargePointId)
+	suite.Require().True(ok)
+	suite.Require().Equal(2, q.Size())
+	suite.Require().True(suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	suite.Assert().True(q.IsEmpty())
+	suite.Assert().False(suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId))
+}
+
 func (suite *OcppJTestSuite) TestEnqueueMultipleRequests() {
 	var messagesToQueue atomic.Int64
 	var sentMessages atomic.Int64
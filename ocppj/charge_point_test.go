@@ -1,6 +1,7 @@
 package ocppj_test
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
@@ -8,9 +9,14 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ocppj"
+	"github.com/xBlaz3kx/ocpp-go/ws"
 )
 
 // ----------------- Start tests -----------------
@@ -36,6 +42,32 @@ func (suite *OcppJTestSuite) TestChargePointStartFailed() {
 	suite.Assert().NotNil(err)
 }
 
+func (suite *OcppJTestSuite) TestChargePointStartWithEndpoints() {
+	endpoints := []ws.Endpoint{{URL: "url1"}, {URL: "url2", ConnectionAttempts: 3}}
+	var wsEndpoints []ws.Endpoint
+	suite.mockClient.On("StartWithEndpoints", mock.Anything).Return().Run(func(args mock.Arguments) {
+		wsEndpoints = args.Get(0).([]ws.Endpoint)
+	})
+	var activeEndpoint ws.Endpoint
+	activeIndex := -1
+	suite.chargePoint.SetOnActiveEndpointHandler(func(endpoint ws.Endpoint, index int) {
+		activeEndpoint = endpoint
+		activeIndex = index
+	})
+	suite.chargePoint.StartWithEndpoints(endpoints)
+	suite.Assert().True(suite.clientDispatcher.IsRunning())
+	// The client ID is appended to the URL of every endpoint
+	suite.Require().Len(wsEndpoints, 2)
+	suite.Assert().Equal("url1/"+suite.chargePoint.Id, wsEndpoints[0].URL)
+	suite.Assert().Equal("url2/"+suite.chargePoint.Id, wsEndpoints[1].URL)
+	suite.Assert().Equal(3, wsEndpoints[1].ConnectionAttempts)
+	// The active endpoint is reported as originally passed
+	suite.Require().NotNil(suite.mockClient.ActiveEndpointHandler)
+	suite.mockClient.ActiveEndpointHandler(wsEndpoints[1], 1)
+	suite.Assert().Equal(endpoints[1], activeEndpoint)
+	suite.Assert().Equal(1, activeIndex)
+}
+
 func (suite *OcppJTestSuite) TestClientNotStartedError() {
 	// Start normally
 	req := newMockRequest("somevalue")
@@ -407,6 +439,44 @@ func (suite *OcppJTestSuite) TestChargePointCallErrorHandler() {
 	suite.Assert().Nil(err)
 }
 
+func (suite *OcppJTestSuite) TestChargePointMiddleware() {
+	mockUniqueId := "5678"
+	mockError := fmt.Sprintf(`[4,"%v","%v","%v",{}]`, mockUniqueId, ocppj.GenericError, "Mock Description")
+	var audited []ocppj.MessageContext
+	audit := func(next ocppj.MessageHandlerFunc) ocppj.MessageHandlerFunc {
+		return func(msg *ocppj.MessageContext) *ocpp.Error {
+			audited = append(audited, *msg)
+			return next(msg)
+		}
+	}
+	suite.chargePoint.Use(audit)
+	suite.chargePoint.SetErrorHandler(func(err *ocpp.Error, details interface{}) {
+		suite.Assert().Equal(mockUniqueId, err.MessageId)
+		suite.Assert().Equal(ocppj.GenericError, err.Code)
+	})
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	suite.chargePoint.RequestState.AddPendingRequest(mockUniqueId, newMockRequest("testValue"))
+	err := suite.chargePoint.Start("someUrl")
+	suite.Require().NoError(err)
+	err = suite.mockClient.MessageHandler([]byte(mockError))
+	suite.Require().NoError(err)
+	requestID, err := suite.chargePoint.SendRequest(newMockRequest("testValue"))
+	suite.Require().NoError(err)
+	suite.Require().Len(audited, 2)
+	// Action of an incoming error is taken from the related request
+	suite.Assert().Equal(ocppj.Inbound, audited[0].Direction)
+	suite.Assert().Equal(ocppj.CALL_ERROR, audited[0].MessageType)
+	suite.Assert().Equal("mock_id", audited[0].ClientID)
+	suite.Assert().Equal(MockFeatureName, audited[0].Action)
+	suite.Assert().Equal(mockError, string(audited[0].Raw))
+	suite.Assert().Equal(ocppj.GenericError, audited[0].Payload.(*ocpp.Error).Code)
+	suite.Assert().Equal(ocppj.Outbound, audited[1].Direction)
+	suite.Assert().Equal(ocppj.CALL, audited[1].MessageType)
+	suite.Assert().Equal(requestID, audited[1].UniqueID)
+	suite.Assert().Equal(MockFeatureName, audited[1].Action)
+}
+
 // ----------------- Queue processing tests -----------------
 
 func (suite *OcppJTestSuite) TestClientEnqueueRequest() {
@@ -434,6 +504,108 @@ func (suite *OcppJTestSuite) TestClientEnqueueRequest() {
 	suite.Assert().Equal(marshaled, bundle.Data)
 }
 
+func (suite *OcppJTestSuite) TestClientSendRequestCtxCanceled() {
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	suite.chargePoint.SetOnRequestCanceled(func(requestId string, request ocpp.Request, err *ocpp.Error) {
+		suite.Fail("unexpected OnRequestCanceled")
+	})
+	err := suite.chargePoint.Start("someUrl")
+	suite.Require().Nil(err)
+	// Already canceled context: nothing is sent
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = suite.chargePoint.SendRequestCtx(ctx, newMockRequest("somevalue"))
+	suite.Require().ErrorIs(err, context.Canceled)
+	suite.Assert().True(suite.clientRequestQueue.IsEmpty())
+	// Request is removed from queue and pending state once the context is done
+	ctx, cancel = context.WithCancel(context.Background())
+	requestID, err := suite.chargePoint.SendRequestCtx(ctx, newMockRequest("somevalue"))
+	suite.Require().Nil(err)
+	time.Sleep(100 * time.Millisecond)
+	suite.Require().True(suite.chargePoint.RequestState.HasPendingRequest())
+	cancel()
+	time.Sleep(100 * time.Millisecond)
+	suite.Assert().True(suite.clientRequestQueue.IsEmpty())
+	suite.Assert().False(suite.chargePoint.RequestState.HasPendingRequest())
+	// A late response is discarded
+	mockConfirmation := fmt.Sprintf(`[3,"%v",{"mockValue":"somevalue"}]`, requestID)
+	suite.chargePoint.SetResponseHandler(func(response ocpp.Response, requestId string) {
+		suite.Fail("unexpected response")
+	})
+	err = suite.mockClient.MessageHandler([]byte(mockConfirmation))
+	suite.Assert().Nil(err)
+}
+
+func (suite *OcppJTestSuite) TestChargePointMetrics() {
+	provider, reader := newTestMeterProvider()
+	suite.Require().NoError(suite.chargePoint.SetMeterProvider(provider))
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	canceledC := make(chan *ocpp.Error, 1)
+	suite.chargePoint.SetOnRequestCanceled(func(requestId string, request ocpp.Request, err *ocpp.Error) {
+		canceledC <- err
+	})
+	suite.clientDispatcher.SetTimeout(200 * time.Millisecond)
+	err := suite.chargePoint.Start("someUrl")
+	suite.Require().NoError(err)
+	attrs := attribute.NewSet(attribute.String("charge_point_id", suite.chargePoint.Id), attribute.String("feature", MockFeatureName))
+	// Request answered with a CallResult
+	requestID, err := suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Eventually(func() bool {
+		return suite.chargePoint.RequestState.HasPendingRequest()
+	}, time.Second, 10*time.Millisecond)
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[3,"%v",{"mockValue":"somevalue"}]`, requestID)))
+	suite.Require().NoError(err)
+	for _, name := range []string{"ocpp_request_latency", "ocpp_request_queue_wait"} {
+		histogram, ok := collectMetric(reader, name).(metricdata.Histogram[float64])
+		suite.Require().True(ok, name)
+		suite.Require().Len(histogram.DataPoints, 1, name)
+		suite.Assert().Equal(attrs, histogram.DataPoints[0].Attributes, name)
+		suite.Assert().Equal(uint64(1), histogram.DataPoints[0].Count, name)
+	}
+	suite.Assert().Nil(collectMetric(reader, "ocpp_call_errors"))
+	// Request timing out
+	_, err = suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	select {
+	case <-canceledC:
+	case <-time.After(time.Second):
+		suite.FailNow("request didn't time out")
+	}
+	timeouts, ok := collectMetric(reader, "ocpp_request_timeouts").(metricdata.Sum[int64])
+	suite.Require().True(ok)
+	suite.Require().Len(timeouts.DataPoints, 1)
+	suite.Assert().Equal(attrs, timeouts.DataPoints[0].Attributes)
+	suite.Assert().Equal(int64(1), timeouts.DataPoints[0].Value)
+}
+
+func (suite *OcppJTestSuite) TestChargePointTracing() {
+	provider, exporter := newTestTracerProvider()
+	suite.chargePoint.SetTracerProvider(provider)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	err := suite.chargePoint.Start("someUrl")
+	suite.Require().NoError(err)
+	requestID, err := suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Eventually(func() bool {
+		return suite.chargePoint.RequestState.HasPendingRequest()
+	}, time.Second, 10*time.Millisecond)
+	// Error response marks the span as failed
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[4,"%v","%v","mock error",{}]`, requestID, ocppj.GenericError)))
+	suite.Require().NoError(err)
+	span, ok := findSpan(exporter, trace.SpanKindClient)
+	suite.Require().True(ok)
+	suite.Assert().Equal(MockFeatureName, span.Name)
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.charge_point_id", suite.chargePoint.Id))
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.unique_id", requestID))
+	suite.Assert().Contains(span.Attributes, attribute.String("ocpp.error_code", string(ocppj.GenericError)))
+	suite.Assert().Equal(codes.Error, span.Status.Code)
+	suite.Assert().Empty(span.Links)
+}
+
 func (suite *OcppJTestSuite) TestClientEnqueueMultipleRequests() {
 	messagesToQueue := 5
 	sentMessages := 0
@@ -1,20 +1,27 @@
 package ocppj
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"gopkg.in/go-playground/validator.v9"
 
 	"github.com/xBlaz3kx/ocpp-go/logging"
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ws"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ClientDisconnectHandler func(err error)
 
 type ClientReconnectHandler func()
 
+type ClientActiveEndpointHandler func(endpoint ws.Endpoint, index int)
+
 type ClientInvalidMessageHook func(err *ocpp.Error, rawMessage string, parsedFields []interface{}) *ocpp.Error
 
 type ClientRequestCanceledHandler func(requestId string, request ocpp.Request, err *ocpp.Error)
@@ -37,9 +44,14 @@ type Client struct {
 	errorHandler          ClientErrorHandler
 	onDisconnectedHandler ClientDisconnectHandler
 	onReconnectedHandler  ClientReconnectHandler
+	onActiveEndpoint      ClientActiveEndpointHandler
 	invalidMessageHook    ClientInvalidMessageHook
+	onRequestCanceled     ClientRequestCanceledHandler
 	dispatcher            ClientDispatcher
+	requestContexts       requestContexts
 	RequestState          ClientState
+	tracer                *exchangeTracer
+	metrics               *ocppMetrics
 }
 
 // Creates a new Client endpoint.
@@ -87,14 +99,59 @@ func NewClient(
 	dispatcher.SetNetworkClient(wsClient)
 	dispatcher.SetPendingRequestState(stateHandler)
 
-	return &Client{
+	c := &Client{
 		Endpoint:     endpoint,
 		logger:       logger,
 		client:       wsClient,
 		Id:           id,
 		dispatcher:   dispatcher,
 		RequestState: stateHandler,
-	}, nil
+		tracer:       newExchangeTracer(nil),
+	}
+	dispatcher.SetOnRequestCanceled(c.onRequestCanceledHandler)
+	if notifier, ok := dispatcher.(requestSentNotifier); ok {
+		notifier.setOnRequestSent(func(_ string, requestID string) {
+			c.tracer.sent("", requestID)
+			c.metrics.RequestSent(context.Background(), "", requestID)
+		})
+	}
+	if source, ok := dispatcher.(messageIdSource); ok {
+		source.setMessageIdGenerator(func(string) (string, error) {
+			return c.newMessageId(c.isMessageIdInUse)
+		})
+	}
+	return c, nil
+}
+
+// SetTracerProvider sets the tracer provider for OCPP exchanges. If not set, the global tracer provider is used.
+//
+// A span is created for every request sent to or received from the server, which ends once the response is received or sent.
+// Spans are linked to the span of the websocket connection, if the connection is traced (see ws.WithClientTracerProvider).
+// Outgoing requests sent via SendRequestCtx are children of the span contained in the context.
+//
+// The tracer provider should be set before starting the client.
+func (c *Client) SetTracerProvider(provider trace.TracerProvider) {
+	c.tracer = newExchangeTracer(provider)
+}
+
+// SetMeterProvider enables OCPP metrics for the client, using the given meter provider. Metrics are disabled by default.
+//
+// The client counts inbound and outbound requests, records per-action histograms for the round-trip latency
+// and the queue wait time of outgoing requests, and counts timeouts, received CallErrors and requests canceled by the dispatcher.
+// All metrics carry the client ID as charge point ID.
+//
+// Passing nil disables metrics again. The meter provider should be set before starting the client.
+func (c *Client) SetMeterProvider(provider metric.MeterProvider) error {
+	if provider == nil {
+		c.metrics = nil
+		return nil
+	}
+	metrics, err := newOcppClientMetrics(provider, "")
+	if err != nil {
+		return err
+	}
+	c.metrics = metrics
+	return nil
 }
 
 // Return incoming requests handler.
@@ -153,9 +210,16 @@ func (c *Client) SetOnReconnectedHandler(handler ClientReconnectHandler) {
 	c.onReconnectedHandler = handler
 }
 
+// Registers the handler to be called whenever a connection to a server was established.
+// The handler receives the endpoint, as passed to StartWithEndpoints, along with its index.
+// If the client was started with a single server URL, the endpoint contains just that URL and the index is always 0.
+func (c *Client) SetOnActiveEndpointHandler(handler ClientActiveEndpointHandler) {
+	c.onActiveEndpoint = handler
+}
+
 // Registers the handler to be called on timeout.
 func (c *Client) SetOnRequestCanceled(handler ClientRequestCanceledHandler) {
-	c.dispatcher.SetOnRequestCanceled(handler)
+	c.onRequestCanceled = handler
 }
 
 // Connects to the given serverURL and starts running the I/O loop for the underlying connection.
@@ -168,32 +232,91 @@ func (c *Client) SetOnRequestCanceled(handler ClientRequestCanceledHandler) {
 //
 // An error may be returned, if establishing the connection failed.
 func (c *Client) Start(serverURL string) error {
-	// Set internal message handler
-	c.client.SetMessageHandler(c.ocppMessageHandler)
-	c.client.SetDisconnectedHandler(c.onDisconnected)
-	c.client.SetReconnectedHandler(c.onReconnected)
+	endpoints := c.setup([]ws.Endpoint{{URL: serverURL}})
 	// Connect & run
-	fullUrl := fmt.Sprintf("%v/%v", serverURL, c.Id)
-	err := c.client.Start(fullUrl)
+	err := c.client.Start(endpoints[0].URL)
 	if err == nil {
+		c.restoreRequests()
 		c.dispatcher.Start()
 	}
 	return err
 }
 
 func (c *Client) StartWithRetries(serverURL string) {
+	endpoints := c.setup([]ws.Endpoint{{URL: serverURL}})
+	// Connect & run
+	c.client.StartWithRetries(endpoints[0].URL)
+	c.restoreRequests()
+	c.dispatcher.Start()
+}
+
+// StartWithEndpoints connects to the first reachable server out of an ordered list of endpoints,
+// and starts running the I/O loop for the underlying connection.
+// The URL of each endpoint is a server URL, to which the client ID is appended, just like in Start.
+//
+// After the configured number of failed connection attempts on an endpoint, the client falls back to the next one.
+// The same applies to automatic re-connections. Refer to ws.Client.StartWithEndpoints for details.
+//
+// The function returns only when the connection has been established.
+func (c *Client) StartWithEndpoints(endpoints []ws.Endpoint) {
+	wsEndpoints := c.setup(endpoints)
+	// Connect & run
+	c.client.StartWithEndpoints(wsEndpoints)
+	c.restoreRequests()
+	c.dispatcher.Start()
+}
+
+// setup sets the internal handlers on the websocket client,
+// and returns the endpoints to connect to, with the client ID appended to their URL.
+func (c *Client) setup(endpoints []ws.Endpoint) []ws.Endpoint {
 	// Set internal message handler
 	c.client.SetMessageHandler(c.ocppMessageHandler)
 	c.client.SetDisconnectedHandler(c.onDisconnected)
 	c.client.SetReconnectedHandler(c.onReconnected)
-	// Connect & run
-	fullUrl := fmt.Sprintf("%v/%v", serverURL, c.Id)
-	c.client.StartWithRetries(fullUrl)
-	c.dispatcher.Start()
+	endpoints = append([]ws.Endpoint{}, endpoints...)
+	c.client.SetActiveEndpointHandler(func(_ ws.Endpoint, index int) {
+		if c.onActiveEndpoint != nil && index < len(endpoints) {
+			c.onActiveEndpoint(endpoints[index], index)
+		}
+	})
+	wsEndpoints := make([]ws.Endpoint, len(endpoints))
+	for i, endpoint := range endpoints {
+		endpoint.URL = fmt.Sprintf("%v/%v", endpoint.URL, c.Id)
+		wsEndpoints[i] = endpoint
+	}
+	return wsEndpoints
+}
+
+// restoreRequests decodes the requests persisted by a previous run (if any), so they are replayed once the
+// dispatcher is started. Requests that cannot be decoded anymore are dropped.
+func (c *Client) restoreRequests() {
+	restorer, ok := c.dispatcher.(requestRestorer)
+	if !ok {
+		return
+	}
+	err := restorer.restoreRequests(func(data []byte) (*Call, error) {
+		arr, err := c.ParseEnvelope(data)
+		if err != nil {
+			return nil, err
+		}
+		message, err := c.ParseRawMessage(arr, nil)
+		if err != nil {
+			return nil, err
+		}
+		call, ok := message.(*Call)
+		if !ok {
+			return nil, fmt.Errorf("persisted message is not a CALL")
+		}
+		return call, nil
+	})
+	if err != nil {
+		c.logger.Errorf("failed to restore persisted requests: %v", err)
+	}
 }
 
 // Stops the client.
 // The underlying I/O loop is stopped and all pending requests are cleared.
+// Requests in a PersistentRequestQueue are retained, and replayed once the client is started again.
 func (c *Client) Stop() {
 	// Overwrite handler to intercept disconnected signal
 	cleanupC := make(chan struct{}, 1)
@@ -208,6 +331,9 @@ func (c *Client) Stop() {
 	if c.dispatcher.IsRunning() {
 		c.dispatcher.Stop()
 	}
+	c.requestContexts.releaseAll()
+	c.metrics.ForgetAll()
+	c.tracer.endAll(ocpp.NewError(GenericError, "client stopped", ""))
 	// Wait for websocket to be cleaned up
 	<-cleanupC
 }
@@ -230,22 +356,67 @@ func (c *Client) IsConnected() bool {
 //
 // - the output queue is full
 func (c *Client) SendRequest(request ocpp.Request) (string, error) {
+	return c.SendRequestCtx(context.Background(), request)
+}
+
+// SendRequestCtx sends an OCPP Request to the server, binding it to the given context.
+//
+// If ctx is done before a response is received, the request is canceled: it is removed from the queue,
+// or its pending slot is released if it was already sent. A late response to the request is discarded.
+// No response, error or cancellation handler is invoked for a request canceled this way.
+//
+// If ctx is already done, ctx.Err() is returned and the request is not sent.
+// Otherwise, the function behaves like SendRequest.
+func (c *Client) SendRequestCtx(ctx context.Context, request ocpp.Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if !c.dispatcher.IsRunning() {
 		return "", fmt.Errorf("ocppj client is not started, couldn't send request")
 	}
 
-	call, err := c.CreateCall(request)
+	var metricErr *ocppMetricsError
+	if c.metrics != nil {
+		defer func() {
+			// Report a metric after request was sent.
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			c.metrics.IncrementOutboundRequests(ctx, c.Id, request.GetFeatureName(), metricErr)
+		}()
+	}
+
+	call, err := c.createCall(request, c.isMessageIdInUse)
 	if err != nil {
+		metricErr = &payloadError
 		return "", err
 	}
 
-	jsonMessage, err := call.MarshalJSON()
+	jsonMessage, err := c.MarshalMessage(call)
 	if err != nil {
+		metricErr = &payloadError
+		return "", err
+	}
+	if jsonMessage, err = c.outbound(c.Id, call, jsonMessage); err != nil {
+		metricErr = &validationError
 		return "", err
 	}
 
+	c.tracer.start(ctx, false, c.Id, "", call, func() interface{} {
+		return c.client
+	})
+	c.metrics.RequestEnqueued("", c.Id, call.UniqueId, call.Action)
+	c.requestContexts.watch(ctx, "", call.UniqueId, func() {
+		c.cancelDispatchedRequest(call.UniqueId)
+		c.metrics.ForgetRequest("", call.UniqueId)
+		c.tracer.end(false, "", call.UniqueId, ocpp.NewError(canceledErrorCode, ctx.Err().Error(), call.UniqueId))
+		c.logger.Debugf("canceled CALL [%s, %s]: %v", call.UniqueId, call.Action, ctx.Err())
+	})
 	// Message will be processed by dispatcher. A dedicated mechanism allows to delegate the message queue handling.
 	if err = c.dispatcher.SendRequest(RequestBundle{Call: call, Data: jsonMessage}); err != nil {
+		c.requestContexts.release("", call.UniqueId)
+		c.metrics.ForgetRequest("", call.UniqueId)
+		c.tracer.end(false, "", call.UniqueId, ocpp.NewError(GenericError, err.Error(), call.UniqueId))
+		metricErr = &metricsNetworkError
 		c.logger.Errorf("error dispatching request [%s, %s]: %v", call.UniqueId, call.Action, err)
 		return "", err
 	}
@@ -254,6 +425,26 @@ func (c *Client) SendRequest(request ocpp.Request) (string, error) {
 	return call.GetUniqueId(), nil
 }
 
+// CancelRequest cancels a previously sent request, identified by its requestID.
+// The request is removed from the queue, or its pending slot is released if it was already sent.
+// A late response to the request is discarded.
+//
+// No response, error or cancellation handler is invoked for the request.
+// Returns true if the request was found, false otherwise.
+// If the dispatcher doesn't implement ClientRequestCanceler, the request can't be canceled and false is returned.
+func (c *Client) CancelRequest(requestID string) bool {
+	c.requestContexts.release("", requestID)
+	c.metrics.ForgetRequest("", requestID)
+	c.tracer.end(false, "", requestID, ocpp.NewError(canceledErrorCode, "request canceled", requestID))
+	return c.cancelDispatchedRequest(requestID)
+}
+
+// cancelDispatchedRequest removes a request from the dispatcher, if the dispatcher supports canceling requests.
+func (c *Client) cancelDispatchedRequest(requestID string) bool {
+	canceler, ok := c.dispatcher.(ClientRequestCanceler)
+	return ok && canceler.CancelRequest(requestID)
+}
+
 // Sends an OCPP Response to the server.
 // The requestID parameter is required and identifies the previously received request.
 //
@@ -270,15 +461,21 @@ func (c *Client) SendResponse(requestId string, response ocpp.Response) error {
 		return err
 	}
 
-	jsonMessage, err := callResult.MarshalJSON()
+	jsonMessage, err := c.MarshalMessage(callResult)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	if jsonMessage, err = c.outbound(c.Id, callResult, jsonMessage); err != nil {
+		return err
+	}
 
 	if err = c.client.Write(jsonMessage); err != nil {
 		c.logger.Errorf("error sending response [%s]: %v", callResult.GetUniqueId(), err)
-		return ocpp.NewError(GenericError, err.Error(), requestId)
+		ocppErr := ocpp.NewError(GenericError, err.Error(), requestId)
+		c.tracer.end(true, "", requestId, ocppErr)
+		return ocppErr
 	}
+	c.tracer.end(true, "", requestId, nil)
 
 	c.logger.Debugf("sent CALL RESULT [%s]", callResult.GetUniqueId())
 	c.logger.Debugf("sent JSON message to server: %s", string(jsonMessage))
@@ -299,15 +496,21 @@ func (c *Client) SendError(requestId string, errorCode ocpp.ErrorCode, descripti
 		return err
 	}
 
-	jsonMessage, err := callError.MarshalJSON()
+	jsonMessage, err := c.MarshalMessage(callError)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	if jsonMessage, err = c.outbound(c.Id, callError, jsonMessage); err != nil {
+		return err
+	}
 
 	if err = c.client.Write(jsonMessage); err != nil {
 		c.logger.Errorf("error sending response error [%s]: %v", callError.UniqueId, err)
-		return ocpp.NewError(GenericError, err.Error(), requestId)
+		ocppErr := ocpp.NewError(GenericError, err.Error(), requestId)
+		c.tracer.end(true, "", requestId, ocppErr)
+		return ocppErr
 	}
+	c.tracer.end(true, "", requestId, ocpp.NewError(errorCode, description, requestId))
 
 	c.logger.Debugf("sent CALL ERROR [%s]", callError.UniqueId)
 	c.logger.Debugf("sent JSON message to server: %s", string(jsonMessage))
@@ -315,18 +518,25 @@ func (c *Client) SendError(requestId string, errorCode ocpp.ErrorCode, descripti
 }
 
 func (c *Client) ocppMessageHandler(data []byte) error {
-	parsedJson, err := ParseRawJsonMessage(data)
+	rawFields, err := c.ParseEnvelope(data)
 	if err != nil {
 		c.logger.Error(err)
 		return err
 	}
 	c.logger.Debugf("received JSON message from server: %s", string(data))
-	message, err := c.ParseMessage(parsedJson, c.RequestState)
+	in, err := c.inbound(c.Id, data, rawFields, c.RequestState)
+	if in.rejected != nil {
+		return c.onInboundRejected(in)
+	}
+	data, rawFields, message := in.raw, in.rawFields, in.message
 	if err != nil {
 		ocppErr := err.(*ocpp.Error)
 		messageID := ocppErr.MessageId
 		// Support ad-hoc callback for invalid message handling
 		if c.invalidMessageHook != nil {
+			// Generic fields are only decoded for the hook, valid messages are decoded once
+			var parsedJson []interface{}
+			_ = c.Codec().Unmarshal(data, &parsedJson)
 			err2 := c.invalidMessageHook(ocppErr, string(data), parsedJson)
 			// If the hook returns an error, use it as output error. If not, use the original error.
 			if err2 != nil {
@@ -350,22 +560,78 @@ func (c *Client) ocppMessageHandler(data []byte) error {
 		case CALL:
 			call := message.(*Call)
 			c.logger.Debugf("handling incoming CALL [%s, %s]", call.UniqueId, call.Action)
+			c.tracer.start(context.Background(), true, c.Id, "", call, func() interface{} {
+				return c.client
+			})
 			c.requestHandler(call.Payload, call.UniqueId, call.Action)
+			c.recordMetric(func(ctx context.Context) {
+				c.metrics.IncrementInboundRequests(ctx, c.Id, call.Payload.GetFeatureName(), nil)
+			})
 		case CALL_RESULT:
 			callResult := message.(*CallResult)
+			callResult.UniqueId = c.originalRequestID(callResult.UniqueId)
 			c.logger.Debugf("handling incoming CALL RESULT [%s]", callResult.UniqueId)
-			c.dispatcher.CompleteRequest(callResult.GetUniqueId()) // Remove current request from queue and send next one
+			c.completeRequest(callResult.GetUniqueId(), nil)
 			if c.responseHandler != nil {
 				c.responseHandler(callResult.Payload, callResult.UniqueId)
 			}
 		case CALL_ERROR:
 			callError := message.(*CallError)
+			callError.UniqueId = c.originalRequestID(callError.UniqueId)
 			c.logger.Debugf("handling incoming CALL ERROR [%s]", callError.UniqueId)
-			c.dispatcher.CompleteRequest(callError.GetUniqueId()) // Remove current request from queue and send next one
+			c.completeRequest(callError.GetUniqueId(), ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId))
 			if c.errorHandler != nil {
 				c.errorHandler(ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId), callError.ErrorDetails)
 			}
 		}
+	} else {
+		c.logUnmatchedResponse(rawFields)
+	}
+	return nil
+}
+
+// completeRequest removes a request, for which a response or error was received, and sends the next request.
+func (c *Client) completeRequest(requestID string, responseErr *ocpp.Error) {
+	c.dispatcher.CompleteRequest(requestID) // Remove current request from queue and send next one
+	c.requestContexts.release("", requestID)
+	c.tracer.end(false, "", requestID, responseErr)
+	c.recordMetric(func(ctx context.Context) {
+		c.metrics.RequestCompleted(ctx, "", requestID, responseErr)
+	})
+}
+
+// onInboundRejected handles an incoming message, which was rejected by a middleware.
+// A rejected Call is answered with the error, while a rejected CallResult or CallError completes the pending request with the error.
+func (c *Client) onInboundRejected(in inboundMessage) error {
+	ocppErr := in.rejected
+	switch in.messageType {
+	case CALL:
+		c.logger.Debugf("CALL [%s] rejected by middleware: %v", in.uniqueID, ocppErr)
+		if call, ok := in.message.(*Call); ok {
+			c.tracer.start(context.Background(), true, c.Id, "", call, func() interface{} {
+				return c.client
+			})
+		}
+		if in.uniqueID != "" {
+			if err := c.SendError(in.uniqueID, ocppErr.Code, ocppErr.Description, nil); err != nil {
+				return err
+			}
+		}
+		return ocppErr
+	case CALL_RESULT, CALL_ERROR:
+		if _, ok := c.RequestState.GetPendingRequest(in.uniqueID); !ok {
+			c.logger.Debugf("message [%s] rejected by middleware: %v", in.uniqueID, ocppErr)
+			return nil
+		}
+		requestID := c.originalRequestID(in.uniqueID)
+		if ocppErr.MessageId == in.uniqueID {
+			ocppErr.MessageId = requestID
+		}
+		c.logger.Debugf("response [%s] rejected by middleware: %v", requestID, ocppErr)
+		c.completeRequest(requestID, ocppErr)
+		if c.errorHandler != nil {
+			c.errorHandler(ocppErr, nil)
+		}
 	}
 	return nil
 }
@@ -398,6 +664,64 @@ func (c *Client) HandleFailedResponseError(requestID string, err error, featureN
 	_ = c.SendError(requestID, responseErr.Code, responseErr.Description, nil)
 }
 
+// isMessageIdInUse returns true if a request with the given message ID is currently pending, queued
+// or bound to a context, or if the message ID is in use by the application.
+func (c *Client) isMessageIdInUse(id string) bool {
+	if _, ok := c.RequestState.GetPendingRequest(id); ok {
+		return true
+	}
+	if checker, ok := c.dispatcher.(messageIdChecker); ok && checker.isMessageIdInUse("", id) {
+		return true
+	}
+	return c.requestContexts.isWatched("", id) || c.isMessageIdInUseByApplication(c.Id, id)
+}
+
+// originalRequestID returns the message ID originally assigned to a request,
+// in case the request was retransmitted using a different message ID.
+func (c *Client) originalRequestID(messageID string) string {
+	if resolver, ok := c.dispatcher.(requestIDResolver); ok {
+		return resolver.originalRequestID("", messageID)
+	}
+	return messageID
+}
+
+// logUnmatchedResponse logs a response, for which no request is pending.
+// This is usually a late response to a request, which was already retransmitted using a new message ID.
+func (c *Client) logUnmatchedResponse(rawFields []json.RawMessage) {
+	if len(rawFields) < 2 {
+		return
+	}
+	messageID, _ := rawJsonString(c.Codec(), rawFields[1])
+	if resolver, ok := c.dispatcher.(requestIDResolver); ok {
+		if requestID, superseded := resolver.supersededRequest("", messageID); superseded {
+			c.logger.Debugf("ignoring late response [%s] to request %s, which was retransmitted with a new message ID", messageID, requestID)
+			return
+		}
+	}
+	c.logger.Debugf("ignoring response [%s], no matching request is pending", messageID)
+}
+
+func (c *Client) onRequestCanceledHandler(requestID string, request ocpp.Request, err *ocpp.Error) {
+	c.requestContexts.release("", requestID)
+	c.tracer.end(false, "", requestID, err)
+	c.recordMetric(func(ctx context.Context) {
+		c.metrics.RequestCanceled(ctx, "", requestID, err)
+	})
+	if c.onRequestCanceled != nil {
+		c.onRequestCanceled(requestID, request, err)
+	}
+}
+
+// recordMetric invokes record with a bounded context, if metrics are enabled.
+func (c *Client) recordMetric(record func(ctx context.Context)) {
+	if c.metrics == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	record(ctx)
+}
+
 func (c *Client) onDisconnected(err error) {
 	c.logger.Error("disconnected from server", err)
 	c.dispatcher.Pause()
@@ -20,13 +20,20 @@ type DefaultClientDispatcher struct {
 	requestQueue        RequestQueue
 	requestChannel      chan bool
 	readyForDispatch    chan bool
+	cancelC             chan clientCancelation
+	stoppedC            chan struct{}
 	pendingRequestState ClientState
 	network             ws.Client
 	mutex               sync.RWMutex
 	onRequestCancel     func(requestID string, request ocpp.Request, err *ocpp.Error)
+	onRequestSent       func(clientID string, requestID string)
+	newMessageId        func(clientID string) (string, error)
 	timer               *time.Timer
 	paused              atomic.Bool
 	timeout             time.Duration
+	retryPolicy         *RetryPolicy
+	retryMutex          sync.Mutex
+	retry               retryState
 }
 
 const (
@@ -45,11 +52,22 @@ func NewDefaultClientDispatcher(queue RequestQueue, logger logging.Logger) *Defa
 		requestQueue:        queue,
 		requestChannel:      nil,
 		readyForDispatch:    make(chan bool, 1),
+		cancelC:             make(chan clientCancelation),
 		pendingRequestState: NewClientState(),
 		timeout:             defaultMessageTimeout,
 	}
 }
 
+// setOnRequestSent registers a handler, which is invoked whenever a queued request was written to the network.
+func (d *DefaultClientDispatcher) setOnRequestSent(handler func(clientID string, requestID string)) {
+	d.onRequestSent = handler
+}
+
+// setMessageIdGenerator sets the generator used for message IDs of retransmitted requests.
+func (d *DefaultClientDispatcher) setMessageIdGenerator(generate func(clientID string) (string, error)) {
+	d.newMessageId = generate
+}
+
 func (d *DefaultClientDispatcher) SetOnRequestCanceled(cb func(requestID string, request ocpp.Request, err *ocpp.Error)) {
 	d.onRequestCancel = cb
 }
@@ -58,10 +76,23 @@ func (d *DefaultClientDispatcher) SetTimeout(timeout time.Duration) {
 	d.timeout = timeout
 }
 
+// SetRetryPolicy sets the policy for retransmitting requests, which timed out or couldn't be sent.
+// By default, or if policy is nil, such requests are canceled right away.
+func (d *DefaultClientDispatcher) SetRetryPolicy(policy *RetryPolicy) {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	d.retryPolicy = policy
+}
+
 func (d *DefaultClientDispatcher) Start() {
 	d.mutex.Lock()
 	d.requestChannel = make(chan bool, 1)
+	d.stoppedC = make(chan struct{})
 	d.timer = time.NewTimer(defaultTimeoutTick) // Default to 24 hours tick
+	if !d.requestQueue.IsEmpty() {
+		// Requests were queued before starting (e.g. restored from a persistent queue)
+		d.requestChannel <- true
+	}
 	d.mutex.Unlock()
 
 	go d.messagePump()
@@ -97,7 +128,8 @@ func (d *DefaultClientDispatcher) SendRequest(req RequestBundle) error {
 	if d.network == nil {
 		return fmt.Errorf("cannot SendRequest, no network client was set")
 	}
-	if err := d.requestQueue.Push(req); err != nil {
+	dropped, err := pushRequest(d.requestQueue, req)
+	if err != nil {
 		return err
 	}
 	d.mutex.RLock()
@@ -105,12 +137,22 @@ func (d *DefaultClientDispatcher) SendRequest(req RequestBundle) error {
 		d.requestChannel <- true
 	}
 	d.mutex.RUnlock()
-
+	if bundle, ok := dropped.(RequestBundle); ok && bundle.Call != nil {
+		d.logger.Infof("dropped queued request %s in favor of %s", bundle.Call.UniqueId, req.Call.UniqueId)
+		if d.onRequestCancel != nil {
+			d.onRequestCancel(bundle.Call.UniqueId, bundle.Call.Payload,
+				ocpp.NewError(GenericError, droppedRequestDescription, bundle.Call.UniqueId))
+		}
+	}
 	return nil
 }
 
 func (d *DefaultClientDispatcher) messagePump() {
 	rdy := true // Ready to transmit at the beginning
+	d.mutex.RLock()
+	stoppedC := d.stoppedC
+	d.mutex.RUnlock()
+	defer close(stoppedC)
 
 	for {
 		select {
@@ -123,20 +165,41 @@ func (d *DefaultClientDispatcher) messagePump() {
 				d.mutex.Unlock()
 				return
 			}
+		case c := <-d.cancelC:
+			// Canceling from within the message pump, so the request can't be dispatched concurrently
+			released := d.cancelRequest(c.requestID)
+			c.result <- released
+			if released != cancelReleased {
+				continue
+			}
+			// The pending slot was released -> may dispatch again
+			rdy = true
 		case _, ok := <-d.timer.C:
 			// Timeout elapsed
 			if !ok {
 				continue
 			}
-			if d.pendingRequestState.HasPendingRequest() {
-				// Current request timed out. Removing request and triggering cancel callback
+			if d.retransmissionDue() {
+				// The retransmission backoff elapsed -> may dispatch again
+				rdy = true
+			} else if d.pendingRequestState.HasPendingRequest() {
 				el := d.requestQueue.Peek()
 				bundle, _ := el.(RequestBundle)
+				if delay, retry := d.retryRequest(bundle); retry {
+					// Current request timed out, but will be sent again once the backoff elapsed
+					d.logger.Infof("request %v timed out, retransmitting in %v", bundle.Call.UniqueId, delay)
+					d.timer.Reset(delay)
+					continue
+				}
+				// Current request timed out. Removing request and triggering cancel callback
 				d.CompleteRequest(bundle.Call.UniqueId)
 				if d.onRequestCancel != nil {
 					d.onRequestCancel(bundle.Call.UniqueId, bundle.Call.Payload,
-						ocpp.NewError(GenericError, "Request timed out", bundle.Call.UniqueId))
+						newRequestTimeoutError(bundle.Call.UniqueId))
 				}
+			} else {
+				// Nothing in flight -> may dispatch again
+				rdy = true
 			}
 			// No request is currently pending -> set timer to high number
 			d.timer.Reset(defaultTimeoutTick)
@@ -152,52 +215,140 @@ func (d *DefaultClientDispatcher) messagePump() {
 
 		// Only dispatch request if able to send and request queue isn't empty
 		if rdy && !d.requestQueue.IsEmpty() {
-			d.dispatchNextRequest()
+			timeout := d.dispatchNextRequest()
 			rdy = false
 			// Set timer
 			if !d.timer.Stop() {
 				<-d.timer.C
 			}
-			d.timer.Reset(d.timeout)
+			d.timer.Reset(timeout)
 		}
 	}
 }
 
-func (d *DefaultClientDispatcher) dispatchNextRequest() {
+// dispatchNextRequest sends the request at the front of the queue.
+// Returns the duration after which the message pump should be woken up again.
+func (d *DefaultClientDispatcher) dispatchNextRequest() time.Duration {
 	// Get first element in queue
 	el := d.requestQueue.Peek()
 
 	bundle, canCast := el.(RequestBundle)
 	if !canCast {
 		d.logger.Errorf("failed to cast request queue element to RequestBundle")
-		return
+		return d.timeout
 	}
 
 	if bundle.Call == nil {
 		d.logger.Errorf("request bundle has no Call associated")
-		return
+		return d.timeout
 	}
 
 	if bundle.Data == nil {
 		d.logger.Errorf("request bundle has no Data associated")
-		return
+		return d.timeout
 	}
 
-	jsonMessage := bundle.Data
-	d.pendingRequestState.AddPendingRequest(bundle.Call.UniqueId, bundle.Call.Payload)
-	// Attempt to send over network
-	err := d.network.Write(jsonMessage)
+	d.retryMutex.Lock()
+	messageID, renew := d.retry.nextAttempt(bundle.Call, d.retryPolicy)
+	d.retryMutex.Unlock()
+	if renew {
+		// Generated without holding the lock, since collision checks inspect the retry state as well
+		if id, err := d.generateMessageId(""); err != nil {
+			d.logger.Errorf("reusing message ID %s for retransmission of request %s: %v", messageID, bundle.Call.UniqueId, err)
+		} else {
+			d.retryMutex.Lock()
+			d.retry.supersede(id)
+			d.retryMutex.Unlock()
+			messageID = id
+		}
+	}
+	jsonMessage, err := wireMessage(bundle, messageID)
+	if err == nil {
+		d.pendingRequestState.AddPendingRequest(messageID, bundle.Call.Payload)
+		// Attempt to send over network
+		err = d.network.Write(jsonMessage)
+	}
 	if err != nil {
-		// TODO: handle retransmission instead of skipping request altogether
+		if delay, retry := d.retryRequest(bundle); retry {
+			d.logger.Errorf("failed to dispatch request %s, retransmitting in %v: %v", bundle.Call.UniqueId, delay, err)
+			return delay
+		}
 		d.CompleteRequest(bundle.Call.GetUniqueId())
 		if d.onRequestCancel != nil {
 			d.onRequestCancel(bundle.Call.UniqueId, bundle.Call.Payload,
 				ocpp.NewError(InternalError, err.Error(), bundle.Call.UniqueId))
 		}
+		return d.timeout
 	}
 
-	d.logger.Infof("dispatched request %s to server", bundle.Call.UniqueId)
+	if d.onRequestSent != nil {
+		d.onRequestSent("", bundle.Call.UniqueId)
+	}
+	d.logger.Infof("dispatched request %s to server", messageID)
 	d.logger.Debugf("sent JSON message to server: %s", string(jsonMessage))
+	return d.timeout
+}
+
+// retryRequest checks whether the request at the front of the queue may be retransmitted, according to the retry policy.
+// If so, the backoff before the retransmission is returned.
+//
+// The request stays pending until the backoff elapsed (see retransmissionDue), so that a late response is still accepted.
+func (d *DefaultClientDispatcher) retryRequest(bundle RequestBundle) (time.Duration, bool) {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	if d.retry.requestID != bundle.Call.UniqueId || !d.retryPolicy.canRetry(bundle.Call.Action, d.retry.attempts) {
+		return 0, false
+	}
+	d.retry.backoff = true
+	return d.retryPolicy.backoff(d.retry.attempts), true
+}
+
+// retransmissionDue checks whether the request is waiting for its retransmission, once the backoff elapsed.
+// If so, the pending request of the previous transmission is released.
+func (d *DefaultClientDispatcher) retransmissionDue() bool {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	if !d.retry.backoff {
+		return false
+	}
+	d.retry.backoff = false
+	d.pendingRequestState.DeletePendingRequest(d.retry.messageID)
+	return true
+}
+
+func (d *DefaultClientDispatcher) restoreRequests(decode func(data []byte) (*Call, error)) error {
+	if q, ok := d.requestQueue.(PersistentRequestQueue); ok {
+		return q.Restore(decode)
+	}
+	return nil
+}
+
+func (d *DefaultClientDispatcher) originalRequestID(_ string, messageID string) string {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	return d.retry.requestFor(messageID)
+}
+
+func (d *DefaultClientDispatcher) supersededRequest(_ string, messageID string) (string, bool) {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	return d.retry.supersededRequest(messageID)
+}
+
+func (d *DefaultClientDispatcher) isMessageIdInUse(_ string, messageID string) bool {
+	d.retryMutex.Lock()
+	inUse := d.retry.isMessageIdInUse(messageID)
+	d.retryMutex.Unlock()
+	return inUse || isQueued(d.requestQueue, messageID)
+}
+
+// generateMessageId returns a new message ID for a retransmitted request.
+// Falls back to the package-level generator, if none was set.
+func (d *DefaultClientDispatcher) generateMessageId(clientID string) (string, error) {
+	if d.newMessageId == nil {
+		return messageIdGenerator(), nil
+	}
+	return d.newMessageId(clientID)
 }
 
 func (d *DefaultClientDispatcher) Pause() {
@@ -223,19 +374,93 @@ func (d *DefaultClientDispatcher) Resume() {
 }
 
 func (d *DefaultClientDispatcher) CompleteRequest(requestId string) {
+	if d.completeRequest(requestId) {
+		// Signal that next message in queue may be sent
+		d.readyForDispatch <- true
+	}
+}
+
+// completeRequest removes the request at the front of the queue, if it matches requestId, and releases its pending slot.
+// Returns true if the request was removed.
+func (d *DefaultClientDispatcher) completeRequest(requestId string) bool {
 	el := d.requestQueue.Peek()
 	if el == nil {
 		d.logger.Errorf("attempting to pop front of queue, but queue is empty")
-		return
+		return false
 	}
 	bundle, _ := el.(RequestBundle)
+	d.retryMutex.Lock()
+	requestId = d.retry.requestFor(requestId)
 	if bundle.Call.UniqueId != requestId {
+		d.retryMutex.Unlock()
 		d.logger.Errorf("internal state mismatch: received response for %v but expected response for %v", requestId, bundle.Call.UniqueId)
-		return
+		return false
 	}
+	messageID := d.retry.messageFor(requestId)
+	d.retry = retryState{}
+	d.retryMutex.Unlock()
 	d.requestQueue.Pop()
-	d.pendingRequestState.DeletePendingRequest(requestId)
+	d.pendingRequestState.DeletePendingRequest(messageID)
 	d.logger.Debugf("removed request %v from front of queue", bundle.Call.UniqueId)
-	// Signal that next message in queue may be sent
-	d.readyForDispatch <- true
+	return true
+}
+
+// clientCancelation is a request to cancel a request, processed by the message pump.
+type clientCancelation struct {
+	requestID string
+	result    chan cancelResult
+}
+
+// cancelResult is the outcome of canceling a request from within a message pump.
+type cancelResult int
+
+const (
+	cancelNotFound cancelResult = iota // The request was neither in flight nor queued.
+	cancelRemoved                      // The request was removed from the queue, before being sent.
+	cancelReleased                     // The request was at the front of the queue, and its pending slot was released.
+)
+
+// CancelRequest cancels a request on behalf of the caller. See ClientRequestCanceler for details.
+//
+// The request is canceled by the message pump, so it can't be dispatched while being canceled.
+// For this reason, CancelRequest must not be invoked from within the onRequestCanceled callback.
+func (d *DefaultClientDispatcher) CancelRequest(requestID string) bool {
+	d.mutex.RLock()
+	stoppedC := d.stoppedC
+	running := d.requestChannel != nil
+	d.mutex.RUnlock()
+	if !running {
+		return false
+	}
+	c := clientCancelation{requestID: requestID, result: make(chan cancelResult, 1)}
+	select {
+	case d.cancelC <- c:
+	case <-stoppedC:
+		return false
+	}
+	switch <-c.result {
+	case cancelReleased:
+		d.logger.Debugf("canceled request %v", requestID)
+	case cancelRemoved:
+		d.logger.Debugf("canceled queued request %v", requestID)
+	default:
+		return false
+	}
+	return true
+}
+
+// cancelRequest removes a request from the queue. Must be invoked by the message pump.
+func (d *DefaultClientDispatcher) cancelRequest(requestID string) cancelResult {
+	isRequest := matchRequestID(requestID)
+	if isRequest(d.requestQueue.Peek()) {
+		// The request may already be in flight: release the pending slot as well
+		if d.completeRequest(requestID) {
+			return cancelReleased
+		}
+		return cancelNotFound
+	}
+	if q, ok := d.requestQueue.(RemovableRequestQueue); ok && q.Remove(isRequest) != nil {
+		return cancelRemoved
+	}
+	return cancelNotFound
 }
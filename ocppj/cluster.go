@@ -0,0 +1,562 @@
+package ocppj
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+)
+
+// ConnectionRegistry keeps track of the node, to which each client of a cluster is connected.
+//
+// Implementations must be safe for concurrent use. A reference implementation backed by Redis
+// is available in the cluster package.
+type ConnectionRegistry interface {
+	// Register records that a client is connected to the given node, replacing any previous record.
+	Register(ctx context.Context, clientID string, nodeID string) error
+	// Unregister removes the record of a client, but only if the client is still registered to the given node.
+	Unregister(ctx context.Context, clientID string, nodeID string) error
+	// Lookup returns the node, to which a client is connected.
+	// The returned flag is false, if the client isn't connected to any node.
+	Lookup(ctx context.Context, clientID string) (string, bool, error)
+}
+
+// ClusterTransport delivers messages between the nodes of a cluster.
+//
+// Implementations must be safe for concurrent use. A reference implementation backed by Redis
+// is available in the cluster package.
+type ClusterTransport interface {
+	// Start starts receiving the messages addressed to the given node.
+	// Every message is passed to the handler, in the order it was received.
+	Start(nodeID string, handler func(data []byte)) error
+	// Send delivers a message to a node. An error is returned, if the node couldn't be reached.
+	Send(ctx context.Context, nodeID string, data []byte) error
+	// Stop stops receiving messages and releases all resources.
+	Stop() error
+}
+
+// ClusterConfig contains the configuration of a server, which is part of a cluster.
+type ClusterConfig struct {
+	// The unique ID of this node within the cluster.
+	NodeID string
+	// The registry shared by all nodes.
+	Registry ConnectionRegistry
+	// The transport used for forwarding requests and responses between nodes.
+	Transport ClusterTransport
+	// The maximum time to wait for the response to a request forwarded to another node.
+	// Defaults to twice the default dispatcher timeout.
+	RequestTimeout time.Duration
+}
+
+// SetCluster makes the server part of a cluster of servers, e.g. replicas running behind a load balancer.
+//
+// Connected clients are recorded in the registry. Requests sent to a client connected to another node
+// are forwarded to that node, which sends them to the client and forwards the response back.
+// The response, error and canceled request handlers are then invoked on the node, which sent the request,
+// just as for local clients, but in a separate goroutine. The channel passed to the handlers only provides the ID of the client.
+//
+// Requests to clients connected to another node are neither queued nor passed to middlewares on the sending node.
+// This happens on the node, to which the client is connected.
+//
+// The cluster must be set before starting the server.
+func (s *Server) SetCluster(config ClusterConfig) {
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = 2 * defaultMessageTimeout
+	}
+	s.cluster = &cluster{config: config}
+}
+
+type clusterMessageType string
+
+const (
+	// A request forwarded to the node, to which the client is connected.
+	clusterRequest clusterMessageType = "request"
+	// A previously forwarded request was canceled by the sending node.
+	clusterCancel clusterMessageType = "cancel"
+	// The response to a forwarded request.
+	clusterResult clusterMessageType = "result"
+	// The error returned by the client for a forwarded request.
+	clusterError clusterMessageType = "error"
+	// A forwarded request couldn't be delivered, or timed out.
+	clusterCanceled clusterMessageType = "canceled"
+)
+
+// clusterMessage is the envelope of all messages sent between nodes.
+type clusterMessage struct {
+	Type             clusterMessageType `json:"type"`
+	Node             string             `json:"node"`
+	ClientID         string             `json:"clientId"`
+	RequestID        string             `json:"requestId"`
+	Action           string             `json:"action,omitempty"`
+	Payload          json.RawMessage    `json:"payload,omitempty"`
+	ErrorCode        ocpp.ErrorCode     `json:"errorCode,omitempty"`
+	ErrorDescription string             `json:"errorDescription,omitempty"`
+	ErrorDetails     json.RawMessage    `json:"errorDetails,omitempty"`
+}
+
+// remoteRequest is a request sent by this node to a client connected to another node.
+type remoteRequest struct {
+	nodeID  string
+	request ocpp.Request
+	timer   *time.Timer
+}
+
+// forwardedRequest identifies the original request of another node, which this node sent on its behalf.
+type forwardedRequest struct {
+	nodeID    string
+	requestID string
+}
+
+// cluster contains the state of a server, which is part of a cluster.
+type cluster struct {
+	config    ClusterConfig
+	mutex     sync.Mutex
+	started   bool
+	remote    map[string]map[string]*remoteRequest   // by client ID and request ID
+	forwarded map[string]map[string]forwardedRequest // by client ID and local request ID
+}
+
+func (c *cluster) addRemote(clientID string, requestID string, r *remoteRequest) {
+	if c.remote == nil {
+		c.remote = map[string]map[string]*remoteRequest{}
+	}
+	if c.remote[clientID] == nil {
+		c.remote[clientID] = map[string]*remoteRequest{}
+	}
+	c.remote[clientID][requestID] = r
+}
+
+// hasRemote returns true if a request with the given ID was sent to a client connected to another node.
+func (c *cluster) hasRemote(clientID string, requestID string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, ok := c.remote[clientID][requestID]
+	return ok
+}
+
+// takeRemote removes a request sent to a client connected to another node, and stops its timeout.
+func (c *cluster) takeRemote(clientID string, requestID string) (*remoteRequest, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	r, ok := c.remote[clientID][requestID]
+	if !ok {
+		return nil, false
+	}
+	r.timer.Stop()
+	delete(c.remote[clientID], requestID)
+	if len(c.remote[clientID]) == 0 {
+		delete(c.remote, clientID)
+	}
+	return r, true
+}
+
+func (c *cluster) addForwarded(clientID string, requestID string, origin forwardedRequest) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.forwarded == nil {
+		c.forwarded = map[string]map[string]forwardedRequest{}
+	}
+	if c.forwarded[clientID] == nil {
+		c.forwarded[clientID] = map[string]forwardedRequest{}
+	}
+	c.forwarded[clientID][requestID] = origin
+}
+
+// takeForwarded removes a request sent on behalf of another node, and returns its origin.
+func (c *cluster) takeForwarded(clientID string, requestID string) (forwardedRequest, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	origin, ok := c.forwarded[clientID][requestID]
+	if !ok {
+		return origin, false
+	}
+	delete(c.forwarded[clientID], requestID)
+	if len(c.forwarded[clientID]) == 0 {
+		delete(c.forwarded, clientID)
+	}
+	return origin, true
+}
+
+// takeForwardedClient removes all requests for a client sent on behalf of other nodes.
+func (c *cluster) takeForwardedClient(clientID string) map[string]forwardedRequest {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	requests := c.forwarded[clientID]
+	delete(c.forwarded, clientID)
+	return requests
+}
+
+// findForwarded returns the local request ID of a request sent on behalf of another node.
+func (c *cluster) findForwarded(clientID string, origin forwardedRequest) (string, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for requestID, o := range c.forwarded[clientID] {
+		if o == origin {
+			return requestID, true
+		}
+	}
+	return "", false
+}
+
+// remoteChannel represents a client connected to another node of the cluster.
+type remoteChannel struct {
+	id string
+}
+
+func (c remoteChannel) ID() string                               { return c.id }
+func (c remoteChannel) RemoteAddr() net.Addr                     { return nil }
+func (c remoteChannel) TLSConnectionState() *tls.ConnectionState { return nil }
+func (c remoteChannel) IsConnected() bool                        { return true }
+
+// startCluster starts receiving messages from other nodes, if the server is part of a cluster.
+func (s *Server) startCluster() {
+	c := s.cluster
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	started := c.started
+	c.started = true
+	c.mutex.Unlock()
+	if started {
+		return
+	}
+	if err := c.config.Transport.Start(c.config.NodeID, s.onClusterMessage); err != nil {
+		s.logger.Errorf("failed to start cluster transport for node %s: %v", c.config.NodeID, err)
+	}
+}
+
+// stopCluster stops receiving messages from other nodes and discards all requests sent to other nodes.
+func (s *Server) stopCluster() {
+	c := s.cluster
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	started := c.started
+	c.started = false
+	for _, requests := range c.remote {
+		for _, r := range requests {
+			r.timer.Stop()
+		}
+	}
+	c.remote = nil
+	c.forwarded = nil
+	c.mutex.Unlock()
+	if !started {
+		return
+	}
+	if err := c.config.Transport.Stop(); err != nil {
+		s.logger.Errorf("failed to stop cluster transport for node %s: %v", c.config.NodeID, err)
+	}
+}
+
+// isLocalClient returns true, if the client is connected to this node.
+func (s *Server) isLocalClient(clientID string) bool {
+	_, ok := s.server.GetChannel(clientID)
+	return ok
+}
+
+// sendRemoteRequest forwards a request to the node, to which the client is connected.
+func (s *Server) sendRemoteRequest(ctx context.Context, clientID string, request ocpp.Request) (string, error) {
+	c := s.cluster
+	nodeID, ok, err := c.config.Registry.Lookup(ctx, clientID)
+	if err != nil {
+		return "", fmt.Errorf("couldn't look up node of client %s: %w", clientID, err)
+	}
+	if !ok || nodeID == c.config.NodeID {
+		return "", fmt.Errorf("client %s is not connected to any node", clientID)
+	}
+	payload, err := s.Codec().Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	c.mutex.Lock()
+	call, err := s.createCall(request, func(id string) bool {
+		// The cluster is already locked
+		_, ok := c.remote[clientID][id]
+		return ok || s.isMessageIdInUseByNode(clientID, id)
+	})
+	if err != nil {
+		c.mutex.Unlock()
+		return "", err
+	}
+	requestID := call.UniqueId
+	c.addRemote(clientID, requestID, &remoteRequest{
+		nodeID:  nodeID,
+		request: request,
+		timer: time.AfterFunc(c.config.RequestTimeout, func() {
+			s.onRemoteRequestTimeout(clientID, requestID)
+		}),
+	})
+	c.mutex.Unlock()
+
+	err = s.sendClusterMessage(ctx, nodeID, clusterMessage{
+		Type:      clusterRequest,
+		ClientID:  clientID,
+		RequestID: requestID,
+		Action:    call.Action,
+		Payload:   payload,
+	})
+	if err != nil {
+		c.takeRemote(clientID, requestID)
+		return "", fmt.Errorf("couldn't forward request to node %s: %w", nodeID, err)
+	}
+	s.requestContexts.watch(ctx, clientID, requestID, func() {
+		s.cancelRemoteRequest(clientID, requestID)
+		s.logger.Debugf("canceled forwarded CALL [%s, %s] for %s: %v", requestID, call.Action, clientID, ctx.Err())
+	})
+	s.logger.Debugf("forwarded CALL [%s, %s] for %s to node %s", requestID, call.Action, clientID, nodeID)
+	return requestID, nil
+}
+
+// cancelRemoteRequest cancels a request sent to a client connected to another node.
+// Returns true if the request was found.
+func (s *Server) cancelRemoteRequest(clientID string, requestID string) bool {
+	r, ok := s.cluster.takeRemote(clientID, requestID)
+	if !ok {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := s.sendClusterMessage(ctx, r.nodeID, clusterMessage{Type: clusterCancel, ClientID: clientID, RequestID: requestID})
+	if err != nil {
+		s.logger.Errorf("couldn't cancel request %s for %s on node %s: %v", requestID, clientID, r.nodeID, err)
+	}
+	return true
+}
+
+func (s *Server) onRemoteRequestTimeout(clientID string, requestID string) {
+	r, ok := s.cluster.takeRemote(clientID, requestID)
+	if !ok {
+		return
+	}
+	s.requestContexts.release(clientID, requestID)
+	s.logger.Infof("forwarded request %s for %s timed out", requestID, clientID)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = s.sendClusterMessage(ctx, r.nodeID, clusterMessage{Type: clusterCancel, ClientID: clientID, RequestID: requestID})
+	if s.canceledRequestHandler != nil {
+		s.canceledRequestHandler(clientID, requestID, r.request, newRequestTimeoutError(requestID))
+	}
+}
+
+func (s *Server) sendClusterMessage(ctx context.Context, nodeID string, message clusterMessage) error {
+	message.Node = s.cluster.config.NodeID
+	data, err := s.Codec().Marshal(message)
+	if err != nil {
+		return err
+	}
+	return s.cluster.config.Transport.Send(ctx, nodeID, data)
+}
+
+// onClusterMessage handles a message received from another node.
+//
+// Messages are handled in the order they were received, but handlers of the application are invoked asynchronously,
+// so the transport keeps receiving messages while they run, e.g. if a handler waits for another forwarded request.
+func (s *Server) onClusterMessage(data []byte) {
+	var message clusterMessage
+	if err := s.Codec().Unmarshal(data, &message); err != nil {
+		s.logger.Errorf("invalid cluster message: %v", err)
+		return
+	}
+	switch message.Type {
+	case clusterRequest:
+		s.onForwardedRequest(message)
+	case clusterCancel:
+		origin := forwardedRequest{nodeID: message.Node, requestID: message.RequestID}
+		if requestID, ok := s.cluster.findForwarded(message.ClientID, origin); ok {
+			s.cluster.takeForwarded(message.ClientID, requestID)
+			s.CancelRequest(message.ClientID, requestID)
+		}
+	case clusterResult, clusterError, clusterCanceled:
+		s.onRemoteResponse(message)
+	default:
+		s.logger.Errorf("unknown cluster message type %v from node %s", message.Type, message.Node)
+	}
+}
+
+// onForwardedRequest sends a request forwarded by another node to a client connected to this node.
+func (s *Server) onForwardedRequest(message clusterMessage) {
+	origin := forwardedRequest{nodeID: message.Node, requestID: message.RequestID}
+	reject := func(code ocpp.ErrorCode, description string) {
+		s.logger.Errorf("couldn't send request %s forwarded by node %s to %s: %s", message.RequestID, message.Node, message.ClientID, description)
+		s.replyCanceled(message.ClientID, origin, ocpp.NewError(code, description, message.RequestID))
+	}
+	profile, ok := s.GetProfileForFeature(message.Action)
+	if !ok {
+		reject(NotSupported, fmt.Sprintf("unsupported action %s", message.Action))
+		return
+	}
+	request, err := s.parseRawJsonRequest(message.Payload, profile.GetFeature(message.Action).GetRequestType())
+	if err != nil {
+		reject(FormatErrorType(s), err.Error())
+		return
+	}
+	if !s.dispatcher.IsRunning() || s.shuttingDown.Load() {
+		reject(GenericError, "server is not running")
+		return
+	}
+	var requestID string
+	_, err = s.sendRequest(context.Background(), message.ClientID, request, func(id string) {
+		requestID = id
+		s.cluster.addForwarded(message.ClientID, id, origin)
+	})
+	if err != nil {
+		if requestID != "" {
+			s.cluster.takeForwarded(message.ClientID, requestID)
+		}
+		reject(InternalError, err.Error())
+	}
+}
+
+// replyCanceled notifies the origin of a forwarded request, that the request was canceled.
+func (s *Server) replyCanceled(clientID string, origin forwardedRequest, err *ocpp.Error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sendErr := s.sendClusterMessage(ctx, origin.nodeID, clusterMessage{
+		Type:             clusterCanceled,
+		ClientID:         clientID,
+		RequestID:        origin.requestID,
+		ErrorCode:        err.Code,
+		ErrorDescription: err.Description,
+	})
+	if sendErr != nil {
+		s.logger.Errorf("couldn't notify node %s of canceled request %s: %v", origin.nodeID, origin.requestID, sendErr)
+	}
+}
+
+// onRemoteResponse handles the outcome of a request sent to a client connected to another node.
+func (s *Server) onRemoteResponse(message clusterMessage) {
+	r, ok := s.cluster.takeRemote(message.ClientID, message.RequestID)
+	if !ok {
+		s.logger.Debugf("discarding %s for unknown forwarded request %s from node %s", message.Type, message.RequestID, message.Node)
+		return
+	}
+	s.requestContexts.release(message.ClientID, message.RequestID)
+	channel := remoteChannel{id: message.ClientID}
+	switch message.Type {
+	case clusterResult:
+		action := r.request.GetFeatureName()
+		profile, _ := s.GetProfileForFeature(action)
+		response, err := s.parseRawJsonConfirmation(message.Payload, profile.GetFeature(action).GetResponseType())
+		if err != nil {
+			if errorHandler := s.errorHandler; errorHandler != nil {
+				go errorHandler(channel, ocpp.NewError(FormatErrorType(s), err.Error(), message.RequestID), nil)
+			}
+			return
+		}
+		if responseHandler := s.responseHandler; responseHandler != nil {
+			go responseHandler(channel, response, message.RequestID)
+		}
+	case clusterError:
+		if errorHandler := s.errorHandler; errorHandler != nil {
+			var details interface{}
+			if len(message.ErrorDetails) > 0 {
+				details = rawJsonValue(s.Codec(), message.ErrorDetails)
+			}
+			go errorHandler(channel, ocpp.NewError(message.ErrorCode, message.ErrorDescription, message.RequestID), details)
+		}
+	case clusterCanceled:
+		if canceledRequestHandler := s.canceledRequestHandler; canceledRequestHandler != nil {
+			go canceledRequestHandler(message.ClientID, message.RequestID, r.request,
+				ocpp.NewError(message.ErrorCode, message.ErrorDescription, message.RequestID))
+		}
+	}
+}
+
+// forwardResponse forwards the response to a request sent on behalf of another node.
+// Returns false, if the request was sent by this node.
+func (s *Server) forwardResponse(clientID string, requestID string, response ocpp.Response) bool {
+	if s.cluster == nil {
+		return false
+	}
+	origin, ok := s.cluster.takeForwarded(clientID, requestID)
+	if !ok {
+		return false
+	}
+	message := clusterMessage{Type: clusterResult, ClientID: clientID, RequestID: origin.requestID, Action: response.GetFeatureName()}
+	payload, err := s.Codec().Marshal(response)
+	if err != nil {
+		message = clusterMessage{Type: clusterError, ClientID: clientID, RequestID: origin.requestID,
+			ErrorCode: FormatErrorType(s), ErrorDescription: err.Error()}
+	} else {
+		message.Payload = payload
+	}
+	s.sendForwardedOutcome(origin, message)
+	return true
+}
+
+// forwardError forwards an error received for a request sent on behalf of another node.
+// Returns false, if the request was sent by this node.
+func (s *Server) forwardError(clientID string, requestID string, ocppErr *ocpp.Error, details interface{}) bool {
+	if s.cluster == nil {
+		return false
+	}
+	origin, ok := s.cluster.takeForwarded(clientID, requestID)
+	if !ok {
+		return false
+	}
+	message := clusterMessage{Type: clusterError, ClientID: clientID, RequestID: origin.requestID,
+		ErrorCode: ocppErr.Code, ErrorDescription: ocppErr.Description}
+	if details != nil {
+		message.ErrorDetails, _ = s.Codec().Marshal(details)
+	}
+	s.sendForwardedOutcome(origin, message)
+	return true
+}
+
+// forwardCanceled notifies the origin of a request sent on behalf of another node, that the request was canceled.
+// Returns false, if the request was sent by this node.
+func (s *Server) forwardCanceled(clientID string, requestID string, err *ocpp.Error) bool {
+	if s.cluster == nil {
+		return false
+	}
+	origin, ok := s.cluster.takeForwarded(clientID, requestID)
+	if !ok {
+		return false
+	}
+	s.replyCanceled(clientID, origin, err)
+	return true
+}
+
+func (s *Server) sendForwardedOutcome(origin forwardedRequest, message clusterMessage) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.sendClusterMessage(ctx, origin.nodeID, message); err != nil {
+		s.logger.Errorf("couldn't forward %s for request %s to node %s: %v", message.Type, origin.requestID, origin.nodeID, err)
+	}
+}
+
+// registerClient records a client connected to this node in the cluster registry.
+func (s *Server) registerClient(clientID string) {
+	if s.cluster == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.cluster.config.Registry.Register(ctx, clientID, s.cluster.config.NodeID); err != nil {
+		s.logger.Errorf("failed to register client %s in cluster: %v", clientID, err)
+	}
+}
+
+// unregisterClient removes a client disconnected from this node from the cluster registry.
+// Requests sent to the client on behalf of other nodes are canceled.
+func (s *Server) unregisterClient(clientID string) {
+	if s.cluster == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.cluster.config.Registry.Unregister(ctx, clientID, s.cluster.config.NodeID); err != nil {
+		s.logger.Errorf("failed to unregister client %s from cluster: %v", clientID, err)
+	}
+	for requestID, origin := range s.cluster.takeForwardedClient(clientID) {
+		s.replyCanceled(clientID, origin, ocpp.NewError(GenericError, "client disconnected", requestID))
+	}
+}
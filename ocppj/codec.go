@@ -0,0 +1,102 @@
+package ocppj
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Codec encodes and decodes OCPP-J messages exchanged by an endpoint.
+//
+// Messages are encoded as JSON arrays containing the payload, while incoming messages are decoded
+// into a []json.RawMessage envelope first, before decoding the payload into the request/response type of the feature.
+// Implementations must therefore honor the json.Marshaler and json.Unmarshaler interfaces,
+// as well as the `json` struct tags of the payload types.
+//
+// A Codec may be used by multiple goroutines concurrently.
+type Codec interface {
+	// Marshal returns the JSON encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal parses the JSON-encoded data and stores the result in the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+	// SetEscapeHTML specifies whether problematic HTML characters (e.g. "<", ">", "&")
+	// should be escaped inside JSON strings, when marshaling.
+	SetEscapeHTML(on bool)
+}
+
+// JSONCodec is the default Codec, based on the encoding/json package of the standard library.
+type JSONCodec struct {
+	escapeHTML *atomic.Bool
+}
+
+// NewJSONCodec creates a new Codec based on encoding/json. HTML characters are escaped by default.
+func NewJSONCodec() *JSONCodec {
+	codec := &JSONCodec{escapeHTML: &atomic.Bool{}}
+	codec.escapeHTML.Store(true)
+	return codec
+}
+
+func (c *JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	buffer := &bytes.Buffer{}
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(c.escapeHTML.Load())
+	err := encoder.Encode(v)
+	return bytes.TrimRight(buffer.Bytes(), "\n"), err
+}
+
+func (c *JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (c *JSONCodec) SetEscapeHTML(on bool) {
+	c.escapeHTML.Store(on)
+}
+
+// The package-wide codec, used by endpoints without a codec of their own.
+// It shares the EscapeHTML flag, so SetHTMLEscape keeps working as before.
+var defaultCodec = &JSONCodec{escapeHTML: &EscapeHTML}
+
+// SetCodec sets the codec used by the endpoint to encode outgoing and decode incoming messages.
+// Passing nil restores the default codec, which is based on encoding/json and honors SetHTMLEscape.
+//
+// The codec should be set before starting the endpoint.
+func (endpoint *Endpoint) SetCodec(codec Codec) {
+	endpoint.codec = codec
+}
+
+// Codec returns the codec used by the endpoint.
+func (endpoint *Endpoint) Codec() Codec {
+	if endpoint.codec == nil {
+		return defaultCodec
+	}
+	return endpoint.codec
+}
+
+// MarshalMessage encodes an OCPP-J message using the codec of the endpoint.
+func (endpoint *Endpoint) MarshalMessage(message Message) ([]byte, error) {
+	return marshalMessage(endpoint.Codec(), message)
+}
+
+// ParseEnvelope decodes the envelope of an OCPP-J message using the codec of the endpoint.
+// The returned elements may be passed to ParseRawMessage.
+func (endpoint *Endpoint) ParseEnvelope(data []byte) ([]json.RawMessage, error) {
+	var arr []json.RawMessage
+	err := endpoint.Codec().Unmarshal(data, &arr)
+	if err != nil {
+		return nil, err
+	}
+	return arr, nil
+}
+
+func marshalMessage(codec Codec, message Message) ([]byte, error) {
+	switch msg := message.(type) {
+	case *Call:
+		return codec.Marshal(msg.fields())
+	case *CallResult:
+		return codec.Marshal(msg.fields())
+	case *CallError:
+		return codec.Marshal(msg.fields())
+	default:
+		return message.MarshalJSON()
+	}
+}
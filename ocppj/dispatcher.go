@@ -1,6 +1,7 @@
 package ocppj
 
 import (
+	"errors"
 	"time"
 
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
@@ -73,6 +74,71 @@ type ClientDispatcher interface {
 	Resume()
 }
 
+// ClientRequestCanceler is an optional interface of a ClientDispatcher, which supports canceling requests
+// on behalf of the caller (typically because the context of a request is done).
+// If the dispatcher doesn't implement it, requests cannot be canceled and are sent regardless.
+type ClientRequestCanceler interface {
+	// Cancels a request on behalf of the caller.
+	// The request is removed from the queue, regardless of whether it was already sent or not.
+	// If the request was pending, its slot is released, so the next queued request may be processed.
+	// A response arriving later for a canceled request will be discarded.
+	//
+	// The onRequestCanceled callback is not triggered. Returns true if the request was found.
+	CancelRequest(requestID string) bool
+}
+
+// ServerRequestCanceler is an optional interface of a ServerDispatcher, which supports canceling requests
+// on behalf of the caller (typically because the context of a request is done).
+// If the dispatcher doesn't implement it, requests cannot be canceled and are sent regardless.
+type ServerRequestCanceler interface {
+	// Cancels a request for a specific client on behalf of the caller.
+	// The request is removed from the client's queue, regardless of whether it was already sent or not.
+	// If the request was pending, its slot is released, so the next queued request may be processed.
+	// A response arriving later for a canceled request will be discarded.
+	//
+	// The onRequestCanceled callback is not triggered. Returns true if the request was found.
+	CancelRequest(clientID string, requestID string) bool
+}
+
+// messageIdChecker is implemented by dispatchers, which can tell whether a message ID is used by a request
+// they hold, i.e. a queued request or a previous transmission of the request in flight.
+// Endpoints use it to avoid generating message IDs, which collide with these requests.
+type messageIdChecker interface {
+	isMessageIdInUse(clientID string, messageID string) bool
+}
+
+// matchRequestID returns a queue matcher for the RequestBundle with the given requestID.
+func matchRequestID(requestID string) func(element interface{}) bool {
+	return func(element interface{}) bool {
+		bundle, ok := element.(RequestBundle)
+		return ok && bundle.Call != nil && bundle.Call.UniqueId == requestID
+	}
+}
+
+// Description of the error passed to the onRequestCanceled callback, when no response was received in time.
+const requestTimeoutDescription = "Request timed out"
+
+// Description of the error passed to the onRequestCanceled callback, when a queued request was dropped
+// in favor of a new one, according to the drop policy of the queue.
+const droppedRequestDescription = "Request dropped from full queue"
+
+// newRequestTimeoutError creates the error passed to the onRequestCanceled callback, when a request timed out.
+func newRequestTimeoutError(requestID string) *ocpp.Error {
+	return ocpp.NewError(GenericError, requestTimeoutDescription, requestID)
+}
+
+// isRequestTimeoutError returns true, if err signals that no response to a request was received in time.
+func isRequestTimeoutError(err *ocpp.Error) bool {
+	return err != nil && err.Code == GenericError && err.Description == requestTimeoutDescription
+}
+
+// IsRequestTimeout returns true, if err was passed to a canceled request handler
+// because no response to the request was received in time.
+func IsRequestTimeout(err error) bool {
+	var ocppErr *ocpp.Error
+	return errors.As(err, &ocppErr) && isRequestTimeoutError(ocppErr)
+}
+
 // pendingRequest is used internally for associating metadata to a pending Request.
 type pendingRequest struct {
 	request ocpp.Request
@@ -1,7 +1,9 @@
 package ocppj_test
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -60,6 +62,30 @@ func setupServerDispatcher() (*ocppj.DefaultServerDispatcher, ocppj.RequestBundl
 	return dispatcher, bundle, nil
 }
 
+// setupShardedServerDispatcher creates and configures a sharded server dispatcher for benchmarking
+// Returns the dispatcher and an example request bundle
+func setupShardedServerDispatcher(shards int) (*ocppj.ShardedServerDispatcher, ocppj.RequestBundle, error) {
+	endpoint := &ocppj.Server{}
+	mockProfile := ocpp.NewProfile("mock", &MockFeature{})
+	endpoint.AddProfile(mockProfile)
+	queueMap := ocppj.NewShardedQueueMap(shards, func() ocppj.ServerQueueMap { return ocppj.NewFIFOQueueMap(1000) })
+	dispatcher := ocppj.NewShardedServerDispatcher(queueMap, shards)
+
+	websocketServer := &MockWebsocketServer{}
+	websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	dispatcher.SetNetworkServer(websocketServer)
+	dispatcher.SetTimeout(30 * time.Second)
+	dispatcher.Start()
+
+	bundle, err := createRequestBundle(endpoint, "benchmark")
+	if err != nil {
+		dispatcher.Stop()
+		return nil, ocppj.RequestBundle{}, err
+	}
+
+	return dispatcher, bundle, nil
+}
+
 // createRequestBundle creates a request bundle from an endpoint and request value
 func createRequestBundle(endpoint interface {
 	CreateCall(request ocpp.Request) (*ocppj.Call, error)
@@ -238,3 +264,120 @@ func BenchmarkServerDispatcher_SendAndComplete(b *testing.B) {
 		}
 	})
 }
+
+// benchmarkServerDispatcherClients benchmarks the full cycle of sending and completing requests,
+// spread across many clients, as done during fleet-wide operations
+func benchmarkServerDispatcherClients(b *testing.B, dispatcher ocppj.ServerDispatcher, bundle ocppj.RequestBundle, clients int) {
+	clientIDs := make([]string, clients)
+	for i := range clientIDs {
+		clientIDs[i] = fmt.Sprintf("client%d", i)
+		dispatcher.CreateClient(clientIDs[i])
+	}
+	var counter atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			clientID := clientIDs[int(counter.Add(1))%clients]
+			_ = dispatcher.SendRequest(clientID, bundle)
+			dispatcher.CompleteRequest(clientID, bundle.Call.UniqueId)
+		}
+	})
+}
+
+// BenchmarkServerDispatcher_ManyClients benchmarks the default server dispatcher with many clients
+func BenchmarkServerDispatcher_ManyClients(b *testing.B) {
+	dispatcher, bundle, err := setupServerDispatcher()
+	if err != nil {
+		b.Fatalf("failed to setup server dispatcher: %v", err)
+	}
+	defer dispatcher.Stop()
+
+	benchmarkServerDispatcherClients(b, dispatcher, bundle, 1000)
+}
+
+// BenchmarkShardedServerDispatcher_SendAndComplete benchmarks the full cycle of sending and completing requests
+// in the sharded server dispatcher
+func BenchmarkShardedServerDispatcher_SendAndComplete(b *testing.B) {
+	dispatcher, bundle, err := setupShardedServerDispatcher(0)
+	if err != nil {
+		b.Fatalf("failed to setup server dispatcher: %v", err)
+	}
+	defer dispatcher.Stop()
+
+	clientID := "client1"
+	dispatcher.CreateClient(clientID)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = dispatcher.SendRequest(clientID, bundle)
+			dispatcher.CompleteRequest(clientID, bundle.Call.UniqueId)
+		}
+	})
+}
+
+// BenchmarkShardedServerDispatcher_ManyClients benchmarks the sharded server dispatcher with many clients,
+// using different numbers of shards
+func BenchmarkShardedServerDispatcher_ManyClients(b *testing.B) {
+	for _, shards := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			dispatcher, bundle, err := setupShardedServerDispatcher(shards)
+			if err != nil {
+				b.Fatalf("failed to setup server dispatcher: %v", err)
+			}
+			defer dispatcher.Stop()
+
+			benchmarkServerDispatcherClients(b, dispatcher, bundle, 1000)
+		})
+	}
+}
+
+// setupParsingEndpoint creates an endpoint with a pending request, as well as an incoming call and response for that request
+func setupParsingEndpoint() (*ocppj.Client, ocppj.ClientState, []byte, []byte) {
+	endpoint := &ocppj.Client{Id: "client1"}
+	endpoint.AddProfile(ocpp.NewProfile("mock", &MockFeature{}))
+	state := ocppj.NewClientState()
+	state.AddPendingRequest("1234", newMockRequest("benchmark"))
+	callData := []byte(`[2,"5678","` + MockFeatureName + `",{"mockValue":"benchmark"}]`)
+	resultData := []byte(`[3,"1234",{"mockValue":"benchmark"}]`)
+	return endpoint, state, callData, resultData
+}
+
+// BenchmarkParseMessage benchmarks parsing incoming messages from generic JSON elements,
+// which requires the payload to be encoded and decoded again
+func BenchmarkParseMessage(b *testing.B) {
+	endpoint, state, callData, resultData := setupParsingEndpoint()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range [][]byte{callData, resultData} {
+			arr, err := ocppj.ParseRawJsonMessage(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = endpoint.ParseMessage(arr, state); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// BenchmarkParseRawMessage benchmarks parsing incoming messages from raw JSON elements,
+// as done by the client and server, which decode the payload only once
+func BenchmarkParseRawMessage(b *testing.B) {
+	endpoint, state, callData, resultData := setupParsingEndpoint()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, data := range [][]byte{callData, resultData} {
+			arr, err := ocppj.ParseRawJsonEnvelope(data)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = endpoint.ParseRawMessage(arr, state); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ocppj_test
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -15,12 +16,17 @@ type ServerDispatcherTestSuite struct {
 	suite.Suite
 	mutex           sync.RWMutex
 	state           ocppj.ServerState
-	websocketServer MockWebsocketServer
+	websocketServer *MockWebsocketServer
 	endpoint        ocppj.Server
 	dispatcher      ocppj.ServerDispatcher
 	queueMap        ocppj.ServerQueueMap
 }
 
+// retryPolicySetter is implemented by the server dispatchers under test.
+type retryPolicySetter interface {
+	SetRetryPolicy(policy *ocppj.RetryPolicy)
+}
+
 func (s *ServerDispatcherTestSuite) SetupTest() {
 	s.endpoint = ocppj.Server{}
 	mockProfile := ocpp.NewProfile("mock", &MockFeature{})
@@ -29,8 +35,8 @@ func (s *ServerDispatcherTestSuite) SetupTest() {
 	s.dispatcher = ocppj.NewDefaultServerDispatcher(s.queueMap)
 	s.state = ocppj.NewServerState(&s.mutex)
 	s.dispatcher.SetPendingRequestState(s.state)
-	s.websocketServer = MockWebsocketServer{}
-	s.dispatcher.SetNetworkServer(&s.websocketServer)
+	s.websocketServer = &MockWebsocketServer{}
+	s.dispatcher.SetNetworkServer(s.websocketServer)
 }
 
 func (s *ServerDispatcherTestSuite) TestServerSendRequest() {
@@ -131,6 +137,85 @@ func (s *ServerDispatcherTestSuite) TestServerRequestCanceled() {
 	s.Assert().True(q.IsEmpty())
 }
 
+func (s *ServerDispatcherTestSuite) TestServerCancelRequest() {
+	// Setup
+	clientID := "client1"
+	sent := make(chan string, 2)
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(1).([]byte)
+		sent <- string(data)
+	}).Return(nil)
+	s.dispatcher.SetOnRequestCanceled(func(cID string, rID string, request ocpp.Request, err *ocpp.Error) {
+		s.Require().Fail("unexpected OnRequestCanceled")
+	})
+	s.dispatcher.Start()
+	s.dispatcher.CreateClient(clientID)
+	// Queue three requests: the first one will be in flight
+	requestIDs := []string{}
+	for i := 0; i < 3; i++ {
+		call, err := s.endpoint.CreateCall(newMockRequest("somevalue"))
+		s.Require().NoError(err)
+		data, err := call.MarshalJSON()
+		s.Require().NoError(err)
+		err = s.dispatcher.SendRequest(clientID, ocppj.RequestBundle{Call: call, Data: data})
+		s.Require().NoError(err)
+		requestIDs = append(requestIDs, call.UniqueId)
+	}
+	<-sent
+	s.Require().True(s.state.HasPendingRequest(clientID))
+	q, ok := s.queueMap.Get(clientID)
+	s.Require().True(ok)
+	// Cancel a queued request, which was never sent
+	s.Assert().True(s.dispatcher.(ocppj.ServerRequestCanceler).CancelRequest(clientID, requestIDs[1]))
+	s.Assert().Equal(2, q.Size())
+	s.Assert().False(s.dispatcher.(ocppj.ServerRequestCanceler).CancelRequest(clientID, requestIDs[1]))
+	s.Assert().False(s.dispatcher.(ocppj.ServerRequestCanceler).CancelRequest("otherClient", requestIDs[2]))
+	// Cancel the in-flight request, the next one is dispatched right away
+	s.Assert().True(s.dispatcher.(ocppj.ServerRequestCanceler).CancelRequest(clientID, requestIDs[0]))
+	select {
+	case data := <-sent:
+		s.Assert().Contains(data, requestIDs[2])
+	case <-time.After(time.Second):
+		s.Require().Fail("next request wasn't dispatched")
+	}
+	s.Assert().Equal(1, q.Size())
+	s.Assert().True(s.state.GetClientState(clientID).HasPendingRequest())
+	_, ok = s.state.GetClientState(clientID).GetPendingRequest(requestIDs[0])
+	s.Assert().False(ok)
+}
+
+func (s *ServerDispatcherTestSuite) TestServerCancelRequestWhileDispatching() {
+	// Setup
+	clientID := "client1"
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	s.dispatcher.Start()
+	s.dispatcher.CreateClient(clientID)
+	q, ok := s.queueMap.Get(clientID)
+	s.Require().True(ok)
+	for i := 0; i < 50; i++ {
+		requestIDs := []string{}
+		for j := 0; j < 2; j++ {
+			call, err := s.endpoint.CreateCall(newMockRequest("somevalue"))
+			s.Require().NoError(err)
+			data, err := call.MarshalJSON()
+			s.Require().NoError(err)
+			s.Require().NoError(s.dispatcher.SendRequest(clientID, ocppj.RequestBundle{Call: call, Data: data}))
+			requestIDs = append(requestIDs, call.UniqueId)
+		}
+		s.Require().Eventually(func() bool {
+			_, pending := s.state.GetClientState(clientID).GetPendingRequest(requestIDs[0])
+			return pending
+		}, time.Second, time.Millisecond)
+		// The second request may be dispatched while being canceled
+		go s.dispatcher.CompleteRequest(clientID, requestIDs[0])
+		s.Assert().True(s.dispatcher.(ocppj.ServerRequestCanceler).CancelRequest(clientID, requestIDs[1]))
+		// Either way, no request may remain pending
+		s.Require().Eventually(func() bool {
+			return q.IsEmpty() && !s.state.HasPendingRequest(clientID)
+		}, time.Second, time.Millisecond, "iteration %d", i)
+	}
+}
+
 func (s *ServerDispatcherTestSuite) TestCreateClient() {
 	// Setup
 	clientID := "client1"
@@ -223,13 +308,222 @@ func (s *ServerDispatcherTestSuite) TestServerDispatcherTimeout() {
 	s.Assert().True(clientQ.IsEmpty())
 }
 
+func (s *ServerDispatcherTestSuite) TestServerRetryOnWriteError() {
+	// Setup
+	clientID := "client1"
+	sent := make(chan string, 2)
+	// First write fails, retransmission succeeds
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(errors.New("mockError")).Once()
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(1).([]byte)
+		sent <- string(data)
+	}).Return(nil)
+	s.dispatcher.SetOnRequestCanceled(func(cID string, rID string, request ocpp.Request, err *ocpp.Error) {
+		s.Require().Fail("unexpected OnRequestCanceled")
+	})
+	dispatcher, ok := s.dispatcher.(retryPolicySetter)
+	s.Require().True(ok)
+	dispatcher.SetRetryPolicy(&ocppj.RetryPolicy{
+		MaxAttempts:    2,
+		Backoff:        ocppj.ExponentialBackoff(100*time.Millisecond, time.Second),
+		ReuseMessageID: true,
+	})
+	s.dispatcher.Start()
+	s.dispatcher.CreateClient(clientID)
+	// Send mock request
+	call, err := s.endpoint.CreateCall(newMockRequest("somevalue"))
+	s.Require().NoError(err)
+	data, err := call.MarshalJSON()
+	s.Require().NoError(err)
+	err = s.dispatcher.SendRequest(clientID, ocppj.RequestBundle{Call: call, Data: data})
+	s.Require().NoError(err)
+	// Request is retransmitted with the same message ID
+	select {
+	case msg := <-sent:
+		s.Assert().Equal(string(data), msg)
+	case <-time.After(time.Second):
+		s.Require().Fail("request wasn't retransmitted")
+	}
+	_, ok = s.state.GetClientState(clientID).GetPendingRequest(call.UniqueId)
+	s.Assert().True(ok)
+	// Complete request
+	s.dispatcher.CompleteRequest(clientID, call.UniqueId)
+	s.Assert().False(s.state.HasPendingRequest(clientID))
+}
+
+func (s *ServerDispatcherTestSuite) TestServerRetryOnTimeout() {
+	// Setup
+	clientID := "client1"
+	sent := make(chan string, 3)
+	canceled := make(chan string, 1)
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(1).([]byte)
+		sent <- string(data)
+	}).Return(nil)
+	s.dispatcher.SetOnRequestCanceled(func(cID string, rID string, request ocpp.Request, err *ocpp.Error) {
+		s.Assert().Equal(clientID, cID)
+		s.Assert().Equal(ocppj.GenericError, err.Code)
+		canceled <- rID
+	})
+	dispatcher, ok := s.dispatcher.(retryPolicySetter)
+	s.Require().True(ok)
+	dispatcher.SetRetryPolicy(&ocppj.RetryPolicy{
+		MaxAttempts: 3,
+		Features:    []string{MockFeatureName},
+	})
+	s.dispatcher.SetTimeout(200 * time.Millisecond)
+	s.dispatcher.Start()
+	s.dispatcher.CreateClient(clientID)
+	// Send mock request
+	call, err := s.endpoint.CreateCall(newMockRequest("somevalue"))
+	s.Require().NoError(err)
+	requestID := call.UniqueId
+	data, err := call.MarshalJSON()
+	s.Require().NoError(err)
+	err = s.dispatcher.SendRequest(clientID, ocppj.RequestBundle{Call: call, Data: data})
+	s.Require().NoError(err)
+	// Every retransmission uses a new message ID
+	messageIDs := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-sent:
+			arr, err := ocppj.ParseJsonMessage(msg)
+			s.Require().NoError(err)
+			messageIDs[arr[1].(string)] = true
+		case <-time.After(time.Second):
+			s.Require().Fail("request wasn't retransmitted")
+		}
+	}
+	s.Assert().Len(messageIDs, 3)
+	s.Assert().True(messageIDs[requestID])
+	// All attempts exhausted, request is canceled using the original ID
+	select {
+	case rID := <-canceled:
+		s.Assert().Equal(requestID, rID)
+	case <-time.After(time.Second):
+		s.Require().Fail("request wasn't canceled")
+	}
+	s.Assert().False(s.state.HasPendingRequest(clientID))
+	clientQ, _ := s.queueMap.Get(clientID)
+	s.Assert().True(clientQ.IsEmpty())
+}
+
+func (s *ServerDispatcherTestSuite) TestServerResponseDuringRetryBackoff() {
+	// Setup
+	clientID := "client1"
+	sent := make(chan string, 2)
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(1).([]byte)
+		sent <- string(data)
+	}).Return(nil)
+	s.dispatcher.SetOnRequestCanceled(func(cID string, rID string, request ocpp.Request, err *ocpp.Error) {
+		s.Require().Fail("unexpected OnRequestCanceled")
+	})
+	dispatcher, ok := s.dispatcher.(retryPolicySetter)
+	s.Require().True(ok)
+	dispatcher.SetRetryPolicy(&ocppj.RetryPolicy{
+		MaxAttempts:    2,
+		Backoff:        ocppj.ExponentialBackoff(500*time.Millisecond, time.Second),
+		ReuseMessageID: true,
+	})
+	s.dispatcher.SetTimeout(100 * time.Millisecond)
+	s.dispatcher.Start()
+	s.dispatcher.CreateClient(clientID)
+	// Send mock request
+	call, err := s.endpoint.CreateCall(newMockRequest("somevalue"))
+	s.Require().NoError(err)
+	data, err := call.MarshalJSON()
+	s.Require().NoError(err)
+	err = s.dispatcher.SendRequest(clientID, ocppj.RequestBundle{Call: call, Data: data})
+	s.Require().NoError(err)
+	<-sent
+	// Request timed out and awaits its retransmission, but is still pending
+	time.Sleep(200 * time.Millisecond)
+	_, ok = s.state.GetClientState(clientID).GetPendingRequest(call.UniqueId)
+	s.Require().True(ok)
+	// Late response completes the request, which isn't retransmitted anymore
+	s.dispatcher.CompleteRequest(clientID, call.UniqueId)
+	s.Assert().False(s.state.HasPendingRequest(clientID))
+	select {
+	case <-sent:
+		s.Require().Fail("request was retransmitted after receiving a response")
+	case <-time.After(600 * time.Millisecond):
+	}
+	clientQ, _ := s.queueMap.Get(clientID)
+	s.Assert().True(clientQ.IsEmpty())
+}
+
+// ShardedServerDispatcherTestSuite runs the server dispatcher tests against a ShardedServerDispatcher.
+type ShardedServerDispatcherTestSuite struct {
+	ServerDispatcherTestSuite
+}
+
+func (s *ShardedServerDispatcherTestSuite) SetupTest() {
+	s.ServerDispatcherTestSuite.SetupTest()
+	s.queueMap = ocppj.NewShardedQueueMap(4, func() ocppj.ServerQueueMap { return ocppj.NewFIFOQueueMap(10) })
+	s.dispatcher = ocppj.NewShardedServerDispatcher(s.queueMap, 4)
+	s.dispatcher.SetPendingRequestState(s.state)
+	s.dispatcher.SetNetworkServer(s.websocketServer)
+}
+
+func (s *ShardedServerDispatcherTestSuite) TestOneRequestInFlightPerClient() {
+	const clients = 20
+	const requests = 5
+	var mutex sync.Mutex
+	inFlight := map[string]string{}
+	s.websocketServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Run(func(args mock.Arguments) {
+		clientID := args.String(0)
+		data, _ := args.Get(1).([]byte)
+		mutex.Lock()
+		defer mutex.Unlock()
+		s.Emptyf(inFlight[clientID], "request %s sent to %s while another request is in flight", data, clientID)
+		inFlight[clientID] = string(data)
+	}).Return(nil)
+	s.dispatcher.SetTimeout(10 * time.Second)
+	s.dispatcher.Start()
+	defer s.dispatcher.Stop()
+	var bundles []map[string]ocppj.RequestBundle
+	for i := 0; i < requests; i++ {
+		bundles = append(bundles, map[string]ocppj.RequestBundle{})
+		for c := 0; c < clients; c++ {
+			clientID := fmt.Sprintf("client%d", c)
+			if i == 0 {
+				s.dispatcher.CreateClient(clientID)
+			}
+			call, err := s.endpoint.CreateCall(newMockRequest("somevalue"))
+			s.Require().NoError(err)
+			data, err := call.MarshalJSON()
+			s.Require().NoError(err)
+			bundle := ocppj.RequestBundle{Call: call, Data: data}
+			bundles[i][clientID] = bundle
+			s.Require().NoError(s.dispatcher.SendRequest(clientID, bundle))
+		}
+	}
+	// Complete the requests of every client in order, verifying that the next one is only sent afterward
+	for i := 0; i < requests; i++ {
+		for clientID, bundle := range bundles[i] {
+			s.Eventually(func() bool {
+				mutex.Lock()
+				defer mutex.Unlock()
+				return inFlight[clientID] == string(bundle.Data)
+			}, time.Second, time.Millisecond)
+			mutex.Lock()
+			inFlight[clientID] = ""
+			mutex.Unlock()
+			s.dispatcher.CompleteRequest(clientID, bundle.Call.UniqueId)
+		}
+	}
+	s.Equal(0, s.queueMap.Size())
+	s.False(s.state.HasPendingRequests())
+}
+
 type ClientDispatcherTestSuite struct {
 	suite.Suite
 	state           ocppj.ClientState
 	queue           ocppj.RequestQueue
 	dispatcher      ocppj.ClientDispatcher
 	endpoint        ocppj.Client
-	websocketClient MockWebsocketClient
+	websocketClient *MockWebsocketClient
 }
 
 func (c *ClientDispatcherTestSuite) SetupTest() {
@@ -240,8 +534,43 @@ func (c *ClientDispatcherTestSuite) SetupTest() {
 	c.dispatcher = ocppj.NewDefaultClientDispatcher(c.queue, nil)
 	c.state = ocppj.NewClientState()
 	c.dispatcher.SetPendingRequestState(c.state)
-	c.websocketClient = MockWebsocketClient{}
-	c.dispatcher.SetNetworkClient(&c.websocketClient)
+	c.websocketClient = &MockWebsocketClient{}
+	c.dispatcher.SetNetworkClient(c.websocketClient)
+}
+
+func (c *ClientDispatcherTestSuite) TestClientDroppedRequestCanceled() {
+	// Setup
+	canceled := make(chan string, 1)
+	c.queue = ocppj.NewPriorityRequestQueue(2, ocppj.WithDropPolicy(ocppj.DropOldest(MockFeatureName)))
+	c.dispatcher = ocppj.NewDefaultClientDispatcher(c.queue, nil)
+	c.dispatcher.SetPendingRequestState(c.state)
+	c.dispatcher.SetNetworkClient(c.websocketClient)
+	c.websocketClient.On("Write", mock.Anything).Return(nil)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		c.Assert().Equal(ocppj.GenericError, err.Code)
+		canceled <- rID
+	})
+	c.dispatcher.Start()
+	var requestIDs []string
+	for i := 0; i < 3; i++ {
+		call, err := c.endpoint.CreateCall(newMockRequest("somevalue"))
+		c.Require().NoError(err)
+		data, err := call.MarshalJSON()
+		c.Require().NoError(err)
+		c.Require().NoError(c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data}))
+		requestIDs = append(requestIDs, call.UniqueId)
+		if i == 0 {
+			c.Require().Eventually(c.state.HasPendingRequest, time.Second, 10*time.Millisecond)
+		}
+	}
+	// The oldest queued request was dropped and canceled, the request in flight is kept
+	select {
+	case rID := <-canceled:
+		c.Assert().Equal(requestIDs[1], rID)
+	case <-time.After(time.Second):
+		c.Require().Fail("dropped request wasn't canceled")
+	}
+	c.Assert().Equal(2, c.queue.Size())
 }
 
 func (c *ClientDispatcherTestSuite) TestClientSendRequest() {
@@ -319,6 +648,49 @@ func (c *ClientDispatcherTestSuite) TestClientRequestCanceled() {
 	c.Assert().True(c.queue.IsEmpty())
 }
 
+func (c *ClientDispatcherTestSuite) TestClientCancelRequest() {
+	// Setup
+	sent := make(chan string, 2)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(0).([]byte)
+		sent <- string(data)
+	}).Return(nil)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		c.Require().Fail("unexpected OnRequestCanceled")
+	})
+	c.dispatcher.Start()
+	// Queue three requests: the first one will be in flight
+	requestIDs := []string{}
+	for i := 0; i < 3; i++ {
+		call, err := c.endpoint.CreateCall(newMockRequest("somevalue"))
+		c.Require().NoError(err)
+		data, err := call.MarshalJSON()
+		c.Require().NoError(err)
+		err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+		c.Require().NoError(err)
+		requestIDs = append(requestIDs, call.UniqueId)
+	}
+	<-sent
+	c.Require().True(c.state.HasPendingRequest())
+	// Cancel a queued request, which was never sent
+	c.Assert().True(c.dispatcher.(ocppj.ClientRequestCanceler).CancelRequest(requestIDs[1]))
+	c.Assert().Equal(2, c.queue.Size())
+	c.Assert().False(c.dispatcher.(ocppj.ClientRequestCanceler).CancelRequest(requestIDs[1]))
+	// Cancel the in-flight request, the next one is dispatched right away
+	c.Assert().True(c.dispatcher.(ocppj.ClientRequestCanceler).CancelRequest(requestIDs[0]))
+	select {
+	case data := <-sent:
+		c.Assert().Contains(data, requestIDs[2])
+	case <-time.After(time.Second):
+		c.Require().Fail("next request wasn't dispatched")
+	}
+	c.Assert().Equal(1, c.queue.Size())
+	_, ok := c.state.GetPendingRequest(requestIDs[0])
+	c.Assert().False(ok)
+	_, ok = c.state.GetPendingRequest(requestIDs[2])
+	c.Assert().True(ok)
+}
+
 func (c *ClientDispatcherTestSuite) TestClientDispatcherTimeout() {
 	// Setup
 	writeC := make(chan bool, 1)
@@ -444,3 +816,124 @@ func (c *ClientDispatcherTestSuite) TestClientSendPausedDispatcher() {
 	c.Assert().Equal(requestNumber, c.queue.Size())
 	c.Assert().False(c.state.HasPendingRequest())
 }
+
+func (c *ClientDispatcherTestSuite) TestClientRetryOnTimeout() {
+	// Setup
+	sent := make(chan string, 2)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(0).([]byte)
+		sent <- string(data)
+	}).Return(nil)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		c.Require().Fail("unexpected OnRequestCanceled")
+	})
+	dispatcher, ok := c.dispatcher.(*ocppj.DefaultClientDispatcher)
+	c.Require().True(ok)
+	dispatcher.SetRetryPolicy(&ocppj.RetryPolicy{
+		MaxAttempts: 2,
+		Backoff:     ocppj.ExponentialBackoff(100*time.Millisecond, time.Second),
+	})
+	c.dispatcher.SetTimeout(200 * time.Millisecond)
+	c.dispatcher.Start()
+	// Send mock request
+	call, err := c.endpoint.CreateCall(newMockRequest("somevalue"))
+	c.Require().NoError(err)
+	requestID := call.UniqueId
+	data, err := call.MarshalJSON()
+	c.Require().NoError(err)
+	err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+	c.Require().NoError(err)
+	<-sent
+	// Request times out and is retransmitted with a new message ID
+	var messageID string
+	select {
+	case msg := <-sent:
+		arr, err := ocppj.ParseJsonMessage(msg)
+		c.Require().NoError(err)
+		messageID = arr[1].(string)
+	case <-time.After(time.Second):
+		c.Require().Fail("request wasn't retransmitted")
+	}
+	c.Assert().NotEqual(requestID, messageID)
+	_, ok = c.state.GetPendingRequest(requestID)
+	c.Assert().False(ok)
+	_, ok = c.state.GetPendingRequest(messageID)
+	c.Assert().True(ok)
+	// Response to the retransmitted message completes the original request
+	c.dispatcher.CompleteRequest(messageID)
+	c.Assert().False(c.state.HasPendingRequest())
+	c.Assert().True(c.queue.IsEmpty())
+}
+
+func (c *ClientDispatcherTestSuite) TestClientResponseDuringRetryBackoff() {
+	// Setup
+	sent := make(chan string, 2)
+	c.websocketClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(0).([]byte)
+		sent <- string(data)
+	}).Return(nil)
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		c.Require().Fail("unexpected OnRequestCanceled")
+	})
+	dispatcher, ok := c.dispatcher.(*ocppj.DefaultClientDispatcher)
+	c.Require().True(ok)
+	dispatcher.SetRetryPolicy(&ocppj.RetryPolicy{
+		MaxAttempts:    2,
+		Backoff:        ocppj.ExponentialBackoff(500*time.Millisecond, time.Second),
+		ReuseMessageID: true,
+	})
+	c.dispatcher.SetTimeout(100 * time.Millisecond)
+	c.dispatcher.Start()
+	// Send mock request
+	call, err := c.endpoint.CreateCall(newMockRequest("somevalue"))
+	c.Require().NoError(err)
+	data, err := call.MarshalJSON()
+	c.Require().NoError(err)
+	err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+	c.Require().NoError(err)
+	<-sent
+	// Request timed out and awaits its retransmission, but is still pending
+	time.Sleep(200 * time.Millisecond)
+	_, ok = c.state.GetPendingRequest(call.UniqueId)
+	c.Require().True(ok)
+	// Late response completes the request, which isn't retransmitted anymore
+	c.dispatcher.CompleteRequest(call.UniqueId)
+	c.Assert().False(c.state.HasPendingRequest())
+	select {
+	case <-sent:
+		c.Require().Fail("request was retransmitted after receiving a response")
+	case <-time.After(600 * time.Millisecond):
+	}
+	c.Assert().True(c.queue.IsEmpty())
+}
+
+func (c *ClientDispatcherTestSuite) TestClientRetryUnsupportedFeature() {
+	// Setup
+	canceled := make(chan bool, 1)
+	c.websocketClient.On("Write", mock.Anything).Return(errors.New("mockError"))
+	c.dispatcher.SetOnRequestCanceled(func(rID string, request ocpp.Request, err *ocpp.Error) {
+		c.Assert().Equal(ocppj.InternalError, err.Code)
+		canceled <- true
+	})
+	dispatcher, ok := c.dispatcher.(*ocppj.DefaultClientDispatcher)
+	c.Require().True(ok)
+	dispatcher.SetRetryPolicy(&ocppj.RetryPolicy{
+		MaxAttempts: 5,
+		Features:    []string{"StartTransaction"},
+	})
+	c.dispatcher.Start()
+	// Send mock request, which may not be retransmitted
+	call, err := c.endpoint.CreateCall(newMockRequest("somevalue"))
+	c.Require().NoError(err)
+	data, err := call.MarshalJSON()
+	c.Require().NoError(err)
+	err = c.dispatcher.SendRequest(ocppj.RequestBundle{Call: call, Data: data})
+	c.Require().NoError(err)
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		c.Require().Fail("request wasn't canceled")
+	}
+	c.websocketClient.AssertNumberOfCalls(c.T(), "Write", 1)
+	c.Assert().True(c.queue.IsEmpty())
+}
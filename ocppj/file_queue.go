@@ -0,0 +1,471 @@
+package ocppj
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// PersistentRequestQueue is a RequestQueue, which keeps its requests across restarts of the application.
+//
+// Persisted requests are stored in their serialized form, hence they need to be decoded again
+// before they can be dispatched. The ocppj Client automatically restores the queue when started.
+type PersistentRequestQueue interface {
+	RequestQueue
+	// Restore decodes all persisted requests, which weren't decoded yet, using the given function.
+	// Requests that cannot be decoded are dropped from the queue and reported in the returned error.
+	Restore(decode func(data []byte) (*Call, error)) error
+}
+
+// requestRestorer is implemented by dispatchers, whose request queue may contain requests persisted by a previous run.
+type requestRestorer interface {
+	restoreRequests(decode func(data []byte) (*Call, error)) error
+}
+
+const (
+	fileQueueOpPush byte = 1
+	// Removes the element at the index contained in the payload
+	fileQueueOpRemove byte = 2
+	// Push with a payload prefixed by the message ID of the request: ID length (2 bytes) | ID | data
+	fileQueueOpPushID byte = 3
+	// Removes the first element with the message ID contained in the payload
+	fileQueueOpRemoveID byte = 4
+	// Each record is made of: op (1 byte) | payload length (4 bytes) | CRC-32 of op and payload (4 bytes) | payload
+	fileQueueHeaderSize = 9
+	// Minimum amount of obsolete records in the log, before the file gets compacted
+	fileQueueCompactThreshold = 1024
+)
+
+type fileQueueElement struct {
+	// Message ID of the request, if known when it was pushed
+	id     string
+	data   []byte
+	bundle *RequestBundle
+}
+
+// FileRequestQueue is a crash-safe RequestQueue, backed by an append-only log file.
+// The queue is thread-safe.
+//
+// Every Push, Pop and Remove operation is appended to the log before returning, so the queue content
+// survives a crash of the process (e.g. kill -9). A partially written record at the end of the log
+// is discarded when the file is loaded again. Use SetSync to additionally survive power losses.
+//
+// The queue is meant to be used by an ocppj Client, e.g. to retain transaction-related messages while
+// offline. Since the queue outlives the client, Init doesn't discard the persisted requests, but reloads them
+// from the log. Use Clear to drop all requests.
+//
+// Every change is written to the log before it is applied in memory. If a removal cannot be written to the log,
+// the request is kept in the queue and the error is reported to the handler set via SetErrorHandler.
+// In that case Pop and Remove return nil, hence the request will be dispatched again.
+type FileRequestQueue struct {
+	path         string
+	file         *os.File
+	capacity     int
+	sync         bool
+	errorHandler func(err error)
+	elements     []fileQueueElement
+	// Amount of records in the log file
+	records int
+	mutex   sync.RWMutex
+}
+
+// NewFileRequestQueue creates a new FileRequestQueue with the given capacity, backed by the file at path.
+//
+// If the file exists, the requests it contains are loaded. These need to be restored before they can be
+// dispatched, which the ocppj Client does automatically when started.
+// Passing capacity = 0 will create a queue without a maximum capacity.
+func NewFileRequestQueue(path string, capacity int) (*FileRequestQueue, error) {
+	q := &FileRequestQueue{
+		path:     path,
+		capacity: capacity,
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// SetSync defines whether every write to the log is committed to stable storage (fsync).
+// This makes the queue survive power losses as well, at the cost of a much lower throughput.
+func (q *FileRequestQueue) SetSync(enabled bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.sync = enabled
+}
+
+// SetErrorHandler registers a handler, which is invoked whenever a removal couldn't be written to the log.
+// The handler is invoked while the queue is locked, so it must not access the queue.
+func (q *FileRequestQueue) SetErrorHandler(handler func(err error)) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.errorHandler = handler
+}
+
+// Init discards the in-memory state of the queue and reloads the persisted requests from the log.
+func (q *FileRequestQueue) Init() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	// On failure, the previous state is kept
+	_ = q.load()
+}
+
+// Restore decodes all persisted requests, which weren't decoded yet, using the given function.
+// Requests that cannot be decoded are dropped from the queue and reported in the returned error.
+func (q *FileRequestQueue) Restore(decode func(data []byte) (*Call, error)) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var errs []error
+	for i := 0; i < len(q.elements); i++ {
+		el := &q.elements[i]
+		if el.bundle != nil {
+			continue
+		}
+		call, err := decode(el.data)
+		if err == nil {
+			el.bundle = &RequestBundle{Call: call, Data: el.data}
+			continue
+		}
+		errs = append(errs, fmt.Errorf("dropping persisted request %d: %w", i, err))
+		if err = q.remove(i); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		i--
+	}
+	return errors.Join(errs...)
+}
+
+// Clear removes all requests from the queue, including the persisted ones.
+func (q *FileRequestQueue) Clear() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.elements = nil
+	return q.truncate()
+}
+
+// Close closes the underlying log file. The queue may not be used afterward.
+func (q *FileRequestQueue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.file.Close()
+}
+
+func (q *FileRequestQueue) Push(element interface{}) error {
+	bundle, ok := element.(RequestBundle)
+	if !ok {
+		return fmt.Errorf("invalid element %T, expected RequestBundle", element)
+	}
+	if bundle.Data == nil {
+		return fmt.Errorf("request bundle has no Data associated")
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.elements) >= q.capacity && q.capacity > 0 {
+		return fmt.Errorf("request queue is full, cannot push new element")
+	}
+	el := fileQueueElement{data: bundle.Data, bundle: &bundle}
+	if bundle.Call != nil {
+		el.id = bundle.Call.UniqueId
+	}
+	if err := q.append(el.pushRecord()); err != nil {
+		return err
+	}
+	q.elements = append(q.elements, el)
+	return nil
+}
+
+func (q *FileRequestQueue) Peek() interface{} {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if len(q.elements) == 0 {
+		return nil
+	}
+	return q.elements[0].value()
+}
+
+func (q *FileRequestQueue) Pop() interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if len(q.elements) == 0 {
+		return nil
+	}
+	result := q.elements[0].value()
+	if err := q.remove(0); err != nil {
+		q.reportError(err)
+		return nil
+	}
+	return result
+}
+
+func (q *FileRequestQueue) Remove(match func(element interface{}) bool) interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, el := range q.elements {
+		if value := el.value(); match(value) {
+			if err := q.remove(i); err != nil {
+				q.reportError(err)
+				return nil
+			}
+			return value
+		}
+	}
+	return nil
+}
+
+func (q *FileRequestQueue) contains(match func(element interface{}) bool) bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	for _, el := range q.elements {
+		if match(el.value()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *FileRequestQueue) Size() int {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return len(q.elements)
+}
+
+func (q *FileRequestQueue) IsFull() bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return len(q.elements) >= q.capacity && q.capacity > 0
+}
+
+func (q *FileRequestQueue) IsEmpty() bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return len(q.elements) == 0
+}
+
+// value returns the element as RequestBundle. Elements that weren't restored yet have no Call associated.
+func (el fileQueueElement) value() interface{} {
+	if el.bundle == nil {
+		return RequestBundle{Data: el.data}
+	}
+	return *el.bundle
+}
+
+// pushRecord returns the log record for pushing the element.
+func (el fileQueueElement) pushRecord() (byte, []byte) {
+	if el.id == "" || len(el.id) > math.MaxUint16 {
+		return fileQueueOpPush, el.data
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(len(el.id)))
+	payload = append(payload, el.id...)
+	return fileQueueOpPushID, append(payload, el.data...)
+}
+
+// remove deletes the element at index i, both from the log and from memory.
+// The removal is written to the log first: if that fails, the element is kept and the error is returned.
+func (q *FileRequestQueue) remove(i int) error {
+	if len(q.elements) == 1 {
+		// Nothing left to keep, the whole log can be dropped
+		if err := q.truncate(); err != nil {
+			return err
+		}
+		q.elements = nil
+		return nil
+	}
+	if err := q.append(q.removeRecord(i)); err != nil {
+		return err
+	}
+	q.elements = append(q.elements[:i:i], q.elements[i+1:]...)
+	if q.records >= fileQueueCompactThreshold && q.records > 2*len(q.elements) {
+		// The removal is already persisted, compaction is simply attempted again on the next removal
+		if err := q.compact(); err != nil {
+			q.reportError(err)
+		}
+	}
+	return nil
+}
+
+// removeRecord returns the log record for removing the element at index i.
+// Elements are identified by message ID, unless the ID is unknown or an earlier element has the same ID.
+func (q *FileRequestQueue) removeRecord(i int) (byte, []byte) {
+	id := q.elements[i].id
+	if id != "" && indexOfElement(q.elements, id) == i {
+		return fileQueueOpRemoveID, []byte(id)
+	}
+	return fileQueueOpRemove, binary.BigEndian.AppendUint32(nil, uint32(i))
+}
+
+// indexOfElement returns the index of the first element with the given message ID, or -1.
+func indexOfElement(elements []fileQueueElement, id string) int {
+	for i, el := range elements {
+		if el.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *FileRequestQueue) reportError(err error) {
+	if q.errorHandler != nil {
+		q.errorHandler(err)
+	}
+}
+
+// append writes a single record at the end of the log.
+func (q *FileRequestQueue) append(op byte, payload []byte) error {
+	record := make([]byte, fileQueueHeaderSize, fileQueueHeaderSize+len(payload))
+	record[0] = op
+	binary.BigEndian.PutUint32(record[1:5], uint32(len(payload)))
+	record = append(record, payload...)
+	checksum := crc32.NewIEEE()
+	checksum.Write(record[:1])
+	checksum.Write(payload)
+	binary.BigEndian.PutUint32(record[5:9], checksum.Sum32())
+	// A single write call, so a crash can only leave a truncated record behind
+	if _, err := q.file.Write(record); err != nil {
+		return fmt.Errorf("failed to write to request queue log: %w", err)
+	}
+	q.records++
+	if q.sync {
+		return q.file.Sync()
+	}
+	return nil
+}
+
+// truncate drops all records from the log.
+func (q *FileRequestQueue) truncate() error {
+	if err := q.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate request queue log: %w", err)
+	}
+	q.records = 0
+	if q.sync {
+		return q.file.Sync()
+	}
+	return nil
+}
+
+// compact rewrites the log, so that it only contains the requests currently in the queue.
+// The new log is written to a temporary file first, which then atomically replaces the old one.
+func (q *FileRequestQueue) compact() error {
+	tmpPath := q.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to compact request queue log: %w", err)
+	}
+	old, oldRecords := q.file, q.records
+	q.file, q.records = tmp, 0
+	for _, el := range q.elements {
+		if err = q.append(el.pushRecord()); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, q.path)
+	}
+	if err != nil {
+		// Keep appending to the old log
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		q.file, q.records = old, oldRecords
+		return fmt.Errorf("failed to compact request queue log: %w", err)
+	}
+	_ = old.Close()
+	syncDir(filepath.Dir(q.path))
+	return nil
+}
+
+// load reads all records from the log and rebuilds the queue content.
+// A corrupted or partially written record at the end of the log is discarded.
+func (q *FileRequestQueue) load() error {
+	file, err := os.OpenFile(q.path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open request queue log: %w", err)
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to read request queue log: %w", err)
+	}
+	var elements []fileQueueElement
+	records := 0
+	offset := 0
+	for offset+fileQueueHeaderSize <= len(data) {
+		op := data[offset]
+		length := int(binary.BigEndian.Uint32(data[offset+1 : offset+5]))
+		end := offset + fileQueueHeaderSize + length
+		if end > len(data) || end < offset {
+			break
+		}
+		payload := data[offset+fileQueueHeaderSize : end]
+		checksum := crc32.NewIEEE()
+		checksum.Write(data[offset : offset+1])
+		checksum.Write(payload)
+		if checksum.Sum32() != binary.BigEndian.Uint32(data[offset+5:offset+9]) {
+			break
+		}
+		valid := true
+		switch op {
+		case fileQueueOpPush:
+			elements = append(elements, fileQueueElement{data: payload})
+		case fileQueueOpPushID:
+			if len(payload) < 2 || int(binary.BigEndian.Uint16(payload))+2 > len(payload) {
+				valid = false
+				break
+			}
+			idEnd := int(binary.BigEndian.Uint16(payload)) + 2
+			elements = append(elements, fileQueueElement{id: string(payload[2:idEnd]), data: payload[idEnd:]})
+		case fileQueueOpRemove:
+			if len(payload) != 4 || int(binary.BigEndian.Uint32(payload)) >= len(elements) {
+				valid = false
+				break
+			}
+			i := int(binary.BigEndian.Uint32(payload))
+			elements = append(elements[:i:i], elements[i+1:]...)
+		case fileQueueOpRemoveID:
+			i := indexOfElement(elements, string(payload))
+			if len(payload) == 0 || i < 0 {
+				valid = false
+				break
+			}
+			elements = append(elements[:i:i], elements[i+1:]...)
+		default:
+			valid = false
+		}
+		if !valid {
+			break
+		}
+		records++
+		offset = end
+	}
+	if offset < len(data) {
+		// Discard the damaged tail, so new records are appended after the last valid one
+		if err = file.Truncate(int64(offset)); err != nil {
+			_ = file.Close()
+			return fmt.Errorf("failed to repair request queue log: %w", err)
+		}
+	}
+	if q.file != nil {
+		_ = q.file.Close()
+	}
+	q.file = file
+	q.elements = elements
+	q.records = records
+	return nil
+}
+
+// syncDir commits a directory entry change (e.g. a rename) to stable storage, where supported.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,281 @@
+package ocppj_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ocppj"
+)
+
+type FileRequestQueueTestSuite struct {
+	suite.Suite
+	path     string
+	queue    *ocppj.FileRequestQueue
+	endpoint ocppj.Client
+}
+
+func (suite *FileRequestQueueTestSuite) SetupTest() {
+	suite.path = filepath.Join(suite.T().TempDir(), "requests.log")
+	queue, err := ocppj.NewFileRequestQueue(suite.path, queueCapacity)
+	suite.Require().NoError(err)
+	suite.queue = queue
+	suite.endpoint = ocppj.Client{Id: "client1"}
+	suite.endpoint.AddProfile(ocpp.NewProfile("mock", &MockFeature{}))
+}
+
+func (suite *FileRequestQueueTestSuite) TearDownTest() {
+	_ = suite.queue.Close()
+}
+
+func (suite *FileRequestQueueTestSuite) newBundle(value string) ocppj.RequestBundle {
+	call, err := suite.endpoint.CreateCall(newMockRequest(value))
+	suite.Require().NoError(err)
+	data, err := call.MarshalJSON()
+	suite.Require().NoError(err)
+	return ocppj.RequestBundle{Call: call, Data: data}
+}
+
+// reopen simulates a restart, by loading the queue again from the same file.
+func (suite *FileRequestQueueTestSuite) reopen() {
+	suite.Require().NoError(suite.queue.Close())
+	queue, err := ocppj.NewFileRequestQueue(suite.path, queueCapacity)
+	suite.Require().NoError(err)
+	suite.queue = queue
+}
+
+func (suite *FileRequestQueueTestSuite) decode(data []byte) (*ocppj.Call, error) {
+	arr, err := ocppj.ParseRawJsonMessage(data)
+	if err != nil {
+		return nil, err
+	}
+	message, err := suite.endpoint.ParseMessage(arr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return message.(*ocppj.Call), nil
+}
+
+func (suite *FileRequestQueueTestSuite) TestPushPop() {
+	bundles := []ocppj.RequestBundle{suite.newBundle("first"), suite.newBundle("second")}
+	for _, bundle := range bundles {
+		suite.Require().NoError(suite.queue.Push(bundle))
+	}
+	suite.Assert().Equal(2, suite.queue.Size())
+	suite.Assert().Equal(bundles[0], suite.queue.Peek())
+	suite.Assert().Equal(bundles[0], suite.queue.Pop())
+	suite.Assert().Equal(bundles[1], suite.queue.Pop())
+	suite.Assert().True(suite.queue.IsEmpty())
+	suite.Assert().Nil(suite.queue.Pop())
+	// Only RequestBundles can be persisted
+	suite.Assert().Error(suite.queue.Push(newMockRequest("somevalue")))
+}
+
+func (suite *FileRequestQueueTestSuite) TestFileQueueFull() {
+	for i := 0; i < queueCapacity; i++ {
+		suite.Require().NoError(suite.queue.Push(suite.newBundle(fmt.Sprintf("request-%v", i))))
+	}
+	suite.Assert().True(suite.queue.IsFull())
+	suite.Assert().Error(suite.queue.Push(suite.newBundle("overflow")))
+}
+
+func (suite *FileRequestQueueTestSuite) TestRestoreAfterRestart() {
+	bundles := []ocppj.RequestBundle{suite.newBundle("first"), suite.newBundle("second"), suite.newBundle("third"), suite.newBundle("fourth")}
+	for _, bundle := range bundles {
+		suite.Require().NoError(suite.queue.Push(bundle))
+	}
+	suite.queue.Pop()
+	removed := suite.queue.Remove(func(element interface{}) bool {
+		return element.(ocppj.RequestBundle).Call.UniqueId == bundles[2].Call.UniqueId
+	})
+	suite.Require().NotNil(removed)
+	suite.reopen()
+	// Requests are loaded, but not decoded yet
+	suite.Require().Equal(2, suite.queue.Size())
+	bundle, ok := suite.queue.Peek().(ocppj.RequestBundle)
+	suite.Require().True(ok)
+	suite.Assert().Nil(bundle.Call)
+	suite.Assert().Equal(bundles[1].Data, bundle.Data)
+	// Restore requests in their original order
+	suite.Require().NoError(suite.queue.Restore(suite.decode))
+	for _, expected := range []ocppj.RequestBundle{bundles[1], bundles[3]} {
+		bundle, ok = suite.queue.Pop().(ocppj.RequestBundle)
+		suite.Require().True(ok)
+		suite.Assert().Equal(expected.Call.UniqueId, bundle.Call.UniqueId)
+		suite.Assert().Equal(expected.Call.Payload, bundle.Call.Payload)
+		suite.Assert().Equal(expected.Data, bundle.Data)
+	}
+	// Empty queue survives a restart as well
+	suite.reopen()
+	suite.Assert().True(suite.queue.IsEmpty())
+}
+
+func (suite *FileRequestQueueTestSuite) TestRestoreInvalidRequest() {
+	suite.Require().NoError(suite.queue.Push(ocppj.RequestBundle{Data: []byte(`[2,"1234","UnknownAction",{}]`)}))
+	valid := suite.newBundle("somevalue")
+	suite.Require().NoError(suite.queue.Push(valid))
+	suite.reopen()
+	err := suite.queue.Restore(suite.decode)
+	suite.Assert().Error(err)
+	suite.Require().Equal(1, suite.queue.Size())
+	bundle := suite.queue.Peek().(ocppj.RequestBundle)
+	suite.Assert().Equal(valid.Call.UniqueId, bundle.Call.UniqueId)
+	// Invalid request was dropped from the log as well
+	suite.reopen()
+	suite.Assert().Equal(1, suite.queue.Size())
+}
+
+func (suite *FileRequestQueueTestSuite) TestRemoveWriteFailure() {
+	bundles := []ocppj.RequestBundle{suite.newBundle("first"), suite.newBundle("second"), suite.newBundle("third")}
+	for _, bundle := range bundles {
+		suite.Require().NoError(suite.queue.Push(bundle))
+	}
+	var errs []error
+	suite.queue.SetErrorHandler(func(err error) {
+		errs = append(errs, err)
+	})
+	// Make every write to the log fail
+	suite.Require().NoError(suite.queue.Close())
+	suite.Assert().Nil(suite.queue.Pop())
+	suite.Assert().Nil(suite.queue.Remove(func(element interface{}) bool {
+		return element.(ocppj.RequestBundle).Call.UniqueId == bundles[1].Call.UniqueId
+	}))
+	suite.Assert().Len(errs, 2)
+	// Requests are kept, both in memory and in the log
+	suite.Assert().Equal(3, suite.queue.Size())
+	suite.Assert().Equal(bundles[0], suite.queue.Peek())
+	queue, err := ocppj.NewFileRequestQueue(suite.path, queueCapacity)
+	suite.Require().NoError(err)
+	suite.queue = queue
+	suite.Assert().Equal(3, suite.queue.Size())
+}
+
+func (suite *FileRequestQueueTestSuite) TestTruncatedLog() {
+	bundles := []ocppj.RequestBundle{suite.newBundle("first"), suite.newBundle("second")}
+	for _, bundle := range bundles {
+		suite.Require().NoError(suite.queue.Push(bundle))
+	}
+	suite.Require().NoError(suite.queue.Close())
+	// Simulate a crash in the middle of writing the last record
+	info, err := os.Stat(suite.path)
+	suite.Require().NoError(err)
+	suite.Require().NoError(os.Truncate(suite.path, info.Size()-5))
+	queue, err := ocppj.NewFileRequestQueue(suite.path, queueCapacity)
+	suite.Require().NoError(err)
+	suite.queue = queue
+	suite.Require().Equal(1, suite.queue.Size())
+	// New records are appended after the last valid one
+	third := suite.newBundle("third")
+	suite.Require().NoError(suite.queue.Push(third))
+	suite.reopen()
+	suite.Require().NoError(suite.queue.Restore(suite.decode))
+	suite.Require().Equal(2, suite.queue.Size())
+	suite.Assert().Equal(bundles[0].Data, suite.queue.Pop().(ocppj.RequestBundle).Data)
+	suite.Assert().Equal(third.Data, suite.queue.Pop().(ocppj.RequestBundle).Data)
+}
+
+func (suite *FileRequestQueueTestSuite) TestCompaction() {
+	queue, err := ocppj.NewFileRequestQueue(suite.path+".big", 0)
+	suite.Require().NoError(err)
+	defer queue.Close()
+	// Keep one request in the queue, so the log isn't simply truncated
+	suite.Require().NoError(queue.Push(suite.newBundle("first")))
+	for i := 0; i < 2000; i++ {
+		suite.Require().NoError(queue.Push(suite.newBundle(fmt.Sprintf("r%v", i))))
+		queue.Remove(func(element interface{}) bool {
+			return element.(ocppj.RequestBundle).Call.Payload.(*MockRequest).MockValue != "first"
+		})
+	}
+	info, err := os.Stat(suite.path + ".big")
+	suite.Require().NoError(err)
+	suite.Assert().Less(info.Size(), int64(100*1024))
+	reopened, err := ocppj.NewFileRequestQueue(suite.path+".big", 0)
+	suite.Require().NoError(err)
+	defer reopened.Close()
+	suite.Require().NoError(reopened.Restore(suite.decode))
+	suite.Require().Equal(1, reopened.Size())
+	suite.Assert().Equal("first", reopened.Peek().(ocppj.RequestBundle).Call.Payload.(*MockRequest).MockValue)
+}
+
+func (suite *FileRequestQueueTestSuite) TestClientReplaysRequests() {
+	for i := 0; i < 3; i++ {
+		suite.Require().NoError(suite.queue.Push(suite.newBundle(fmt.Sprintf("request-%v", i))))
+	}
+	suite.reopen()
+	// Restarted client replays the persisted requests in order
+	mockClient := &MockWebsocketClient{}
+	sent := make(chan []byte, 3)
+	mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	mockClient.On("Stop").Return(nil)
+	mockClient.On("IsConnected").Return(false)
+	mockClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		sent <- args.Get(0).([]byte)
+	}).Return(nil)
+	dispatcher := ocppj.NewDefaultClientDispatcher(suite.queue, nil)
+	client, err := ocppj.NewClient("client1", mockClient, dispatcher, nil, nil, ocpp.NewProfile("mock", &MockFeature{}))
+	suite.Require().NoError(err)
+	suite.Require().NoError(client.Start("someUrl"))
+	defer client.Stop()
+	for i := 0; i < 3; i++ {
+		select {
+		case data := <-sent:
+			arr, err := ocppj.ParseRawJsonMessage(data)
+			suite.Require().NoError(err)
+			suite.Assert().Contains(string(data), fmt.Sprintf("request-%v", i))
+			// Respond, so the next request is dispatched
+			err = mockClient.MessageHandler([]byte(fmt.Sprintf(`[3,"%v",{"mockValue":"somevalue"}]`, arr[1])))
+			suite.Require().NoError(err)
+		case <-time.After(time.Second):
+			suite.Require().Fail("persisted request wasn't replayed")
+		}
+	}
+	suite.Assert().True(suite.queue.IsEmpty())
+}
+
+const fileQueueCrashEnv = "OCPPJ_FILE_QUEUE_CRASH_PATH"
+
+// TestFileRequestQueueCrashHelper is executed in a subprocess by TestFileRequestQueueSurvivesKill.
+func TestFileRequestQueueCrashHelper(t *testing.T) {
+	path := os.Getenv(fileQueueCrashEnv)
+	if path == "" {
+		t.Skip("only executed as helper process")
+	}
+	queue, err := ocppj.NewFileRequestQueue(path, 0)
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		data := []byte(fmt.Sprintf(`[2,"%v","%v",{"mockValue":"request-%v"}]`, i, MockFeatureName, i))
+		require.NoError(t, queue.Push(ocppj.RequestBundle{Data: data}))
+	}
+	queue.Pop()
+	// Crash without closing the queue
+	_ = syscall.Kill(os.Getpid(), syscall.SIGKILL)
+	time.Sleep(time.Minute)
+}
+
+func TestFileRequestQueueSurvivesKill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.log")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestFileRequestQueueCrashHelper$")
+	cmd.Env = append(os.Environ(), fileQueueCrashEnv+"="+path)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.False(t, exitErr.Success())
+	queue, err := ocppj.NewFileRequestQueue(path, 0)
+	require.NoError(t, err)
+	defer queue.Close()
+	require.Equal(t, 4, queue.Size())
+	for i := 1; i < 5; i++ {
+		bundle, ok := queue.Pop().(ocppj.RequestBundle)
+		require.True(t, ok)
+		assert.Contains(t, string(bundle.Data), fmt.Sprintf("request-%v", i))
+	}
+}
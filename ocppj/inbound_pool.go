@@ -0,0 +1,191 @@
+package ocppj
+
+import (
+	"sync"
+)
+
+const (
+	defaultInboundWorkers   = 100
+	defaultInboundQueueSize = 1000
+)
+
+// InboundWorkerPoolConfig contains the configuration of the worker pool for incoming requests (see Server.SetInboundWorkerPool).
+type InboundWorkerPoolConfig struct {
+	// The maximum number of incoming requests handled concurrently, across all clients. Defaults to 100.
+	Workers int
+	// The maximum number of incoming requests waiting for a worker, across all clients. Defaults to 1000.
+	// Further requests are rejected with an InternalError, until the queue has room again.
+	QueueSize int
+	// Ordered reports whether requests with the given action must be handled in the order they were received.
+	// An ordered request isn't handled before all previous ordered requests of the same client were answered,
+	// while other requests may be handled concurrently.
+	// If nil, all requests of a client are handled in order.
+	Ordered func(action string) bool
+}
+
+// inboundTask is an incoming request, waiting to be handled by the worker pool.
+type inboundTask struct {
+	clientID  string
+	requestID string
+	ordered   bool
+	handle    func()
+}
+
+// inboundWorker is a worker occupied by an incoming request.
+type inboundWorker struct {
+	ordered  bool // true if the request is ordered
+	returned bool // set once the request handler returned
+	detached bool // set if the client disconnected, while the request handler was still running
+}
+
+// inboundPoolClient contains the requests of a client currently handled by the worker pool.
+type inboundPoolClient struct {
+	running map[string]*inboundWorker // by request ID
+	ordered bool                      // true if an ordered request is being handled
+}
+
+// inboundPool hands incoming requests off to a bounded number of workers.
+//
+// A worker is occupied from the moment a request is passed to the request handler, until a response
+// or error is sent for that request. This also bounds handlers, which answer requests asynchronously.
+// If the client disconnects before, the worker is occupied until the request handler returned.
+type inboundPool struct {
+	config  InboundWorkerPoolConfig
+	mutex   sync.Mutex
+	queue   []*inboundTask
+	active  int
+	clients map[string]*inboundPoolClient
+}
+
+func newInboundPool(config InboundWorkerPoolConfig) *inboundPool {
+	if config.Workers <= 0 {
+		config.Workers = defaultInboundWorkers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultInboundQueueSize
+	}
+	return &inboundPool{config: config, clients: map[string]*inboundPoolClient{}}
+}
+
+// submit queues an incoming request. Returns false if the queue is full.
+func (p *inboundPool) submit(clientID string, requestID string, action string, handle func()) bool {
+	ordered := p.config.Ordered == nil || p.config.Ordered(action)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.queue) >= p.config.QueueSize {
+		return false
+	}
+	p.queue = append(p.queue, &inboundTask{clientID: clientID, requestID: requestID, ordered: ordered, handle: handle})
+	p.schedule()
+	return true
+}
+
+// schedule starts queued requests, as long as workers are available.
+// Ordered requests of a client are skipped, while a previous ordered request of the same client is being handled.
+// Must be called while holding the mutex.
+func (p *inboundPool) schedule() {
+	for i := 0; i < len(p.queue) && p.active < p.config.Workers; {
+		task := p.queue[i]
+		client := p.clients[task.clientID]
+		if task.ordered && client != nil && client.ordered {
+			i++
+			continue
+		}
+		p.queue = append(p.queue[:i], p.queue[i+1:]...)
+		if client == nil {
+			client = &inboundPoolClient{running: map[string]*inboundWorker{}}
+			p.clients[task.clientID] = client
+		}
+		worker := &inboundWorker{ordered: task.ordered}
+		client.running[task.requestID] = worker
+		client.ordered = client.ordered || task.ordered
+		p.active++
+		go p.run(task.handle, worker)
+	}
+}
+
+// run invokes the request handler on a worker.
+// If the client disconnected while the handler was running, the worker is released once the handler returns.
+func (p *inboundPool) run(handle func(), worker *inboundWorker) {
+	handle()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	worker.returned = true
+	if worker.detached {
+		p.active--
+		p.schedule()
+	}
+}
+
+// done releases the worker of an answered request, and starts the next queued requests.
+func (p *inboundPool) done(clientID string, requestID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	client := p.clients[clientID]
+	if client == nil {
+		return
+	}
+	worker, ok := client.running[requestID]
+	if !ok {
+		return
+	}
+	delete(client.running, requestID)
+	if worker.ordered {
+		client.ordered = false
+	}
+	if len(client.running) == 0 {
+		delete(p.clients, clientID)
+	}
+	p.active--
+	p.schedule()
+}
+
+// disconnect drops the queued requests of a client and releases the workers of its unanswered requests.
+// Workers, whose request handler is still running, are released once the handler returns,
+// so the number of running handlers never exceeds the number of workers.
+func (p *inboundPool) disconnect(clientID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	queue := p.queue[:0]
+	for _, task := range p.queue {
+		if task.clientID != clientID {
+			queue = append(queue, task)
+		}
+	}
+	for i := len(queue); i < len(p.queue); i++ {
+		p.queue[i] = nil
+	}
+	p.queue = queue
+	if client := p.clients[clientID]; client != nil {
+		for _, worker := range client.running {
+			if worker.returned {
+				p.active--
+			} else {
+				worker.detached = true
+			}
+		}
+		delete(p.clients, clientID)
+	}
+	p.schedule()
+}
+
+// SetInboundWorkerPool hands incoming requests off to a bounded pool of workers, instead of invoking the request handler
+// on the goroutine reading messages from the client. This way, a slow request handler doesn't delay responses
+// to requests sent by the server, which are always processed right away.
+//
+// Requests are handled in the order they were received, as configured via InboundWorkerPoolConfig.Ordered.
+// Every request handled by the pool must be answered via SendResponse or SendError, to release its worker.
+// Queued requests are dropped, when the client disconnects.
+//
+// The worker pool must be set before starting the server.
+func (s *Server) SetInboundWorkerPool(config InboundWorkerPoolConfig) {
+	s.inboundPool = newInboundPool(config)
+}
+
+// callAnswered marks an incoming request as answered, releasing its worker if handled by the worker pool.
+func (s *Server) callAnswered(clientID string, requestID string) {
+	s.inboundCalls.answered(clientID, requestID)
+	if s.inboundPool != nil {
+		s.inboundPool.done(clientID, requestID)
+	}
+}
@@ -0,0 +1,88 @@
+package ocppj
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Maximum number of IDs generated for a new Call, before giving up due to collisions.
+const maxMessageIdAttempts = 10
+
+// RandomMessageId generates a message ID from a random 32-bit integer.
+// This is the default generator, unless configured otherwise.
+func RandomMessageId() string {
+	return fmt.Sprintf("%v", rand.Uint32())
+}
+
+// UUIDv4MessageId generates a random UUID (version 4) as message ID.
+func UUIDv4MessageId() string {
+	return uuid.NewString()
+}
+
+// UUIDv7MessageId generates a time-ordered UUID (version 7) as message ID.
+// Falls back to a random UUID, in case a time-ordered one couldn't be generated.
+func UUIDv7MessageId() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+// NewMonotonicMessageIdGenerator returns a message ID generator, based on an increasing counter.
+//
+// The counter is seeded with the current time, so that IDs aren't reused after restarting the application.
+// The generator is thread-safe.
+func NewMonotonicMessageIdGenerator() func() string {
+	var counter atomic.Uint64
+	counter.Store(uint64(time.Now().UnixNano()))
+	return func() string {
+		return strconv.FormatUint(counter.Add(1), 10)
+	}
+}
+
+// SetMessageIdGenerator sets a lambda function for generating unique IDs for new messages created by this endpoint.
+// This overrides the generator set for the whole package via the SetMessageIdGenerator function.
+//
+// Built-in generators are RandomMessageId, UUIDv4MessageId, UUIDv7MessageId and NewMonotonicMessageIdGenerator.
+func (endpoint *Endpoint) SetMessageIdGenerator(generator func() string) {
+	endpoint.messageIdGenerator = generator
+}
+
+// SetMessageIdInUseHandler sets a function, which reports whether a message ID is still in use by the application,
+// e.g. because a callback for a request with that ID is registered.
+// Generated message IDs, for which it returns true, are discarded like IDs of requests pending or queued in the endpoint.
+//
+// The handler is invoked while sending a request, hence it must not send requests itself.
+// Clients pass their own ID as clientID.
+func (endpoint *Endpoint) SetMessageIdInUseHandler(handler func(clientID string, messageID string) bool) {
+	endpoint.messageIdInUse = handler
+}
+
+// isMessageIdInUseByApplication returns true if the handler set via SetMessageIdInUseHandler reports the message ID as in use.
+func (endpoint *Endpoint) isMessageIdInUseByApplication(clientID string, messageID string) bool {
+	return endpoint.messageIdInUse != nil && endpoint.messageIdInUse(clientID, messageID)
+}
+
+// newMessageId returns a new message ID, using the generator of the endpoint if set.
+//
+// If isInUse is not nil, the ID is regenerated as long as it collides with an ID currently in use.
+// An error is returned, if no unique ID could be generated.
+func (endpoint *Endpoint) newMessageId(isInUse func(id string) bool) (string, error) {
+	generate := endpoint.messageIdGenerator
+	if generate == nil {
+		generate = messageIdGenerator
+	}
+	for i := 0; i < maxMessageIdAttempts; i++ {
+		id := generate()
+		if isInUse == nil || !isInUse(id) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("couldn't generate a unique message ID after %d attempts", maxMessageIdAttempts)
+}
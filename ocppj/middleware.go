@@ -0,0 +1,229 @@
+package ocppj
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+)
+
+// MessageDirection identifies whether a message was received or is about to be sent by an endpoint.
+type MessageDirection int
+
+const (
+	Inbound MessageDirection = iota
+	Outbound
+)
+
+func (d MessageDirection) String() string {
+	if d == Outbound {
+		return "outbound"
+	}
+	return "inbound"
+}
+
+// MessageContext describes an OCPP-J message passing through a middleware chain.
+type MessageContext struct {
+	Direction MessageDirection
+	// ID of the client the message is exchanged with. For a Client endpoint, this is the ID of the client itself.
+	ClientID    string
+	MessageType MessageType
+	UniqueID    string
+	// Feature name of the message. For CallResult and CallError messages, this is the feature of the related request, if known.
+	Action string
+	// Parsed payload of the message: an ocpp.Request for a Call, an ocpp.Response for a CallResult
+	// and an *ocpp.Error for a CallError.
+	//
+	// Inbound middlewares run before the message is validated. If the message couldn't be parsed, the payload is nil.
+	// Inbound middlewares may replace the payload, before it is passed to the handler.
+	// The replacement must be of the same kind as the original.
+	Payload interface{}
+	// Raw message, as received from or written to the network.
+	//
+	// Middlewares may replace the raw message, e.g. to fix messages of a misbehaving firmware.
+	// A replaced inbound message is parsed and validated again, and replacements of the payload are ignored.
+	// A replaced outbound message is written to the network as is.
+	Raw []byte
+}
+
+// MessageHandlerFunc processes a message passing through a middleware chain.
+// Returning an error stops the message from being processed any further.
+type MessageHandlerFunc func(msg *MessageContext) *ocpp.Error
+
+// Middleware wraps the processing of inbound and outbound messages of an endpoint.
+// A middleware may inspect or modify the message, before and after invoking next.
+//
+// Inbound messages pass through the chain before they are parsed and validated,
+// and before a CallResult or CallError completes the related request.
+// Responses, for which no request is pending, don't pass through the chain.
+//
+// To short-circuit the chain, a middleware returns an error without invoking next:
+//
+//   - an inbound Call is not passed to the request handler. The error is sent to the other endpoint instead.
+//   - an inbound CallResult or CallError completes the pending request. The error is passed to the error handler instead.
+//   - an outbound message is not sent. The error is returned to the caller.
+type Middleware func(next MessageHandlerFunc) MessageHandlerFunc
+
+// middlewareChain is an ordered list of middlewares. The first middleware is the outermost one.
+type middlewareChain []Middleware
+
+// build composes the middlewares of the chain into a single handler.
+func (chain middlewareChain) build() MessageHandlerFunc {
+	handler := func(msg *MessageContext) *ocpp.Error {
+		return nil
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
+
+// handleMiddleware passes the message through the middleware chain of the endpoint.
+func (endpoint *Endpoint) handleMiddleware(msg *MessageContext) *ocpp.Error {
+	err := endpoint.middleware(msg)
+	if err != nil && err.MessageId == "" {
+		err.MessageId = msg.UniqueID
+	}
+	return err
+}
+
+// payloadOf returns the payload and action of a message, as exposed to middlewares.
+func payloadOf(message Message) (interface{}, string) {
+	switch msg := message.(type) {
+	case *Call:
+		return msg.Payload, msg.Action
+	case *CallResult:
+		if msg.Payload == nil {
+			return nil, ""
+		}
+		return msg.Payload, msg.Payload.GetFeatureName()
+	case *CallError:
+		return ocpp.NewError(msg.ErrorCode, msg.ErrorDescription, msg.UniqueId), ""
+	}
+	return nil, ""
+}
+
+// newMessageContext creates the context for a message passing through a middleware chain.
+func newMessageContext(direction MessageDirection, clientID string, message Message, raw []byte) *MessageContext {
+	payload, action := payloadOf(message)
+	return &MessageContext{
+		Direction:   direction,
+		ClientID:    clientID,
+		MessageType: message.GetMessageTypeId(),
+		UniqueID:    message.GetUniqueId(),
+		Action:      action,
+		Payload:     payload,
+		Raw:         raw,
+	}
+}
+
+// Use appends middlewares to the chain of the endpoint. Every inbound and outbound message passes through
+// the chain, in the order the middlewares were added.
+//
+// Middlewares are invoked synchronously, so they MUST return as soon as possible.
+// Middlewares should be added before starting the endpoint.
+func (endpoint *Endpoint) Use(middlewares ...Middleware) {
+	endpoint.middlewares = append(endpoint.middlewares, middlewares...)
+	endpoint.middleware = endpoint.middlewares.build()
+}
+
+// outbound passes an outgoing message through the middleware chain. Returns the raw message to write to the network.
+func (endpoint *Endpoint) outbound(clientID string, message Message, raw []byte) ([]byte, error) {
+	if endpoint.middleware == nil {
+		return raw, nil
+	}
+	msg := newMessageContext(Outbound, clientID, message, raw)
+	if err := endpoint.handleMiddleware(msg); err != nil {
+		return nil, err
+	}
+	return msg.Raw, nil
+}
+
+// inboundMessage is an incoming message, which passed through the middleware chain of an endpoint.
+type inboundMessage struct {
+	// Parsed message. Nil if the message is invalid, or if no request is pending for a CallResult or CallError.
+	message Message
+	// Raw message and its envelope, possibly replaced by a middleware.
+	raw       []byte
+	rawFields []json.RawMessage
+	// Type and unique ID of the message, as far as they could be determined. Only set if the message passed through the chain.
+	messageType MessageType
+	uniqueID    string
+	// Error returned by a middleware, which short-circuited the chain.
+	rejected *ocpp.Error
+}
+
+// inbound parses an incoming message and passes it through the middleware chain, before it is processed.
+// If a middleware replaced the raw message, the replacement is parsed instead.
+//
+// The returned error is the error encountered while parsing the message, unless the chain short-circuited.
+func (endpoint *Endpoint) inbound(clientID string, raw []byte, rawFields []json.RawMessage, state ClientState) (inboundMessage, error) {
+	in := inboundMessage{raw: raw, rawFields: rawFields}
+	message, err := endpoint.ParseRawMessage(rawFields, state)
+	in.message = message
+	if endpoint.middleware == nil || (err == nil && message == nil) {
+		return in, err
+	}
+	msg := endpoint.newInboundContext(clientID, message, raw, rawFields, state)
+	in.messageType, in.uniqueID = msg.MessageType, msg.UniqueID
+	if rejected := endpoint.handleMiddleware(msg); rejected != nil {
+		in.rejected = rejected
+		return in, nil
+	}
+	if !bytes.Equal(msg.Raw, raw) {
+		in.raw = msg.Raw
+		in.message = nil
+		if in.rawFields, err = endpoint.ParseEnvelope(msg.Raw); err != nil {
+			return in, ocpp.NewError(FormatErrorType(endpoint), err.Error(), "")
+		}
+		in.message, err = endpoint.ParseRawMessage(in.rawFields, state)
+		return in, err
+	}
+	if err != nil {
+		return in, err
+	}
+	switch m := message.(type) {
+	case *Call:
+		if request, ok := msg.Payload.(ocpp.Request); ok {
+			m.Payload = request
+		}
+	case *CallResult:
+		if response, ok := msg.Payload.(ocpp.Response); ok {
+			m.Payload = response
+		}
+	case *CallError:
+		if ocppErr, ok := msg.Payload.(*ocpp.Error); ok && ocppErr != nil {
+			m.ErrorCode = ocppErr.Code
+			m.ErrorDescription = ocppErr.Description
+		}
+	}
+	return in, nil
+}
+
+// newInboundContext creates the context for an incoming message passing through the middleware chain.
+// If the message couldn't be parsed, the context is filled from its envelope as far as possible.
+func (endpoint *Endpoint) newInboundContext(clientID string, message Message, raw []byte, rawFields []json.RawMessage, state ClientState) *MessageContext {
+	var msg *MessageContext
+	if message != nil {
+		msg = newMessageContext(Inbound, clientID, message, raw)
+	} else {
+		msg = &MessageContext{Direction: Inbound, ClientID: clientID, Raw: raw}
+		codec := endpoint.Codec()
+		var rawTypeId float64
+		if len(rawFields) > 0 && codec.Unmarshal(rawFields[0], &rawTypeId) == nil {
+			msg.MessageType = MessageType(rawTypeId)
+		}
+		if len(rawFields) > 1 {
+			msg.UniqueID, _ = rawJsonString(codec, rawFields[1])
+		}
+		if msg.MessageType == CALL && len(rawFields) > 2 {
+			msg.Action, _ = rawJsonString(codec, rawFields[2])
+		}
+	}
+	if msg.Action == "" && msg.MessageType != CALL && state != nil {
+		if request, ok := state.GetPendingRequest(msg.UniqueID); ok {
+			msg.Action = request.GetFeatureName()
+		}
+	}
+	return msg
+}
@@ -5,7 +5,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"math/rand"
 	"reflect"
 	"sync/atomic"
 
@@ -22,6 +21,8 @@ func init() {
 
 // Allows an instance of ocppj to configure if the message is Marshaled by escaping special caracters like "<", ">", "&" etc
 // For more info https://pkg.go.dev/encoding/json#HTMLEscape
+//
+// The flag applies to all endpoints using the default codec. Endpoints with a custom codec are configured via Codec.SetEscapeHTML.
 func SetHTMLEscape(flag bool) {
 	EscapeHTML.Store(flag)
 }
@@ -44,9 +45,7 @@ type Message interface {
 	json.Marshaler
 }
 
-var messageIdGenerator = func() string {
-	return fmt.Sprintf("%v", rand.Uint32())
-}
+var messageIdGenerator = RandomMessageId
 
 // SetMessageIdGenerator sets a lambda function for generating unique IDs for new messages.
 // The function is invoked automatically when creating a new Call.
@@ -54,6 +53,8 @@ var messageIdGenerator = func() string {
 // Settings this overrides the default behavior, which is:
 //
 //	fmt.Sprintf("%v", rand.Uint32())
+//
+// The generator may also be set for a single endpoint, via Endpoint.SetMessageIdGenerator.
 func SetMessageIdGenerator(generator func() string) {
 	if generator != nil {
 		messageIdGenerator = generator
@@ -80,12 +81,16 @@ func (call *Call) GetUniqueId() string {
 }
 
 func (call *Call) MarshalJSON() ([]byte, error) {
+	return defaultCodec.Marshal(call.fields())
+}
+
+func (call *Call) fields() []interface{} {
 	fields := make([]interface{}, 4)
 	fields[0] = int(call.MessageTypeId)
 	fields[1] = call.UniqueId
 	fields[2] = call.Action
 	fields[3] = call.Payload
-	return jsonMarshal(fields)
+	return fields
 }
 
 // -------------------- Call Result --------------------
@@ -107,11 +112,15 @@ func (callResult *CallResult) GetUniqueId() string {
 }
 
 func (callResult *CallResult) MarshalJSON() ([]byte, error) {
+	return defaultCodec.Marshal(callResult.fields())
+}
+
+func (callResult *CallResult) fields() []interface{} {
 	fields := make([]interface{}, 3)
 	fields[0] = int(callResult.MessageTypeId)
 	fields[1] = callResult.UniqueId
 	fields[2] = callResult.Payload
-	return jsonMarshal(fields)
+	return fields
 }
 
 // -------------------- Call Error --------------------
@@ -135,6 +144,10 @@ func (callError *CallError) GetUniqueId() string {
 }
 
 func (callError *CallError) MarshalJSON() ([]byte, error) {
+	return defaultCodec.Marshal(callError.fields())
+}
+
+func (callError *CallError) fields() []interface{} {
 	fields := make([]interface{}, 5)
 	fields[0] = int(callError.MessageTypeId)
 	fields[1] = callError.UniqueId
@@ -145,7 +158,7 @@ func (callError *CallError) MarshalJSON() ([]byte, error) {
 	} else {
 		fields[4] = callError.ErrorDetails
 	}
-	return ocppMessageToJson(fields)
+	return fields
 }
 
 const (
@@ -212,6 +225,20 @@ func ParseRawJsonMessage(dataJson []byte) ([]interface{}, error) {
 	return arr, nil
 }
 
+// Unmarshals the envelope of an OCPP-J json object from a byte array, using the default codec.
+// Returns the raw elements contained in the message, which are not decoded any further.
+// The payload is decoded exactly once, directly into the type of the feature, by Endpoint.ParseRawMessage.
+//
+// To decode the envelope with the codec of an endpoint, use Endpoint.ParseEnvelope.
+func ParseRawJsonEnvelope(dataJson []byte) ([]json.RawMessage, error) {
+	var arr []json.RawMessage
+	err := defaultCodec.Unmarshal(dataJson, &arr)
+	if err != nil {
+		return nil, err
+	}
+	return arr, nil
+}
+
 // Unmarshals an OCPP-J json object from a JSON string.
 // Returns the array of elements contained in the message.
 func ParseJsonMessage(dataJson string) ([]interface{}, error) {
@@ -219,16 +246,6 @@ func ParseJsonMessage(dataJson string) ([]interface{}, error) {
 	return ParseRawJsonMessage(rawJson)
 }
 
-func ocppMessageToJson(message interface{}) ([]byte, error) {
-	jsonData, err := jsonMarshal(message)
-	if err != nil {
-		return nil, err
-	}
-	jsonData[0] = '['
-	jsonData[len(jsonData)-1] = ']'
-	return jsonData, nil
-}
-
 func getValueLength(value interface{}) int {
 	switch value := value.(type) {
 	case int:
@@ -282,22 +299,19 @@ func errorFromValidation(d dialector, validationErrors validator.ValidationError
 	return ocpp.NewError(GenericError, fmt.Sprintf("%v", validationErrors.Error()), messageId)
 }
 
-// Marshals data by manipulating EscapeHTML property of encoder
-func jsonMarshal(t interface{}) ([]byte, error) {
-	buffer := &bytes.Buffer{}
-	encoder := json.NewEncoder(buffer)
-	encoder.SetEscapeHTML(EscapeHTML.Load())
-	err := encoder.Encode(t)
-	return bytes.TrimRight(buffer.Bytes(), "\n"), err
-}
-
 // -------------------- Endpoint --------------------
 
 // An OCPP-J endpoint is one of the two entities taking part in the communication.
 // The endpoint keeps state for supported OCPP profiles and current pending requests.
 type Endpoint struct {
-	dialect  ocpp.Dialect
-	Profiles []*ocpp.Profile
+	dialect            ocpp.Dialect
+	Profiles           []*ocpp.Profile
+	messageIdGenerator func() string
+	messageIdInUse     func(clientID string, messageID string) bool
+	codec              Codec
+	middlewares        middlewareChain
+	// middleware is the composed middleware chain, nil if no middlewares were added
+	middleware MessageHandlerFunc
 }
 
 // Sets endpoint dialect.
@@ -337,56 +351,100 @@ func (endpoint *Endpoint) GetProfileForFeature(featureName string) (*ocpp.Profil
 	return nil, false
 }
 
-func parseRawJsonRequest(raw interface{}, requestType reflect.Type) (ocpp.Request, error) {
-	if raw == nil {
-		raw = &struct{}{}
-	}
-	bytes, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
-	}
+func (endpoint *Endpoint) parseRawJsonRequest(raw interface{}, requestType reflect.Type) (ocpp.Request, error) {
 	request := reflect.New(requestType).Interface()
-	err = json.Unmarshal(bytes, &request)
-	if err != nil {
+	if err := unmarshalRawJson(endpoint.Codec(), raw, request); err != nil {
 		return nil, err
 	}
 	result := request.(ocpp.Request)
 	return result, nil
 }
 
-func parseRawJsonConfirmation(raw interface{}, confirmationType reflect.Type) (ocpp.Response, error) {
-	if raw == nil {
-		raw = &struct{}{}
-	}
-	bytes, err := json.Marshal(raw)
-	if err != nil {
-		return nil, err
-	}
+func (endpoint *Endpoint) parseRawJsonConfirmation(raw interface{}, confirmationType reflect.Type) (ocpp.Response, error) {
 	confirmation := reflect.New(confirmationType).Interface()
-	err = json.Unmarshal(bytes, &confirmation)
-	if err != nil {
+	if err := unmarshalRawJson(endpoint.Codec(), raw, confirmation); err != nil {
 		return nil, err
 	}
 	result := confirmation.(ocpp.Response)
 	return result, nil
 }
 
+// unmarshalRawJson decodes a payload into target. Raw JSON is decoded right away,
+// while previously decoded values (e.g. maps) need to be encoded again first.
+func unmarshalRawJson(codec Codec, raw interface{}, target interface{}) error {
+	var data []byte
+	switch raw := raw.(type) {
+	case json.RawMessage:
+		data = raw
+	case nil:
+		return nil
+	default:
+		var err error
+		if data, err = codec.Marshal(raw); err != nil {
+			return err
+		}
+	}
+	return codec.Unmarshal(data, target)
+}
+
+// rawJsonValue decodes a single element of a message into a generic value, e.g. for error descriptions.
+func rawJsonValue(codec Codec, raw json.RawMessage) interface{} {
+	var value interface{}
+	if err := codec.Unmarshal(raw, &value); err != nil {
+		return string(raw)
+	}
+	return value
+}
+
+// rawJsonString decodes a single element of a message, which is expected to be a string.
+func rawJsonString(codec Codec, raw json.RawMessage) (string, bool) {
+	// Fast path for strings without escape sequences
+	if len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"' && bytes.IndexByte(raw, '\\') < 0 {
+		return string(raw[1 : len(raw)-1]), true
+	}
+	var value string
+	if err := codec.Unmarshal(raw, &value); err != nil {
+		return "", false
+	}
+	return value, true
+}
+
 // Parses an OCPP-J message. The function expects an array of elements, as contained in the JSON message.
 //
 // Pending requests are automatically cleared, in case the received message is a CallResponse or CallError.
+//
+// Since the elements were already decoded, they need to be encoded again. To parse incoming messages,
+// prefer ParseRawJsonEnvelope and ParseRawMessage, which decode the payload only once.
 func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState ClientState) (Message, error) {
+	fields := make([]json.RawMessage, len(arr))
+	for i, el := range arr {
+		raw, err := endpoint.Codec().Marshal(el)
+		if err != nil {
+			return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at %d: %v", el, i, err), "")
+		}
+		fields[i] = raw
+	}
+	return endpoint.ParseRawMessage(fields, pendingRequestState)
+}
+
+// Parses an OCPP-J message. The function expects the raw elements, as contained in the JSON message
+// and returned by ParseRawJsonEnvelope. The payload is decoded directly into the type of the feature.
+//
+// Pending requests are automatically cleared, in case the received message is a CallResponse or CallError.
+func (endpoint *Endpoint) ParseRawMessage(arr []json.RawMessage, pendingRequestState ClientState) (Message, error) {
 	// Checking message fields
 	if len(arr) < 3 {
 		return nil, ocpp.NewError(FormatErrorType(endpoint), "Invalid message. Expected array length >= 3", "")
 	}
-	rawTypeId, ok := arr[0].(float64)
-	if !ok {
-		return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 0, expected message type (int)", arr[0]), "")
+	codec := endpoint.Codec()
+	var rawTypeId float64
+	if err := codec.Unmarshal(arr[0], &rawTypeId); err != nil {
+		return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 0, expected message type (int)", rawJsonValue(codec, arr[0])), "")
 	}
 	typeId := MessageType(rawTypeId)
-	uniqueId, ok := arr[1].(string)
+	uniqueId, ok := rawJsonString(codec, arr[1])
 	if !ok {
-		return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 1, expected unique ID (string)", arr[1]), uniqueId)
+		return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 1, expected unique ID (string)", rawJsonValue(codec, arr[1])), uniqueId)
 	}
 	if uniqueId == "" {
 		return nil, ocpp.NewError(FormatErrorType(endpoint), "Invalid unique ID, cannot be empty", uniqueId)
@@ -396,16 +454,16 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 		if len(arr) != 4 {
 			return nil, ocpp.NewError(FormatErrorType(endpoint), "Invalid Call message. Expected array length 4", uniqueId)
 		}
-		action, ok := arr[2].(string)
+		action, ok := rawJsonString(codec, arr[2])
 		if !ok {
-			return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 2, expected action (string)", arr[2]), uniqueId)
+			return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 2, expected action (string)", rawJsonValue(codec, arr[2])), uniqueId)
 		}
 
 		profile, ok := endpoint.GetProfileForFeature(action)
 		if !ok {
 			return nil, ocpp.NewError(NotSupported, fmt.Sprintf("Unsupported feature %v", action), uniqueId)
 		}
-		request, err := profile.ParseRequest(action, arr[3], parseRawJsonRequest)
+		request, err := profile.ParseRequest(action, arr[3], endpoint.parseRawJsonRequest)
 		if err != nil {
 			return nil, ocpp.NewError(FormatErrorType(endpoint), err.Error(), uniqueId)
 		}
@@ -427,7 +485,7 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 			return nil, nil
 		}
 		profile, _ := endpoint.GetProfileForFeature(request.GetFeatureName())
-		confirmation, err := profile.ParseResponse(request.GetFeatureName(), arr[2], parseRawJsonConfirmation)
+		confirmation, err := profile.ParseResponse(request.GetFeatureName(), arr[2], endpoint.parseRawJsonConfirmation)
 		if err != nil {
 			return nil, ocpp.NewError(FormatErrorType(endpoint), err.Error(), uniqueId)
 		}
@@ -452,17 +510,14 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 		}
 		var details interface{}
 		if len(arr) > 4 {
-			details = arr[4]
+			details = rawJsonValue(codec, arr[4])
 		}
-		rawErrorCode, ok := arr[2].(string)
+		rawErrorCode, ok := rawJsonString(codec, arr[2])
 		if !ok {
-			return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 2, expected rawErrorCode (string)", arr[2]), rawErrorCode)
+			return nil, ocpp.NewError(FormatErrorType(endpoint), fmt.Sprintf("Invalid element %v at 2, expected rawErrorCode (string)", rawJsonValue(codec, arr[2])), rawErrorCode)
 		}
 		errorCode := ocpp.ErrorCode(rawErrorCode)
-		errorDescription := ""
-		if v, ok := arr[3].(string); ok {
-			errorDescription = v
-		}
+		errorDescription, _ := rawJsonString(codec, arr[3])
 		callError := CallError{
 			MessageTypeId:    CALL_ERROR,
 			UniqueId:         uniqueId,
@@ -485,13 +540,21 @@ func (endpoint *Endpoint) ParseMessage(arr []interface{}, pendingRequestState Cl
 //
 // The created call is not automatically scheduled for transmission and is not added to the list of pending requests.
 func (endpoint *Endpoint) CreateCall(request ocpp.Request) (*Call, error) {
+	return endpoint.createCall(request, nil)
+}
+
+// createCall creates a Call message like CreateCall.
+// If isInUse is not nil, the message ID is regenerated in case it collides with a message ID currently in use.
+func (endpoint *Endpoint) createCall(request ocpp.Request, isInUse func(id string) bool) (*Call, error) {
 	action := request.GetFeatureName()
 	profile, _ := endpoint.GetProfileForFeature(action)
 	if profile == nil {
 		return nil, fmt.Errorf("Couldn't create Call for unsupported action %v", action)
 	}
-	// TODO: handle collisions?
-	uniqueId := messageIdGenerator()
+	uniqueId, err := endpoint.newMessageId(isInUse)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create Call for action %v: %w", action, err)
+	}
 	call := Call{
 		MessageTypeId: CALL,
 		UniqueId:      uniqueId,
@@ -1,13 +1,20 @@
 package ocppj_test
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net"
+	"net/http"
 	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	ut "github.com/go-playground/universal-translator"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -15,6 +22,11 @@ import (
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ocppj"
 	"github.com/xBlaz3kx/ocpp-go/ws"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/go-playground/validator.v9"
 )
 
@@ -46,6 +58,60 @@ func NewMockWebSocket(id string) MockWebSocket {
 	return MockWebSocket{id: id}
 }
 
+// MockTracedWebSocket is a MockWebSocket, whose connection is traced.
+type MockTracedWebSocket struct {
+	MockWebSocket
+	spanContext trace.SpanContext
+}
+
+func (websocket MockTracedWebSocket) SpanContext() trace.SpanContext {
+	return websocket.spanContext
+}
+
+func newTestSpanContext() trace.SpanContext {
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x01},
+		SpanID:     trace.SpanID{0x02},
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func newTestTracerProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+// findSpan returns the first exported span with the given kind.
+func findSpan(exporter *tracetest.InMemoryExporter, kind trace.SpanKind) (tracetest.SpanStub, bool) {
+	for _, span := range exporter.GetSpans() {
+		if span.SpanKind == kind {
+			return span, true
+		}
+	}
+	return tracetest.SpanStub{}, false
+}
+
+func newTestMeterProvider() (*sdkmetric.MeterProvider, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	return sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)), reader
+}
+
+// collectMetric returns the collected data points of a metric, or nil if the metric wasn't recorded.
+func collectMetric(reader *sdkmetric.ManualReader, name string) metricdata.Aggregation {
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		return nil
+	}
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return m.Data
+			}
+		}
+	}
+	return nil
+}
+
 // ---------------------- MOCK WEBSOCKET SERVER ----------------------
 
 type MockWebsocketServer struct {
@@ -55,17 +121,42 @@ type MockWebsocketServer struct {
 	NewClientHandler          func(ws ws.Channel)
 	CheckClientHandler        ws.CheckClientHandler
 	DisconnectedClientHandler func(ws ws.Channel)
+	ReplacedClientHandler     ws.ReplacedHandler
+	RateLimitedHandler        ws.MessageHandler
 	errC                      chan error
 }
 
+// basicWebsocketServer only exposes the methods of ws.Server, hiding the optional interfaces of the wrapped server.
+type basicWebsocketServer struct {
+	ws.Server
+}
+
 func (websocketServer *MockWebsocketServer) Start(port int, listenPath string) {
 	websocketServer.MethodCalled("Start", port, listenPath)
 }
 
+func (websocketServer *MockWebsocketServer) Serve(listener net.Listener, listenPath string) error {
+	args := websocketServer.MethodCalled("Serve", listener, listenPath)
+	return args.Error(0)
+}
+
+func (websocketServer *MockWebsocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	websocketServer.MethodCalled("ServeHTTP", w, r)
+}
+
 func (websocketServer *MockWebsocketServer) Stop() {
 	websocketServer.MethodCalled("Stop")
 }
 
+func (websocketServer *MockWebsocketServer) StopAccepting() {
+	websocketServer.MethodCalled("StopAccepting")
+}
+
+func (websocketServer *MockWebsocketServer) Shutdown(ctx context.Context) error {
+	args := websocketServer.MethodCalled("Shutdown", ctx)
+	return args.Error(0)
+}
+
 func (websocketServer *MockWebsocketServer) Write(webSocketId string, data []byte) error {
 	args := websocketServer.MethodCalled("Write", webSocketId, data)
 	return args.Error(0)
@@ -83,6 +174,14 @@ func (websocketServer *MockWebsocketServer) SetDisconnectedClientHandler(handler
 	websocketServer.DisconnectedClientHandler = handler
 }
 
+func (websocketServer *MockWebsocketServer) SetReplacedClientHandler(handler ws.ReplacedHandler) {
+	websocketServer.ReplacedClientHandler = handler
+}
+
+func (websocketServer *MockWebsocketServer) SetRateLimitedMessageHandler(handler ws.MessageHandler) {
+	websocketServer.RateLimitedHandler = handler
+}
+
 func (websocketServer *MockWebsocketServer) AddSupportedSubprotocol(subProto string) {
 }
 
@@ -107,15 +206,22 @@ func (websocketServer *MockWebsocketServer) SetCheckClientHandler(handler ws.Che
 	websocketServer.CheckClientHandler = handler
 }
 
+func (websocketServer *MockWebsocketServer) GetChannel(websocketId string) (ws.Channel, bool) {
+	args := websocketServer.MethodCalled("GetChannel", websocketId)
+	channel, _ := args.Get(0).(ws.Channel)
+	return channel, args.Bool(1)
+}
+
 // ---------------------- MOCK WEBSOCKET CLIENT ----------------------
 
 type MockWebsocketClient struct {
 	mock.Mock
 	ws.Client
-	MessageHandler      func(data []byte) error
-	ReconnectedHandler  func()
-	DisconnectedHandler func(err error)
-	errC                chan error
+	MessageHandler        func(data []byte) error
+	ReconnectedHandler    func()
+	DisconnectedHandler   func(err error)
+	ActiveEndpointHandler func(endpoint ws.Endpoint, index int)
+	errC                  chan error
 }
 
 func (websocketClient *MockWebsocketClient) Start(url string) error {
@@ -123,6 +229,10 @@ func (websocketClient *MockWebsocketClient) Start(url string) error {
 	return args.Error(0)
 }
 
+func (websocketClient *MockWebsocketClient) StartWithEndpoints(endpoints []ws.Endpoint) {
+	websocketClient.MethodCalled("StartWithEndpoints", endpoints)
+}
+
 func (websocketClient *MockWebsocketClient) Stop() {
 	websocketClient.MethodCalled("Stop")
 }
@@ -139,6 +249,10 @@ func (websocketClient *MockWebsocketClient) SetDisconnectedHandler(handler func(
 	websocketClient.DisconnectedHandler = handler
 }
 
+func (websocketClient *MockWebsocketClient) SetActiveEndpointHandler(handler func(endpoint ws.Endpoint, index int)) {
+	websocketClient.ActiveEndpointHandler = handler
+}
+
 func (websocketClient *MockWebsocketClient) ThrowError(err error) {
 	if websocketClient.errC != nil {
 		websocketClient.errC <- err
@@ -489,6 +603,216 @@ func (suite *OcppJTestSuite) TestCreateCall() {
 	suite.Assert().Nil(pendingRequest)
 }
 
+func (suite *OcppJTestSuite) TestCreateCallEndpointMessageIdGenerator() {
+	suite.chargePoint.SetMessageIdGenerator(func() string {
+		return "endpoint-id"
+	})
+	call, err := suite.chargePoint.CreateCall(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal("endpoint-id", call.UniqueId)
+	// Other endpoints are unaffected
+	call, err = suite.centralSystem.CreateCall(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Assert().NotEqual("endpoint-id", call.UniqueId)
+}
+
+func (suite *OcppJTestSuite) TestMessageIdGenerators() {
+	id, err := uuid.Parse(ocppj.UUIDv4MessageId())
+	suite.Require().NoError(err)
+	suite.Assert().Equal(uuid.Version(4), id.Version())
+	first, err := uuid.Parse(ocppj.UUIDv7MessageId())
+	suite.Require().NoError(err)
+	suite.Assert().Equal(uuid.Version(7), first.Version())
+	second, err := uuid.Parse(ocppj.UUIDv7MessageId())
+	suite.Require().NoError(err)
+	suite.Assert().Less(first.String(), second.String())
+	generate := ocppj.NewMonotonicMessageIdGenerator()
+	previous, err := strconv.ParseUint(generate(), 10, 64)
+	suite.Require().NoError(err)
+	for i := 0; i < 10; i++ {
+		next, err := strconv.ParseUint(generate(), 10, 64)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(previous+1, next)
+		previous = next
+	}
+	suite.Assert().NotEmpty(ocppj.RandomMessageId())
+}
+
+// sequenceMessageIdGenerator returns the given IDs in order, repeating the last one forever.
+func sequenceMessageIdGenerator(ids ...string) func() string {
+	var mutex sync.Mutex
+	return func() string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		id := ids[0]
+		if len(ids) > 1 {
+			ids = ids[1:]
+		}
+		return id
+	}
+}
+
+func (suite *OcppJTestSuite) TestClientMessageIdCollision() {
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Return(nil)
+	suite.chargePoint.SetMessageIdGenerator(sequenceMessageIdGenerator("1", "1", "2", "1"))
+	err := suite.chargePoint.Start("someUrl")
+	suite.Require().NoError(err)
+	requestID, err := suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Equal("1", requestID)
+	suite.Require().Eventually(suite.chargePoint.RequestState.HasPendingRequest, time.Second, 10*time.Millisecond)
+	// ID of the pending request is skipped
+	requestID, err = suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal("2", requestID)
+	// Give up, if no unique ID can be generated
+	_, err = suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	suite.Assert().ErrorContains(err, "unique message ID")
+}
+
+func (suite *OcppJTestSuite) TestServerMessageIdCollision() {
+	mockChargePointId := "1234"
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	suite.centralSystem.SetMessageIdGenerator(sequenceMessageIdGenerator("1", "1", "2"))
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	requestID, err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Equal("1", requestID)
+	suite.Require().Eventually(func() bool {
+		return suite.centralSystem.RequestState.HasPendingRequest(mockChargePointId)
+	}, time.Second, 10*time.Millisecond)
+	// ID of the pending request is skipped
+	requestID, err = suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal("2", requestID)
+}
+
+func (suite *OcppJTestSuite) TestServerMessageIdInUseHandler() {
+	mockChargePointId := "1234"
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	suite.centralSystem.SetMessageIdGenerator(sequenceMessageIdGenerator("1", "2"))
+	suite.centralSystem.SetMessageIdInUseHandler(func(clientID string, messageID string) bool {
+		return clientID == mockChargePointId && messageID == "1"
+	})
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	requestID, err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Assert().Equal("2", requestID)
+}
+
+func (suite *OcppJTestSuite) TestServerMessageIdCollisionQueued() {
+	mockChargePointId := "1234"
+	suite.mockServer.On("Start", mock.AnythingOfType("int"), mock.AnythingOfType("string")).Return(nil)
+	suite.mockServer.On("Write", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+	suite.centralSystem.SetMessageIdGenerator(sequenceMessageIdGenerator("1", "2", "1", "2", "3"))
+	suite.centralSystem.Start(8887, "/{ws}")
+	suite.serverDispatcher.CreateClient(mockChargePointId)
+	for _, expected := range []string{"1", "2", "3"} {
+		requestID, err := suite.centralSystem.SendRequest(mockChargePointId, newMockRequest("somevalue"))
+		suite.Require().NoError(err)
+		suite.Assert().Equal(expected, requestID)
+	}
+}
+
+func (suite *OcppJTestSuite) TestClientRetransmissionMessageIdGenerator() {
+	sent := make(chan string, 2)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		data, _ := args.Get(0).([]byte)
+		arr, err := ocppj.ParseJsonMessage(string(data))
+		suite.Require().NoError(err)
+		sent <- arr[1].(string)
+	}).Return(nil)
+	suite.clientDispatcher.(retryPolicySetter).SetRetryPolicy(&ocppj.RetryPolicy{MaxAttempts: 2})
+	suite.clientDispatcher.SetTimeout(100 * time.Millisecond)
+	// Retransmissions use the generator of the endpoint, skipping the ID of the queued request
+	suite.chargePoint.SetMessageIdGenerator(sequenceMessageIdGenerator("1", "1", "2"))
+	err := suite.chargePoint.Start("someUrl")
+	suite.Require().NoError(err)
+	requestID, err := suite.chargePoint.SendRequest(newMockRequest("somevalue"))
+	suite.Require().NoError(err)
+	suite.Require().Equal("1", requestID)
+	for _, expected := range []string{"1", "2"} {
+		select {
+		case messageID := <-sent:
+			suite.Assert().Equal(expected, messageID)
+		case <-time.After(time.Second):
+			suite.Require().Fail("request wasn't transmitted")
+		}
+	}
+}
+
+// countingCodec is a Codec, which keeps track of the encoded and decoded messages.
+type countingCodec struct {
+	*ocppj.JSONCodec
+	marshaled   atomic.Int32
+	unmarshaled atomic.Int32
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshaled.Add(1)
+	return c.JSONCodec.Marshal(v)
+}
+
+func (c *countingCodec) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshaled.Add(1)
+	return c.JSONCodec.Unmarshal(data, v)
+}
+
+func (suite *OcppJTestSuite) TestJSONCodecEscapeHTML() {
+	codec := ocppj.NewJSONCodec()
+	data, err := codec.Marshal("<&>")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(`"\u003c\u0026\u003e"`, string(data))
+	codec.SetEscapeHTML(false)
+	data, err = codec.Marshal("<&>")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(`"<&>"`, string(data))
+	// Default codec of endpoints is unaffected
+	call, err := suite.chargePoint.CreateCall(newMockRequest("<&>"))
+	suite.Require().NoError(err)
+	data, err = suite.chargePoint.MarshalMessage(call)
+	suite.Require().NoError(err)
+	suite.Assert().Contains(string(data), `\u003c\u0026\u003e`)
+}
+
+func (suite *OcppJTestSuite) TestEndpointCodec() {
+	codec := &countingCodec{JSONCodec: ocppj.NewJSONCodec()}
+	codec.SetEscapeHTML(false)
+	suite.chargePoint.SetCodec(codec)
+	suite.Assert().Equal(codec, suite.chargePoint.Codec())
+	suite.Assert().NotEqual(codec, suite.centralSystem.Codec())
+	sent := make(chan []byte, 1)
+	suite.mockClient.On("Start", mock.AnythingOfType("string")).Return(nil)
+	suite.mockClient.On("Write", mock.Anything).Run(func(args mock.Arguments) {
+		sent <- args.Get(0).([]byte)
+	}).Return(nil)
+	suite.Require().NoError(suite.chargePoint.Start("someUrl"))
+	requestID, err := suite.chargePoint.SendRequest(newMockRequest("<&>"))
+	suite.Require().NoError(err)
+	select {
+	case data := <-sent:
+		suite.Assert().Contains(string(data), fmt.Sprintf(`[2,"%v","%v",{`, requestID, MockFeatureName))
+		suite.Assert().Contains(string(data), `"mockValue":"<&>"`)
+	case <-time.After(time.Second):
+		suite.Require().Fail("request wasn't sent")
+	}
+	suite.Assert().Equal(int32(1), codec.marshaled.Load())
+	// Incoming messages are decoded with the codec as well
+	err = suite.mockClient.MessageHandler([]byte(fmt.Sprintf(`[3,"%v",{"mockValue":"somevalue"}]`, requestID)))
+	suite.Require().NoError(err)
+	suite.Assert().Positive(codec.unmarshaled.Load())
+	suite.Assert().False(suite.chargePoint.RequestState.HasPendingRequest())
+	// Restore the default codec
+	suite.chargePoint.SetCodec(nil)
+	suite.Assert().NotEqual(codec, suite.chargePoint.Codec())
+}
+
 func (suite *OcppJTestSuite) TestCreateCallResult() {
 	t := suite.T()
 	mockValue := "someothervalue"
@@ -809,9 +1133,13 @@ func (m MockValidationError) Error() string                     { return fmt.Spr
 func TestMockOcppJ(t *testing.T) {
 	suite.Run(t, new(ClientQueueTestSuite))
 	suite.Run(t, new(ServerQueueMapTestSuite))
+	suite.Run(t, new(ShardedQueueMapTestSuite))
 	suite.Run(t, new(ClientStateTestSuite))
 	suite.Run(t, new(ServerStateTestSuite))
 	suite.Run(t, new(ClientDispatcherTestSuite))
 	suite.Run(t, new(ServerDispatcherTestSuite))
+	suite.Run(t, new(ShardedServerDispatcherTestSuite))
 	suite.Run(t, new(OcppJTestSuite))
+	suite.Run(t, new(FileRequestQueueTestSuite))
+	suite.Run(t, new(PriorityQueueTestSuite))
 }
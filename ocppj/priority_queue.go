@@ -0,0 +1,367 @@
+package ocppj
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+)
+
+// RequestPriority defines the order in which requests in a PriorityRequestQueue are dispatched.
+// Requests with a lower value are dispatched first.
+type RequestPriority int
+
+const (
+	PriorityBoot        RequestPriority = 0
+	PriorityTransaction RequestPriority = 10
+	PriorityStatus      RequestPriority = 20
+	PriorityDefault     RequestPriority = 30
+	PriorityMeterValues RequestPriority = 40
+)
+
+// DefaultFeaturePriorities returns the feature priorities used by a PriorityRequestQueue, unless configured otherwise.
+//
+// Boot notifications are dispatched first, followed by transaction-related messages and status notifications.
+// Periodic meter values are dispatched last. All other features are assigned PriorityDefault.
+func DefaultFeaturePriorities() map[string]RequestPriority {
+	return map[string]RequestPriority{
+		"BootNotification":   PriorityBoot,
+		"StartTransaction":   PriorityTransaction,
+		"StopTransaction":    PriorityTransaction,
+		"TransactionEvent":   PriorityTransaction,
+		"StatusNotification": PriorityStatus,
+		"MeterValues":        PriorityMeterValues,
+	}
+}
+
+// DropPolicy selects the queued element to drop, when a new element is pushed into a full PriorityRequestQueue.
+//
+// queued contains the elements which may be dropped, in dispatch order. The request currently in flight is never part of it.
+// The function returns the index of the element to drop, or -1 to reject the new element instead.
+type DropPolicy func(queued []interface{}, element interface{}) int
+
+// RejectNewest is a DropPolicy, which never drops queued elements. Pushing into a full queue returns an error.
+// This is the default policy of a PriorityRequestQueue.
+func RejectNewest(queued []interface{}, element interface{}) int {
+	return -1
+}
+
+// DropOldest returns a DropPolicy, which drops the oldest queued request for any of the given features.
+// Requests for other features are never dropped, e.g. to drop periodic meter values but not transaction messages:
+//
+//	policy := ocppj.DropOldest("MeterValues")
+//
+// Requests belonging to a transaction, i.e. with a TransactionId set (e.g. OCPP 1.6 MeterValues sampled during a transaction),
+// are never dropped either, since OCPP requires them to be delivered.
+// If no such request is queued, the new element is rejected.
+func DropOldest(features ...string) DropPolicy {
+	return func(queued []interface{}, element interface{}) int {
+		return slices.IndexFunc(queued, func(el interface{}) bool {
+			return slices.Contains(features, featureNameOf(el)) && !isTransactionRelated(el)
+		})
+	}
+}
+
+type PriorityRequestQueueOption func(*PriorityRequestQueue)
+
+// WithFeaturePriorities sets the priority for each feature name. Features not contained in the map are
+// assigned the default priority. This replaces the DefaultFeaturePriorities.
+func WithFeaturePriorities(priorities map[string]RequestPriority) PriorityRequestQueueOption {
+	return func(q *PriorityRequestQueue) {
+		q.priorities = priorities
+	}
+}
+
+// WithDefaultPriority sets the priority for features without an explicit priority. Defaults to PriorityDefault.
+func WithDefaultPriority(priority RequestPriority) PriorityRequestQueueOption {
+	return func(q *PriorityRequestQueue) {
+		q.defaultPriority = priority
+	}
+}
+
+// WithDropPolicy sets the policy to apply when pushing into a full queue. Defaults to RejectNewest.
+func WithDropPolicy(policy DropPolicy) PriorityRequestQueueOption {
+	return func(q *PriorityRequestQueue) {
+		q.dropPolicy = policy
+	}
+}
+
+// WithDropHandler sets a function to be invoked for every element, which was dropped from the queue
+// in favor of a new element. The function is invoked synchronously while pushing.
+//
+// When used by a dispatcher, dropped requests are additionally canceled, so the request canceled handler
+// of the endpoint and the callback of the request are invoked with a GenericError.
+func WithDropHandler(handler func(element interface{})) PriorityRequestQueueOption {
+	return func(q *PriorityRequestQueue) {
+		q.onDrop = handler
+	}
+}
+
+type priorityBucket struct {
+	priority RequestPriority
+	elements []interface{}
+}
+
+// PriorityRequestQueue is a RequestQueue, which dispatches requests according to the priority of their feature.
+// Requests with the same priority are dispatched in FIFO order. The queue is thread-safe.
+//
+// The element returned by Peek stays at the front of the queue until it is popped or removed,
+// so a request in flight is never overtaken by requests with a higher priority pushed afterward.
+type PriorityRequestQueue struct {
+	buckets         []priorityBucket
+	head            interface{}
+	capacity        int
+	priorities      map[string]RequestPriority
+	defaultPriority RequestPriority
+	dropPolicy      DropPolicy
+	onDrop          func(element interface{})
+	mutex           sync.Mutex
+}
+
+// NewPriorityRequestQueue creates a new PriorityRequestQueue with the given capacity.
+//
+// Passing capacity = 0 will create a queue without a maximum capacity.
+// The capacity cannot change after creation.
+func NewPriorityRequestQueue(capacity int, opts ...PriorityRequestQueueOption) *PriorityRequestQueue {
+	q := &PriorityRequestQueue{
+		capacity:        capacity,
+		priorities:      DefaultFeaturePriorities(),
+		defaultPriority: PriorityDefault,
+		dropPolicy:      RejectNewest,
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	return q
+}
+
+func (q *PriorityRequestQueue) Init() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.buckets = nil
+	q.head = nil
+}
+
+func (q *PriorityRequestQueue) Push(element interface{}) error {
+	_, err := q.pushEvicting(element)
+	return err
+}
+
+// pushEvicting pushes the element like Push, and returns the element dropped in its favor, if any.
+func (q *PriorityRequestQueue) pushEvicting(element interface{}) (interface{}, error) {
+	q.mutex.Lock()
+	var dropped interface{}
+	if q.isFull() {
+		queued := q.queued()
+		i := q.dropPolicy(queued, element)
+		if i < 0 || i >= len(queued) {
+			q.mutex.Unlock()
+			return nil, fmt.Errorf("request queue is full, cannot push new element")
+		}
+		dropped = q.removeQueued(i)
+	}
+	b := q.bucket(q.priorityOf(element))
+	b.elements = append(b.elements, element)
+	q.mutex.Unlock()
+	if dropped != nil && q.onDrop != nil {
+		q.onDrop(dropped)
+	}
+	return dropped, nil
+}
+
+func (q *PriorityRequestQueue) Peek() interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.peek()
+}
+
+func (q *PriorityRequestQueue) Pop() interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	result := q.peek()
+	q.head = nil
+	return result
+}
+
+func (q *PriorityRequestQueue) peek() interface{} {
+	if q.head != nil {
+		return q.head
+	}
+	// Pin the next element, until it gets popped
+	for i := range q.buckets {
+		if len(q.buckets[i].elements) > 0 {
+			q.head = q.buckets[i].elements[0]
+			q.buckets[i].elements = q.buckets[i].elements[1:]
+			return q.head
+		}
+	}
+	return nil
+}
+
+func (q *PriorityRequestQueue) Remove(match func(element interface{}) bool) interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.remove(match)
+}
+
+func (q *PriorityRequestQueue) contains(match func(element interface{}) bool) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.head != nil && match(q.head) {
+		return true
+	}
+	for _, b := range q.buckets {
+		if slices.ContainsFunc(b.elements, match) {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *PriorityRequestQueue) Size() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size()
+}
+
+func (q *PriorityRequestQueue) IsFull() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.isFull()
+}
+
+func (q *PriorityRequestQueue) IsEmpty() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size() == 0
+}
+
+func (q *PriorityRequestQueue) size() int {
+	size := 0
+	if q.head != nil {
+		size++
+	}
+	for _, b := range q.buckets {
+		size += len(b.elements)
+	}
+	return size
+}
+
+func (q *PriorityRequestQueue) isFull() bool {
+	return q.capacity > 0 && q.size() >= q.capacity
+}
+
+// queued returns all elements except the pinned head, in dispatch order.
+func (q *PriorityRequestQueue) queued() []interface{} {
+	var queued []interface{}
+	for _, b := range q.buckets {
+		queued = append(queued, b.elements...)
+	}
+	return queued
+}
+
+// removeQueued removes the i-th element in dispatch order, not considering the pinned head.
+func (q *PriorityRequestQueue) removeQueued(i int) interface{} {
+	for j := range q.buckets {
+		b := &q.buckets[j]
+		if i < len(b.elements) {
+			el := b.elements[i]
+			b.elements = append(b.elements[:i:i], b.elements[i+1:]...)
+			return el
+		}
+		i -= len(b.elements)
+	}
+	return nil
+}
+
+func (q *PriorityRequestQueue) remove(match func(element interface{}) bool) interface{} {
+	if q.head != nil && match(q.head) {
+		result := q.head
+		q.head = nil
+		return result
+	}
+	for i := range q.buckets {
+		b := &q.buckets[i]
+		for j, el := range b.elements {
+			if match(el) {
+				b.elements = append(b.elements[:j:j], b.elements[j+1:]...)
+				return el
+			}
+		}
+	}
+	return nil
+}
+
+// bucket returns the bucket for the given priority, creating it if needed. Buckets are sorted by priority.
+func (q *PriorityRequestQueue) bucket(priority RequestPriority) *priorityBucket {
+	i, found := slices.BinarySearchFunc(q.buckets, priority, func(b priorityBucket, p RequestPriority) int {
+		return int(b.priority) - int(p)
+	})
+	if !found {
+		q.buckets = slices.Insert(q.buckets, i, priorityBucket{priority: priority})
+	}
+	return &q.buckets[i]
+}
+
+func (q *PriorityRequestQueue) priorityOf(element interface{}) RequestPriority {
+	if priority, ok := q.priorities[featureNameOf(element)]; ok {
+		return priority
+	}
+	return q.defaultPriority
+}
+
+// featureNameOf returns the feature name of a queued element, which is either a RequestBundle or an ocpp.Request.
+func featureNameOf(element interface{}) string {
+	switch el := element.(type) {
+	case RequestBundle:
+		if el.Call != nil {
+			return el.Call.Action
+		}
+	case ocpp.Request:
+		return el.GetFeatureName()
+	}
+	return ""
+}
+
+// isTransactionRelated returns true if the payload of a queued element has a non-empty TransactionId field.
+func isTransactionRelated(element interface{}) bool {
+	var request interface{} = element
+	if bundle, ok := element.(RequestBundle); ok {
+		if bundle.Call == nil {
+			return false
+		}
+		request = bundle.Call.Payload
+	}
+	value := reflect.ValueOf(request)
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			return false
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return false
+	}
+	transactionID := value.FieldByName("TransactionId")
+	return transactionID.IsValid() && !transactionID.IsZero()
+}
+
+// PriorityQueueMap is a ServerQueueMap, which creates a PriorityRequestQueue for every client.
+// Apart from that, it behaves like a FIFOQueueMap.
+type PriorityQueueMap struct {
+	*FIFOQueueMap
+}
+
+// NewPriorityQueueMap creates a new PriorityQueueMap, which will automatically create priority queues
+// with the specified capacity and options.
+//
+// Passing capacity = 0 will generate queues without a maximum capacity.
+func NewPriorityQueueMap(clientQueueCapacity int, opts ...PriorityRequestQueueOption) *PriorityQueueMap {
+	queueMap := NewFIFOQueueMap(clientQueueCapacity)
+	queueMap.newQueue = func() RequestQueue {
+		return NewPriorityRequestQueue(clientQueueCapacity, opts...)
+	}
+	return &PriorityQueueMap{FIFOQueueMap: queueMap}
+}
@@ -0,0 +1,147 @@
+package ocppj_test
+
+import (
+	"fmt"
+
+	"github.com/stretchr/testify/suite"
+	"github.com/xBlaz3kx/ocpp-go/ocppj"
+)
+
+type PriorityQueueTestSuite struct {
+	suite.Suite
+}
+
+func newPriorityBundle(action string, id int) ocppj.RequestBundle {
+	uniqueID := fmt.Sprintf("%v-%v", action, id)
+	return ocppj.RequestBundle{
+		Call: &ocppj.Call{MessageTypeId: ocppj.CALL, UniqueId: uniqueID, Action: action},
+		Data: []byte(uniqueID),
+	}
+}
+
+func (suite *PriorityQueueTestSuite) popIDs(q ocppj.RequestQueue) []string {
+	var ids []string
+	for !q.IsEmpty() {
+		ids = append(ids, q.Pop().(ocppj.RequestBundle).Call.UniqueId)
+	}
+	return ids
+}
+
+func (suite *PriorityQueueTestSuite) TestPriorityOrder() {
+	q := ocppj.NewPriorityRequestQueue(0)
+	for i := 0; i < 2; i++ {
+		suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", i)))
+		suite.Require().NoError(q.Push(newPriorityBundle("Heartbeat", i)))
+		suite.Require().NoError(q.Push(newPriorityBundle("StatusNotification", i)))
+		suite.Require().NoError(q.Push(newPriorityBundle("StartTransaction", i)))
+	}
+	suite.Require().NoError(q.Push(newPriorityBundle("BootNotification", 0)))
+	suite.Assert().Equal(9, q.Size())
+	suite.Assert().Equal([]string{
+		"BootNotification-0",
+		"StartTransaction-0", "StartTransaction-1",
+		"StatusNotification-0", "StatusNotification-1",
+		"Heartbeat-0", "Heartbeat-1",
+		"MeterValues-0", "MeterValues-1",
+	}, suite.popIDs(q))
+	suite.Assert().Nil(q.Peek())
+	suite.Assert().Nil(q.Pop())
+}
+
+func (suite *PriorityQueueTestSuite) TestCustomPriorities() {
+	q := ocppj.NewPriorityRequestQueue(0,
+		ocppj.WithFeaturePriorities(map[string]ocppj.RequestPriority{"Heartbeat": 1}),
+		ocppj.WithDefaultPriority(5),
+	)
+	suite.Require().NoError(q.Push(newPriorityBundle("BootNotification", 0)))
+	suite.Require().NoError(q.Push(newPriorityBundle("Heartbeat", 0)))
+	suite.Assert().Equal([]string{"Heartbeat-0", "BootNotification-0"}, suite.popIDs(q))
+}
+
+func (suite *PriorityQueueTestSuite) TestPeekedElementIsNotOvertaken() {
+	q := ocppj.NewPriorityRequestQueue(0)
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 0)))
+	// Request is in flight
+	suite.Assert().Equal("MeterValues-0", q.Peek().(ocppj.RequestBundle).Call.UniqueId)
+	suite.Require().NoError(q.Push(newPriorityBundle("BootNotification", 0)))
+	suite.Assert().Equal("MeterValues-0", q.Peek().(ocppj.RequestBundle).Call.UniqueId)
+	suite.Assert().Equal([]string{"MeterValues-0", "BootNotification-0"}, suite.popIDs(q))
+}
+
+func (suite *PriorityQueueTestSuite) TestPriorityRemove() {
+	q := ocppj.NewPriorityRequestQueue(0)
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 0)))
+	suite.Require().NoError(q.Push(newPriorityBundle("StatusNotification", 0)))
+	q.Peek()
+	isRequest := func(id string) func(el interface{}) bool {
+		return func(el interface{}) bool {
+			return el.(ocppj.RequestBundle).Call.UniqueId == id
+		}
+	}
+	suite.Assert().NotNil(q.Remove(isRequest("MeterValues-0")))
+	suite.Assert().Nil(q.Remove(isRequest("MeterValues-0")))
+	// Pinned head was removed as well
+	suite.Assert().NotNil(q.Remove(isRequest("StatusNotification-0")))
+	suite.Assert().True(q.IsEmpty())
+}
+
+func (suite *PriorityQueueTestSuite) TestFullQueueRejectsNewest() {
+	q := ocppj.NewPriorityRequestQueue(2)
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 0)))
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 1)))
+	suite.Assert().True(q.IsFull())
+	suite.Assert().Error(q.Push(newPriorityBundle("BootNotification", 0)))
+	suite.Assert().Equal(2, q.Size())
+}
+
+func (suite *PriorityQueueTestSuite) TestFullQueueDropsOldestMeterValues() {
+	var dropped []string
+	q := ocppj.NewPriorityRequestQueue(3,
+		ocppj.WithDropPolicy(ocppj.DropOldest("MeterValues")),
+		ocppj.WithDropHandler(func(element interface{}) {
+			dropped = append(dropped, element.(ocppj.RequestBundle).Call.UniqueId)
+		}),
+	)
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 0)))
+	// In-flight request is never dropped
+	q.Peek()
+	suite.Require().NoError(q.Push(newPriorityBundle("StartTransaction", 0)))
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 1)))
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 2)))
+	suite.Assert().Equal([]string{"MeterValues-1"}, dropped)
+	suite.Require().NoError(q.Push(newPriorityBundle("StopTransaction", 0)))
+	suite.Assert().Equal([]string{"MeterValues-1", "MeterValues-2"}, dropped)
+	// Only transaction messages left, which are never dropped
+	suite.Assert().Error(q.Push(newPriorityBundle("MeterValues", 3)))
+	suite.Assert().Equal([]string{"MeterValues-0", "StartTransaction-0", "StopTransaction-0"}, suite.popIDs(q))
+}
+
+// transactionMockRequest is a request belonging to a transaction, e.g. OCPP 1.6 MeterValues with a TransactionId.
+type transactionMockRequest struct {
+	*MockRequest
+	TransactionId *int
+}
+
+func (suite *PriorityQueueTestSuite) TestDropOldestKeepsTransactionRelated() {
+	q := ocppj.NewPriorityRequestQueue(2, ocppj.WithDropPolicy(ocppj.DropOldest("MeterValues")))
+	transactionID := 42
+	transactionRelated := newPriorityBundle("MeterValues", 0)
+	transactionRelated.Call.Payload = &transactionMockRequest{MockRequest: newMockRequest("somevalue"), TransactionId: &transactionID}
+	suite.Require().NoError(q.Push(newPriorityBundle("StartTransaction", 0)))
+	q.Peek()
+	suite.Require().NoError(q.Push(transactionRelated))
+	suite.Assert().Error(q.Push(newPriorityBundle("MeterValues", 1)))
+	suite.Assert().Equal([]string{"StartTransaction-0", "MeterValues-0"}, suite.popIDs(q))
+}
+
+func (suite *PriorityQueueTestSuite) TestPriorityQueueMap() {
+	queueMap := ocppj.NewPriorityQueueMap(5)
+	q := queueMap.GetOrCreate("client1")
+	suite.Require().IsType(&ocppj.PriorityRequestQueue{}, q)
+	suite.Require().NoError(q.Push(newPriorityBundle("MeterValues", 0)))
+	suite.Require().NoError(q.Push(newPriorityBundle("BootNotification", 0)))
+	suite.Assert().Equal(2, queueMap.Size())
+	suite.Assert().Equal([]string{"BootNotification-0", "MeterValues-0"}, suite.popIDs(q))
+	// Default queue map is still FIFO
+	suite.Assert().IsType(&ocppj.FIFOClientQueue{}, ocppj.NewFIFOQueueMap(5).GetOrCreate("client1"))
+}
@@ -2,7 +2,10 @@ package ocppj
 
 import (
 	"fmt"
+	"hash/fnv"
 	"maps"
+	"runtime"
+	"slices"
 	"sync"
 )
 
@@ -35,6 +38,42 @@ type RequestQueue interface {
 	IsEmpty() bool
 }
 
+// RemovableRequestQueue is an optional interface of a RequestQueue, which allows removing arbitrary elements,
+// e.g. to cancel a request, which is still queued.
+// If a queue doesn't implement it, only the request at the front of the queue may be canceled.
+type RemovableRequestQueue interface {
+	// Remove deletes the first element of the queue for which the match function returns true.
+	// Returns the removed element, or nil if no element matched.
+	Remove(match func(element interface{}) bool) interface{}
+}
+
+// evictingRequestQueue is implemented by request queues, which may drop queued requests in favor of new ones.
+// Dispatchers use it to cancel the dropped requests.
+type evictingRequestQueue interface {
+	pushEvicting(element interface{}) (interface{}, error)
+}
+
+// searchableRequestQueue is implemented by request queues, which can tell whether they contain an element.
+// Endpoints use it to avoid generating message IDs, which are already used by queued requests.
+type searchableRequestQueue interface {
+	contains(match func(element interface{}) bool) bool
+}
+
+// isQueued returns true if the queue contains the request with the given ID.
+// Queues that cannot be searched never contain it.
+func isQueued(q RequestQueue, requestID string) bool {
+	searchable, ok := q.(searchableRequestQueue)
+	return ok && searchable.contains(matchRequestID(requestID))
+}
+
+// pushRequest pushes an element into a queue, and returns the element dropped in its favor, if any.
+func pushRequest(q RequestQueue, element interface{}) (interface{}, error) {
+	if evicting, ok := q.(evictingRequestQueue); ok {
+		return evicting.pushEvicting(element)
+	}
+	return nil, q.Push(element)
+}
+
 // FIFOClientQueue is a default queue implementation. The queue is thread-safe.
 type FIFOClientQueue struct {
 	elements []interface{}
@@ -78,6 +117,24 @@ func (q *FIFOClientQueue) Pop() interface{} {
 	return result
 }
 
+func (q *FIFOClientQueue) Remove(match func(element interface{}) bool) interface{} {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, el := range q.elements {
+		if match(el) {
+			q.elements = append(q.elements[:i:i], q.elements[i+1:]...)
+			return el
+		}
+	}
+	return nil
+}
+
+func (q *FIFOClientQueue) contains(match func(element interface{}) bool) bool {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	return slices.ContainsFunc(q.elements, match)
+}
+
 func (q *FIFOClientQueue) Size() int {
 	q.mutex.RLock()
 	defer q.mutex.RUnlock()
@@ -142,6 +199,7 @@ type ServerQueueMap interface {
 type FIFOQueueMap struct {
 	data          map[string]RequestQueue
 	queueCapacity int
+	newQueue      func() RequestQueue
 	mutex         sync.RWMutex
 }
 
@@ -163,7 +221,7 @@ func (f *FIFOQueueMap) GetOrCreate(clientID string) RequestQueue {
 	defer f.mutex.Unlock()
 	q, ok := f.data[clientID]
 	if !ok {
-		q = NewFIFOClientQueue(f.queueCapacity)
+		q = f.newQueue()
 		f.data[clientID] = q
 	}
 	return q
@@ -214,5 +272,88 @@ func (f *FIFOQueueMap) SizePerClient() map[string]int {
 // Passing capacity = 0 will generate queues without a maximum capacity.
 // The capacity cannot change after creation.
 func NewFIFOQueueMap(clientQueueCapacity int) *FIFOQueueMap {
-	return &FIFOQueueMap{data: map[string]RequestQueue{}, queueCapacity: clientQueueCapacity}
+	return &FIFOQueueMap{
+		data:          map[string]RequestQueue{},
+		queueCapacity: clientQueueCapacity,
+		newQueue: func() RequestQueue {
+			return NewFIFOClientQueue(clientQueueCapacity)
+		},
+	}
+}
+
+// ShardedQueueMap is a ServerQueueMap, which spreads clients across multiple inner queue maps.
+// Each inner map is guarded by its own mutex, which reduces lock contention when serving many clients concurrently.
+//
+// A client is always assigned to the same shard, based on a hash of its ID.
+type ShardedQueueMap struct {
+	shards []ServerQueueMap
+}
+
+// NewShardedQueueMap creates a new ShardedQueueMap with the given number of shards.
+// Every shard is created by invoking newQueueMap, e.g.:
+//
+//	queueMap := NewShardedQueueMap(16, func() ServerQueueMap { return NewFIFOQueueMap(1000) })
+//
+// If shards is not positive, GOMAXPROCS shards are created.
+func NewShardedQueueMap(shards int, newQueueMap func() ServerQueueMap) *ShardedQueueMap {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	f := &ShardedQueueMap{shards: make([]ServerQueueMap, shards)}
+	for i := range f.shards {
+		f.shards[i] = newQueueMap()
+	}
+	return f
+}
+
+func (f *ShardedQueueMap) shard(clientID string) ServerQueueMap {
+	return f.shards[shardIndex(clientID, len(f.shards))]
+}
+
+func (f *ShardedQueueMap) Init() {
+	for _, shard := range f.shards {
+		shard.Init()
+	}
+}
+
+func (f *ShardedQueueMap) Get(clientID string) (RequestQueue, bool) {
+	return f.shard(clientID).Get(clientID)
+}
+
+func (f *ShardedQueueMap) GetOrCreate(clientID string) RequestQueue {
+	return f.shard(clientID).GetOrCreate(clientID)
+}
+
+func (f *ShardedQueueMap) Remove(clientID string) {
+	f.shard(clientID).Remove(clientID)
+}
+
+func (f *ShardedQueueMap) Add(clientID string, queue RequestQueue) {
+	f.shard(clientID).Add(clientID, queue)
+}
+
+func (f *ShardedQueueMap) Size() int {
+	total := 0
+	for _, shard := range f.shards {
+		total += shard.Size()
+	}
+	return total
+}
+
+func (f *ShardedQueueMap) SizePerClient() map[string]int {
+	sizes := map[string]int{}
+	for _, shard := range f.shards {
+		maps.Copy(sizes, shard.SizePerClient())
+	}
+	return sizes
+}
+
+// shardIndex returns the shard, to which a client is assigned.
+func shardIndex(clientID string, shards int) int {
+	if shards <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(clientID))
+	return int(h.Sum32() % uint32(shards))
 }
@@ -87,6 +87,28 @@ func (suite *ClientQueueTestSuite) TestPopElement() {
 	suite.Assert().False(suite.queue.IsFull())
 }
 
+func (suite *ClientQueueTestSuite) TestRemoveElement() {
+	for _, value := range []string{"first", "second", "third"} {
+		err := suite.queue.Push(newMockRequest(value))
+		suite.Require().Nil(err)
+	}
+	matchValue := func(value string) func(element interface{}) bool {
+		return func(element interface{}) bool {
+			req, ok := element.(*MockRequest)
+			return ok && req.MockValue == value
+		}
+	}
+	el := suite.queue.(ocppj.RemovableRequestQueue).Remove(matchValue("second"))
+	suite.Require().NotNil(el)
+	suite.Assert().Equal("second", el.(*MockRequest).MockValue)
+	suite.Assert().Equal(2, suite.queue.Size())
+	suite.Assert().Nil(suite.queue.(ocppj.RemovableRequestQueue).Remove(matchValue("second")))
+	// Order of the remaining elements is preserved
+	suite.Assert().Equal("first", suite.queue.Pop().(*MockRequest).MockValue)
+	suite.Assert().Equal("third", suite.queue.Pop().(*MockRequest).MockValue)
+	suite.Assert().True(suite.queue.IsEmpty())
+}
+
 func (suite *ClientQueueTestSuite) TestQueueNoCapacity() {
 	suite.queue = ocppj.NewFIFOClientQueue(0)
 	for i := 0; i < 50; i++ {
@@ -118,6 +140,17 @@ func (suite *ServerQueueMapTestSuite) SetupTest() {
 	suite.queueMap = ocppj.NewFIFOQueueMap(queueCapacity)
 }
 
+// ShardedQueueMapTestSuite runs the queue map tests against a ShardedQueueMap.
+type ShardedQueueMapTestSuite struct {
+	ServerQueueMapTestSuite
+}
+
+func (suite *ShardedQueueMapTestSuite) SetupTest() {
+	suite.queueMap = ocppj.NewShardedQueueMap(4, func() ocppj.ServerQueueMap {
+		return ocppj.NewFIFOQueueMap(queueCapacity)
+	})
+}
+
 func (suite *ServerQueueMapTestSuite) TestAddElement() {
 	q := ocppj.NewFIFOClientQueue(0)
 	el := "element1"
@@ -0,0 +1,83 @@
+package ocppj
+
+import (
+	"context"
+	"sync"
+)
+
+// requestContexts keeps track of the contexts bound to outgoing requests.
+// Whenever a watched context is done before the request completed, a cancel function is invoked.
+//
+// Clients use an empty clientID, since they only talk to a single endpoint.
+type requestContexts struct {
+	mutex sync.Mutex
+	stops map[string]map[string]func() bool
+}
+
+// watch invokes onDone once ctx is done, unless the request is released first.
+// Contexts that can never be done are not tracked at all.
+func (r *requestContexts) watch(ctx context.Context, clientID string, requestID string, onDone func()) {
+	if ctx.Done() == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.stops == nil {
+		r.stops = map[string]map[string]func() bool{}
+	}
+	if r.stops[clientID] == nil {
+		r.stops[clientID] = map[string]func() bool{}
+	}
+	r.stops[clientID][requestID] = context.AfterFunc(ctx, func() {
+		if r.release(clientID, requestID) {
+			onDone()
+		}
+	})
+}
+
+// release stops watching the context bound to a request.
+// Returns true if the request was being watched.
+func (r *requestContexts) release(clientID string, requestID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stop, ok := r.stops[clientID][requestID]
+	if !ok {
+		return false
+	}
+	stop()
+	delete(r.stops[clientID], requestID)
+	if len(r.stops[clientID]) == 0 {
+		delete(r.stops, clientID)
+	}
+	return true
+}
+
+// isWatched returns true if the context bound to a request is being watched.
+func (r *requestContexts) isWatched(clientID string, requestID string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	_, ok := r.stops[clientID][requestID]
+	return ok
+}
+
+// releaseClient stops watching the contexts of all requests for a client.
+func (r *requestContexts) releaseClient(clientID string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, stop := range r.stops[clientID] {
+		stop()
+	}
+	delete(r.stops, clientID)
+}
+
+// releaseAll stops watching all contexts.
+func (r *requestContexts) releaseAll() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, clientStops := range r.stops {
+		for _, stop := range clientStops {
+			stop()
+		}
+	}
+	r.stops = nil
+}
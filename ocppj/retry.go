@@ -0,0 +1,175 @@
+package ocppj
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// RetryPolicy configures the retransmission of outgoing requests, which either timed out
+// or couldn't be written to the network.
+//
+// OCPP requires transaction-related messages (e.g. StartTransaction, StopTransaction, TransactionEvent)
+// to be delivered at-least-once, so these are typically the features configured for retransmission:
+//
+//	policy := &ocppj.RetryPolicy{
+//		MaxAttempts:    3,
+//		Backoff:        ocppj.ExponentialBackoff(5*time.Second, time.Minute),
+//		Features:       []string{"StartTransaction", "StopTransaction", "MeterValues"},
+//		ReuseMessageID: true,
+//	}
+//
+// A request is canceled as usual once all attempts were exhausted.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of transmissions for a single request, including the first one.
+	// Values lower than 2 disable retransmission.
+	MaxAttempts int
+	// Backoff returns the delay before the n-th retransmission of a request, starting at 1.
+	// If nil, requests are retransmitted right away.
+	Backoff func(retry int) time.Duration
+	// Features contains the feature names of the requests which may be retransmitted.
+	// If empty, all requests may be retransmitted.
+	Features []string
+	// ReuseMessageID defines whether a retransmitted request keeps its original message ID.
+	// If false, a new message ID is generated for every retransmission. Responses are still reported
+	// to the application using the message ID originally returned by SendRequest.
+	ReuseMessageID bool
+}
+
+// ExponentialBackoff returns a Backoff function for a RetryPolicy.
+// The delay starts at initial and doubles on every retry, up to max.
+func ExponentialBackoff(initial time.Duration, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		delay := initial
+		for i := 1; i < retry && delay < max; i++ {
+			delay *= 2
+		}
+		return min(delay, max)
+	}
+}
+
+// canRetry returns true if a request for the given feature may be transmitted again,
+// after having been transmitted the given number of times.
+func (p *RetryPolicy) canRetry(featureName string, attempts int) bool {
+	if p == nil || attempts >= p.MaxAttempts {
+		return false
+	}
+	return len(p.Features) == 0 || slices.Contains(p.Features, featureName)
+}
+
+// backoff returns the delay before the given retransmission.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	if p.Backoff == nil {
+		return 0
+	}
+	return p.Backoff(retry)
+}
+
+// retryState tracks the transmission attempts of the request currently in flight.
+type retryState struct {
+	// requestID is the message ID originally assigned to the request.
+	requestID string
+	attempts  int
+	// messageID is the message ID used for the latest transmission. It differs from
+	// requestID only if the request was retransmitted with a new message ID.
+	messageID string
+	// superseded contains the message IDs of previous transmissions, which were replaced by messageID.
+	superseded []string
+	// backoff is set while waiting for the backoff before retransmitting the request.
+	// The request stays pending meanwhile, so that a late response to the previous transmission is still accepted.
+	backoff bool
+}
+
+// nextAttempt updates the state for a new transmission of the given call.
+// Returns the message ID to be used on the wire for this transmission, and whether the policy
+// requires a new message ID instead, which has to be set via supersede.
+func (s *retryState) nextAttempt(call *Call, policy *RetryPolicy) (string, bool) {
+	if s.requestID != call.UniqueId {
+		*s = retryState{requestID: call.UniqueId, messageID: call.UniqueId}
+	}
+	s.attempts++
+	s.backoff = false
+	return s.messageID, s.attempts > 1 && policy != nil && !policy.ReuseMessageID
+}
+
+// supersede replaces the message ID used on the wire for the request in flight.
+func (s *retryState) supersede(messageID string) {
+	s.superseded = append(s.superseded, s.messageID)
+	s.messageID = messageID
+}
+
+// messageFor returns the message ID currently used on the wire for the given request.
+func (s *retryState) messageFor(requestID string) string {
+	if s.requestID == requestID && s.messageID != "" {
+		return s.messageID
+	}
+	return requestID
+}
+
+// requestFor returns the message ID originally assigned to the request currently sent with messageID.
+func (s *retryState) requestFor(messageID string) string {
+	if s.messageID == messageID && s.requestID != "" {
+		return s.requestID
+	}
+	return messageID
+}
+
+// isMessageIdInUse returns true if messageID is used by any transmission of the request in flight.
+func (s *retryState) isMessageIdInUse(messageID string) bool {
+	return s.messageID == messageID || slices.Contains(s.superseded, messageID)
+}
+
+// supersededRequest returns the message ID originally assigned to the request currently in flight,
+// if messageID was used for a previous transmission of it.
+func (s *retryState) supersededRequest(messageID string) (string, bool) {
+	if slices.Contains(s.superseded, messageID) {
+		return s.requestID, true
+	}
+	return "", false
+}
+
+// requestIDResolver is implemented by dispatchers, which may retransmit requests using a new message ID.
+// Endpoints use it to report responses using the message ID originally returned by SendRequest.
+type requestIDResolver interface {
+	originalRequestID(clientID string, messageID string) string
+	// supersededRequest returns the message ID originally assigned to a request in flight,
+	// if messageID was used for a previous transmission of it.
+	supersededRequest(clientID string, messageID string) (string, bool)
+}
+
+// messageIdSource is implemented by dispatchers, which may retransmit requests using a new message ID.
+// Endpoints use it to provide their own message ID generator, including collision checks.
+type messageIdSource interface {
+	setMessageIdGenerator(generate func(clientID string) (string, error))
+}
+
+// wireMessage returns the serialized message for a transmission of the bundle, using the given message ID.
+//
+// Only the message ID is replaced, so the remaining elements keep the encoding produced by the codec of the endpoint.
+func wireMessage(bundle RequestBundle, messageID string) ([]byte, error) {
+	if messageID == bundle.Call.UniqueId {
+		return bundle.Data, nil
+	}
+	fields, err := ParseRawJsonEnvelope(bundle.Data)
+	if err != nil || len(fields) < 2 {
+		call := *bundle.Call
+		call.UniqueId = messageID
+		return call.MarshalJSON()
+	}
+	id, err := json.Marshal(messageID)
+	if err != nil {
+		return nil, err
+	}
+	fields[1] = id
+	var buffer bytes.Buffer
+	buffer.WriteByte('[')
+	for i, field := range fields {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		buffer.Write(field)
+	}
+	buffer.WriteByte(']')
+	return buffer.Bytes(), nil
+}
@@ -2,7 +2,11 @@ package ocppj
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -10,6 +14,8 @@ import (
 	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"github.com/xBlaz3kx/ocpp-go/ws"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"gopkg.in/go-playground/validator.v9"
 )
 
@@ -26,9 +32,16 @@ type Server struct {
 	responseHandler           ResponseHandler
 	errorHandler              ErrorHandler
 	invalidMessageHook        InvalidMessageHook
+	canceledRequestHandler    CanceledRequestHandler
 	dispatcher                ServerDispatcher
+	requestContexts           requestContexts
 	RequestState              ServerState
 	metrics                   *ocppMetrics
+	tracer                    *exchangeTracer
+	inboundCalls              inboundCalls
+	shuttingDown              atomic.Bool
+	cluster                   *cluster
+	inboundPool               *inboundPool
 }
 
 type ClientHandler func(client ws.Channel)
@@ -73,11 +86,13 @@ func NewServer(
 	}
 
 	if stateHandler == nil {
-		d, ok := dispatcher.(*DefaultServerDispatcher)
-		if !ok {
-			stateHandler = NewServerState(nil)
-		} else {
+		switch d := dispatcher.(type) {
+		case *DefaultServerDispatcher:
+			stateHandler = d.pendingRequestState
+		case *ShardedServerDispatcher:
 			stateHandler = d.pendingRequestState
+		default:
+			stateHandler = NewServerState(nil)
 		}
 	}
 
@@ -89,19 +104,61 @@ func NewServer(
 	dispatcher.SetPendingRequestState(stateHandler)
 
 	// Create server and add profiles
-	s := Server{
+	s := &Server{
 		logger:       logger,
 		Endpoint:     Endpoint{},
 		server:       wsServer,
 		RequestState: stateHandler,
 		dispatcher:   dispatcher,
 		metrics:      metrics,
+		tracer:       newExchangeTracer(nil),
 	}
 	for _, profile := range profiles {
 		s.AddProfile(profile)
 	}
+	dispatcher.SetOnRequestCanceled(s.onRequestCanceled)
+	if notifier, ok := dispatcher.(requestSentNotifier); ok {
+		notifier.setOnRequestSent(func(clientID string, requestID string) {
+			s.tracer.sent(clientID, requestID)
+			s.metrics.RequestSent(context.Background(), clientID, requestID)
+		})
+	}
+	if source, ok := dispatcher.(messageIdSource); ok {
+		source.setMessageIdGenerator(func(clientID string) (string, error) {
+			return s.newMessageId(func(id string) bool {
+				return s.isMessageIdInUse(clientID, id)
+			})
+		})
+	}
 
-	return &s, nil
+	return s, nil
+}
+
+// SetTracerProvider sets the tracer provider for OCPP exchanges. If not set, the global tracer provider is used.
+//
+// A span is created for every request sent to or received from a client, which ends once the response is received or sent.
+// Spans are linked to the span of the websocket connection, if the connection is traced (see ws.WithServerTracerProvider).
+// Outgoing requests sent via SendRequestCtx are children of the span contained in the context.
+//
+// The tracer provider should be set before starting the server.
+func (s *Server) SetTracerProvider(provider trace.TracerProvider) {
+	s.tracer = newExchangeTracer(provider)
+}
+
+// SetMeterProvider sets the meter provider for OCPP metrics. If not set, the global meter provider is used.
+//
+// Besides counting inbound and outbound requests, the server records per-action histograms for the round-trip latency
+// and the queue wait time of outgoing requests, and counts timeouts, received CallErrors and requests canceled by the dispatcher.
+// Metrics of the dispatcher are configured separately (see WithMeterProvider).
+//
+// The meter provider should be set before starting the server.
+func (s *Server) SetMeterProvider(provider metric.MeterProvider) error {
+	metrics, err := newOcppServerMetrics(provider, "")
+	if err != nil {
+		return err
+	}
+	s.metrics = metrics
+	return nil
 }
 
 // Registers a handler for incoming requests.
@@ -139,7 +196,7 @@ func (s *Server) SetInvalidMessageHook(hook InvalidMessageHook) {
 
 // Registers a handler for canceled request messages.
 func (s *Server) SetCanceledRequestHandler(handler CanceledRequestHandler) {
-	s.dispatcher.SetOnRequestCanceled(handler)
+	s.canceledRequestHandler = handler
 }
 
 // Registers a handler for incoming client connections.
@@ -164,22 +221,74 @@ func (s *Server) SetDisconnectedClientHandler(handler ClientHandler) {
 //
 // An error may be returned, if the websocket server couldn't be started.
 func (s *Server) Start(listenPort int, listenPath string) {
+	s.setup()
+	// Serve & run
+	s.server.Start(listenPort, listenPath)
+	// TODO: return error?
+}
+
+// Serve is like Start, but accepts incoming connections on the given listener,
+// e.g. a Unix socket or a systemd-activated listener.
+//
+// The function blocks until the server is stopped. It returns nil if the server was stopped via Stop or Shutdown,
+// or the error that caused the websocket server to fail otherwise.
+// An error is returned right away, if the websocket server doesn't implement ws.ListenerServer.
+func (s *Server) Serve(listener net.Listener, listenPath string) error {
+	listenerServer, ok := s.server.(ws.ListenerServer)
+	if !ok {
+		return fmt.Errorf("websocket server %T doesn't support serving on a listener", s.server)
+	}
+	s.setup()
+	return listenerServer.Serve(listener, listenPath)
+}
+
+// Handler starts the server without listening for connections on its own,
+// and returns the websocket upgrade handler of the underlying websocket server.
+//
+// The handler may be mounted on an existing HTTP server or router, on one or more paths.
+// Call Stop or Shutdown to close all websocket connections, once the handler is not needed anymore.
+// Calling Handler again on a running server simply returns the same handler.
+//
+// An error is returned, if the websocket server doesn't implement http.Handler.
+func (s *Server) Handler() (http.Handler, error) {
+	handler, ok := s.server.(http.Handler)
+	if !ok {
+		return nil, fmt.Errorf("websocket server %T doesn't implement http.Handler", s.server)
+	}
+	s.setup()
+	return handler, nil
+}
+
+// setup sets the internal handlers on the websocket server and starts the dispatcher, if it isn't running yet.
+func (s *Server) setup() {
 	// Set internal message handler
 	s.server.SetCheckClientHandler(s.checkClientHandler)
 	s.server.SetNewClientHandler(s.onClientConnected)
 	s.server.SetDisconnectedClientHandler(s.onClientDisconnected)
+	if replacer, ok := s.server.(ws.ConnectionReplacer); ok {
+		replacer.SetReplacedClientHandler(s.onClientReplaced)
+	}
+	if notifier, ok := s.server.(ws.RateLimitedMessageNotifier); ok {
+		notifier.SetRateLimitedMessageHandler(s.onRateLimitedMessage)
+	}
 	s.server.SetMessageHandler(s.ocppMessageHandler)
-	s.dispatcher.Start()
-	// Serve & run
-	s.server.Start(listenPort, listenPath)
-	// TODO: return error?
+	if !s.dispatcher.IsRunning() {
+		// A previous shutdown completed, so the server accepts outgoing requests again
+		s.shuttingDown.Store(false)
+		s.dispatcher.Start()
+	}
+	s.startCluster()
 }
 
 // Stops the server.
 // This clears all pending requests and causes the Start function to return.
 func (s *Server) Stop() {
+	s.stopCluster()
 	s.dispatcher.Stop()
 	s.server.Stop()
+	s.requestContexts.releaseAll()
+	s.metrics.ForgetAll()
+	s.tracer.endAll(ocpp.NewError(GenericError, "server stopped", ""))
 }
 
 // Sends an OCPP Request to a client, identified by the clientID parameter.
@@ -194,10 +303,36 @@ func (s *Server) Stop() {
 //
 // - the output queue is full
 func (s *Server) SendRequest(clientID string, request ocpp.Request) (string, error) {
+	return s.SendRequestCtx(context.Background(), clientID, request)
+}
+
+// SendRequestCtx sends an OCPP Request to a client, binding it to the given context.
+//
+// If ctx is done before a response is received, the request is canceled: it is removed from the client's queue,
+// or its pending slot is released if it was already sent. A late response to the request is discarded.
+// No response, error or cancellation handler is invoked for a request canceled this way.
+//
+// If ctx is already done, ctx.Err() is returned and the request is not sent.
+// Otherwise, the function behaves like SendRequest.
+func (s *Server) SendRequestCtx(ctx context.Context, clientID string, request ocpp.Request) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
 	if !s.dispatcher.IsRunning() {
 		return "", fmt.Errorf("ocppj server is not started, couldn't send request")
 	}
+	if s.shuttingDown.Load() {
+		return "", fmt.Errorf("ocppj server is shutting down, couldn't send request")
+	}
+	if s.cluster != nil && !s.isLocalClient(clientID) {
+		return s.sendRemoteRequest(ctx, clientID, request)
+	}
+	return s.sendRequest(ctx, clientID, request, nil)
+}
 
+// sendRequest queues a request for a client connected to this server.
+// If onCreated is not nil, it is invoked with the message ID of the request, right before the request is queued.
+func (s *Server) sendRequest(ctx context.Context, clientID string, request ocpp.Request, onCreated func(requestID string)) (string, error) {
 	var metricErr *ocppMetricsError
 	defer func() {
 		// Report a metric after request was sent.
@@ -206,20 +341,43 @@ func (s *Server) SendRequest(clientID string, request ocpp.Request) (string, err
 		s.metrics.IncrementOutboundRequests(ctx, clientID, request.GetFeatureName(), metricErr)
 	}()
 
-	call, err := s.CreateCall(request)
+	call, err := s.createCall(request, func(id string) bool {
+		return s.isMessageIdInUse(clientID, id)
+	})
 	if err != nil {
 		metricErr = &payloadError // Could also be a val
 		return "", err
 	}
 
-	jsonMessage, err := call.MarshalJSON()
+	jsonMessage, err := s.MarshalMessage(call)
 	if err != nil {
 		metricErr = &payloadError
 		return "", err
 	}
+	if jsonMessage, err = s.outbound(clientID, call, jsonMessage); err != nil {
+		metricErr = &validationError
+		return "", err
+	}
 
+	s.tracer.start(ctx, false, clientID, clientID, call, func() interface{} {
+		channel, _ := s.server.GetChannel(clientID)
+		return channel
+	})
+	s.metrics.RequestEnqueued(clientID, clientID, call.UniqueId, call.Action)
+	s.requestContexts.watch(ctx, clientID, call.UniqueId, func() {
+		s.cancelDispatchedRequest(clientID, call.UniqueId)
+		s.metrics.ForgetRequest(clientID, call.UniqueId)
+		s.tracer.end(false, clientID, call.UniqueId, ocpp.NewError(canceledErrorCode, ctx.Err().Error(), call.UniqueId))
+		s.logger.Debugf("canceled CALL [%s, %s] for %s: %v", call.UniqueId, call.Action, clientID, ctx.Err())
+	})
+	if onCreated != nil {
+		onCreated(call.UniqueId)
+	}
 	// Will not send right away. Queuing message and let it be processed by dedicated requestPump routine
 	if err = s.dispatcher.SendRequest(clientID, RequestBundle{call, jsonMessage}); err != nil {
+		s.requestContexts.release(clientID, call.UniqueId)
+		s.metrics.ForgetRequest(clientID, call.UniqueId)
+		s.tracer.end(false, clientID, call.UniqueId, ocpp.NewError(GenericError, err.Error(), call.UniqueId))
 		metricErr = &metricsNetworkError
 		s.logger.Errorf("error dispatching request [%s, %s] to %s: %v", call.UniqueId, call.Action, clientID, err)
 		return "", err
@@ -230,6 +388,58 @@ func (s *Server) SendRequest(clientID string, request ocpp.Request) (string, err
 	return call.GetUniqueId(), nil
 }
 
+// ConnectedClients returns the channels of all clients currently connected to this server.
+// Clients connected to other nodes of a cluster are not included.
+func (s *Server) ConnectedClients() []ws.Channel {
+	clientIDs := s.inboundCalls.connectedClients()
+	channels := make([]ws.Channel, 0, len(clientIDs))
+	for _, clientID := range clientIDs {
+		if channel, ok := s.server.GetChannel(clientID); ok {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// IsClientConnected returns true, if the client is connected to this server.
+// If the server is part of a cluster, clients connected to other nodes are reported as connected as well.
+func (s *Server) IsClientConnected(clientID string) bool {
+	if _, ok := s.server.GetChannel(clientID); ok {
+		return true
+	}
+	if s.cluster == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	nodeID, ok, err := s.cluster.config.Registry.Lookup(ctx, clientID)
+	return err == nil && ok && nodeID != s.cluster.config.NodeID
+}
+
+// CancelRequest cancels a previously sent request for a client, identified by its requestID.
+// The request is removed from the client's queue, or its pending slot is released if it was already sent.
+// A late response to the request is discarded.
+//
+// No response, error or cancellation handler is invoked for the request.
+// Returns true if the request was found, false otherwise.
+// If the dispatcher doesn't implement ServerRequestCanceler, the request can't be canceled and false is returned.
+func (s *Server) CancelRequest(clientID string, requestID string) bool {
+	if s.cluster != nil && s.cancelRemoteRequest(clientID, requestID) {
+		s.requestContexts.release(clientID, requestID)
+		return true
+	}
+	s.requestContexts.release(clientID, requestID)
+	s.metrics.ForgetRequest(clientID, requestID)
+	s.tracer.end(false, clientID, requestID, ocpp.NewError(canceledErrorCode, "request canceled", requestID))
+	return s.cancelDispatchedRequest(clientID, requestID)
+}
+
+// cancelDispatchedRequest removes a request from the dispatcher, if the dispatcher supports canceling requests.
+func (s *Server) cancelDispatchedRequest(clientID string, requestID string) bool {
+	canceler, ok := s.dispatcher.(ServerRequestCanceler)
+	return ok && canceler.CancelRequest(clientID, requestID)
+}
+
 // Sends an OCPP Response to a client, identified by the clientID parameter.
 // The requestID parameter is required and identifies the previously received request.
 //
@@ -241,18 +451,29 @@ func (s *Server) SendRequest(clientID string, request ocpp.Request) (string, err
 //
 // - a network error occurred
 func (s *Server) SendResponse(clientID string, requestId string, response ocpp.Response) error {
+	// The request counts as answered even if the response couldn't be sent, so its worker is always released
+	defer s.callAnswered(clientID, requestId)
+	if s.inboundCalls.isStale(clientID, requestId) {
+		return staleCallError(clientID, requestId)
+	}
 	callResult, err := s.CreateCallResult(response, requestId)
 	if err != nil {
 		return err
 	}
-	jsonMessage, err := callResult.MarshalJSON()
+	jsonMessage, err := s.MarshalMessage(callResult)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	if jsonMessage, err = s.outbound(clientID, callResult, jsonMessage); err != nil {
+		return err
+	}
 	if err = s.server.Write(clientID, jsonMessage); err != nil {
 		s.logger.Errorf("error sending response [%s] to %s: %v", callResult.GetUniqueId(), clientID, err)
-		return ocpp.NewError(GenericError, err.Error(), requestId)
+		ocppErr := ocpp.NewError(GenericError, err.Error(), requestId)
+		s.tracer.end(true, clientID, requestId, ocppErr)
+		return ocppErr
 	}
+	s.tracer.end(true, clientID, requestId, nil)
 	s.logger.Debugf("sent CALL RESULT [%s] for %s", callResult.GetUniqueId(), clientID)
 	s.logger.Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
 	return nil
@@ -267,18 +488,29 @@ func (s *Server) SendResponse(clientID string, requestId string, response ocpp.R
 //
 // - a network error occurred
 func (s *Server) SendError(clientID string, requestId string, errorCode ocpp.ErrorCode, description string, details interface{}) error {
+	// The request counts as answered even if the error couldn't be sent, so its worker is always released
+	defer s.callAnswered(clientID, requestId)
+	if s.inboundCalls.isStale(clientID, requestId) {
+		return staleCallError(clientID, requestId)
+	}
 	callError, err := s.CreateCallError(requestId, errorCode, description, details)
 	if err != nil {
 		return err
 	}
-	jsonMessage, err := callError.MarshalJSON()
+	jsonMessage, err := s.MarshalMessage(callError)
 	if err != nil {
 		return ocpp.NewError(GenericError, err.Error(), requestId)
 	}
+	if jsonMessage, err = s.outbound(clientID, callError, jsonMessage); err != nil {
+		return err
+	}
 	if err = s.server.Write(clientID, jsonMessage); err != nil {
 		s.logger.Errorf("error sending response error [%s] to %s: %v", callError.UniqueId, clientID, err)
-		return ocpp.NewError(GenericError, err.Error(), requestId)
+		ocppErr := ocpp.NewError(GenericError, err.Error(), requestId)
+		s.tracer.end(true, clientID, requestId, ocppErr)
+		return ocppErr
 	}
+	s.tracer.end(true, clientID, requestId, ocpp.NewError(errorCode, description, requestId))
 	s.logger.Debugf("sent CALL ERROR [%s] for %s", callError.UniqueId, clientID)
 	s.logger.Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
 	return nil
@@ -288,7 +520,7 @@ func (s *Server) ocppMessageHandler(wsChannel ws.Channel, data []byte) error {
 	metricCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	parsedJson, err := ParseRawJsonMessage(data)
+	rawFields, err := s.ParseEnvelope(data)
 	if err != nil {
 		s.metrics.IncrementOutboundRequests(metricCtx, wsChannel.ID(), "", &payloadError)
 		s.logger.Error(err)
@@ -298,13 +530,20 @@ func (s *Server) ocppMessageHandler(wsChannel ws.Channel, data []byte) error {
 	s.logger.Debugf("received JSON message from %s: %s", wsChannel.ID(), string(data))
 	// Get pending requests for client
 	pending := s.RequestState.GetClientState(wsChannel.ID())
-	message, err := s.ParseMessage(parsedJson, pending)
+	in, err := s.inbound(wsChannel.ID(), data, rawFields, pending)
+	if in.rejected != nil {
+		return s.onInboundRejected(metricCtx, wsChannel, pending, in)
+	}
+	data, rawFields, message := in.raw, in.rawFields, in.message
 	if err != nil {
 		s.metrics.IncrementOutboundRequests(metricCtx, wsChannel.ID(), "", &validationError)
 		ocppErr := err.(*ocpp.Error)
 		messageID := ocppErr.MessageId
 		// Support ad-hoc callback for invalid message handling
 		if s.invalidMessageHook != nil {
+			// Generic fields are only decoded for the hook, valid messages are decoded once
+			var parsedJson []interface{}
+			_ = s.Codec().Unmarshal(data, &parsedJson)
 			err2 := s.invalidMessageHook(wsChannel, ocppErr, string(data), parsedJson)
 			// If the hook returns an error, use it as output error. If not, use the original error.
 			if err2 != nil {
@@ -328,31 +567,131 @@ func (s *Server) ocppMessageHandler(wsChannel ws.Channel, data []byte) error {
 		case CALL:
 			call := message.(*Call)
 			s.logger.Debugf("handling incoming CALL [%s, %s] from %s", call.UniqueId, call.Action, wsChannel.ID())
+			s.tracer.start(context.Background(), true, wsChannel.ID(), wsChannel.ID(), call, func() interface{} {
+				return wsChannel
+			})
 			if s.requestHandler != nil {
-				s.requestHandler(wsChannel, call.Payload, call.UniqueId, call.Action)
+				s.inboundCalls.received(wsChannel.ID(), call.UniqueId)
+				if s.inboundPool == nil {
+					s.requestHandler(wsChannel, call.Payload, call.UniqueId, call.Action)
+				} else if !s.inboundPool.submit(wsChannel.ID(), call.UniqueId, call.Action, func() {
+					s.requestHandler(wsChannel, call.Payload, call.UniqueId, call.Action)
+				}) {
+					ocppErr := ocpp.NewError(InternalError, "too many pending requests", call.UniqueId)
+					s.logger.Infof("CALL [%s, %s] from %s rejected, inbound queue is full", call.UniqueId, call.Action, wsChannel.ID())
+					if err2 := s.SendError(wsChannel.ID(), call.UniqueId, ocppErr.Code, ocppErr.Description, nil); err2 != nil {
+						return err2
+					}
+					return ocppErr
+				}
 			}
 			s.metrics.IncrementInboundRequests(metricCtx, wsChannel.ID(), call.Payload.GetFeatureName(), nil)
 		case CALL_RESULT:
 			callResult := message.(*CallResult)
+			callResult.UniqueId = s.originalRequestID(wsChannel.ID(), callResult.UniqueId)
 			s.logger.Debugf("handling incoming CALL RESULT [%s] from %s", callResult.UniqueId, wsChannel.ID())
-			s.dispatcher.CompleteRequest(wsChannel.ID(), callResult.GetUniqueId())
-			if s.responseHandler != nil {
+			s.completeRequest(metricCtx, wsChannel.ID(), callResult.GetUniqueId(), nil)
+			if s.forwardResponse(wsChannel.ID(), callResult.UniqueId, callResult.Payload) {
+				s.logger.Debugf("forwarded CALL RESULT [%s] from %s", callResult.UniqueId, wsChannel.ID())
+			} else if s.responseHandler != nil {
 				s.responseHandler(wsChannel, callResult.Payload, callResult.UniqueId)
 			}
 			s.metrics.IncrementOutboundRequests(metricCtx, wsChannel.ID(), callResult.Payload.GetFeatureName(), nil)
 		case CALL_ERROR:
 			callError := message.(*CallError)
+			callError.UniqueId = s.originalRequestID(wsChannel.ID(), callError.UniqueId)
 			s.logger.Debugf("handling incoming CALL ERROR [%s] from %s", callError.UniqueId, wsChannel.ID())
-			s.dispatcher.CompleteRequest(wsChannel.ID(), callError.GetUniqueId())
-			if s.errorHandler != nil {
+			responseErr := ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId)
+			s.completeRequest(metricCtx, wsChannel.ID(), callError.GetUniqueId(), responseErr)
+			if s.forwardError(wsChannel.ID(), callError.UniqueId, responseErr, callError.ErrorDetails) {
+				s.logger.Debugf("forwarded CALL ERROR [%s] from %s", callError.UniqueId, wsChannel.ID())
+			} else if s.errorHandler != nil {
 				s.errorHandler(wsChannel, ocpp.NewError(callError.ErrorCode, callError.ErrorDescription, callError.UniqueId), callError.ErrorDetails)
 			}
-			// todo add metric for error
 		}
+	} else {
+		s.logUnmatchedResponse(wsChannel.ID(), rawFields)
 	}
 	return nil
 }
 
+// completeRequest removes a request, for which a response or error was received, and sends the next request to the client.
+func (s *Server) completeRequest(ctx context.Context, clientID string, requestID string, responseErr *ocpp.Error) {
+	s.dispatcher.CompleteRequest(clientID, requestID)
+	s.requestContexts.release(clientID, requestID)
+	s.tracer.end(false, clientID, requestID, responseErr)
+	s.metrics.RequestCompleted(ctx, clientID, requestID, responseErr)
+}
+
+// onInboundRejected handles an incoming message, which was rejected by a middleware.
+// A rejected Call is answered with the error, while a rejected CallResult or CallError completes the pending request with the error.
+func (s *Server) onInboundRejected(ctx context.Context, wsChannel ws.Channel, pending ClientState, in inboundMessage) error {
+	ocppErr := in.rejected
+	switch in.messageType {
+	case CALL:
+		s.logger.Debugf("CALL [%s] from %s rejected by middleware: %v", in.uniqueID, wsChannel.ID(), ocppErr)
+		if call, ok := in.message.(*Call); ok {
+			s.tracer.start(context.Background(), true, wsChannel.ID(), wsChannel.ID(), call, func() interface{} {
+				return wsChannel
+			})
+		}
+		if in.uniqueID != "" {
+			if err := s.SendError(wsChannel.ID(), in.uniqueID, ocppErr.Code, ocppErr.Description, nil); err != nil {
+				return err
+			}
+		}
+		return ocppErr
+	case CALL_RESULT, CALL_ERROR:
+		if _, ok := pending.GetPendingRequest(in.uniqueID); !ok {
+			s.logger.Debugf("message [%s] from %s rejected by middleware: %v", in.uniqueID, wsChannel.ID(), ocppErr)
+			return nil
+		}
+		requestID := s.originalRequestID(wsChannel.ID(), in.uniqueID)
+		if ocppErr.MessageId == in.uniqueID {
+			ocppErr.MessageId = requestID
+		}
+		s.logger.Debugf("response [%s] from %s rejected by middleware: %v", requestID, wsChannel.ID(), ocppErr)
+		s.completeRequest(ctx, wsChannel.ID(), requestID, ocppErr)
+		if !s.forwardError(wsChannel.ID(), requestID, ocppErr, nil) && s.errorHandler != nil {
+			s.errorHandler(wsChannel, ocppErr, nil)
+		}
+	}
+	return nil
+}
+
+// Description of the error sent to clients, whose requests were rejected by the rate limiter of the websocket server.
+const rateLimitedDescription = "Rate limit exceeded"
+
+// onRateLimitedMessage replies with a CallError to incoming requests, which were rejected by the rate limiter
+// of the websocket server. Other messages are dropped.
+func (s *Server) onRateLimitedMessage(wsChannel ws.Channel, data []byte) error {
+	rawFields, err := s.ParseEnvelope(data)
+	if err != nil || len(rawFields) < 3 {
+		return nil
+	}
+	var typeId MessageType
+	var uniqueId string
+	if s.Codec().Unmarshal(rawFields[0], &typeId) != nil || typeId != CALL ||
+		s.Codec().Unmarshal(rawFields[1], &uniqueId) != nil || uniqueId == "" {
+		return nil
+	}
+	s.logger.Debugf("rejecting rate-limited CALL [%s] from %s", uniqueId, wsChannel.ID())
+	callError, err := s.CreateCallError(uniqueId, GenericError, rateLimitedDescription, nil)
+	if err != nil {
+		return err
+	}
+	jsonMessage, err := s.MarshalMessage(callError)
+	if err != nil {
+		return err
+	}
+	// The request isn't tracked as an inbound call, so SendError isn't used.
+	// The client may even be flooding the server with a request, which is still being processed.
+	if jsonMessage, err = s.outbound(wsChannel.ID(), callError, jsonMessage); err != nil {
+		return err
+	}
+	return s.server.Write(wsChannel.ID(), jsonMessage)
+}
+
 // HandleFailedResponseError allows to handle failures while sending responses (either CALL_RESULT or CALL_ERROR).
 // It internally analyzes and creates an ocpp.Error based on the given error.
 // It will the attempt to send it to the client.
@@ -381,21 +720,127 @@ func (s *Server) HandleFailedResponseError(clientID string, requestID string, er
 	_ = s.SendError(clientID, requestID, responseErr.Code, responseErr.Description, nil)
 }
 
+// isMessageIdInUse returns true if a request for a client with the given message ID is currently pending, queued,
+// bound to a context or sent via another node of the cluster, or if the message ID is in use by the application.
+func (s *Server) isMessageIdInUse(clientID string, id string) bool {
+	if s.cluster != nil && s.cluster.hasRemote(clientID, id) {
+		return true
+	}
+	return s.isMessageIdInUseByNode(clientID, id)
+}
+
+// isMessageIdInUseByNode is like isMessageIdInUse, but doesn't consider requests sent via other nodes of the cluster.
+func (s *Server) isMessageIdInUseByNode(clientID string, id string) bool {
+	// Avoid creating a state for the client, in case there is none
+	if s.RequestState.HasPendingRequest(clientID) {
+		if _, ok := s.RequestState.GetClientState(clientID).GetPendingRequest(id); ok {
+			return true
+		}
+	}
+	if checker, ok := s.dispatcher.(messageIdChecker); ok && checker.isMessageIdInUse(clientID, id) {
+		return true
+	}
+	return s.requestContexts.isWatched(clientID, id) || s.isMessageIdInUseByApplication(clientID, id)
+}
+
+// logUnmatchedResponse logs a response from a client, for which no request is pending.
+// This is usually a late response to a request, which was already retransmitted using a new message ID.
+func (s *Server) logUnmatchedResponse(clientID string, rawFields []json.RawMessage) {
+	if len(rawFields) < 2 {
+		return
+	}
+	messageID, _ := rawJsonString(s.Codec(), rawFields[1])
+	if resolver, ok := s.dispatcher.(requestIDResolver); ok {
+		if requestID, superseded := resolver.supersededRequest(clientID, messageID); superseded {
+			s.logger.Debugf("ignoring late response [%s] from %s to request %s, which was retransmitted with a new message ID", messageID, clientID, requestID)
+			return
+		}
+	}
+	s.logger.Debugf("ignoring response [%s] from %s, no matching request is pending", messageID, clientID)
+}
+
+// originalRequestID returns the message ID originally assigned to a request for a client,
+// in case the request was retransmitted using a different message ID.
+func (s *Server) originalRequestID(clientID string, messageID string) string {
+	if resolver, ok := s.dispatcher.(requestIDResolver); ok {
+		return resolver.originalRequestID(clientID, messageID)
+	}
+	return messageID
+}
+
+func (s *Server) onRequestCanceled(clientID string, requestID string, request ocpp.Request, err *ocpp.Error) {
+	s.requestContexts.release(clientID, requestID)
+	s.tracer.end(false, clientID, requestID, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	s.metrics.RequestCanceled(ctx, clientID, requestID, err)
+	if s.forwardCanceled(clientID, requestID, err) {
+		return
+	}
+	if s.canceledRequestHandler != nil {
+		s.canceledRequestHandler(clientID, requestID, request, err)
+	}
+}
+
 func (s *Server) onClientConnected(ws ws.Channel) {
 	// Create state for connected client
 	s.dispatcher.CreateClient(ws.ID())
+	s.inboundCalls.connect(ws.ID())
+	s.registerClient(ws.ID())
 	// Invoke callback
 	if s.newClientHandler != nil {
 		s.newClientHandler(ws)
 	}
 }
 
+// staleCallError is returned when answering an incoming request, which was received over a replaced connection.
+func staleCallError(clientID string, requestID string) error {
+	return ocpp.NewError(GenericError, fmt.Sprintf("request was received over a replaced connection of %s", clientID), requestID)
+}
+
 func (s *Server) onClientDisconnected(ws ws.Channel) {
 	// Clear state for disconnected client
 	s.dispatcher.DeleteClient(ws.ID())
 	s.RequestState.ClearClientPendingRequest(ws.ID())
+	s.requestContexts.releaseClient(ws.ID())
+	s.tracer.endClient(ws.ID(), ocpp.NewError(GenericError, "client disconnected", ""))
+	s.metrics.ForgetClient(ws.ID())
+	s.inboundCalls.disconnect(ws.ID())
+	if s.inboundPool != nil {
+		s.inboundPool.disconnect(ws.ID())
+	}
+	s.unregisterClient(ws.ID())
 	// Invoke callback
 	if s.disconnectedClientHandler != nil {
 		s.disconnectedClientHandler(ws)
 	}
 }
+
+// onClientReplaced handles the connection of a client being replaced by a new one (see ws.ReplaceDuplicateConnection).
+// Queued requests are migrated to the new connection, if supported by the dispatcher.
+// Incoming requests received over the old connection can't be answered anymore, and are released.
+// The disconnected and new client handlers are invoked as for a regular reconnection.
+func (s *Server) onClientReplaced(old ws.Channel, new ws.Channel) {
+	replacer, ok := s.dispatcher.(clientReplacer)
+	if !ok {
+		// Requests cannot be migrated, so the client state is reset
+		s.onClientDisconnected(old)
+		s.onClientConnected(new)
+		return
+	}
+	s.logger.Infof("connection of %s was replaced, migrating requests", new.ID())
+	// Release the state of the old connection. Contexts and spans of queued outgoing requests are kept,
+	// since the requests are migrated, while the request in flight is canceled by the dispatcher.
+	s.tracer.endInbound(old.ID(), ocpp.NewError(GenericError, "connection was replaced", ""))
+	s.inboundCalls.replace(old.ID())
+	if s.inboundPool != nil {
+		s.inboundPool.disconnect(old.ID())
+	}
+	replacer.replaceClient(new.ID())
+	if s.disconnectedClientHandler != nil {
+		s.disconnectedClientHandler(old)
+	}
+	if s.newClientHandler != nil {
+		s.newClientHandler(new)
+	}
+}
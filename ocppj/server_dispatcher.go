@@ -29,6 +29,14 @@ func WithLogger(logger logging.Logger) DefaultServerDispatcherOption {
 	}
 }
 
+// WithServerDispatcherRetryPolicy sets the policy for retransmitting requests, which timed out or couldn't be sent.
+// By default, such requests are canceled right away.
+func WithServerDispatcherRetryPolicy(policy *RetryPolicy) DefaultServerDispatcherOption {
+	return func(d *DefaultServerDispatcher) {
+		d.retryPolicy = policy
+	}
+}
+
 func WithMeterProvider(provider metric.MeterProvider) DefaultServerDispatcherOption {
 	return func(d *DefaultServerDispatcher) {
 		if provider == nil {
@@ -56,12 +64,18 @@ type DefaultServerDispatcher struct {
 	pendingRequestState ServerState
 	timeout             time.Duration
 	timerC              chan string
+	opC                 chan serverPumpOp
 	running             atomic.Bool
 	stoppedC            chan struct{}
 	onRequestCancel     CanceledRequestHandler
+	onRequestSent       func(clientID string, requestID string)
+	newMessageId        func(clientID string) (string, error)
 	network             ws.Server
 	mutex               sync.RWMutex
 	metrics             *dispatcherMetrics
+	retryPolicy         *RetryPolicy
+	retryMutex          sync.Mutex
+	retries             map[string]retryState
 }
 
 // Handler function to be invoked when a request gets canceled (either due to timeout or to other external factors).
@@ -73,6 +87,11 @@ type clientTimeoutContext struct {
 	cancel func()
 }
 
+func newClientTimeoutContext(timeout time.Duration) clientTimeoutContext {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	return clientTimeoutContext{ctx: ctx, cancel: cancel}
+}
+
 func (c clientTimeoutContext) isActive() bool {
 	return c.cancel != nil
 }
@@ -83,6 +102,22 @@ func NewDefaultServerDispatcher(
 	queueMap ServerQueueMap,
 	opts ...DefaultServerDispatcherOption,
 ) *DefaultServerDispatcher {
+	d := newDefaultServerDispatcher(queueMap, opts...)
+	if d == nil {
+		return nil
+	}
+
+	d.pendingRequestState = NewServerState(&d.mutex)
+
+	d.metrics.ObserveQueues(queueMap)
+	d.metrics.ObserveInFlightRequests(d.pendingRequestState.(*serverState))
+
+	return d
+}
+
+// newDefaultServerDispatcher creates a DefaultServerDispatcher, without registering any metric observers.
+// The pending request state must be set by the caller.
+func newDefaultServerDispatcher(queueMap ServerQueueMap, opts ...DefaultServerDispatcherOption) *DefaultServerDispatcher {
 	logger := &logging.VoidLogger{}
 
 	dispatcherMetrics, err := newDispatcherMetrics(otel.GetMeterProvider(), logger)
@@ -97,9 +132,11 @@ func NewDefaultServerDispatcher(
 		requestChannel:   make(chan string, 20),
 		readyForDispatch: make(chan string, 1),
 		timerC:           make(chan string, 10),
+		opC:              make(chan serverPumpOp),
 		stoppedC:         make(chan struct{}, 1),
 		timeout:          defaultMessageTimeout,
 		metrics:          dispatcherMetrics,
+		retries:          map[string]retryState{},
 	}
 
 	// Apply options
@@ -107,11 +144,6 @@ func NewDefaultServerDispatcher(
 		opt(d)
 	}
 
-	d.pendingRequestState = NewServerState(&d.mutex)
-
-	dispatcherMetrics.ObserveQueues(queueMap)
-	dispatcherMetrics.ObserveInFlightRequests(d.pendingRequestState.(*serverState))
-
 	return d
 }
 
@@ -145,6 +177,14 @@ func (d *DefaultServerDispatcher) SetTimeout(timeout time.Duration) {
 	d.timeout = timeout
 }
 
+// SetRetryPolicy sets the policy for retransmitting requests, which timed out or couldn't be sent.
+// If policy is nil, such requests are canceled right away.
+func (d *DefaultServerDispatcher) SetRetryPolicy(policy *RetryPolicy) {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	d.retryPolicy = policy
+}
+
 func (d *DefaultServerDispatcher) CreateClient(clientID string) {
 	if d.IsRunning() {
 		_ = d.queueMap.GetOrCreate(clientID)
@@ -153,15 +193,97 @@ func (d *DefaultServerDispatcher) CreateClient(clientID string) {
 
 func (d *DefaultServerDispatcher) DeleteClient(clientID string) {
 	d.queueMap.Remove(clientID)
+	d.retryMutex.Lock()
+	delete(d.retries, clientID)
+	d.retryMutex.Unlock()
 	if d.IsRunning() {
 		d.requestChannel <- clientID
 	}
 }
 
+func (d *DefaultServerDispatcher) queuedRequests(clientID string) int {
+	q, ok := d.queueMap.Get(clientID)
+	if !ok {
+		return 0
+	}
+	return q.Size()
+}
+
+// dropRequests removes all requests for a client from its queue, including the request in flight, and returns them.
+// The requests are removed by the message pump, so none of them can be dispatched concurrently.
+// No cancellation callback is invoked for the dropped requests.
+func (d *DefaultServerDispatcher) dropRequests(clientID string) []RequestBundle {
+	var dropped []RequestBundle
+	d.runInPump(clientID, func(q RequestQueue) bool {
+		released := false
+		if bundle, ok := q.Peek().(RequestBundle); ok && d.pendingRequestState.HasPendingRequest(clientID) {
+			released = d.completeRequest(clientID, q, bundle.Call.UniqueId)
+			if released {
+				dropped = append(dropped, bundle)
+			}
+		}
+		for !q.IsEmpty() {
+			el := q.Pop()
+			if el == nil {
+				break
+			}
+			if bundle, ok := el.(RequestBundle); ok {
+				dropped = append(dropped, bundle)
+			}
+		}
+		return released
+	})
+	return dropped
+}
+
+// clientReplacer is implemented by dispatchers, which can migrate the requests of a client to a new connection.
+type clientReplacer interface {
+	replaceClient(clientID string)
+}
+
+// replaceClient migrates the requests of a client, whose connection was replaced by a new one.
+//
+// The request in flight was sent over the old connection, so its response will never arrive: it is canceled right away,
+// triggering the onRequestCanceled callback. Queued requests are kept and will be sent over the new connection.
+func (d *DefaultServerDispatcher) replaceClient(clientID string) {
+	var canceled RequestBundle
+	// The request in flight is released by the message pump, so it can't time out or be completed concurrently
+	d.runInPump(clientID, func(q RequestQueue) bool {
+		// A request awaiting its retransmission is sent over the new connection once the backoff elapsed
+		if !d.pendingRequestState.HasPendingRequest(clientID) || d.awaitingRetransmission(clientID) {
+			return false
+		}
+		bundle, ok := q.Peek().(RequestBundle)
+		if !ok || !d.completeRequest(clientID, q, bundle.Call.UniqueId) {
+			return false
+		}
+		canceled = bundle
+		return true
+	})
+	if canceled.Call == nil {
+		return
+	}
+	d.logger.Infof("canceled request %s for %s, due to replaced connection", canceled.Call.UniqueId, clientID)
+	if d.onRequestCancel != nil {
+		d.onRequestCancel(clientID, canceled.Call.UniqueId, canceled.Call.Payload,
+			ocpp.NewError(GenericError, "connection was replaced", canceled.Call.UniqueId))
+	}
+}
+
 func (d *DefaultServerDispatcher) SetNetworkServer(server ws.Server) {
 	d.network = server
 }
 
+// setOnRequestSent registers a handler, which is invoked whenever a queued request was written to the network.
+func (d *DefaultServerDispatcher) setOnRequestSent(handler func(clientID string, requestID string)) {
+	d.onRequestSent = handler
+}
+
+// setMessageIdGenerator sets the generator used for message IDs of retransmitted requests.
+func (d *DefaultServerDispatcher) setMessageIdGenerator(generate func(clientID string) (string, error)) {
+	d.newMessageId = generate
+}
+
 func (d *DefaultServerDispatcher) SetOnRequestCanceled(cb CanceledRequestHandler) {
 	d.onRequestCancel = cb
 }
@@ -178,12 +300,20 @@ func (d *DefaultServerDispatcher) SendRequest(clientID string, req RequestBundle
 	if !ok {
 		return fmt.Errorf("cannot send request %s, no client %s exists", req.Call.UniqueId, clientID)
 	}
-	if err := q.Push(req); err != nil {
+	dropped, err := pushRequest(q, req)
+	if err != nil {
 		return err
 	}
 
 	d.requestChannel <- clientID
 
+	if bundle, ok := dropped.(RequestBundle); ok && bundle.Call != nil {
+		d.logger.Infof("dropped queued request %s for %s in favor of %s", bundle.Call.UniqueId, clientID, req.Call.UniqueId)
+		if d.onRequestCancel != nil {
+			d.onRequestCancel(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
+				ocpp.NewError(GenericError, droppedRequestDescription, bundle.Call.UniqueId))
+		}
+	}
 	return nil
 }
 
@@ -241,7 +371,10 @@ func (d *DefaultServerDispatcher) messagePump() {
 				clientContextMap[clientID] = clientTimeoutContext{}
 			}
 
-			if d.pendingRequestState.HasPendingRequest(clientID) {
+			if d.retransmissionDue(clientID) {
+				// The retransmission backoff elapsed -> may dispatch again
+				clientQueue, rdy = d.queueMap.Get(clientID)
+			} else if d.pendingRequestState.HasPendingRequest(clientID) {
 				// Current request for client timed out. Removing request and triggering cancel callback
 				q, found := d.queueMap.Get(clientID)
 				if !found {
@@ -256,13 +389,41 @@ func (d *DefaultServerDispatcher) messagePump() {
 					continue
 				}
 				bundle, _ := el.(RequestBundle)
+				if delay, retry := d.retryRequest(clientID, bundle); retry {
+					// Current request timed out, but will be sent again once the backoff elapsed
+					d.logger.Infof("request %v for %v timed out, retransmitting in %v", bundle.Call.UniqueId, clientID, delay)
+					clientCtx = newClientTimeoutContext(delay)
+					clientContextMap[clientID] = clientCtx
+					go d.waitForTimeout(clientID, clientCtx)
+					continue
+				}
 				d.CompleteRequest(clientID, bundle.Call.UniqueId)
 				d.logger.Infof("request %v for %v timed out", bundle.Call.UniqueId, clientID)
 				if d.onRequestCancel != nil {
 					d.onRequestCancel(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
-						ocpp.NewError(GenericError, "Request timed out", bundle.Call.UniqueId))
+						newRequestTimeoutError(bundle.Call.UniqueId))
+				}
+			}
+		case op := <-d.opC:
+			// Operations on a client queue are executed here, so no request can be dispatched concurrently
+			clientID = op.clientID
+			rdy = false
+			clientQueue, ok = d.queueMap.Get(clientID)
+			if !ok {
+				clientQueue = nil
+				close(op.done)
+				continue
+			}
+			if op.run(clientQueue) {
+				// The request in flight was released: stop its timeout and dispatch the next request
+				clientCtx = clientContextMap[clientID]
+				if clientCtx.isActive() {
+					clientCtx.cancel()
+					clientContextMap[clientID] = clientTimeoutContext{}
 				}
+				rdy = true
 			}
+			close(op.done)
 		case clientID = <-d.readyForDispatch:
 			// Cancel previous timeout (if any)
 			clientCtx, ok = clientContextMap[clientID]
@@ -307,7 +468,6 @@ func (d *DefaultServerDispatcher) dispatchNextRequest(clientID string) (clientCt
 		return
 	}
 
-	jsonMessage := bundle.Data
 	if bundle.Call == nil {
 		d.logger.Errorf("request bundle has no Call associated")
 		return
@@ -318,11 +478,35 @@ func (d *DefaultServerDispatcher) dispatchNextRequest(clientID string) (clientCt
 	}
 
 	callID := bundle.Call.GetUniqueId()
-	d.pendingRequestState.AddPendingRequest(clientID, callID, bundle.Call.Payload)
-	err := d.network.Write(clientID, jsonMessage)
+	d.retryMutex.Lock()
+	state := d.retries[clientID]
+	messageID, renew := state.nextAttempt(bundle.Call, d.retryPolicy)
+	d.retries[clientID] = state
+	d.retryMutex.Unlock()
+	if renew {
+		// Generated without holding the lock, since collision checks inspect the retry state as well
+		if id, err := d.generateMessageId(clientID); err != nil {
+			d.logger.Errorf("reusing message ID %s for retransmission of request %s for %s: %v", messageID, callID, clientID, err)
+		} else {
+			d.retryMutex.Lock()
+			state = d.retries[clientID]
+			state.supersede(id)
+			d.retries[clientID] = state
+			d.retryMutex.Unlock()
+			messageID = id
+		}
+	}
+	jsonMessage, err := wireMessage(bundle, messageID)
+	if err == nil {
+		d.pendingRequestState.AddPendingRequest(clientID, messageID, bundle.Call.Payload)
+		err = d.network.Write(clientID, jsonMessage)
+	}
 	if err != nil {
 		d.logger.Errorf("error while sending message: %v", err)
-		// TODO: handle retransmission instead of removing pending request
+		if delay, retry := d.retryRequest(clientID, bundle); retry {
+			d.logger.Infof("retransmitting request %s for %s in %v", callID, clientID, delay)
+			return newClientTimeoutContext(delay)
+		}
 		d.CompleteRequest(clientID, callID)
 		if d.onRequestCancel != nil {
 			d.onRequestCancel(clientID, bundle.Call.UniqueId, bundle.Call.Payload,
@@ -332,14 +516,89 @@ func (d *DefaultServerDispatcher) dispatchNextRequest(clientID string) (clientCt
 	}
 	// Create and return context (only if timeout is set)
 	if d.timeout > 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
-		clientCtx = clientTimeoutContext{ctx: ctx, cancel: cancel}
+		clientCtx = newClientTimeoutContext(d.timeout)
+	}
+	if d.onRequestSent != nil {
+		d.onRequestSent(clientID, callID)
 	}
-	d.logger.Infof("dispatched request %s for %s", callID, clientID)
+	d.logger.Infof("dispatched request %s for %s", messageID, clientID)
 	d.logger.Debugf("sent JSON message to %s: %s", clientID, string(jsonMessage))
 	return
 }
 
+// retryRequest checks whether the request at the front of a client queue may be retransmitted, according to the retry policy.
+// If so, the backoff before the retransmission is returned.
+//
+// The request stays pending until the backoff elapsed (see retransmissionDue), so that a late response is still accepted.
+func (d *DefaultServerDispatcher) retryRequest(clientID string, bundle RequestBundle) (time.Duration, bool) {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	state := d.retries[clientID]
+	if state.requestID != bundle.Call.UniqueId || !d.retryPolicy.canRetry(bundle.Call.Action, state.attempts) {
+		return 0, false
+	}
+	state.backoff = true
+	d.retries[clientID] = state
+	return d.retryPolicy.backoff(state.attempts), true
+}
+
+// retransmissionDue checks whether the request of a client is waiting for its retransmission, once the backoff elapsed.
+// If so, the pending request of the previous transmission is released.
+func (d *DefaultServerDispatcher) retransmissionDue(clientID string) bool {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	state, ok := d.retries[clientID]
+	if !ok || !state.backoff {
+		return false
+	}
+	state.backoff = false
+	d.retries[clientID] = state
+	d.pendingRequestState.DeletePendingRequest(clientID, state.messageID)
+	return true
+}
+
+// awaitingRetransmission returns true, if the request of a client is waiting for the backoff before its retransmission.
+func (d *DefaultServerDispatcher) awaitingRetransmission(clientID string) bool {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	return d.retries[clientID].backoff
+}
+
+func (d *DefaultServerDispatcher) originalRequestID(clientID string, messageID string) string {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	state := d.retries[clientID]
+	return state.requestFor(messageID)
+}
+
+func (d *DefaultServerDispatcher) supersededRequest(clientID string, messageID string) (string, bool) {
+	d.retryMutex.Lock()
+	defer d.retryMutex.Unlock()
+	state := d.retries[clientID]
+	return state.supersededRequest(messageID)
+}
+
+func (d *DefaultServerDispatcher) isMessageIdInUse(clientID string, messageID string) bool {
+	d.retryMutex.Lock()
+	state := d.retries[clientID]
+	inUse := state.isMessageIdInUse(messageID)
+	d.retryMutex.Unlock()
+	if inUse {
+		return true
+	}
+	q, ok := d.queueMap.Get(clientID)
+	return ok && isQueued(q, messageID)
+}
+
+// generateMessageId returns a new message ID for a request retransmitted to a client.
+// Falls back to the package-level generator, if none was set.
+func (d *DefaultServerDispatcher) generateMessageId(clientID string) (string, error) {
+	if d.newMessageId == nil {
+		return messageIdGenerator(), nil
+	}
+	return d.newMessageId(clientID)
+}
+
 func (d *DefaultServerDispatcher) waitForTimeout(clientID string, clientCtx clientTimeoutContext) {
 	defer clientCtx.cancel()
 	d.logger.Debugf("started timeout timer for %s", clientID)
@@ -370,20 +629,97 @@ func (d *DefaultServerDispatcher) CompleteRequest(clientID string, requestID str
 		d.logger.Errorf("attempting to complete request for client %v, but no matching queue found", clientID)
 		return
 	}
+	if d.completeRequest(clientID, q, requestID) {
+		// Signal that next message in queue may be sent
+		d.readyForDispatch <- clientID
+	}
+}
+
+// completeRequest removes the request at the front of a client queue, if it matches requestID,
+// and releases its pending slot. Returns true if the request was removed.
+func (d *DefaultServerDispatcher) completeRequest(clientID string, q RequestQueue, requestID string) bool {
 	el := q.Peek()
 	if el == nil {
 		d.logger.Errorf("attempting to pop front of queue, but queue is empty")
-		return
+		return false
 	}
 	bundle, _ := el.(RequestBundle)
 	callID := bundle.Call.GetUniqueId()
+	d.retryMutex.Lock()
+	state := d.retries[clientID]
+	requestID = state.requestFor(requestID)
 	if callID != requestID {
+		d.retryMutex.Unlock()
 		d.logger.Errorf("internal state mismatch: processing response for %v but expected response for %v", requestID, callID)
-		return
+		return false
 	}
+	messageID := state.messageFor(requestID)
+	delete(d.retries, clientID)
+	d.retryMutex.Unlock()
 	q.Pop()
-	d.pendingRequestState.DeletePendingRequest(clientID, requestID)
+	d.pendingRequestState.DeletePendingRequest(clientID, messageID)
 	d.logger.Debugf("completed request %s for %s", callID, clientID)
-	// Signal that next message in queue may be sent
-	d.readyForDispatch <- clientID
+	return true
+}
+
+// serverPumpOp is an operation on the request queue of a client, executed by the message pump.
+// run returns true, if it released the request in flight, so the next queued request may be dispatched.
+type serverPumpOp struct {
+	clientID string
+	run      func(q RequestQueue) bool
+	done     chan struct{}
+}
+
+// runInPump executes run on the request queue of a client from within the message pump, and waits for it to complete.
+// Returns false, if run wasn't executed because the dispatcher is stopped or the client has no queue.
+//
+// Must not be invoked from within the message pump, e.g. from the onRequestCanceled callback.
+func (d *DefaultServerDispatcher) runInPump(clientID string, run func(q RequestQueue) bool) bool {
+	if !d.IsRunning() {
+		return false
+	}
+	executed := false
+	op := serverPumpOp{clientID: clientID, done: make(chan struct{}), run: func(q RequestQueue) bool {
+		executed = true
+		return run(q)
+	}}
+	stoppedC := d.stoppedC
+	select {
+	case d.opC <- op:
+	case <-stoppedC:
+		return false
+	}
+	<-op.done
+	return executed
+}
+
+// CancelRequest cancels a request on behalf of the caller. See ServerRequestCanceler for details.
+//
+// The request is canceled by the message pump, so it can't be dispatched while being canceled.
+// For this reason, CancelRequest must not be invoked from within the onRequestCanceled callback.
+func (d *DefaultServerDispatcher) CancelRequest(clientID string, requestID string) bool {
+	result := cancelNotFound
+	isRequest := matchRequestID(requestID)
+	d.runInPump(clientID, func(q RequestQueue) bool {
+		if isRequest(q.Peek()) {
+			// The request may already be in flight: release the pending slot as well
+			if d.completeRequest(clientID, q, requestID) {
+				result = cancelReleased
+			}
+			return result == cancelReleased
+		}
+		if removable, ok := q.(RemovableRequestQueue); ok && removable.Remove(isRequest) != nil {
+			result = cancelRemoved
+		}
+		return false
+	})
+	switch result {
+	case cancelReleased:
+		d.logger.Debugf("canceled request %s for %s", requestID, clientID)
+	case cancelRemoved:
+		d.logger.Debugf("canceled queued request %s for %s", requestID, clientID)
+	default:
+		return false
+	}
+	return true
 }
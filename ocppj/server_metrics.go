@@ -3,8 +3,11 @@ package ocppj
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
@@ -12,6 +15,11 @@ import (
 const (
 	requestsInboundMetric  = "ocpp_requests_inbound"
 	requestsOutboundMetric = "ocpp_requests_outbound"
+	requestLatencyMetric   = "ocpp_request_latency"
+	requestQueueWaitMetric = "ocpp_request_queue_wait"
+	requestTimeoutsMetric  = "ocpp_request_timeouts"
+	requestsCanceledMetric = "ocpp_requests_canceled"
+	callErrorsMetric       = "ocpp_call_errors"
 )
 
 const (
@@ -19,6 +27,7 @@ const (
 	attributeOcppVersion   = "ocpp_version"
 	attributeFeature       = "feature"
 	attributeError         = "error"
+	attributeErrorCode     = "error_code"
 )
 
 type ocppMetricsError string
@@ -31,20 +40,50 @@ var (
 	validationError      = ocppMetricsError("validation_error")
 )
 
+// requestTiming holds the timestamps of an outgoing request, until it is completed.
+type requestTiming struct {
+	chargePointId string
+	requestName   string
+	enqueued      time.Time
+	sent          time.Time
+}
+
+type requestTimingKey struct {
+	clientID  string
+	requestID string
+}
+
 type ocppMetrics struct {
-	requestsIn  metric.Int64Histogram
-	requestsOut metric.Int64Histogram
-	meter       metric.Meter
+	requestsIn       metric.Int64Histogram
+	requestsOut      metric.Int64Histogram
+	requestLatency   metric.Float64Histogram
+	requestQueueWait metric.Float64Histogram
+	requestTimeouts  metric.Int64Counter
+	requestsCanceled metric.Int64Counter
+	callErrors       metric.Int64Counter
+	meter            metric.Meter
+
+	mutex   sync.Mutex
+	timings map[requestTimingKey]*requestTiming
 }
 
 // newOcppServerMetrics Creates a new metrics instance
 func newOcppServerMetrics(meterProvider metric.MeterProvider, ocppVersion string) (*ocppMetrics, error) {
+	return newOcppMetrics(meterProvider, "ocpp", ocppVersion)
+}
+
+// newOcppClientMetrics creates a new metrics instance for a client endpoint.
+func newOcppClientMetrics(meterProvider metric.MeterProvider, ocppVersion string) (*ocppMetrics, error) {
+	return newOcppMetrics(meterProvider, "ocpp_client", ocppVersion)
+}
+
+func newOcppMetrics(meterProvider metric.MeterProvider, meterName string, ocppVersion string) (*ocppMetrics, error) {
 	if meterProvider == nil {
 		return nil, errors.New("meterProvider is required")
 	}
 
 	meter := meterProvider.Meter(
-		"ocpp",
+		meterName,
 		metric.WithInstrumentationAttributes(attribute.String(attributeOcppVersion, ocppVersion)),
 	)
 
@@ -64,22 +103,73 @@ func newOcppServerMetrics(meterProvider metric.MeterProvider, ocppVersion string
 		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", requestsOutboundMetric))
 	}
 
+	requestLatency, err := meter.Float64Histogram(
+		requestLatencyMetric,
+		metric.WithDescription("Round-trip latency of outbound requests, from sending a request until its response is received"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", requestLatencyMetric))
+	}
+
+	requestQueueWait, err := meter.Float64Histogram(
+		requestQueueWaitMetric,
+		metric.WithDescription("Time outbound requests spend in the queue, before being sent"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", requestQueueWaitMetric))
+	}
+
+	requestTimeouts, err := meter.Int64Counter(
+		requestTimeoutsMetric,
+		metric.WithDescription("Number of outbound requests, for which no response was received in time"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", requestTimeoutsMetric))
+	}
+
+	requestsCanceled, err := meter.Int64Counter(
+		requestsCanceledMetric,
+		metric.WithDescription("Number of outbound requests canceled by the dispatcher, due to timeouts or internal errors"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", requestsCanceledMetric))
+	}
+
+	callErrors, err := meter.Int64Counter(
+		callErrorsMetric,
+		metric.WithDescription("Number of CallErrors received in response to outbound requests"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", callErrorsMetric))
+	}
+
 	metrics := &ocppMetrics{
-		requestsIn:  requestsIn,
-		requestsOut: requestsOut,
-		meter:       meter,
+		requestsIn:       requestsIn,
+		requestsOut:      requestsOut,
+		requestLatency:   requestLatency,
+		requestQueueWait: requestQueueWait,
+		requestTimeouts:  requestTimeouts,
+		requestsCanceled: requestsCanceled,
+		callErrors:       callErrors,
+		meter:            meter,
+		timings:          map[requestTimingKey]*requestTiming{},
 	}
 	return metrics, nil
 }
 
 func (m *ocppMetrics) IncrementInboundRequests(ctx context.Context, chargePointId, requestName string, error *ocppMetricsError) {
+	if m == nil {
+		return
+	}
 	attrs := []attribute.KeyValue{
 		attribute.String(attributeChargePointId, chargePointId),
 	}
 
 	// Optionally add a request name. Should be present most of the time, except when we cannot unmarshal the request.
 	if requestName != "" {
-		attribute.String(attributeFeature, requestName)
+		attrs = append(attrs, attribute.String(attributeFeature, requestName))
 	}
 
 	if error != nil {
@@ -91,13 +181,16 @@ func (m *ocppMetrics) IncrementInboundRequests(ctx context.Context, chargePointI
 }
 
 func (m *ocppMetrics) IncrementOutboundRequests(ctx context.Context, chargePointId, requestName string, error *ocppMetricsError) {
+	if m == nil {
+		return
+	}
 	attrs := []attribute.KeyValue{
 		attribute.String(attributeChargePointId, chargePointId),
 	}
 
 	// Optionally add a request name. Should be present most of the time, except when we cannot unmarshal the request.
 	if requestName != "" {
-		attribute.String(attributeFeature, requestName)
+		attrs = append(attrs, attribute.String(attributeFeature, requestName))
 	}
 
 	if error != nil {
@@ -107,3 +200,117 @@ func (m *ocppMetrics) IncrementOutboundRequests(ctx context.Context, chargePoint
 	metricAttrs := metric.WithAttributes(attrs...)
 	m.requestsOut.Record(ctx, 1, metricAttrs)
 }
+
+func requestAttributes(chargePointId, requestName string, attrs ...attribute.KeyValue) metric.MeasurementOption {
+	return metric.WithAttributes(append([]attribute.KeyValue{
+		attribute.String(attributeChargePointId, chargePointId),
+		attribute.String(attributeFeature, requestName),
+	}, attrs...)...)
+}
+
+// RequestEnqueued starts timing an outbound request. Clients use an empty clientID.
+func (m *ocppMetrics) RequestEnqueued(clientID, chargePointId, requestID, requestName string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.timings[requestTimingKey{clientID: clientID, requestID: requestID}] = &requestTiming{
+		chargePointId: chargePointId,
+		requestName:   requestName,
+		enqueued:      time.Now(),
+	}
+}
+
+// RequestSent records the time an outbound request spent in the queue.
+// The queue wait time is only recorded for the first transmission, while the latency is measured from the latest one.
+func (m *ocppMetrics) RequestSent(ctx context.Context, clientID, requestID string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	timing, ok := m.timings[requestTimingKey{clientID: clientID, requestID: requestID}]
+	if !ok {
+		m.mutex.Unlock()
+		return
+	}
+	firstSent := timing.sent.IsZero()
+	timing.sent = time.Now()
+	queueWait := timing.sent.Sub(timing.enqueued)
+	m.mutex.Unlock()
+	if firstSent {
+		m.requestQueueWait.Record(ctx, queueWait.Seconds(), requestAttributes(timing.chargePointId, timing.requestName))
+	}
+}
+
+// RequestCompleted records the round-trip latency of an outbound request, once a response was received.
+// If the response is a CallError, it is counted by error code.
+func (m *ocppMetrics) RequestCompleted(ctx context.Context, clientID, requestID string, callError *ocpp.Error) {
+	timing, ok := m.removeTiming(clientID, requestID)
+	if !ok {
+		return
+	}
+	if !timing.sent.IsZero() {
+		m.requestLatency.Record(ctx, time.Since(timing.sent).Seconds(), requestAttributes(timing.chargePointId, timing.requestName))
+	}
+	if callError != nil {
+		m.callErrors.Add(ctx, 1, requestAttributes(timing.chargePointId, timing.requestName, attribute.String(attributeErrorCode, string(callError.Code))))
+	}
+}
+
+// RequestCanceled counts an outbound request canceled by the dispatcher. Timeouts are counted separately as well.
+func (m *ocppMetrics) RequestCanceled(ctx context.Context, clientID, requestID string, err *ocpp.Error) {
+	timing, ok := m.removeTiming(clientID, requestID)
+	if !ok {
+		return
+	}
+	var errorCode string
+	if err != nil {
+		errorCode = string(err.Code)
+	}
+	m.requestsCanceled.Add(ctx, 1, requestAttributes(timing.chargePointId, timing.requestName, attribute.String(attributeErrorCode, errorCode)))
+	if isRequestTimeoutError(err) {
+		m.requestTimeouts.Add(ctx, 1, requestAttributes(timing.chargePointId, timing.requestName))
+	}
+}
+
+// ForgetRequest stops timing an outbound request, without recording anything (e.g. when canceled by the caller).
+func (m *ocppMetrics) ForgetRequest(clientID, requestID string) {
+	m.removeTiming(clientID, requestID)
+}
+
+// ForgetClient stops timing all outbound requests for a client.
+func (m *ocppMetrics) ForgetClient(clientID string) {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key := range m.timings {
+		if key.clientID == clientID {
+			delete(m.timings, key)
+		}
+	}
+}
+
+// ForgetAll stops timing all outbound requests.
+func (m *ocppMetrics) ForgetAll() {
+	if m == nil {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.timings = map[requestTimingKey]*requestTiming{}
+}
+
+func (m *ocppMetrics) removeTiming(clientID, requestID string) (*requestTiming, bool) {
+	if m == nil {
+		return nil, false
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := requestTimingKey{clientID: clientID, requestID: requestID}
+	timing, ok := m.timings[key]
+	delete(m.timings, key)
+	return timing, ok
+}
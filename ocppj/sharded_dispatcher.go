@@ -0,0 +1,181 @@
+package ocppj
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xBlaz3kx/ocpp-go/ws"
+)
+
+// ShardedServerDispatcher is an implementation of the ServerDispatcher interface,
+// which spreads clients across multiple message pumps.
+//
+// The DefaultServerDispatcher serves all clients from a single goroutine. When sending requests to thousands
+// of clients at once, e.g. a fleet-wide configuration change, that goroutine becomes a bottleneck.
+// The ShardedServerDispatcher runs one DefaultServerDispatcher per shard instead, each with its own message pump.
+// A client is always assigned to the same shard, based on a hash of its ID,
+// so at most one request per client is in flight at any time.
+//
+// All shards share the same queue map and pending request state.
+// To reduce lock contention on the queue map as well, pass a ShardedQueueMap with the same number of shards.
+type ShardedServerDispatcher struct {
+	shards              []*DefaultServerDispatcher
+	queueMap            ServerQueueMap
+	pendingRequestState ServerState
+	mutex               sync.RWMutex
+	running             atomic.Bool
+}
+
+// NewShardedServerDispatcher creates a new ShardedServerDispatcher with the given number of shards.
+// If shards is not positive, GOMAXPROCS shards are created.
+//
+// The options are applied to every shard.
+func NewShardedServerDispatcher(
+	queueMap ServerQueueMap,
+	shards int,
+	opts ...DefaultServerDispatcherOption,
+) *ShardedServerDispatcher {
+	if shards <= 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	d := &ShardedServerDispatcher{
+		shards:   make([]*DefaultServerDispatcher, shards),
+		queueMap: queueMap,
+	}
+	for i := range d.shards {
+		shard := newDefaultServerDispatcher(queueMap, opts...)
+		if shard == nil {
+			return nil
+		}
+		d.shards[i] = shard
+	}
+	d.SetPendingRequestState(NewServerState(&d.mutex))
+
+	// Metrics are observed once for all shards
+	metrics := d.shards[0].metrics
+	metrics.ObserveQueues(queueMap)
+	metrics.ObserveInFlightRequests(d.pendingRequestState.(*serverState))
+
+	return d
+}
+
+// shard returns the dispatcher, to which a client is assigned.
+func (d *ShardedServerDispatcher) shard(clientID string) *DefaultServerDispatcher {
+	return d.shards[shardIndex(clientID, len(d.shards))]
+}
+
+// Shards returns the number of shards of the dispatcher.
+func (d *ShardedServerDispatcher) Shards() int {
+	return len(d.shards)
+}
+
+func (d *ShardedServerDispatcher) Start() {
+	for _, shard := range d.shards {
+		shard.Start()
+	}
+	d.running.Store(true)
+}
+
+func (d *ShardedServerDispatcher) IsRunning() bool {
+	return d.running.Load()
+}
+
+func (d *ShardedServerDispatcher) Stop() {
+	d.running.Store(false)
+	for _, shard := range d.shards {
+		shard.Stop()
+	}
+}
+
+func (d *ShardedServerDispatcher) SetTimeout(timeout time.Duration) {
+	for _, shard := range d.shards {
+		shard.SetTimeout(timeout)
+	}
+}
+
+// SetRetryPolicy sets the policy for retransmitting requests, which timed out or couldn't be sent.
+// If policy is nil, such requests are canceled right away.
+func (d *ShardedServerDispatcher) SetRetryPolicy(policy *RetryPolicy) {
+	for _, shard := range d.shards {
+		shard.SetRetryPolicy(policy)
+	}
+}
+
+func (d *ShardedServerDispatcher) SendRequest(clientID string, req RequestBundle) error {
+	return d.shard(clientID).SendRequest(clientID, req)
+}
+
+func (d *ShardedServerDispatcher) CompleteRequest(clientID string, requestID string) {
+	d.shard(clientID).CompleteRequest(clientID, requestID)
+}
+
+func (d *ShardedServerDispatcher) CancelRequest(clientID string, requestID string) bool {
+	return d.shard(clientID).CancelRequest(clientID, requestID)
+}
+
+func (d *ShardedServerDispatcher) SetOnRequestCanceled(cb CanceledRequestHandler) {
+	for _, shard := range d.shards {
+		shard.SetOnRequestCanceled(cb)
+	}
+}
+
+func (d *ShardedServerDispatcher) SetNetworkServer(server ws.Server) {
+	for _, shard := range d.shards {
+		shard.SetNetworkServer(server)
+	}
+}
+
+func (d *ShardedServerDispatcher) SetPendingRequestState(state ServerState) {
+	d.pendingRequestState = state
+	for _, shard := range d.shards {
+		shard.SetPendingRequestState(state)
+	}
+}
+
+func (d *ShardedServerDispatcher) CreateClient(clientID string) {
+	d.shard(clientID).CreateClient(clientID)
+}
+
+func (d *ShardedServerDispatcher) DeleteClient(clientID string) {
+	d.shard(clientID).DeleteClient(clientID)
+}
+
+// setOnRequestSent registers a handler, which is invoked whenever a queued request was written to the network.
+func (d *ShardedServerDispatcher) setOnRequestSent(handler func(clientID string, requestID string)) {
+	for _, shard := range d.shards {
+		shard.setOnRequestSent(handler)
+	}
+}
+
+// setMessageIdGenerator sets the generator used for message IDs of retransmitted requests.
+func (d *ShardedServerDispatcher) setMessageIdGenerator(generate func(clientID string) (string, error)) {
+	for _, shard := range d.shards {
+		shard.setMessageIdGenerator(generate)
+	}
+}
+
+func (d *ShardedServerDispatcher) replaceClient(clientID string) {
+	d.shard(clientID).replaceClient(clientID)
+}
+
+func (d *ShardedServerDispatcher) originalRequestID(clientID string, messageID string) string {
+	return d.shard(clientID).originalRequestID(clientID, messageID)
+}
+
+func (d *ShardedServerDispatcher) supersededRequest(clientID string, messageID string) (string, bool) {
+	return d.shard(clientID).supersededRequest(clientID, messageID)
+}
+
+func (d *ShardedServerDispatcher) isMessageIdInUse(clientID string, messageID string) bool {
+	return d.shard(clientID).isMessageIdInUse(clientID, messageID)
+}
+
+func (d *ShardedServerDispatcher) queuedRequests(clientID string) int {
+	return d.shard(clientID).queuedRequests(clientID)
+}
+
+func (d *ShardedServerDispatcher) dropRequests(clientID string) []RequestBundle {
+	return d.shard(clientID).dropRequests(clientID)
+}
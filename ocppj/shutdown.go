@@ -0,0 +1,281 @@
+package ocppj
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ws"
+)
+
+// Interval at which Shutdown checks whether all outstanding requests completed.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// ShutdownOutcome describes how the requests exchanged with a client were handled during a graceful shutdown.
+type ShutdownOutcome int
+
+const (
+	// The client had no outstanding requests, when the shutdown started.
+	ShutdownIdle ShutdownOutcome = iota
+	// All outstanding requests completed or timed out, before the connection was closed.
+	ShutdownDrained
+	// Requests were still outstanding when the shutdown context was done, and were dropped.
+	ShutdownInterrupted
+)
+
+func (o ShutdownOutcome) String() string {
+	switch o {
+	case ShutdownIdle:
+		return "idle"
+	case ShutdownDrained:
+		return "drained"
+	case ShutdownInterrupted:
+		return "interrupted"
+	}
+	return fmt.Sprintf("ShutdownOutcome(%d)", int(o))
+}
+
+// ClientShutdownResult reports how the connection of a client was terminated by a graceful shutdown.
+type ClientShutdownResult struct {
+	Outcome ShutdownOutcome
+	// Number of outgoing requests, which were still queued or awaiting a response when the connection was closed.
+	PendingRequests int
+	// Number of incoming requests, which were still awaiting a response when the connection was closed.
+	UnansweredRequests int
+}
+
+// ShutdownReport contains the result of a graceful shutdown for every client connected at the time, by client ID.
+type ShutdownReport map[string]ClientShutdownResult
+
+// requestQueueInspector is implemented by dispatchers, which expose the number of queued requests for a client.
+// Endpoints use it to wait for queued requests to be sent, before shutting down.
+type requestQueueInspector interface {
+	queuedRequests(clientID string) int
+}
+
+// requestDropper is implemented by dispatchers, which can drop all requests for a client.
+// Endpoints use it to cancel outstanding requests, when a shutdown is interrupted.
+type requestDropper interface {
+	dropRequests(clientID string) []RequestBundle
+}
+
+// Description of the error passed to the cancellation handler for requests dropped by an interrupted shutdown.
+const shutdownDroppedDescription = "Request dropped due to server shutdown"
+
+// inboundCalls keeps track of the connected clients and of the incoming requests, which weren't answered yet.
+type inboundCalls struct {
+	mutex      sync.Mutex
+	clients    map[string]struct{}
+	unanswered map[string]map[string]struct{}
+	stale      map[string]map[string]struct{} // unanswered requests received over a replaced connection
+}
+
+func (c *inboundCalls) connect(clientID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.clients == nil {
+		c.clients = map[string]struct{}{}
+	}
+	c.clients[clientID] = struct{}{}
+}
+
+func (c *inboundCalls) disconnect(clientID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.clients, clientID)
+	delete(c.unanswered, clientID)
+	delete(c.stale, clientID)
+}
+
+// replace marks the unanswered requests of a client as stale, since the connection they were received over was replaced.
+// Stale requests must not be answered over the new connection.
+func (c *inboundCalls) replace(clientID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.unanswered[clientID]) == 0 {
+		return
+	}
+	if c.stale == nil {
+		c.stale = map[string]map[string]struct{}{}
+	}
+	if c.stale[clientID] == nil {
+		c.stale[clientID] = map[string]struct{}{}
+	}
+	for requestID := range c.unanswered[clientID] {
+		c.stale[clientID][requestID] = struct{}{}
+	}
+	delete(c.unanswered, clientID)
+}
+
+// isStale returns true, if an incoming request was received over a connection, which was replaced in the meantime.
+func (c *inboundCalls) isStale(clientID string, requestID string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, ok := c.stale[clientID][requestID]
+	return ok
+}
+
+// forget removes an incoming request from the stale requests of a client.
+// Must be called with the mutex held.
+func (c *inboundCalls) forget(clientID string, requestID string) {
+	delete(c.stale[clientID], requestID)
+	if len(c.stale[clientID]) == 0 {
+		delete(c.stale, clientID)
+	}
+}
+
+func (c *inboundCalls) connectedClients() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	clients := make([]string, 0, len(c.clients))
+	for clientID := range c.clients {
+		clients = append(clients, clientID)
+	}
+	return clients
+}
+
+// received marks an incoming request as awaiting a response.
+func (c *inboundCalls) received(clientID string, requestID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.unanswered == nil {
+		c.unanswered = map[string]map[string]struct{}{}
+	}
+	if c.unanswered[clientID] == nil {
+		c.unanswered[clientID] = map[string]struct{}{}
+	}
+	c.unanswered[clientID][requestID] = struct{}{}
+	// The request ID was reused over the new connection
+	c.forget(clientID, requestID)
+}
+
+// answered marks an incoming request as answered.
+func (c *inboundCalls) answered(clientID string, requestID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.unanswered[clientID], requestID)
+	if len(c.unanswered[clientID]) == 0 {
+		delete(c.unanswered, clientID)
+	}
+	c.forget(clientID, requestID)
+}
+
+func (c *inboundCalls) count(clientID string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.unanswered[clientID])
+}
+
+// outstandingRequests returns the number of outgoing and incoming requests for a client, which didn't complete yet.
+func (s *Server) outstandingRequests(clientID string) (outgoing int, incoming int) {
+	if inspector, ok := s.dispatcher.(requestQueueInspector); ok {
+		outgoing = inspector.queuedRequests(clientID)
+	} else if s.RequestState.HasPendingRequest(clientID) {
+		outgoing = 1
+	}
+	return outgoing, s.inboundCalls.count(clientID)
+}
+
+// updateShutdownReport updates the number of outstanding requests for all clients.
+// Clients, which were idle so far but received a request in the meantime, must be drained as well.
+// Returns true if no outstanding requests are left.
+func (s *Server) updateShutdownReport(report ShutdownReport) bool {
+	drained := true
+	for clientID, result := range report {
+		result.PendingRequests, result.UnansweredRequests = s.outstandingRequests(clientID)
+		if result.PendingRequests > 0 || result.UnansweredRequests > 0 {
+			result.Outcome = ShutdownDrained
+			drained = false
+		}
+		report[clientID] = result
+	}
+	return drained
+}
+
+// dropOutstandingRequests cancels all outgoing requests for a client, which are still queued or awaiting a response.
+// The cancellation handler is invoked for every dropped request.
+func (s *Server) dropOutstandingRequests(clientID string) {
+	dropper, ok := s.dispatcher.(requestDropper)
+	if !ok {
+		return
+	}
+	for _, bundle := range dropper.dropRequests(clientID) {
+		requestID := bundle.Call.UniqueId
+		s.onRequestCanceled(clientID, requestID, bundle.Call.Payload, ocpp.NewError(GenericError, shutdownDroppedDescription, requestID))
+	}
+}
+
+// Shutdown gracefully shuts down the server, allowing ongoing message exchanges to complete.
+//
+// The server stops accepting new connections and new outgoing requests right away.
+// It then waits until all queued and pending requests completed or timed out,
+// and all incoming requests were answered, or until ctx is done.
+// Finally, all connections are closed with the close error configured on the websocket server
+// (see ws.WithShutdownCloseError), so that clients may reconnect to another server instance.
+//
+// The returned report contains the outcome for every client connected when the shutdown started.
+// If ctx is done before all requests completed, ctx.Err() is returned along with the report.
+// Outgoing requests dropped this way are passed to the cancellation handler with a GenericError,
+// if supported by the dispatcher.
+//
+// If the websocket server doesn't implement ws.GracefulShutdowner, new connections are accepted while waiting,
+// and all connections are closed via Stop.
+//
+// The server doesn't accept new outgoing requests after a shutdown, until it is started again.
+func (s *Server) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	s.shuttingDown.Store(true)
+	shutdowner, graceful := s.server.(ws.GracefulShutdowner)
+	if graceful {
+		shutdowner.StopAccepting()
+	}
+	s.logger.Info("shutting down, waiting for outstanding requests")
+
+	clients := s.inboundCalls.connectedClients()
+	report := ShutdownReport{}
+	for _, clientID := range clients {
+		outgoing, incoming := s.outstandingRequests(clientID)
+		if outgoing > 0 || incoming > 0 {
+			report[clientID] = ClientShutdownResult{Outcome: ShutdownDrained}
+		} else {
+			report[clientID] = ClientShutdownResult{Outcome: ShutdownIdle}
+		}
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	var err error
+	for err == nil && !s.updateShutdownReport(report) {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	if err != nil {
+		for clientID, result := range report {
+			if result.PendingRequests > 0 || result.UnansweredRequests > 0 {
+				result.Outcome = ShutdownInterrupted
+				report[clientID] = result
+				s.logger.Infof("dropping %d outgoing and %d incoming requests for %s", result.PendingRequests, result.UnansweredRequests, clientID)
+				s.dropOutstandingRequests(clientID)
+			}
+		}
+	}
+
+	s.stopCluster()
+	if s.dispatcher.IsRunning() {
+		s.dispatcher.Stop()
+	}
+	if !graceful {
+		// The websocket server can't reject new connections in the meantime, nor close connections gracefully
+		s.server.Stop()
+	} else if wsErr := shutdowner.Shutdown(ctx); wsErr != nil && err == nil {
+		err = wsErr
+	}
+	s.requestContexts.releaseAll()
+	s.metrics.ForgetAll()
+	s.tracer.endAll(ocpp.NewError(GenericError, "server shut down", ""))
+	return report, err
+}
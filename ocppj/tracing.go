@@ -0,0 +1,187 @@
+package ocppj
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/xBlaz3kx/ocpp-go/ocpp"
+	"github.com/xBlaz3kx/ocpp-go/ws"
+)
+
+const tracerName = "github.com/xBlaz3kx/ocpp-go/ocppj"
+
+const (
+	attributeSpanChargePointId = "ocpp.charge_point_id"
+	attributeSpanAction        = "ocpp.action"
+	attributeSpanUniqueId      = "ocpp.unique_id"
+	attributeSpanQueueWait     = "ocpp.queue_wait_ms"
+	attributeSpanErrorCode     = "ocpp.error_code"
+)
+
+// Error code recorded on spans of requests, which were canceled locally.
+const canceledErrorCode ocpp.ErrorCode = "Canceled"
+
+// requestSentNotifier is implemented by dispatchers, which notify when a queued request is written to the network.
+// Endpoints use it to measure the time requests spend in the queue.
+type requestSentNotifier interface {
+	setOnRequestSent(handler func(clientID string, requestID string))
+}
+
+type exchangeKey struct {
+	inbound  bool
+	clientID string
+	uniqueID string
+}
+
+type exchangeSpan struct {
+	span    trace.Span
+	started time.Time
+	sent    bool
+}
+
+// exchangeTracer keeps track of the spans of ongoing CALL/CALLRESULT exchanges.
+//
+// Outgoing requests are traced from the moment they are enqueued, until a response is received or the request is canceled.
+// Incoming requests are traced from the moment they are received, until a response is sent.
+// Clients use an empty clientID, since they only talk to a single endpoint.
+type exchangeTracer struct {
+	tracer trace.Tracer
+	mutex  sync.Mutex
+	spans  map[exchangeKey]*exchangeSpan
+}
+
+// newExchangeTracer creates a tracer for the given provider. If provider is nil, the global tracer provider is used.
+func newExchangeTracer(provider trace.TracerProvider) *exchangeTracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &exchangeTracer{
+		tracer: provider.Tracer(tracerName),
+		spans:  map[exchangeKey]*exchangeSpan{},
+	}
+}
+
+// linkConnection links a span to the span of the websocket connection, if the connection is traced.
+func linkConnection(span trace.Span, connection interface{}) {
+	provider, ok := connection.(ws.SpanContextProvider)
+	if !ok {
+		return
+	}
+	spanContext := provider.SpanContext()
+	if spanContext.IsValid() {
+		span.AddLink(trace.Link{SpanContext: spanContext})
+	}
+}
+
+// start creates a span for a new exchange. The span is a child of any span contained in ctx.
+//
+// The connection function returns the websocket connection the exchange belongs to.
+// It is only invoked if the span is recorded.
+func (t *exchangeTracer) start(ctx context.Context, inbound bool, chargePointID string, clientID string, call *Call, connection func() interface{}) {
+	kind := trace.SpanKindClient
+	if inbound {
+		kind = trace.SpanKindServer
+	}
+	_, span := t.tracer.Start(ctx, call.Action,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(
+			attribute.String(attributeSpanChargePointId, chargePointID),
+			attribute.String(attributeSpanAction, call.Action),
+			attribute.String(attributeSpanUniqueId, call.UniqueId),
+		),
+	)
+	if !span.IsRecording() {
+		return
+	}
+	linkConnection(span, connection())
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := exchangeKey{inbound: inbound, clientID: clientID, uniqueID: call.UniqueId}
+	if previous, ok := t.spans[key]; ok {
+		// Unique IDs are reused by the other endpoint, the old exchange will never complete
+		previous.span.End()
+	}
+	t.spans[key] = &exchangeSpan{span: span, started: time.Now()}
+}
+
+// sent records that an outgoing request was written to the network.
+// The time spent in the queue is only recorded for the first transmission.
+func (t *exchangeTracer) sent(clientID string, requestID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	exchange, ok := t.spans[exchangeKey{clientID: clientID, uniqueID: requestID}]
+	if !ok {
+		return
+	}
+	if !exchange.sent {
+		exchange.sent = true
+		exchange.span.SetAttributes(attribute.Int64(attributeSpanQueueWait, time.Since(exchange.started).Milliseconds()))
+	}
+	exchange.span.AddEvent("sent")
+}
+
+// end ends the span of an exchange. If err is not nil, the exchange is marked as failed.
+func (t *exchangeTracer) end(inbound bool, clientID string, uniqueID string, err *ocpp.Error) {
+	t.mutex.Lock()
+	key := exchangeKey{inbound: inbound, clientID: clientID, uniqueID: uniqueID}
+	exchange, ok := t.spans[key]
+	delete(t.spans, key)
+	t.mutex.Unlock()
+	if !ok {
+		return
+	}
+	if err != nil {
+		exchange.span.SetAttributes(attribute.String(attributeSpanErrorCode, string(err.Code)))
+		exchange.span.SetStatus(codes.Error, err.Description)
+	}
+	exchange.span.End()
+}
+
+// endClient ends the spans of all exchanges with a client, marking them as failed.
+func (t *exchangeTracer) endClient(clientID string, err *ocpp.Error) {
+	t.mutex.Lock()
+	var keys []exchangeKey
+	for key := range t.spans {
+		if key.clientID == clientID {
+			keys = append(keys, key)
+		}
+	}
+	t.mutex.Unlock()
+	for _, key := range keys {
+		t.end(key.inbound, key.clientID, key.uniqueID, err)
+	}
+}
+
+// endInbound ends the spans of all incoming requests from a client, marking them as failed.
+func (t *exchangeTracer) endInbound(clientID string, err *ocpp.Error) {
+	t.mutex.Lock()
+	var keys []exchangeKey
+	for key := range t.spans {
+		if key.inbound && key.clientID == clientID {
+			keys = append(keys, key)
+		}
+	}
+	t.mutex.Unlock()
+	for _, key := range keys {
+		t.end(key.inbound, key.clientID, key.uniqueID, err)
+	}
+}
+
+// endAll ends the spans of all exchanges, marking them as failed.
+func (t *exchangeTracer) endAll(err *ocpp.Error) {
+	t.mutex.Lock()
+	var keys []exchangeKey
+	for key := range t.spans {
+		keys = append(keys, key)
+	}
+	t.mutex.Unlock()
+	for _, key := range keys {
+		t.end(key.inbound, key.clientID, key.uniqueID, err)
+	}
+}
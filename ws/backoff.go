@@ -0,0 +1,146 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffStrategy computes the delay before each automatic reconnection attempt of a client.
+//
+// Strategies may be set on a client via WithClientBackoff.
+// If no strategy is set, the client uses an OCPPBackoff created from its timeout configuration.
+type BackoffStrategy interface {
+	// NextDelay returns the delay to wait before a reconnection attempt.
+	// The attempt starts at 1, and is reset whenever the client falls back to another endpoint.
+	// The previously returned delay is passed along, and is zero for the first attempt.
+	NextDelay(attempt int, previous time.Duration) time.Duration
+}
+
+// randomDuration returns a random duration in the interval [min, max].
+func randomDuration(min time.Duration, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(rand.Int63n(int64(max-min)+1))
+}
+
+// OCPPBackoff implements the reconnection back-off defined by the RetryBackOff* configuration variables of OCPP 2.0.1.
+//
+// The first attempt is delayed by WaitMinimum plus a random part of at most RandomRange.
+// Each subsequent attempt doubles the previous delay and adds a new random part, up to RepeatTimes times.
+// Afterward, the client keeps reconnecting with the same delay.
+type OCPPBackoff struct {
+	WaitMinimum time.Duration
+	RandomRange time.Duration
+	RepeatTimes int
+}
+
+// NewOCPPBackoff creates an OCPPBackoff from the RetryBackOff* fields of a client timeout configuration.
+func NewOCPPBackoff(config ClientTimeoutConfig) OCPPBackoff {
+	return OCPPBackoff{
+		WaitMinimum: config.RetryBackOffWaitMinimum,
+		RandomRange: time.Duration(config.RetryBackOffRandomRange) * time.Second,
+		RepeatTimes: config.RetryBackOffRepeatTimes,
+	}
+}
+
+func (b OCPPBackoff) NextDelay(attempt int, previous time.Duration) time.Duration {
+	if attempt <= 1 || previous <= 0 {
+		return b.WaitMinimum + randomDuration(0, b.RandomRange)
+	}
+	if attempt-1 > b.RepeatTimes {
+		return previous
+	}
+	return 2*previous + randomDuration(0, b.RandomRange)
+}
+
+// ExponentialBackoff multiplies the delay by a constant factor after every attempt, up to a maximum delay.
+//
+// To avoid many clients reconnecting in lockstep, a Jitter between 0 and 1 may be set.
+// Each delay is then picked randomly, between (1 - Jitter) times and the full computed delay.
+type ExponentialBackoff struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration // If zero, the delay isn't capped.
+	Multiplier   float64       // Defaults to 2, if lower than 1.
+	Jitter       float64
+}
+
+func (b ExponentialBackoff) NextDelay(attempt int, _ time.Duration) time.Duration {
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(b.InitialDelay) * math.Pow(multiplier, float64(max(attempt-1, 0)))
+	if b.MaxDelay > 0 && delay > float64(b.MaxDelay) {
+		delay = float64(b.MaxDelay)
+	}
+	jitter := min(max(b.Jitter, 0), 1)
+	return randomDuration(time.Duration(delay*(1-jitter)), time.Duration(delay))
+}
+
+// DecorrelatedJitterBackoff picks each delay randomly, between BaseDelay and three times the previous delay,
+// up to a maximum delay.
+//
+// Delays grow roughly exponentially, while spreading out the reconnection attempts of many clients,
+// which lost their connection at the same time.
+type DecorrelatedJitterBackoff struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration // If zero, the delay isn't capped.
+}
+
+func (b DecorrelatedJitterBackoff) NextDelay(_ int, previous time.Duration) time.Duration {
+	delay := randomDuration(b.BaseDelay, max(b.BaseDelay, 3*previous))
+	if b.MaxDelay > 0 && delay > b.MaxDelay {
+		delay = b.MaxDelay
+	}
+	return delay
+}
+
+// RetryClassifier decides whether the client should keep reconnecting, after a connection attempt failed with the given error.
+//
+// If the server rejected the websocket handshake, the error is an HttpConnectionError.
+type RetryClassifier func(err error) bool
+
+// RetryAll is the default RetryClassifier, which treats all errors as retryable.
+func RetryAll(_ error) bool {
+	return true
+}
+
+// FatalHTTPStatusCodes returns a RetryClassifier, which stops reconnecting if the server rejected
+// the websocket handshake with any of the given HTTP status codes. All other errors are retryable.
+//
+// For example, to stop reconnecting once the server rejects the credentials of the client:
+//
+//	client := ws.NewClient(ws.WithClientRetryClassifier(ws.FatalHTTPStatusCodes(http.StatusUnauthorized, http.StatusForbidden)))
+func FatalHTTPStatusCodes(codes ...int) RetryClassifier {
+	fatal := map[int]struct{}{}
+	for _, code := range codes {
+		fatal[code] = struct{}{}
+	}
+	return func(err error) bool {
+		var httpErr HttpConnectionError
+		if errors.As(err, &httpErr) {
+			_, isFatal := fatal[httpErr.HttpCode]
+			return !isFatal
+		}
+		return true
+	}
+}
+
+// ReconnectionStoppedError is reported via the Errors channel of a client, when the client stops reconnecting
+// to the server, either because the maximum number of attempts was reached or because of a fatal error.
+type ReconnectionStoppedError struct {
+	Attempts int   // The number of failed connection attempts.
+	Err      error // The error returned by the last connection attempt.
+}
+
+func (e ReconnectionStoppedError) Error() string {
+	return fmt.Sprintf("stopped reconnecting after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e ReconnectionStoppedError) Unwrap() error {
+	return e.Err
+}
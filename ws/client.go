@@ -1,11 +1,11 @@
 package ws
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"path"
@@ -13,6 +13,7 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/xBlaz3kx/ocpp-go/logging"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ---------------------- CLIENT ----------------------
@@ -64,16 +65,28 @@ type Client interface {
 	// To stop a running client, call the Stop function.
 	Start(url string) error
 	// Starts the client and attempts to connect to the server on a specified URL.
-	// If the connection fails, it keeps retrying with Backoff strategy from TimeoutConfig.
+	// If the connection fails, it keeps retrying with the backoff strategy of the client (see WithClientBackoff).
 	//
 	// For example:
 	//	client.StartWithRetries("ws://localhost:8887/ws/1234")
 	//
-	// The function returns only when the connection has been established.
+	// The function returns only when the connection has been established,
+	// or when the client stopped retrying (see WithClientMaxReconnectAttempts and WithClientRetryClassifier).
 	// Incoming messages are passed automatically to the callback function, so no explicit read operation is required.
 	//
 	// To stop a running client, call the Stop function.
 	StartWithRetries(url string)
+	// StartWithEndpoints is like StartWithRetries, but fails over across an ordered list of endpoints,
+	// e.g. the network connection profiles of an OCPP 2.0.1 charging station, sorted by priority.
+	//
+	// The client first attempts to connect to the first endpoint. After the configured number of consecutive failed attempts
+	// on an endpoint, it falls back to the next one, wrapping around after the last one.
+	// Attempts are delayed by the backoff strategy of the client, which is reset when falling back.
+	// Automatic reconnections follow the same logic, starting with the endpoint that was connected last.
+	//
+	// The function returns only when the connection has been established, or when the client stopped retrying.
+	// If no endpoints are passed, an error is reported via the Errors channel and the function returns right away.
+	StartWithEndpoints(endpoints []Endpoint)
 	// Stop closes the output of the websocket Channel, effectively closing the connection to the server with a normal closure.
 	Stop()
 	// Errors returns a channel for error messages. If it doesn't exist it es created.
@@ -98,6 +111,11 @@ type Client interface {
 	//
 	// If set, the DisconnectedHandler will always be invoked before the Reconnected callback is invoked.
 	SetReconnectedHandler(handler func())
+	// SetActiveEndpointHandler sets a callback function, invoked whenever a connection to an endpoint was established.
+	// The callback receives the endpoint along with its index in the list passed to StartWithEndpoints.
+	//
+	// If the client was started with a single URL, the endpoint contains just that URL and the index is always 0.
+	SetActiveEndpointHandler(handler func(endpoint Endpoint, index int))
 	// IsConnected Returns information about the current connection status.
 	// If the client is currently attempting to auto-reconnect to the server, the function returns false.
 	IsConnected() bool
@@ -121,21 +139,50 @@ type Client interface {
 	SetHeaderValue(key string, value string)
 }
 
+// Endpoint describes a server, which the client may connect to. See StartWithEndpoints.
+type Endpoint struct {
+	// The URL of the server, e.g. "wss://csms.example.com/ocpp/CS001".
+	URL string
+	// Optional TLS configuration for the endpoint. If nil, the TLS configuration of the client is used.
+	TLSConfig *tls.Config
+	// Optional basic authentication credentials for the endpoint.
+	// If Username is empty, the credentials set on the client are used (see SetBasicAuth).
+	Username string
+	Password string
+	// Number of consecutive failed connection attempts, after which the client falls back to the next endpoint.
+	// Values lower than 1 are treated as 1.
+	ConnectionAttempts int
+}
+
+func (e Endpoint) connectionAttempts() int {
+	if e.ConnectionAttempts < 1 {
+		return 1
+	}
+	return e.ConnectionAttempts
+}
+
 // client is the default implementation of a Websocket client.
 //
 // Use the NewClient function to create a new client.
 type client struct {
 	logger         logging.Logger
 	webSocket      *webSocket
-	url            url.URL
+	endpoints      []Endpoint
+	endpointIndex  int // index of the endpoint currently in use
+	failedAttempts int // consecutive failed connection attempts to the endpoint currently in use
 	messageHandler func(data []byte) error
 	dialOptions    []func(*websocket.Dialer)
 	header         http.Header
 	timeoutConfig  ClientTimeoutConfig
 	onDisconnected func(err error)
 	onReconnected  func()
+	onEndpoint     func(endpoint Endpoint, index int)
 	errC           chan error
 	reconnectC     chan struct{} // used for signaling, that a reconnection attempt should be interrupted
+	backoff        BackoffStrategy
+	maxAttempts    int // maximum number of reconnection attempts, unlimited if zero
+	retryable      RetryClassifier
+	tracer         trace.Tracer
 }
 
 // ClientOpt is a function that can be used to set options on a client during creation.
@@ -161,6 +208,94 @@ func WithClientCompression(enable bool) ClientOpt {
 	}
 }
 
+// proxyURL builds the URL of a proxy with the given scheme, address and optional credentials.
+func proxyURL(scheme string, proxyAddr string, username string, password string) *url.URL {
+	u := &url.URL{Scheme: scheme, Host: proxyAddr}
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	return u
+}
+
+// WithClientHTTPProxy connects the client to the server through an HTTP proxy, using the CONNECT method.
+// The proxyAddr is the host:port of the proxy.
+//
+// If a username is passed, the credentials are sent to the proxy via the Proxy-Authorization header,
+// using basic authentication.
+func WithClientHTTPProxy(proxyAddr string, username string, password string) ClientOpt {
+	return func(c *client) {
+		u := proxyURL("http", proxyAddr, username, password)
+		c.dialOptions = append(c.dialOptions, func(dialer *websocket.Dialer) {
+			dialer.Proxy = http.ProxyURL(u)
+		})
+	}
+}
+
+// WithClientSOCKS5Proxy connects the client to the server through a SOCKS5 proxy.
+// The proxyAddr is the host:port of the proxy.
+//
+// If a username is passed, the client authenticates to the proxy using the username/password method.
+func WithClientSOCKS5Proxy(proxyAddr string, username string, password string) ClientOpt {
+	return func(c *client) {
+		u := proxyURL("socks5", proxyAddr, username, password)
+		c.dialOptions = append(c.dialOptions, func(dialer *websocket.Dialer) {
+			dialer.Proxy = http.ProxyURL(u)
+		})
+	}
+}
+
+// WithClientProxyFromEnvironment connects the client to the server through the proxy configured
+// via the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables (or the lowercase versions thereof).
+// See http.ProxyFromEnvironment for details.
+//
+// HTTPS_PROXY is used for wss URLs, HTTP_PROXY for ws URLs. Both HTTP CONNECT and SOCKS5 proxy URLs are supported.
+func WithClientProxyFromEnvironment() ClientOpt {
+	return func(c *client) {
+		c.dialOptions = append(c.dialOptions, func(dialer *websocket.Dialer) {
+			dialer.Proxy = http.ProxyFromEnvironment
+		})
+	}
+}
+
+// WithClientBackoff sets the strategy used for delaying automatic reconnection attempts.
+// If not set, an OCPPBackoff is created from the RetryBackOff* fields of the timeout configuration.
+func WithClientBackoff(strategy BackoffStrategy) ClientOpt {
+	return func(c *client) {
+		c.backoff = strategy
+	}
+}
+
+// WithClientMaxReconnectAttempts sets the maximum number of consecutive reconnection attempts.
+// Once reached, the client stops reconnecting and reports a ReconnectionStoppedError via the Errors channel.
+//
+// By default, or if attempts is lower than 1, the client keeps reconnecting until it is stopped.
+func WithClientMaxReconnectAttempts(attempts int) ClientOpt {
+	return func(c *client) {
+		c.maxAttempts = attempts
+	}
+}
+
+// WithClientRetryClassifier sets the classifier, which decides whether the client keeps reconnecting after a failed attempt.
+// If the classifier returns false, the client stops reconnecting and reports a ReconnectionStoppedError via the Errors channel.
+//
+// By default, all errors are retryable. See FatalHTTPStatusCodes for stopping on specific HTTP responses of the server.
+func WithClientRetryClassifier(classifier RetryClassifier) ClientOpt {
+	return func(c *client) {
+		if classifier == nil {
+			classifier = RetryAll
+		}
+		c.retryable = classifier
+	}
+}
+
+// WithClientTracerProvider sets the tracer provider for client traces.
+// A span is created for every websocket connection, which is accessible via the SpanContextProvider interface of the client.
+func WithClientTracerProvider(tracerProvider trace.TracerProvider) ClientOpt {
+	return func(c *client) {
+		c.tracer = newTracer(tracerProvider)
+	}
+}
+
 // WithClientLogger sets the logger for the client.
 // If not set, a VoidLogger will be used.
 func WithClientLogger(logger logging.Logger) ClientOpt {
@@ -205,6 +340,8 @@ func NewClient(opts ...ClientOpt) Client {
 		timeoutConfig: NewClientTimeoutConfig(),
 		reconnectC:    make(chan struct{}, 1),
 		header:        http.Header{},
+		tracer:        newTracer(nil),
+		retryable:     RetryAll,
 	}
 	for _, o := range opts {
 		o(c)
@@ -228,6 +365,10 @@ func (c *client) SetReconnectedHandler(handler func()) {
 	c.onReconnected = handler
 }
 
+func (c *client) SetActiveEndpointHandler(handler func(endpoint Endpoint, index int)) {
+	c.onEndpoint = handler
+}
+
 func (c *client) AddOption(option interface{}) {
 	dialOption, ok := option.(func(*websocket.Dialer))
 	if ok {
@@ -252,7 +393,12 @@ func (c *client) SetRequestedSubProtocol(subProto string) {
 }
 
 func (c *client) SetBasicAuth(username string, password string) {
-	c.header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":"+password)))
+	c.header.Set("Authorization", basicAuthValue(username, password))
+}
+
+// basicAuthValue encodes credentials for the Authorization header, using basic authentication.
+func basicAuthValue(username string, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
 }
 
 func (c *client) SetHeaderValue(key string, value string) {
@@ -266,12 +412,42 @@ func (c *client) getReadTimeout() time.Time {
 	return time.Now().Add(c.timeoutConfig.PongWait)
 }
 
+// backoffStrategy returns the strategy for delaying reconnection attempts.
+func (c *client) backoffStrategy() BackoffStrategy {
+	if c.backoff != nil {
+		return c.backoff
+	}
+	return NewOCPPBackoff(c.timeoutConfig)
+}
+
+// reconnectionStopped reports that the client gave up reconnecting to the server.
+func (c *client) reconnectionStopped(attempts int, err error) {
+	c.logger.Infof("stopped reconnecting after %d attempts", attempts)
+	c.error(ReconnectionStoppedError{Attempts: attempts, Err: err})
+}
+
+// connectionFailed records a failed connection attempt to the current endpoint.
+// Returns true, if the client fell back to the next endpoint.
+func (c *client) connectionFailed() bool {
+	c.failedAttempts++
+	if len(c.endpoints) < 2 || c.failedAttempts < c.endpoints[c.endpointIndex].connectionAttempts() {
+		return false
+	}
+	c.failedAttempts = 0
+	c.endpointIndex = (c.endpointIndex + 1) % len(c.endpoints)
+	c.logger.Infof("falling back to endpoint %d", c.endpointIndex)
+	return true
+}
+
 func (c *client) handleReconnection() {
 	c.logger.Info("started automatic reconnection handler")
-	delay := c.timeoutConfig.RetryBackOffWaitMinimum + time.Duration(rand.Intn(c.timeoutConfig.RetryBackOffRandomRange+1))*time.Second
-	reconnectionAttempts := 1
-	for {
+	backoff := c.backoffStrategy()
+	backoffAttempt := 1
+	var delay time.Duration
+	var err error
+	for reconnectionAttempts := 1; c.maxAttempts <= 0 || reconnectionAttempts <= c.maxAttempts; reconnectionAttempts++ {
 		// Wait before reconnecting
+		delay = backoff.NextDelay(backoffAttempt, delay)
 		select {
 		case <-time.After(delay):
 		case <-c.reconnectC:
@@ -280,7 +456,7 @@ func (c *client) handleReconnection() {
 		}
 
 		c.logger.Info("reconnecting... attempt", reconnectionAttempts)
-		err := c.Start(c.url.String())
+		err = c.connect()
 		if err == nil {
 			// Re-connection was successful
 			c.logger.Info("reconnected successfully to server")
@@ -290,14 +466,20 @@ func (c *client) handleReconnection() {
 			return
 		}
 		c.error(fmt.Errorf("reconnection failed: %w", err))
+		if !c.retryable(err) {
+			c.reconnectionStopped(reconnectionAttempts, err)
+			return
+		}
 
-		if reconnectionAttempts < c.timeoutConfig.RetryBackOffRepeatTimes {
-			// Re-connection failed, double the delay
-			delay *= 2
-			delay += time.Duration(rand.Intn(c.timeoutConfig.RetryBackOffRandomRange+1)) * time.Second
+		if c.connectionFailed() {
+			// Fell back to the next endpoint, reset the backoff
+			backoffAttempt = 1
+			delay = 0
+		} else {
+			backoffAttempt++
 		}
-		reconnectionAttempts += 1
 	}
+	c.reconnectionStopped(c.maxAttempts, err)
 }
 
 func (c *client) IsConnected() bool {
@@ -307,6 +489,14 @@ func (c *client) IsConnected() bool {
 	return c.webSocket.IsConnected()
 }
 
+// Returns the span context of the current connection. The span context is invalid, if the client isn't connected.
+func (c *client) SpanContext() trace.SpanContext {
+	if c.webSocket == nil || !c.webSocket.IsConnected() {
+		return trace.SpanContext{}
+	}
+	return c.webSocket.SpanContext()
+}
+
 func (c *client) Write(data []byte) error {
 	if !c.IsConnected() {
 		return fmt.Errorf("client is currently not connected, cannot send data")
@@ -316,19 +506,51 @@ func (c *client) Write(data []byte) error {
 }
 
 func (c *client) StartWithRetries(urlStr string) {
-	err := c.Start(urlStr)
+	c.setEndpoints([]Endpoint{{URL: urlStr}})
+	c.startWithRetries()
+}
+
+func (c *client) StartWithEndpoints(endpoints []Endpoint) {
+	if len(endpoints) == 0 {
+		c.error(fmt.Errorf("no endpoints to connect to"))
+		return
+	}
+	c.setEndpoints(endpoints)
+	c.startWithRetries()
+}
+
+func (c *client) startWithRetries() {
+	err := c.connect()
 	if err != nil {
 		c.logger.Info("Connection error:", err)
+		if !c.retryable(err) {
+			c.reconnectionStopped(0, err)
+			return
+		}
+		c.connectionFailed()
 		c.handleReconnection()
 	}
 }
 
+func (c *client) setEndpoints(endpoints []Endpoint) {
+	c.endpoints = append([]Endpoint{}, endpoints...)
+	c.endpointIndex = 0
+	c.failedAttempts = 0
+}
+
 func (c *client) Start(urlStr string) error {
+	c.setEndpoints([]Endpoint{{URL: urlStr}})
+	return c.connect()
+}
+
+// connect attempts to connect to the current endpoint.
+func (c *client) connect() error {
+	endpoint := c.endpoints[c.endpointIndex]
+	urlStr := endpoint.URL
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		return err
 	}
-	c.url = *u
 	if c.reconnectC == nil {
 		c.reconnectC = make(chan struct{}, 1)
 	}
@@ -342,9 +564,17 @@ func (c *client) Start(urlStr string) error {
 	for _, option := range c.dialOptions {
 		option(&dialer)
 	}
+	if endpoint.TLSConfig != nil {
+		dialer.TLSClientConfig = endpoint.TLSConfig
+	}
+	header := c.header
+	if endpoint.Username != "" {
+		header = c.header.Clone()
+		header.Set("Authorization", basicAuthValue(endpoint.Username, endpoint.Password))
+	}
 	// Connect
 	c.logger.Info("connecting to server")
-	ws, resp, err := dialer.Dial(urlStr, c.header)
+	ws, resp, err := dialer.Dial(urlStr, header)
 	if err != nil {
 		if resp != nil {
 			httpError := HttpConnectionError{Message: err.Error(), HttpStatus: resp.Status, HttpCode: resp.StatusCode}
@@ -384,9 +614,15 @@ func (c *client) Start(urlStr string) error {
 		return fmt.Errorf("failed to create websocket channel: %w", err)
 	}
 
+	c.webSocket.header = resp.Header
+	c.webSocket.span = startConnectionSpan(context.Background(), c.tracer, trace.SpanKindClient, id, ws.RemoteAddr().String(), ws.Subprotocol())
 	c.logger.Infof("connected to server as %s", id)
+	c.failedAttempts = 0
 	// Start reader and write routine
 	c.webSocket.run()
+	if c.onEndpoint != nil {
+		c.onEndpoint(endpoint, c.endpointIndex)
+	}
 	return nil
 }
 
@@ -0,0 +1,131 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EventType identifies a connection lifecycle event of a server.
+type EventType int
+
+const (
+	// A client connected.
+	ConnectedEvent EventType = iota
+	// A client disconnected. The event contains the close code and reason of the connection.
+	DisconnectedEvent
+	// A connection timed out, since no ping or pong was received from the client in time.
+	// The event is followed by a DisconnectedEvent.
+	PingTimeoutEvent
+	// A connection was rejected by the basic authentication or by the CheckClientHandler of the server.
+	AuthRejectedEvent
+	// A connection was rejected, since another client with the same ID is connected already.
+	DuplicateRejectedEvent
+)
+
+func (t EventType) String() string {
+	switch t {
+	case ConnectedEvent:
+		return "connected"
+	case DisconnectedEvent:
+		return "disconnected"
+	case PingTimeoutEvent:
+		return "ping timeout"
+	case AuthRejectedEvent:
+		return "auth rejected"
+	case DuplicateRejectedEvent:
+		return "duplicate rejected"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event describes a connection lifecycle event of a server.
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	ClientID string
+	// The channel of the connection. Nil for rejected connections.
+	Channel Channel
+	// The address of the client.
+	RemoteAddr net.Addr
+	// The close code of the connection. Only set for DisconnectedEvent.
+	CloseCode int
+	// The close reason of a disconnected connection, or the reason a connection was rejected.
+	Reason string
+}
+
+// EventSource is implemented by servers, which publish the connection lifecycle events of their clients.
+type EventSource interface {
+	// SubscribeEvents returns a channel, which receives the connection lifecycle events of the server,
+	// along with a function for cancelling the subscription. The channel is closed once the subscription is cancelled.
+	//
+	// Events are buffered up to bufferSize. The server never blocks on subscribers:
+	// if the buffer of a subscriber is full, further events are dropped for that subscriber.
+	SubscribeEvents(bufferSize int) (<-chan Event, func())
+}
+
+// eventBus delivers events to any number of subscribers.
+// Events are never blocking: if the buffer of a subscriber is full, the event is dropped for that subscriber.
+type eventBus struct {
+	mutex       sync.RWMutex
+	subscribers map[chan Event]struct{}
+}
+
+func (b *eventBus) subscribe(bufferSize int) (<-chan Event, func()) {
+	eventC := make(chan Event, max(bufferSize, 0))
+	b.mutex.Lock()
+	if b.subscribers == nil {
+		b.subscribers = map[chan Event]struct{}{}
+	}
+	b.subscribers[eventC] = struct{}{}
+	b.mutex.Unlock()
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mutex.Lock()
+			delete(b.subscribers, eventC)
+			close(eventC)
+			b.mutex.Unlock()
+		})
+	}
+	return eventC, unsubscribe
+}
+
+func (b *eventBus) publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	for eventC := range b.subscribers {
+		select {
+		case eventC <- event:
+		default:
+		}
+	}
+}
+
+// isTimeout returns true if a connection was closed, because a read or write deadline expired.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// closeDetails returns the close code and reason of a connection, which was closed with the given error.
+func closeDetails(w Channel, err error) (int, string) {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return closeErr.Code, closeErr.Text
+	}
+	if err != nil {
+		return websocket.CloseAbnormalClosure, err.Error()
+	}
+	if ws, ok := w.(*webSocket); ok && ws.closeError != nil {
+		return ws.closeError.Code, ws.closeError.Text
+	}
+	return websocket.CloseNormalClosure, ""
+}
@@ -15,8 +15,11 @@ const (
 	chargePointsConnectedMetric = "websocket_charge_points_connected"
 	messageRateMetric           = "websocket_message_rate"
 	pingPongDurationMetric      = "websocket_ping_pong_duration"
+	limitViolationsMetric       = "websocket_limit_violations"
 	attributeChargePointId      = "charge_point_id"
 	attributeDirection          = "direction"
+	attributeViolation          = "violation"
+	attributeAction             = "action"
 )
 
 const (
@@ -30,6 +33,7 @@ type serverMetrics struct {
 	chargePointsConnectedMetric metric.Int64ObservableGauge
 	pingPongDurationMetric      metric.Float64Histogram
 	messageRate                 metric.Int64Histogram
+	limitViolations             metric.Int64Counter
 }
 
 func newServerMetrics(meterProvider metric.MeterProvider) (*serverMetrics, error) {
@@ -65,6 +69,14 @@ func newServerMetrics(meterProvider metric.MeterProvider) (*serverMetrics, error
 		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", pingPongDurationMetric))
 	}
 
+	m.limitViolations, err = meter.Int64Counter(
+		limitViolationsMetric,
+		metric.WithDescription("Number of inbound limit violations"),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("failed to create %s metric", limitViolationsMetric))
+	}
+
 	m.chargePointsConnectedMetric = chargePointsConnected
 	m.messageRate = messageRate
 
@@ -98,3 +110,12 @@ func (m *serverMetrics) RecordPingPongDuration(ctx context.Context, duration tim
 	)
 	m.pingPongDurationMetric.Record(ctx, duration.Seconds(), attributes)
 }
+
+func (m *serverMetrics) RecordLimitViolation(chargePointId string, violation LimitViolation, action RateLimitAction) {
+	attributes := metric.WithAttributes(
+		attribute.String(attributeChargePointId, chargePointId),
+		attribute.String(attributeViolation, string(violation)),
+		attribute.String(attributeAction, action.String()),
+	)
+	m.limitViolations.Add(context.Background(), 1, attributes)
+}
@@ -0,0 +1,392 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// SubProtocolProvider is implemented by channels, which expose the subprotocol negotiated during the websocket handshake.
+type SubProtocolProvider interface {
+	// SubProtocol returns the negotiated subprotocol, or an empty string if none was negotiated.
+	SubProtocol() string
+}
+
+// subProtocolOf returns the subprotocol negotiated by a channel, if the channel exposes it.
+func subProtocolOf(channel Channel) string {
+	if provider, ok := channel.(SubProtocolProvider); ok {
+		return provider.SubProtocol()
+	}
+	return ""
+}
+
+// ProtocolRouter lets a single websocket server accept clients speaking different subprotocols,
+// e.g. OCPP 1.6 and OCPP 2.0.1 charge points connecting to the same URL.
+//
+// Each route is a Server on its own, which only sees the channels that negotiated one of its subprotocols.
+// Routes may therefore be passed to separate OCPP-J endpoints:
+//
+//	wsServer := ws.NewServer()
+//	router := ws.NewProtocolRouter(wsServer)
+//	centralSystem, _ := ocpp16.NewCentralSystem(nil, router.Route("ocpp1.6"), nil)
+//	csms, _ := ocpp2.NewCSMS(nil, router.Route("ocpp2.0.1"), nil)
+//	_, _ = centralSystem.Handler()
+//	_, _ = csms.Handler()
+//	wsServer.Start(8887, "/{ws}")
+//
+// The subprotocol is negotiated per connection, following the preference order of the client.
+// All routes share the connection registry of the underlying server, hence client IDs are unique across subprotocols.
+//
+// The router takes over all handlers of the underlying server, which must not be changed afterward.
+// Handlers and hooks that aren't specific to a subprotocol (timeouts, authentication, charge point ID resolution)
+// are shared by all routes, and may be set on the underlying server or on any route.
+type ProtocolRouter struct {
+	server  Server
+	mutex   sync.RWMutex
+	routes  map[string]*protocolRoute
+	clients map[string]*routedClient
+}
+
+type routedClient struct {
+	channel Channel
+	route   *protocolRoute
+	closedC chan struct{} // closed once the channel was disconnected.
+}
+
+// NewProtocolRouter creates a router on top of a websocket server.
+func NewProtocolRouter(server Server) *ProtocolRouter {
+	r := &ProtocolRouter{
+		server:  server,
+		routes:  map[string]*protocolRoute{},
+		clients: map[string]*routedClient{},
+	}
+	server.SetCheckClientHandler(r.checkClient)
+	server.SetNewClientHandler(r.onConnected)
+	server.SetDisconnectedClientHandler(r.onDisconnected)
+	server.SetMessageHandler(r.onMessage)
+	if replacer, ok := server.(ConnectionReplacer); ok {
+		replacer.SetReplacedClientHandler(r.onReplaced)
+	}
+	if notifier, ok := server.(RateLimitedMessageNotifier); ok {
+		notifier.SetRateLimitedMessageHandler(r.onRateLimited)
+	}
+	return r
+}
+
+// Route creates a new route for the given subprotocols. More subprotocols may be added via AddSupportedSubprotocol.
+//
+// A subprotocol is routed to the first route it was added to. Adding it to further routes has no effect.
+//
+// Calling Start or Serve on a route starts the underlying server, so only one route should be started that way.
+// Serve and ServeHTTP require the underlying server to implement ListenerServer and http.Handler respectively.
+// Endpoints using the other routes may be set up without listening, e.g. via ocppj.Server.Handler.
+// Stop, StopAccepting and Shutdown only affect the channels of the route, while the underlying server keeps running.
+func (r *ProtocolRouter) Route(subProtocols ...string) Server {
+	route := &protocolRoute{router: r}
+	for _, subProto := range subProtocols {
+		route.AddSupportedSubprotocol(subProto)
+	}
+	return route
+}
+
+// SubProtocol returns the subprotocol negotiated by a connected client.
+// Returns false, if no client with the given ID is connected.
+func (r *ProtocolRouter) SubProtocol(clientID string) (string, bool) {
+	channel, ok := r.server.GetChannel(clientID)
+	if !ok {
+		return "", false
+	}
+	return subProtocolOf(channel), true
+}
+
+func (r *ProtocolRouter) addSubProtocol(route *protocolRoute, subProto string) {
+	r.mutex.Lock()
+	if _, exists := r.routes[subProto]; !exists {
+		r.routes[subProto] = route
+	}
+	r.mutex.Unlock()
+	r.server.AddSupportedSubprotocol(subProto)
+}
+
+// negotiate returns the route of the first subprotocol requested by a client, which is supported by any route.
+// This matches the subprotocol negotiated by the underlying server.
+func (r *ProtocolRouter) negotiate(req *http.Request) *protocolRoute {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, subProto := range websocket.Subprotocols(req) {
+		if route, ok := r.routes[subProto]; ok {
+			return route
+		}
+	}
+	return nil
+}
+
+func (r *ProtocolRouter) routeOf(channel Channel) *protocolRoute {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.routes[subProtocolOf(channel)]
+}
+
+func (r *ProtocolRouter) register(channel Channel, route *protocolRoute) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.clients[channel.ID()] = &routedClient{channel: channel, route: route, closedC: make(chan struct{})}
+}
+
+func (r *ProtocolRouter) unregister(channel Channel) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	client, ok := r.clients[channel.ID()]
+	if !ok || client.channel != channel {
+		return
+	}
+	delete(r.clients, channel.ID())
+	close(client.closedC)
+}
+
+// routeClients returns the clients currently connected to a route.
+func (r *ProtocolRouter) routeClients(route *protocolRoute) []*routedClient {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	var clients []*routedClient
+	for _, client := range r.clients {
+		if client.route == route {
+			clients = append(clients, client)
+		}
+	}
+	return clients
+}
+
+// --------- Internal callbacks server -> router ---------
+
+func (r *ProtocolRouter) checkClient(id string, req *http.Request) bool {
+	route := r.negotiate(req)
+	if route == nil {
+		// No supported subprotocol was requested, the underlying server will reject the connection
+		return true
+	}
+	return route.checkClient(id, req)
+}
+
+func (r *ProtocolRouter) onConnected(channel Channel) {
+	route := r.routeOf(channel)
+	if route == nil {
+		// The subprotocol was added to the underlying server directly
+		_ = r.server.StopConnection(channel.ID(), websocket.CloseError{Code: websocket.CloseProtocolError, Text: "invalid or unsupported subprotocol"})
+		return
+	}
+	r.register(channel, route)
+	if route.newClientHandler != nil {
+		route.newClientHandler(channel)
+	}
+}
+
+func (r *ProtocolRouter) onDisconnected(channel Channel) {
+	r.unregister(channel)
+	if route := r.routeOf(channel); route != nil && route.disconnectedHandler != nil {
+		route.disconnectedHandler(channel)
+	}
+}
+
+func (r *ProtocolRouter) onReplaced(old Channel, new Channel) {
+	oldRoute := r.routeOf(old)
+	newRoute := r.routeOf(new)
+	if oldRoute != nil && oldRoute == newRoute && oldRoute.replacedHandler != nil {
+		r.unregister(old)
+		r.register(new, newRoute)
+		newRoute.replacedHandler(old, new)
+		return
+	}
+	// The client switched to another subprotocol, or the route isn't interested in replacements
+	r.onDisconnected(old)
+	r.onConnected(new)
+}
+
+func (r *ProtocolRouter) onMessage(channel Channel, data []byte) error {
+	route := r.routeOf(channel)
+	if route == nil || route.messageHandler == nil {
+		return fmt.Errorf("no message handler set for subprotocol %v", subProtocolOf(channel))
+	}
+	return route.messageHandler(channel, data)
+}
+
+func (r *ProtocolRouter) onRateLimited(channel Channel, data []byte) error {
+	route := r.routeOf(channel)
+	if route == nil || route.rateLimitedHandler == nil {
+		return nil
+	}
+	return route.rateLimitedHandler(channel, data)
+}
+
+// shutdownCloseError returns the close error, with which a server closes connections when shutting down.
+func shutdownCloseError(s Server) websocket.CloseError {
+	if srv, ok := s.(*server); ok {
+		return srv.shutdownError
+	}
+	return defaultShutdownCloseError
+}
+
+// protocolRoute is the Server implementation returned by ProtocolRouter.Route.
+type protocolRoute struct {
+	router              *ProtocolRouter
+	messageHandler      MessageHandler
+	checkClientHandler  CheckClientHandler
+	newClientHandler    ConnectedHandler
+	disconnectedHandler func(ws Channel)
+	replacedHandler     ReplacedHandler
+	rateLimitedHandler  MessageHandler
+	draining            atomic.Bool
+}
+
+func (route *protocolRoute) Start(port int, listenPath string) {
+	route.draining.Store(false)
+	route.router.server.Start(port, listenPath)
+}
+
+func (route *protocolRoute) Serve(listener net.Listener, listenPath string) error {
+	listenerServer, ok := route.router.server.(ListenerServer)
+	if !ok {
+		return fmt.Errorf("websocket server %T doesn't support serving on a listener", route.router.server)
+	}
+	route.draining.Store(false)
+	return listenerServer.Serve(listener, listenPath)
+}
+
+func (route *protocolRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	handler, ok := route.router.server.(http.Handler)
+	if !ok {
+		http.Error(w, "websocket server doesn't support serving HTTP requests", http.StatusNotImplemented)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+func (route *protocolRoute) Stop() {
+	route.closeConnections(websocket.CloseError{Code: websocket.CloseNormalClosure, Text: ""})
+}
+
+func (route *protocolRoute) StopAccepting() {
+	route.draining.Store(true)
+}
+
+func (route *protocolRoute) Shutdown(ctx context.Context) error {
+	route.StopAccepting()
+	clients := route.closeConnections(shutdownCloseError(route.router.server))
+	for _, client := range clients {
+		select {
+		case <-client.closedC:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// closeConnections closes all channels of the route and returns the respective clients.
+func (route *protocolRoute) closeConnections(closeError websocket.CloseError) []*routedClient {
+	clients := route.router.routeClients(route)
+	for _, client := range clients {
+		// The connection may be closing already
+		_ = route.router.server.StopConnection(client.channel.ID(), closeError)
+	}
+	return clients
+}
+
+func (route *protocolRoute) StopConnection(id string, closeError websocket.CloseError) error {
+	if _, ok := route.GetChannel(id); !ok {
+		return fmt.Errorf("couldn't stop websocket connection. No connection with id %s is open", id)
+	}
+	return route.router.server.StopConnection(id, closeError)
+}
+
+func (route *protocolRoute) Errors() <-chan error {
+	return route.router.server.Errors()
+}
+
+// SubscribeEvents subscribes to the events of the underlying server, including events of other routes.
+// If the underlying server doesn't implement EventSource, the subscription never receives any events.
+func (route *protocolRoute) SubscribeEvents(bufferSize int) (<-chan Event, func()) {
+	source, ok := route.router.server.(EventSource)
+	if !ok {
+		return new(eventBus).subscribe(bufferSize)
+	}
+	return source.SubscribeEvents(bufferSize)
+}
+
+func (route *protocolRoute) SetMessageHandler(handler MessageHandler) {
+	route.messageHandler = handler
+}
+
+func (route *protocolRoute) SetNewClientHandler(handler ConnectedHandler) {
+	route.newClientHandler = handler
+}
+
+func (route *protocolRoute) SetDisconnectedClientHandler(handler func(ws Channel)) {
+	route.disconnectedHandler = handler
+}
+
+func (route *protocolRoute) SetReplacedClientHandler(handler ReplacedHandler) {
+	route.replacedHandler = handler
+}
+
+func (route *protocolRoute) SetRateLimitedMessageHandler(handler MessageHandler) {
+	route.rateLimitedHandler = handler
+}
+
+func (route *protocolRoute) SetCheckClientHandler(handler CheckClientHandler) {
+	route.checkClientHandler = handler
+}
+
+func (route *protocolRoute) checkClient(id string, r *http.Request) bool {
+	if route.draining.Load() {
+		return false
+	}
+	if route.checkClientHandler == nil {
+		return true
+	}
+	return route.checkClientHandler(id, r)
+}
+
+func (route *protocolRoute) SetTimeoutConfig(config ServerTimeoutConfig) {
+	route.router.server.SetTimeoutConfig(config)
+}
+
+func (route *protocolRoute) Write(webSocketId string, data []byte) error {
+	if _, ok := route.GetChannel(webSocketId); !ok {
+		return fmt.Errorf("couldn't write to websocket. No socket with id %v is open", webSocketId)
+	}
+	return route.router.server.Write(webSocketId, data)
+}
+
+func (route *protocolRoute) AddSupportedSubprotocol(subProto string) {
+	route.router.addSubProtocol(route, subProto)
+}
+
+func (route *protocolRoute) SetChargePointIdResolver(resolver func(r *http.Request) (string, error)) {
+	route.router.server.SetChargePointIdResolver(resolver)
+}
+
+func (route *protocolRoute) SetBasicAuthHandler(handler func(username string, password string) bool) {
+	route.router.server.SetBasicAuthHandler(handler)
+}
+
+func (route *protocolRoute) SetCheckOriginHandler(handler func(r *http.Request) bool) {
+	route.router.server.SetCheckOriginHandler(handler)
+}
+
+func (route *protocolRoute) Addr() *net.TCPAddr {
+	return route.router.server.Addr()
+}
+
+func (route *protocolRoute) GetChannel(websocketId string) (Channel, bool) {
+	channel, ok := route.router.server.GetChannel(websocketId)
+	if !ok || route.router.routeOf(channel) != route {
+		return nil, false
+	}
+	return channel, true
+}
@@ -0,0 +1,161 @@
+package ws
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// RateLimitAction defines how the server handles an inbound message, which exceeds the rate limit of a connection.
+type RateLimitAction int
+
+const (
+	// DropMessage discards the message. This is the default action.
+	DropMessage RateLimitAction = iota
+	// RejectMessage discards the message and passes it to the rate-limited message handler of the upper layer
+	// (see RateLimitedMessageNotifier), which may reply with an error, e.g. an OCPP CallError.
+	RejectMessage
+	// CloseConnection closes the connection with a ClosePolicyViolation.
+	CloseConnection
+)
+
+func (a RateLimitAction) String() string {
+	switch a {
+	case DropMessage:
+		return "drop"
+	case RejectMessage:
+		return "reject"
+	case CloseConnection:
+		return "close"
+	}
+	return fmt.Sprintf("RateLimitAction(%d)", int(a))
+}
+
+// RateLimitConfig contains the inbound rate limit applied to each connection of a server.
+//
+// Messages are limited using a token bucket per connection: the bucket holds up to Burst tokens
+// and is refilled with MessagesPerSecond tokens per second. Every inbound message consumes a token.
+type RateLimitConfig struct {
+	// The sustained number of messages per second, each client is allowed to send. If zero, messages aren't limited.
+	MessagesPerSecond float64
+	// The maximum number of messages, a client may send in a burst. Defaults to MessagesPerSecond, rounded up.
+	Burst int
+	// The action to perform on messages exceeding the limit.
+	Action RateLimitAction
+}
+
+// WithRateLimit limits the rate of inbound messages on each connection of the server.
+//
+// Every violation is recorded by the server metrics and reported via the Errors channel as a LimitViolationError.
+func WithRateLimit(config RateLimitConfig) ServerOpt {
+	return func(s *server) {
+		s.rateLimit = config
+	}
+}
+
+// WithMaxMessageSize sets the maximum size in bytes of inbound messages on each connection of the server.
+//
+// If a client sends a larger message, the connection is closed with a CloseMessageTooBig.
+// Every violation is recorded by the server metrics and reported via the Errors channel as a LimitViolationError.
+func WithMaxMessageSize(size int64) ServerOpt {
+	return func(s *server) {
+		s.maxMessageSize = size
+	}
+}
+
+// RateLimitedMessageNotifier is implemented by servers, which support rejecting rate-limited messages.
+//
+// Upper layers may use it to reply to messages rejected with the RejectMessage action.
+type RateLimitedMessageNotifier interface {
+	// SetRateLimitedMessageHandler sets a callback function, invoked for every inbound message rejected by the rate limiter.
+	// The callback is invoked on the read routine of the connection, so it MUST return as soon as possible.
+	SetRateLimitedMessageHandler(handler MessageHandler)
+}
+
+// LimitViolation identifies an inbound limit of a connection.
+type LimitViolation string
+
+const (
+	// RateLimitViolation means a client exceeded the message rate limit (see WithRateLimit).
+	RateLimitViolation LimitViolation = "rate_limit"
+	// MessageSizeViolation means a client sent a message exceeding the maximum message size (see WithMaxMessageSize).
+	MessageSizeViolation LimitViolation = "message_size"
+)
+
+// LimitViolationError is reported via the Errors channel of a server, whenever a client violates an inbound limit.
+type LimitViolationError struct {
+	ClientID  string
+	Violation LimitViolation
+	Action    RateLimitAction
+}
+
+func (e LimitViolationError) Error() string {
+	return fmt.Sprintf("client %s violated %s limit, action: %v", e.ClientID, e.Violation, e.Action)
+}
+
+// tokenBucket implements the rate limit of a single connection.
+// It is only accessed by the read routine of the connection, hence it isn't synchronized.
+type tokenBucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	closing bool // set once the connection is being closed due to a violation.
+}
+
+// newTokenBucket creates a full token bucket for the given configuration.
+// Returns nil if no rate limit is configured.
+func newTokenBucket(config RateLimitConfig) *tokenBucket {
+	if config.MessagesPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(config.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(config.MessagesPerSecond)
+	}
+	return &tokenBucket{
+		rate:   config.MessagesPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// allow consumes a token, if available.
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// rateLimitExceeded handles an inbound message exceeding the rate limit of a connection,
+// and returns the error to report.
+func (s *server) rateLimitExceeded(w *webSocket, data []byte) error {
+	if w.limiter.closing {
+		// Messages received while the connection is being closed are dropped
+		return nil
+	}
+	action := s.rateLimit.Action
+	s.metrics.RecordLimitViolation(w.ID(), RateLimitViolation, action)
+	switch action {
+	case RejectMessage:
+		if s.rateLimitedHandler != nil {
+			if err := s.rateLimitedHandler(w, data); err != nil {
+				s.logger.Errorf("failed to reject rate-limited message from %s: %v", w.ID(), err)
+			}
+		}
+	case CloseConnection:
+		w.limiter.closing = true
+		err := w.Close(websocket.CloseError{Code: websocket.ClosePolicyViolation, Text: "rate limit exceeded"})
+		if err != nil {
+			s.logger.Debugf("connection for %s is already closing: %v", w.ID(), err)
+		}
+	}
+	return LimitViolationError{ClientID: w.ID(), Violation: RateLimitViolation, Action: action}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -16,6 +17,7 @@ import (
 	"github.com/xBlaz3kx/ocpp-go/logging"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ---------------------- SERVER ----------------------
@@ -47,6 +49,8 @@ type CheckClientHandler func(id string, r *http.Request) bool
 // If you need to set a specific timeout configuration, refer to the SetTimeoutConfig method.
 //
 // Using Start and Stop you can respectively start and stop listening for incoming client websocket connections.
+// Servers may also accept connections on an existing listener (see ListenerServer),
+// or be mounted on an existing HTTP server, by implementing http.Handler.
 //
 // To be notified of new and terminated connections,
 // refer to SetNewClientHandler and SetDisconnectedClientHandler functions.
@@ -145,14 +149,26 @@ type server struct {
 	tlsCertificatePath    string
 	tlsCertificateKey     string
 	// enableCompression is used to enable or disable compression for the websocket connections.
-	enableCompression bool
-	timeoutConfig     ServerTimeoutConfig
-	upgrader          websocket.Upgrader
-	errC              chan error
-	connMutex         sync.RWMutex
-	addr              *net.TCPAddr
-	httpHandler       *mux.Router
-	metrics           *serverMetrics
+	enableCompression  bool
+	timeoutConfig      ServerTimeoutConfig
+	upgrader           websocket.Upgrader
+	errC               chan error
+	connMutex          sync.RWMutex
+	addr               *net.TCPAddr
+	httpHandler        *mux.Router
+	metrics            *serverMetrics
+	tracer             trace.Tracer
+	duplicateHandler   DuplicateConnectionHandler
+	replacedHandler    ReplacedHandler
+	draining           atomic.Bool
+	shutdownError      websocket.CloseError
+	rateLimit          RateLimitConfig
+	maxMessageSize     int64
+	rateLimitedHandler MessageHandler
+	trustedProxies     []*net.IPNet
+	trustedProxyErrors []error
+	clientCertHeader   string
+	events             eventBus
 }
 
 // ServerOpt is a function that can be used to set options on a server during creation.
@@ -191,6 +207,104 @@ func WithServerMeterProvider(meterProvider metric.MeterProvider) ServerOpt {
 	}
 }
 
+// WithServerTracerProvider sets the tracer provider for server traces.
+// A span is created for every websocket connection, which is accessible via the SpanContextProvider interface of the channel.
+func WithServerTracerProvider(tracerProvider trace.TracerProvider) ServerOpt {
+	return func(s *server) {
+		s.tracer = newTracer(tracerProvider)
+	}
+}
+
+// DuplicateConnectionPolicy defines how the server handles a new connection with the ID of an already connected client.
+type DuplicateConnectionPolicy int
+
+const (
+	// RejectDuplicateConnection closes the new connection with a ClosePolicyViolation, keeping the existing one.
+	// This is the default policy.
+	RejectDuplicateConnection DuplicateConnectionPolicy = iota
+	// ReplaceDuplicateConnection closes the existing connection and hands over to the new one.
+	//
+	// This allows clients to reconnect over a new TCP connection, before the server noticed that the old one is dead
+	// (e.g. due to NAT timeouts or cellular handovers).
+	ReplaceDuplicateConnection
+)
+
+// DuplicateConnectionHandler decides how to handle a new connection with the ID of an already connected client.
+// The existing channel and the HTTP request of the new connection are passed to the handler.
+type DuplicateConnectionHandler func(existing Channel, r *http.Request) DuplicateConnectionPolicy
+
+// ReplacedHandler is invoked when an existing connection was replaced by a new connection with the same ID.
+// The old channel is already closed, while the new one is ready to use.
+type ReplacedHandler func(old Channel, new Channel)
+
+// ListenerServer is implemented by servers, which may accept incoming connections on an existing listener.
+type ListenerServer interface {
+	// Serve is like Start, but accepts incoming connections on the given listener, e.g. a Unix socket or a systemd-activated listener.
+	// The listener is closed once the function returns.
+	//
+	// The function blocks until the server is stopped. It returns nil if the server was stopped via Stop or Shutdown,
+	// or the error that caused the server to fail otherwise.
+	Serve(listener net.Listener, listenPath string) error
+}
+
+// GracefulShutdowner is implemented by servers, which support shutting down gracefully.
+//
+// Upper layers may use it to stop accepting new connections, while ongoing message exchanges complete.
+type GracefulShutdowner interface {
+	// StopAccepting stops accepting new connections: subsequent upgrade requests are rejected with 503 Service Unavailable.
+	// Open channels are not affected. Use Shutdown to close them.
+	StopAccepting()
+	// Shutdown gracefully shuts down a running websocket server.
+	//
+	// New connections are rejected, while all open channels are closed with the close error configured via WithShutdownCloseError.
+	// The function waits until all channels were closed or ctx is done, then the previously called Start function will return.
+	// If ctx is done before all channels were closed, ctx.Err() is returned.
+	Shutdown(ctx context.Context) error
+}
+
+// ConnectionReplacer is implemented by servers, which support replacing duplicate connections.
+//
+// Upper layers may use it to be notified of replaced connections, e.g. to migrate the state of the old channel to the new one.
+type ConnectionReplacer interface {
+	// SetReplacedClientHandler sets a callback function, invoked when a connection was replaced by a new one with the same ID.
+	//
+	// If the callback is set, it is invoked instead of the disconnected client handler for the old channel
+	// and the new client handler for the new channel.
+	// Otherwise, the replacement is notified as a disconnection, followed by a new connection.
+	SetReplacedClientHandler(handler ReplacedHandler)
+}
+
+// WithDuplicateConnectionPolicy sets the policy for new connections with the ID of an already connected client.
+// By default, duplicate connections are rejected.
+func WithDuplicateConnectionPolicy(policy DuplicateConnectionPolicy) ServerOpt {
+	return func(s *server) {
+		s.duplicateHandler = func(Channel, *http.Request) DuplicateConnectionPolicy {
+			return policy
+		}
+	}
+}
+
+// WithDuplicateConnectionHandler sets a callback, which decides how to handle each new connection
+// with the ID of an already connected client. It replaces any policy set via WithDuplicateConnectionPolicy.
+//
+// The handler is invoked after the connection was upgraded, so it MUST return as soon as possible.
+func WithDuplicateConnectionHandler(handler DuplicateConnectionHandler) ServerOpt {
+	return func(s *server) {
+		s.duplicateHandler = handler
+	}
+}
+
+// Close error sent to clients by Shutdown, unless configured otherwise via WithShutdownCloseError.
+var defaultShutdownCloseError = websocket.CloseError{Code: websocket.CloseServiceRestart, Text: "server shutting down"}
+
+// WithShutdownCloseError sets the close error sent to clients, when their connection is closed by Shutdown.
+// By default, connections are closed with CloseServiceRestart, so clients may reconnect to another server instance.
+func WithShutdownCloseError(closeError websocket.CloseError) ServerOpt {
+	return func(s *server) {
+		s.shutdownError = closeError
+	}
+}
+
 // WithServerLogger sets the logger for the server.
 // If not set, a VoidLogger will be used.
 func WithServerLogger(logger logging.Logger) ServerOpt {
@@ -231,11 +345,15 @@ func NewServer(opts ...ServerOpt) Server {
 		timeoutConfig: NewServerTimeoutConfig(),
 		upgrader:      websocket.Upgrader{Subprotocols: []string{}},
 		httpHandler:   router,
+		connections:   make(map[string]*webSocket),
 		chargePointIdResolver: func(r *http.Request) (string, error) {
 			url := r.URL
 			return path.Base(url.Path), nil
 		},
-		metrics: serverMetrics,
+		metrics:       serverMetrics,
+		shutdownError: defaultShutdownCloseError,
+		// Note: If tracing is not configured, the global tracer provider is used, which is a noop by default.
+		tracer: newTracer(nil),
 	}
 	for _, o := range opts {
 		o(s)
@@ -245,6 +363,9 @@ func NewServer(opts ...ServerOpt) Server {
 		// todo improve error handling
 		s.logger.Error(errors.Wrap(err, "Error creating websocket server metrics"))
 	}
+	for _, err := range s.trustedProxyErrors {
+		s.logger.Error(err)
+	}
 
 	s.upgrader.EnableCompression = s.enableCompression
 	return s
@@ -254,6 +375,10 @@ func (s *server) SetMessageHandler(handler MessageHandler) {
 	s.messageHandler = handler
 }
 
+func (s *server) SetRateLimitedMessageHandler(handler MessageHandler) {
+	s.rateLimitedHandler = handler
+}
+
 func (s *server) SetCheckClientHandler(handler CheckClientHandler) {
 	s.checkClientHandler = handler
 }
@@ -266,6 +391,10 @@ func (s *server) SetDisconnectedClientHandler(handler func(ws Channel)) {
 	s.disconnectedHandler = handler
 }
 
+func (s *server) SetReplacedClientHandler(handler ReplacedHandler) {
+	s.replacedHandler = handler
+}
+
 func (s *server) SetTimeoutConfig(config ServerTimeoutConfig) {
 	s.timeoutConfig = config
 }
@@ -306,6 +435,10 @@ func (s *server) Errors() <-chan error {
 	return s.errC
 }
 
+func (s *server) SubscribeEvents(bufferSize int) (<-chan Event, func()) {
+	return s.events.subscribe(bufferSize)
+}
+
 func (s *server) Addr() *net.TCPAddr {
 	return s.addr
 }
@@ -315,42 +448,57 @@ func (s *server) AddHttpHandler(listenPath string, handler func(w http.ResponseW
 }
 
 func (s *server) Start(port int, listenPath string) {
+	addr := fmt.Sprintf(":%v", port)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.error(fmt.Errorf("failed to listen: %w", err))
+		return
+	}
+
+	s.logger.Infof("listening on tcp network %v", addr)
+	if err = s.Serve(ln, listenPath); err != nil {
+		s.error(fmt.Errorf("failed to listen: %w", err))
+	}
+}
+
+func (s *server) Serve(listener net.Listener, listenPath string) error {
+	defer listener.Close()
 	s.connMutex.Lock()
 	s.connections = make(map[string]*webSocket)
 	s.connMutex.Unlock()
+	s.draining.Store(false)
 
 	if s.httpServer == nil {
 		s.httpServer = &http.Server{}
 	}
+	s.httpServer.Addr = listener.Addr().String()
 
-	addr := fmt.Sprintf(":%v", port)
-	s.httpServer.Addr = addr
-
-	s.AddHttpHandler(listenPath, func(w http.ResponseWriter, r *http.Request) {
-		s.wsHandler(w, r)
-	})
+	s.AddHttpHandler(listenPath, s.ServeHTTP)
 	s.httpServer.Handler = s.httpHandler
 
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		s.error(fmt.Errorf("failed to listen: %w", err))
-		return
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		s.addr = addr
 	}
-	defer ln.Close()
 
-	s.addr = ln.Addr().(*net.TCPAddr)
-
-	s.logger.Infof("listening on tcp network %v", addr)
-	s.httpServer.RegisterOnShutdown(s.stopConnections)
+	var err error
 	if s.tlsCertificatePath != "" && s.tlsCertificateKey != "" {
-		err = s.httpServer.ServeTLS(ln, s.tlsCertificatePath, s.tlsCertificateKey)
+		err = s.httpServer.ServeTLS(listener, s.tlsCertificatePath, s.tlsCertificateKey)
 	} else {
-		err = s.httpServer.Serve(ln)
+		err = s.httpServer.Serve(listener)
 	}
-
-	if !errors.Is(err, http.ErrServerClosed) {
-		s.error(fmt.Errorf("failed to listen: %w", err))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
 	}
+	return err
+}
+
+// ServeHTTP upgrades an incoming HTTP request to a websocket connection, making the server an http.Handler.
+//
+// The handler may be mounted on an existing HTTP server or router, on one or more paths, instead of calling Start or Serve.
+// In this case, the charge point ID is resolved from the request as usual (see SetChargePointIdResolver),
+// and Stop or Shutdown only close the websocket connections, leaving the HTTP server running.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.wsHandler(w, r)
 }
 
 func (s *server) Stop() {
@@ -359,11 +507,55 @@ func (s *server) Stop() {
 	if err != nil {
 		s.error(fmt.Errorf("shutdown failed: %w", err))
 	}
+	s.stopConnections()
+
+	if s.errC != nil {
+		close(s.errC)
+		s.errC = nil
+	}
+}
+
+func (s *server) StopAccepting() {
+	s.draining.Store(true)
+}
+
+func (s *server) Shutdown(ctx context.Context) error {
+	s.logger.Info("shutting down websocket server")
+	s.StopAccepting()
+	s.connMutex.RLock()
+	connections := make([]*webSocket, 0, len(s.connections))
+	for _, conn := range s.connections {
+		connections = append(connections, conn)
+	}
+	s.connMutex.RUnlock()
+
+	for _, conn := range connections {
+		if err := conn.Close(s.shutdownError); err != nil {
+			s.logger.Debugf("connection for %s is already closing: %v", conn.ID(), err)
+		}
+	}
+	var result error
+	for _, conn := range connections {
+		select {
+		case <-conn.closedC:
+		case <-ctx.Done():
+			result = ctx.Err()
+		}
+		if result != nil {
+			break
+		}
+	}
 
+	if err := s.httpServer.Shutdown(ctx); err != nil && result == nil {
+		result = fmt.Errorf("shutdown failed: %w", err)
+	}
+	// Remaining connections are closed forcefully
+	s.stopConnections()
 	if s.errC != nil {
 		close(s.errC)
 		s.errC = nil
 	}
+	return result
 }
 
 func (s *server) StopConnection(id string, closeError websocket.CloseError) error {
@@ -393,7 +585,7 @@ func (s *server) GetChannel(websocketId string) (Channel, bool) {
 
 func (s *server) stopConnections() {
 	s.connMutex.Lock()
-	defer s.connMutex.Lock()
+	defer s.connMutex.Unlock()
 
 	for _, conn := range s.connections {
 		err := conn.Close(websocket.CloseError{Code: websocket.CloseNormalClosure, Text: ""})
@@ -428,7 +620,23 @@ func (s *server) wsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "NotFound", http.StatusNotFound)
 		return
 	}
-	s.logger.Debugf("handling new connection for %s from %s", id, r.RemoteAddr)
+	peer, err := s.resolvePeer(r)
+	if err != nil {
+		s.error(err)
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	r = withPeer(r, peer)
+	remoteAddr := r.RemoteAddr
+	if peer.Addr != nil {
+		remoteAddr = peer.Addr.String()
+	}
+	s.logger.Debugf("handling new connection for %s from %s", id, remoteAddr)
+	if s.draining.Load() {
+		s.logger.Debugf("rejecting connection for %s, server is not accepting new connections", id)
+		http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+		return
+	}
 	// Negotiate sub-protocol
 	clientSubProtocols := websocket.Subprotocols(r)
 	negotiatedSubProtocol := ""
@@ -457,6 +665,7 @@ out:
 			ok = s.basicAuthHandler(username, password)
 		}
 		if !ok {
+			s.events.publish(Event{Type: AuthRejectedEvent, ClientID: id, RemoteAddr: peer.Addr, Reason: "invalid credentials"})
 			s.error(fmt.Errorf("basic auth failed: credentials invalid"))
 			w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
@@ -467,14 +676,18 @@ out:
 	if s.checkClientHandler != nil {
 		ok := s.checkClientHandler(id, r)
 		if !ok {
+			s.events.publish(Event{Type: AuthRejectedEvent, ClientID: id, RemoteAddr: peer.Addr, Reason: "invalid client"})
 			s.error(fmt.Errorf("client validation: invalid client"))
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 	}
 
-	// Upgrade websocket
-	conn, err := s.upgrader.Upgrade(w, r, responseHeader)
+	// Upgrade websocket. The sub-protocol was negotiated above, following the preference order of the client,
+	// so the upgrader must not pick one on its own.
+	upgrader := s.upgrader
+	upgrader.Subprotocols = nil
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 	if err != nil {
 		s.error(fmt.Errorf("upgrade failed: %w", err))
 		return
@@ -483,7 +696,7 @@ out:
 	s.logger.Debugf("upgraded websocket connection for %s from %s", id, conn.RemoteAddr().String())
 	// If unsupported sub-protocol, terminate the connection immediately
 	if negotiatedSubProtocol == "" {
-		s.error(fmt.Errorf("unsupported subprotocols %v for new client %v (%v)", clientSubProtocols, id, r.RemoteAddr))
+		s.error(fmt.Errorf("unsupported subprotocols %v for new client %v (%v)", clientSubProtocols, id, remoteAddr))
 		_ = conn.WriteControl(websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.CloseProtocolError, "invalid or unsupported subprotocol"),
 			time.Now().Add(s.timeoutConfig.WriteWait))
@@ -491,10 +704,21 @@ out:
 		return
 	}
 	// Check whether client exists
+	s.connMutex.RLock()
+	existing, exists := s.connections[id]
+	s.connMutex.RUnlock()
+	var replaced *webSocket
+	if exists && s.duplicatePolicy(existing, r) == ReplaceDuplicateConnection {
+		s.replaceConnection(existing)
+		replaced = existing
+	}
 	s.connMutex.Lock()
 	// There is already a connection with the same ID. Close the new one immediately with a PolicyViolation.
-	if _, exists := s.connections[id]; exists {
+	// If the existing connection was replaced, another connection with the same ID may have taken over in the meantime.
+	if _, exists = s.connections[id]; exists {
 		s.connMutex.Unlock()
+		s.replacementFailed(replaced)
+		s.events.publish(Event{Type: DuplicateRejectedEvent, ClientID: id, RemoteAddr: peer.Addr, Reason: "a connection with this ID already exists"})
 		s.error(fmt.Errorf("client %s already exists, closing duplicate client", id))
 		_ = conn.WriteControl(websocket.CloseMessage,
 			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "a connection with this ID already exists"),
@@ -515,17 +739,23 @@ out:
 			s.logger),
 		s.handleMessage,
 		s.handleDisconnect,
-		func(_ Channel, err error) {
-			s.error(err)
-		},
+		s.handleError,
 	)
 	if err != nil {
 		s.connMutex.Unlock()
+		s.replacementFailed(replaced)
 		s.error(fmt.Errorf("failed to create websocket for client %s: %w", id, err))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	ws.span = startConnectionSpan(r.Context(), s.tracer, trace.SpanKindServer, id, remoteAddr, negotiatedSubProtocol)
+	ws.limiter = newTokenBucket(s.rateLimit)
+	ws.peer = &peer
+	ws.header = r.Header
+	if s.maxMessageSize > 0 {
+		conn.SetReadLimit(s.maxMessageSize)
+	}
 	// Add new client
 	s.connections[ws.id] = ws
 	s.connMutex.Unlock()
@@ -534,14 +764,52 @@ out:
 
 	// Start reader and write routine
 	ws.run()
-	if s.newClientHandler != nil {
+	s.events.publish(Event{Type: ConnectedEvent, ClientID: id, Channel: ws, RemoteAddr: ws.RemoteAddr()})
+	if replaced != nil && s.replacedHandler != nil && replaced.replacedNotified.CompareAndSwap(false, true) {
+		s.replacedHandler(replaced, ws)
+	} else if s.newClientHandler != nil {
 		var channel Channel = ws
 		s.newClientHandler(channel)
 	}
 }
 
+// duplicatePolicy returns the policy for a new connection with the ID of the existing channel.
+func (s *server) duplicatePolicy(existing Channel, r *http.Request) DuplicateConnectionPolicy {
+	if s.duplicateHandler == nil {
+		return RejectDuplicateConnection
+	}
+	return s.duplicateHandler(existing, r)
+}
+
+// replaceConnection closes an existing connection, which is replaced by a new one with the same ID.
+// The function returns once the connection was cleaned up.
+func (s *server) replaceConnection(existing *webSocket) {
+	s.logger.Infof("replacing existing connection for %s", existing.ID())
+	existing.replaced.Store(true)
+	err := existing.Close(websocket.CloseError{Code: websocket.ClosePolicyViolation, Text: "replaced by a new connection"})
+	if err != nil {
+		s.logger.Debugf("connection for %s is already closing: %v", existing.ID(), err)
+	}
+	<-existing.closedC
+}
+
+// replacementFailed notifies the disconnection of a replaced connection, if no new connection took its place.
+// The disconnection is only notified, if neither the replacement nor the disconnection were notified yet,
+// e.g. by another connection replacing the same one concurrently.
+func (s *server) replacementFailed(replaced *webSocket) {
+	if replaced == nil || s.replacedHandler == nil || s.disconnectedHandler == nil {
+		return
+	}
+	if replaced.replacedNotified.CompareAndSwap(false, true) {
+		s.disconnectedHandler(replaced)
+	}
+}
+
 // --------- Internal callbacks webSocket -> server ---------
 func (s *server) handleMessage(w Channel, data []byte) error {
+	if ws, ok := w.(*webSocket); ok && ws.limiter != nil && !ws.limiter.allow(time.Now()) {
+		return s.rateLimitExceeded(ws, data)
+	}
 	if s.messageHandler != nil {
 		s.metrics.RecordMessageRate(context.Background(), w.ID(), directionInbound)
 		return s.messageHandler(w, data)
@@ -549,13 +817,31 @@ func (s *server) handleMessage(w Channel, data []byte) error {
 	return fmt.Errorf("no message handler set")
 }
 
-func (s *server) handleDisconnect(w Channel, _ error) {
+func (s *server) handleError(w Channel, err error) {
+	if errors.Is(err, websocket.ErrReadLimit) {
+		s.metrics.RecordLimitViolation(w.ID(), MessageSizeViolation, CloseConnection)
+		err = LimitViolationError{ClientID: w.ID(), Violation: MessageSizeViolation, Action: CloseConnection}
+	}
+	s.error(err)
+}
+
+func (s *server) handleDisconnect(w Channel, err error) {
 	// server never attempts to auto-reconnect to client. Resources are simply freed up
 	s.connMutex.Lock()
-	delete(s.connections, w.ID())
+	if current, ok := s.connections[w.ID()]; ok && Channel(current) == w {
+		delete(s.connections, w.ID())
+	}
 	s.connMutex.Unlock()
 	s.logger.Infof("closed connection to %s", w.ID())
-	if s.disconnectedHandler != nil {
+	if isTimeout(err) {
+		s.events.publish(Event{Type: PingTimeoutEvent, ClientID: w.ID(), Channel: w, RemoteAddr: w.RemoteAddr()})
+	}
+	closeCode, closeReason := closeDetails(w, err)
+	s.events.publish(Event{Type: DisconnectedEvent, ClientID: w.ID(), Channel: w, RemoteAddr: w.RemoteAddr(), CloseCode: closeCode, Reason: closeReason})
+	// A replaced connection is notified together with the new one
+	ws, _ := w.(*webSocket)
+	replaced := ws != nil && ws.replaced.Load() && s.replacedHandler != nil
+	if s.disconnectedHandler != nil && !replaced {
 		s.disconnectedHandler(w)
 	}
 
@@ -0,0 +1,62 @@
+package ws
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName          = "github.com/xBlaz3kx/ocpp-go/ws"
+	connectionSpanName  = "websocket connection"
+	attributeClientID   = "ocpp.charge_point_id"
+	attributeRemoteAddr = "net.peer.addr"
+	attributeProtocol   = "websocket.subprotocol"
+)
+
+// SpanContextProvider is implemented by channels and clients, which trace their connection via OpenTelemetry.
+//
+// The span of a connection starts once the websocket is established and ends when it is closed.
+// Spans of messages exchanged over the connection may link to it.
+type SpanContextProvider interface {
+	// SpanContext returns the span context of the current connection.
+	// The returned span context is invalid, if there is no connection.
+	SpanContext() trace.SpanContext
+}
+
+// newTracer returns the tracer of the package for the given provider.
+// If provider is nil, the global tracer provider is used.
+func newTracer(provider trace.TracerProvider) trace.Tracer {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+// startConnectionSpan starts the span of a new websocket connection.
+func startConnectionSpan(ctx context.Context, tracer trace.Tracer, kind trace.SpanKind, id string, remoteAddr string, subProtocol string) trace.Span {
+	_, span := tracer.Start(ctx, connectionSpanName,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(
+			attribute.String(attributeClientID, id),
+			attribute.String(attributeRemoteAddr, remoteAddr),
+			attribute.String(attributeProtocol, subProtocol),
+		),
+	)
+	return span
+}
+
+// endConnectionSpan ends the span of a websocket connection. A forced disconnection is recorded as error.
+func endConnectionSpan(span trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,254 @@
+package ws
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Peer describes the client of a websocket connection, as seen by the server.
+type Peer struct {
+	// Address of the client. Behind a trusted proxy, this is the address forwarded by the proxy.
+	Addr net.Addr
+	// Certificate chain presented by the client, leaf first. Behind a trusted proxy, this is the chain forwarded by the proxy.
+	// Nil, if the client didn't present any certificate.
+	Certificates []*x509.Certificate
+	// Address of the trusted proxy, which forwarded the connection. Nil, if the client connected directly.
+	Proxy net.Addr
+}
+
+// PeerProvider is implemented by channels, which expose the client of a connection.
+type PeerProvider interface {
+	// Peer returns the client of the connection.
+	Peer() Peer
+}
+
+type peerContextKey struct{}
+
+// PeerFromRequest returns the client of a websocket connection request, as resolved by the server.
+// The function may be used within a CheckClientHandler.
+func PeerFromRequest(r *http.Request) (Peer, bool) {
+	peer, ok := r.Context().Value(peerContextKey{}).(Peer)
+	return peer, ok
+}
+
+// TrustedProxyConfig contains the configuration for accepting connections through reverse proxies,
+// e.g. TLS-terminating load balancers.
+type TrustedProxyConfig struct {
+	// The trusted proxies, either as CIDRs (e.g. "10.0.0.0/8") or as single IP addresses.
+	// Forwarded headers are only honored for connections coming from a trusted proxy.
+	Proxies []string
+	// The header containing the client certificate chain, forwarded by the proxies (e.g. "X-Forwarded-Client-Cert").
+	// If empty, client certificates aren't read from forwarded headers.
+	//
+	// The header may contain either URL-encoded PEM certificates, or an Envoy-style element with Cert and Chain fields.
+	ClientCertHeader string
+}
+
+// WithTrustedProxies configures the server to run behind reverse proxies.
+//
+// For connections coming from a trusted proxy, the address of the client is read from the Forwarded or,
+// if missing, from the X-Forwarded-For header. The client certificate chain is read from the configured header.
+// The resolved client is exposed via the PeerProvider interface of the channel and via PeerFromRequest.
+// The RemoteAddr of the channel returns the address of the client as well.
+//
+// Invalid proxy addresses are ignored and logged, when the server is created.
+func WithTrustedProxies(config TrustedProxyConfig) ServerOpt {
+	return func(s *server) {
+		s.trustedProxies = nil
+		s.trustedProxyErrors = nil
+		for _, proxy := range config.Proxies {
+			network, err := parseIPNet(proxy)
+			if err != nil {
+				s.trustedProxyErrors = append(s.trustedProxyErrors, err)
+				continue
+			}
+			s.trustedProxies = append(s.trustedProxies, network)
+		}
+		s.clientCertHeader = config.ClientCertHeader
+	}
+}
+
+// parseIPNet parses a CIDR or a single IP address.
+func parseIPNet(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %v: %w", s, err)
+		}
+		return network, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted proxy %v", s)
+	}
+	bits := 8 * net.IPv4len
+	if ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+func (s *server) isTrustedProxy(ip net.IP) bool {
+	for _, network := range s.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePeer returns the client of a connection request.
+// Forwarded headers are only taken into account, if the request comes from a trusted proxy.
+func (s *server) resolvePeer(r *http.Request) (Peer, error) {
+	var peer Peer
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		peer.Certificates = r.TLS.PeerCertificates
+	}
+	remoteAddr := parseTCPAddr(r.RemoteAddr)
+	if remoteAddr == nil {
+		// Not an IP address, e.g. when serving on a unix socket
+		return peer, nil
+	}
+	peer.Addr = remoteAddr
+	if !s.isTrustedProxy(remoteAddr.IP) {
+		return peer, nil
+	}
+	peer.Proxy = remoteAddr
+	peer.Addr = s.forwardedAddr(r, remoteAddr)
+	if s.clientCertHeader != "" {
+		peer.Certificates = nil
+		if value := r.Header.Get(s.clientCertHeader); value != "" {
+			certificates, err := parseForwardedCertificates(value)
+			if err != nil {
+				return peer, fmt.Errorf("invalid client certificate forwarded by %v: %w", remoteAddr, err)
+			}
+			peer.Certificates = certificates
+		}
+	}
+	return peer, nil
+}
+
+// forwardedAddr returns the address of the client, as forwarded by a chain of proxies.
+// The chain is walked from the closest proxy, until the first untrusted address is found.
+func (s *server) forwardedAddr(r *http.Request, proxyAddr *net.TCPAddr) *net.TCPAddr {
+	var hops []string
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		hops = forwardedForValues(values)
+	} else {
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, hop := range strings.Split(value, ",") {
+				hops = append(hops, strings.TrimSpace(hop))
+			}
+		}
+	}
+	addr := proxyAddr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hopAddr := parseTCPAddr(hops[i])
+		if hopAddr == nil {
+			// Unknown or obfuscated address, the closest known address is used
+			break
+		}
+		addr = hopAddr
+		if !s.isTrustedProxy(hopAddr.IP) {
+			break
+		}
+	}
+	return addr
+}
+
+// forwardedForValues returns the for= parameters of Forwarded headers, as defined by RFC 7239.
+func forwardedForValues(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := "unknown"
+			for _, pair := range strings.Split(element, ";") {
+				key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(key, "for") {
+					hop = strings.Trim(val, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// parseTCPAddr parses an IP address with an optional port. Returns nil, if the address is invalid.
+func parseTCPAddr(s string) *net.TCPAddr {
+	if ip := net.ParseIP(strings.Trim(s, "[]")); ip != nil {
+		return &net.TCPAddr{IP: ip}
+	}
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	port, err := strconv.Atoi(portStr)
+	if ip == nil || err != nil {
+		return nil
+	}
+	return &net.TCPAddr{IP: ip, Port: port}
+}
+
+// parseForwardedCertificates parses a certificate chain forwarded by a proxy.
+// The value may either contain URL-encoded PEM certificates, or an Envoy-style element with Cert and Chain fields.
+func parseForwardedCertificates(value string) ([]*x509.Certificate, error) {
+	value = strings.TrimSpace(value)
+	encoded := value
+	if !strings.HasPrefix(value, "-----BEGIN") && !strings.HasPrefix(strings.ToUpper(value), "%2D%2D%2D%2D%2DBEGIN") {
+		// Envoy format, e.g. By=...;Hash=...;Cert="...";Chain="...". The chain includes the leaf certificate.
+		encoded = ""
+		element, _, _ := strings.Cut(value, ",")
+		for _, pair := range strings.Split(element, ";") {
+			key, val, found := strings.Cut(strings.TrimSpace(pair), "=")
+			if !found {
+				continue
+			}
+			if strings.EqualFold(key, "Chain") {
+				encoded = strings.Trim(val, `"`)
+				break
+			} else if strings.EqualFold(key, "Cert") {
+				encoded = strings.Trim(val, `"`)
+			}
+		}
+	}
+	// Plain unescaping, since base64-encoded data may contain '+' characters
+	data, err := url.PathUnescape(encoded)
+	if err != nil {
+		return nil, err
+	}
+	var certificates []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, fmt.Errorf("no certificates found")
+	}
+	return certificates, nil
+}
+
+// withPeer attaches the client of a connection request to the request context.
+func withPeer(r *http.Request, peer Peer) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), peerContextKey{}, peer))
+}
@@ -6,13 +6,17 @@ package ws
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/xBlaz3kx/ocpp-go/logging"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -141,6 +145,31 @@ type Channel interface {
 	IsConnected() bool
 }
 
+// HeaderProvider is implemented by channels, which expose the HTTP headers of the websocket handshake.
+type HeaderProvider interface {
+	// Header returns the HTTP headers of the websocket handshake.
+	// For channels accepted by a server, these are the request headers sent by the client (e.g. User-Agent).
+	// For client channels, these are the response headers sent by the server.
+	Header() http.Header
+}
+
+// ChannelStatsProvider is implemented by channels, which keep traffic statistics of their connection.
+type ChannelStatsProvider interface {
+	// Stats returns a snapshot of the traffic statistics of the connection.
+	Stats() ChannelStats
+}
+
+// ChannelStats contains the traffic statistics of a channel.
+type ChannelStats struct {
+	ConnectedAt   time.Time     // The time the connection was established.
+	LastMessageAt time.Time     // The time the last message was received from the peer. Zero, if no message was received yet.
+	MessagesIn    int64         // The number of messages received from the peer.
+	MessagesOut   int64         // The number of messages sent to the peer.
+	BytesIn       int64         // The number of payload bytes received from the peer.
+	BytesOut      int64         // The number of payload bytes sent to the peer.
+	PingRTT       time.Duration // The round-trip time of the last ping sent to the peer. Zero, if no pong was received yet.
+}
+
 // WebSocketConfig is a utility config struct for a single webSocket.
 // By default, it inherits values from respective the ClientTimeoutConfig or ServerTimeoutConfig.
 // However, during creation, some fields may be overridden and customized on a websocket-basis.
@@ -229,6 +258,24 @@ type webSocket struct {
 	onClosed           DisconnectedHandler
 	onError            ErrorHandler
 	onMessage          MessageHandler
+	span               trace.Span            // span of the connection, may be nil
+	closedC            chan struct{}         // closed once the connection was cleaned up and the onClosed callback returned.
+	replaced           atomic.Bool           // set if the connection is being replaced by a new one with the same ID.
+	replacedNotified   atomic.Bool           // set once the replacement or the disconnection of a replaced connection was notified.
+	subProtocol        string                // subprotocol negotiated during the handshake.
+	limiter            *tokenBucket          // inbound rate limit, may be nil. Only accessed by the readPump.
+	peer               *Peer                 // client of the connection, as resolved by the server. Nil for client-side websockets.
+	header             http.Header           // headers of the handshake request (server-side) or response (client-side).
+	closeError         *websocket.CloseError // close error sent to the peer, when the connection was closed gracefully.
+	remoteAddr         net.Addr
+	connectedAt        time.Time
+	lastMessageAt      atomic.Int64 // unix nanoseconds
+	messagesIn         atomic.Int64
+	messagesOut        atomic.Int64
+	bytesIn            atomic.Int64
+	bytesOut           atomic.Int64
+	pingSentAt         atomic.Int64 // unix nanoseconds
+	pingRTT            atomic.Int64
 }
 
 func newWebSocket(id string, conn *websocket.Conn, tlsState *tls.ConnectionState, cfg WebSocketConfig, onMessage MessageHandler, onClosed DisconnectedHandler, onError ErrorHandler) (*webSocket, error) {
@@ -240,10 +287,14 @@ func newWebSocket(id string, conn *websocket.Conn, tlsState *tls.ConnectionState
 		connection:         conn,
 		mutex:              sync.RWMutex{},
 		tlsConnectionState: tlsState,
+		subProtocol:        conn.Subprotocol(),
+		connectedAt:        time.Now(),
+		remoteAddr:         conn.RemoteAddr(),
 		outQueue:           make(chan message, 2),
 		pingC:              make(chan []byte, 1),
 		closeC:             make(chan websocket.CloseError, 1),
 		forceCloseC:        make(chan error, 1),
+		closedC:            make(chan struct{}),
 		onClosed:           onClosed,
 		onError:            onError,
 		onMessage:          onMessage,
@@ -258,8 +309,20 @@ func (w *webSocket) ID() string {
 }
 
 // Returns the address of the remote peer.
+// Behind a trusted proxy, the address of the client forwarded by the proxy is returned.
 func (w *webSocket) RemoteAddr() net.Addr {
-	return w.connection.RemoteAddr()
+	if w.peer != nil && w.peer.Addr != nil {
+		return w.peer.Addr
+	}
+	return w.remoteAddr
+}
+
+// Returns the client of the connection. Only available for connections accepted by a server.
+func (w *webSocket) Peer() Peer {
+	if w.peer != nil {
+		return *w.peer
+	}
+	return Peer{Addr: w.RemoteAddr()}
 }
 
 // Returns the TLS connection state of the connection, if any.
@@ -267,6 +330,40 @@ func (w *webSocket) TLSConnectionState() *tls.ConnectionState {
 	return w.tlsConnectionState
 }
 
+// Returns the span context of the connection. The span context is invalid, if the connection isn't traced.
+func (w *webSocket) SpanContext() trace.SpanContext {
+	if w.span == nil {
+		return trace.SpanContext{}
+	}
+	return w.span.SpanContext()
+}
+
+// Returns the subprotocol negotiated during the handshake.
+func (w *webSocket) SubProtocol() string {
+	return w.subProtocol
+}
+
+// Returns the headers of the websocket handshake.
+func (w *webSocket) Header() http.Header {
+	return w.header
+}
+
+// Returns a snapshot of the traffic statistics of the connection.
+func (w *webSocket) Stats() ChannelStats {
+	stats := ChannelStats{
+		ConnectedAt: w.connectedAt,
+		MessagesIn:  w.messagesIn.Load(),
+		MessagesOut: w.messagesOut.Load(),
+		BytesIn:     w.bytesIn.Load(),
+		BytesOut:    w.bytesOut.Load(),
+		PingRTT:     time.Duration(w.pingRTT.Load()),
+	}
+	if last := w.lastMessageAt.Load(); last != 0 {
+		stats.LastMessageAt = time.Unix(0, last)
+	}
+	return stats
+}
+
 func (w *webSocket) IsConnected() bool {
 	w.mutex.RLock()
 	defer w.mutex.RUnlock()
@@ -356,6 +453,9 @@ func (w *webSocket) onPing(appData string) error {
 func (w *webSocket) onPong(appData string) error {
 	conn := w.connection
 	w.log.Debugf("pong received from %s: %s", w.id, appData)
+	if sentAt := w.pingSentAt.Load(); sentAt != 0 {
+		w.pingRTT.Store(time.Now().UnixNano() - sentAt)
+	}
 	// Reset read interval after receiving a pong
 	return conn.SetReadDeadline(w.getReadTimeout())
 }
@@ -372,9 +472,11 @@ func (w *webSocket) cleanup(err error) {
 	close(w.closeC)
 	close(w.forceCloseC)
 	w.mutex.Unlock()
+	endConnectionSpan(w.span, err)
 	// Invoke callback to notify the websocket was closed.
 	// If err is not nil, the disconnect is considered forced (i.e. not user-initiated).
 	w.onClosed(w, err)
+	close(w.closedC)
 }
 
 func (w *webSocket) run() {
@@ -397,7 +499,8 @@ func (w *webSocket) readPump() {
 	for {
 		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure, websocket.CloseNormalClosure) ||
+				errors.Is(err, websocket.ErrReadLimit) {
 				w.onError(w, fmt.Errorf("read failed unexpectedly for %s: %w", w.id, err))
 			}
 			// Verify whether the disconnect was already dealt with
@@ -415,6 +518,9 @@ func (w *webSocket) readPump() {
 			return
 		}
 
+		w.messagesIn.Add(1)
+		w.bytesIn.Add(int64(len(msg)))
+		w.lastMessageAt.Store(time.Now().UnixNano())
 		// Forward message to handler.
 		// Errors during the handling don't interrupt the websocket routine but will be reported.
 		err = w.onMessage(w, msg)
@@ -441,6 +547,7 @@ func (w *webSocket) writePump() {
 			w.mutex.Lock()
 			// Send periodic ping
 			_ = conn.SetWriteDeadline(time.Now().Add(w.cfg.WriteWait))
+			w.pingSentAt.Store(time.Now().UnixNano())
 			err := conn.WriteMessage(websocket.PingMessage, []byte{})
 			w.mutex.Unlock()
 			if err != nil {
@@ -483,6 +590,8 @@ func (w *webSocket) writePump() {
 				closure(err)
 				return
 			}
+			w.messagesOut.Add(1)
+			w.bytesOut.Add(int64(len(msg.data)))
 			w.log.Debugf("written %d bytes to %s", len(msg.data), w.id)
 		case closeErr := <-w.closeC:
 			// webSocket is being gracefully closed by user command
@@ -495,6 +604,7 @@ func (w *webSocket) writePump() {
 				websocket.FormatCloseMessage(closeErr.Code, closeErr.Text),
 				time.Now().Add(w.cfg.WriteWait))
 			w.mutex.Unlock()
+			w.closeError = &closeErr
 			if err != nil {
 				// At this point the connection is considered to be forcefully closed,
 				// but we still continue with the intended flow.
@@ -1,24 +1,32 @@
 package ws
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/pem"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -28,6 +36,12 @@ import (
 
 	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -561,6 +575,731 @@ func (s *WebSocketSuite) TestClientDuplicateConnection() {
 	s.True(ok)
 }
 
+func (s *WebSocketSuite) TestClientDuplicateConnectionReplaced() {
+	s.server = newWebsocketServer(s.T(), nil)
+	WithDuplicateConnectionPolicy(ReplaceDuplicateConnection)(s.server)
+	connectedC := make(chan Channel, 2)
+	disconnectedC := make(chan Channel, 2)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	s.server.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	// Connect client 1
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	wsClient1 := newWebsocketClient(s.T(), nil)
+	s.client = wsClient1
+	closedC := make(chan error, 1)
+	wsClient1.SetDisconnectedHandler(func(err error) {
+		wsClient1.SetDisconnectedHandler(nil)
+		closedC <- err
+	})
+	err := wsClient1.Start(u.String())
+	s.Require().NoError(err)
+	oldChannel := <-connectedC
+	// Connect client 2, replacing client 1
+	wsClient2 := newWebsocketClient(s.T(), nil)
+	defer wsClient2.Stop()
+	err = wsClient2.Start(u.String())
+	s.Require().NoError(err)
+	select {
+	case err = <-closedC:
+		var wsErr *websocket.CloseError
+		s.Require().True(errors.As(err, &wsErr))
+		s.Equal(websocket.ClosePolicyViolation, wsErr.Code)
+		s.Equal("replaced by a new connection", wsErr.Text)
+	case <-time.After(time.Second):
+		s.FailNow("old connection wasn't closed")
+	}
+	// Replacement is notified as disconnection, followed by a new connection
+	s.Equal(oldChannel, <-disconnectedC)
+	newChannel := <-connectedC
+	s.NotEqual(oldChannel, newChannel)
+	s.True(newChannel.IsConnected())
+	c, ok := s.server.GetChannel(path.Base(testPath))
+	s.True(ok)
+	s.Equal(newChannel, c)
+}
+
+func (s *WebSocketSuite) TestClientDuplicateConnectionHandler() {
+	s.server = newWebsocketServer(s.T(), nil)
+	WithDuplicateConnectionHandler(func(existing Channel, r *http.Request) DuplicateConnectionPolicy {
+		s.Equal(path.Base(testPath), existing.ID())
+		if r.Header.Get("X-Replace") != "" {
+			return ReplaceDuplicateConnection
+		}
+		return RejectDuplicateConnection
+	})(s.server)
+	connectedC := make(chan Channel, 1)
+	replacedC := make(chan [2]Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	disconnectedC := make(chan Channel, 1)
+	s.server.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	s.server.SetReplacedClientHandler(func(old Channel, new Channel) {
+		replacedC <- [2]Channel{old, new}
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	wsClient1 := newWebsocketClient(s.T(), nil)
+	s.client = wsClient1
+	wsClient1.SetDisconnectedHandler(func(err error) {
+		wsClient1.SetDisconnectedHandler(nil)
+	})
+	err := wsClient1.Start(u.String())
+	s.Require().NoError(err)
+	oldChannel := <-connectedC
+	// Duplicate connection without header is rejected
+	rejectedC := make(chan struct{}, 1)
+	wsClient2 := newWebsocketClient(s.T(), nil)
+	wsClient2.SetDisconnectedHandler(func(err error) {
+		wsClient2.SetDisconnectedHandler(nil)
+		rejectedC <- struct{}{}
+	})
+	err = wsClient2.Start(u.String())
+	s.Require().NoError(err)
+	<-rejectedC
+	s.True(oldChannel.IsConnected())
+	// Duplicate connection with header replaces the old one
+	wsClient3 := newWebsocketClient(s.T(), nil)
+	defer wsClient3.Stop()
+	wsClient3.SetHeaderValue("X-Replace", "true")
+	err = wsClient3.Start(u.String())
+	s.Require().NoError(err)
+	select {
+	case channels := <-replacedC:
+		s.Equal(oldChannel, channels[0])
+		s.False(channels[0].IsConnected())
+		s.True(channels[1].IsConnected())
+	case <-time.After(time.Second):
+		s.FailNow("connection wasn't replaced")
+	}
+	s.Empty(connectedC)
+	s.Empty(disconnectedC)
+}
+
+func (s *WebSocketSuite) TestClientDuplicateConnectionReplacementFailed() {
+	s.server = newWebsocketServer(s.T(), nil)
+	id := path.Base(testPath)
+	// Another connection takes over, while the existing one is being replaced
+	takeover := &webSocket{id: id}
+	WithDuplicateConnectionHandler(func(existing Channel, r *http.Request) DuplicateConnectionPolicy {
+		s.server.connMutex.Lock()
+		s.server.connections[id] = takeover
+		s.server.connMutex.Unlock()
+		return ReplaceDuplicateConnection
+	})(s.server)
+	connectedC := make(chan Channel, 1)
+	disconnectedC := make(chan Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	s.server.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	s.server.SetReplacedClientHandler(func(old Channel, new Channel) {
+		s.Fail("replacement shouldn't be notified")
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	wsClient1 := newWebsocketClient(s.T(), nil)
+	s.client = wsClient1
+	wsClient1.SetDisconnectedHandler(func(err error) {
+		wsClient1.SetDisconnectedHandler(nil)
+	})
+	err := wsClient1.Start(u.String())
+	s.Require().NoError(err)
+	oldChannel := <-connectedC
+	rejectedC := make(chan struct{}, 1)
+	wsClient2 := newWebsocketClient(s.T(), nil)
+	wsClient2.SetDisconnectedHandler(func(err error) {
+		wsClient2.SetDisconnectedHandler(nil)
+		rejectedC <- struct{}{}
+	})
+	err = wsClient2.Start(u.String())
+	s.Require().NoError(err)
+	<-rejectedC
+	// The closed connection is notified as disconnected, since nothing replaced it
+	select {
+	case channel := <-disconnectedC:
+		s.Equal(oldChannel, channel)
+	case <-time.After(time.Second):
+		s.FailNow("replaced connection wasn't notified")
+	}
+	s.Empty(connectedC)
+	s.server.connMutex.Lock()
+	delete(s.server.connections, id)
+	s.server.connMutex.Unlock()
+}
+
+func (s *WebSocketSuite) TestServerShutdown() {
+	closeError := websocket.CloseError{Code: websocket.CloseTryAgainLater, Text: "try another replica"}
+	s.server = newWebsocketServer(s.T(), nil)
+	WithShutdownCloseError(closeError)(s.server)
+	connectedC := make(chan Channel, 1)
+	disconnectedC := make(chan Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	s.server.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	wsClient := newWebsocketClient(s.T(), nil)
+	s.client = wsClient
+	closedC := make(chan error, 1)
+	wsClient.SetDisconnectedHandler(func(err error) {
+		wsClient.SetDisconnectedHandler(nil)
+		closedC <- err
+	})
+	err := wsClient.Start(u.String())
+	s.Require().NoError(err)
+	channel := <-connectedC
+	// New connections are rejected, while open ones keep working
+	s.server.StopAccepting()
+	wsClient2 := newWebsocketClient(s.T(), nil)
+	err = wsClient2.Start(u.String())
+	var httpErr HttpConnectionError
+	s.Require().ErrorAs(err, &httpErr)
+	s.Equal(http.StatusServiceUnavailable, httpErr.HttpCode)
+	s.True(channel.IsConnected())
+	// Open connections are closed with the configured close error
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err = s.server.Shutdown(ctx)
+	s.Require().NoError(err)
+	s.Equal(channel, <-disconnectedC)
+	select {
+	case err = <-closedC:
+		var wsErr *websocket.CloseError
+		s.Require().ErrorAs(err, &wsErr)
+		s.Equal(closeError.Code, wsErr.Code)
+		s.Equal(closeError.Text, wsErr.Text)
+	case <-time.After(time.Second):
+		s.FailNow("client wasn't disconnected")
+	}
+	s.server = nil
+}
+
+func (s *WebSocketSuite) TestServerServeListener() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	connectedC := make(chan Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	serveC := make(chan error, 1)
+	go func() {
+		serveC <- s.server.Serve(listener, serverPath)
+	}()
+	u := url.URL{Scheme: "ws", Host: listener.Addr().String(), Path: testPath}
+	err = s.client.Start(u.String())
+	s.Require().NoError(err)
+	channel := <-connectedC
+	s.Equal(path.Base(testPath), channel.ID())
+	s.Equal(listener.Addr().String(), s.server.Addr().String())
+	// Stopping the server causes Serve to return without error
+	s.server.Stop()
+	select {
+	case err = <-serveC:
+		s.NoError(err)
+	case <-time.After(time.Second):
+		s.FailNow("serve didn't return")
+	}
+	s.server = nil
+}
+
+func (s *WebSocketSuite) TestServerHandler() {
+	connectedC := make(chan Channel, 2)
+	disconnectedC := make(chan Channel, 2)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	s.server.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnectedC <- ws
+	})
+	// Mount the handler on an existing router, on multiple paths
+	mux := http.NewServeMux()
+	mux.Handle("/ocpp16/{id}", s.server)
+	mux.Handle("/ocpp201/{id}", s.server)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+	host := strings.TrimPrefix(httpServer.URL, "http://")
+	client1 := newWebsocketClient(s.T(), nil)
+	s.client = client1
+	err := client1.Start((&url.URL{Scheme: "ws", Host: host, Path: "/ocpp16/cp1"}).String())
+	s.Require().NoError(err)
+	client2 := newWebsocketClient(s.T(), nil)
+	defer client2.Stop()
+	err = client2.Start((&url.URL{Scheme: "ws", Host: host, Path: "/ocpp201/cp2"}).String())
+	s.Require().NoError(err)
+	ids := []string{(<-connectedC).ID(), (<-connectedC).ID()}
+	s.ElementsMatch([]string{"cp1", "cp2"}, ids)
+	_, ok := s.server.GetChannel("cp2")
+	s.True(ok)
+	// Stopping the server only closes the websocket connections
+	s.server.Stop()
+	ids = []string{(<-disconnectedC).ID(), (<-disconnectedC).ID()}
+	s.ElementsMatch([]string{"cp1", "cp2"}, ids)
+	resp, err := http.Get(httpServer.URL + "/health")
+	s.Require().NoError(err)
+	_ = resp.Body.Close()
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.server = nil
+}
+
+func (s *WebSocketSuite) TestProtocolRouter() {
+	router := NewProtocolRouter(s.server)
+	route16 := router.Route(defaultSubProtocol)
+	route201 := router.Route("ocpp2.0.1")
+	connected16C := make(chan Channel, 1)
+	connected201C := make(chan Channel, 1)
+	disconnected16C := make(chan Channel, 1)
+	message201C := make(chan []byte, 1)
+	route16.SetNewClientHandler(func(ws Channel) {
+		connected16C <- ws
+	})
+	route16.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnected16C <- ws
+	})
+	route201.SetNewClientHandler(func(ws Channel) {
+		connected201C <- ws
+	})
+	route201.SetMessageHandler(func(ws Channel, data []byte) error {
+		message201C <- data
+		return nil
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	go func() {
+		_ = route16.(ListenerServer).Serve(listener, serverPath)
+	}()
+	// OCPP 1.6 client
+	u := url.URL{Scheme: "ws", Host: listener.Addr().String(), Path: "/ws/cp1"}
+	err = s.client.Start(u.String())
+	s.Require().NoError(err)
+	s.Equal("cp1", (<-connected16C).ID())
+	// Client preferring OCPP 2.0.1
+	client201 := NewClient()
+	client201.SetRequestedSubProtocol("ocpp2.0.1")
+	client201.SetRequestedSubProtocol(defaultSubProtocol)
+	clientMessageC := make(chan []byte, 1)
+	client201.SetMessageHandler(func(data []byte) error {
+		clientMessageC <- data
+		return nil
+	})
+	u.Path = "/ws/cp2"
+	err = client201.Start(u.String())
+	s.Require().NoError(err)
+	defer client201.Stop()
+	s.Equal("cp2", (<-connected201C).ID())
+	subProto, ok := router.SubProtocol("cp2")
+	s.True(ok)
+	s.Equal("ocpp2.0.1", subProto)
+	// Messages are routed by subprotocol
+	err = client201.Write([]byte("inbound"))
+	s.Require().NoError(err)
+	s.Equal([]byte("inbound"), <-message201C)
+	_, ok = route16.GetChannel("cp2")
+	s.False(ok)
+	s.Error(route16.Write("cp2", []byte("outbound")))
+	err = route201.Write("cp2", []byte("outbound"))
+	s.Require().NoError(err)
+	s.Equal([]byte("outbound"), <-clientMessageC)
+	// Client IDs are unique across subprotocols
+	duplicateClient := NewClient()
+	duplicateClient.SetRequestedSubProtocol("ocpp2.0.1")
+	closedC := make(chan error, 1)
+	duplicateClient.SetDisconnectedHandler(func(err error) {
+		duplicateClient.SetDisconnectedHandler(nil)
+		closedC <- err
+	})
+	u.Path = "/ws/cp1"
+	err = duplicateClient.Start(u.String())
+	s.Require().NoError(err)
+	var wsErr *websocket.CloseError
+	s.Require().ErrorAs(<-closedC, &wsErr)
+	s.Equal(websocket.ClosePolicyViolation, wsErr.Code)
+	// Stopping a route only closes its own channels
+	route16.Stop()
+	s.Equal("cp1", (<-disconnected16C).ID())
+	_, ok = router.SubProtocol("cp1")
+	s.False(ok)
+	_, ok = route201.GetChannel("cp2")
+	s.True(ok)
+}
+
+func (s *WebSocketSuite) TestServerRateLimit() {
+	reader := sdkmetric.NewManualReader()
+	WithServerMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))(s.server)
+	WithRateLimit(RateLimitConfig{MessagesPerSecond: 0.01, Burst: 2, Action: RejectMessage})(s.server)
+	messageC := make(chan []byte, 4)
+	s.server.SetMessageHandler(func(ws Channel, data []byte) error {
+		messageC <- data
+		return nil
+	})
+	rejectedC := make(chan []byte, 4)
+	s.server.SetRateLimitedMessageHandler(func(ws Channel, data []byte) error {
+		rejectedC <- data
+		return nil
+	})
+	errC := s.server.Errors()
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	// The first messages are within the burst, the following ones are rejected
+	for i := 0; i < 4; i++ {
+		err = s.client.Write([]byte(strconv.Itoa(i)))
+		s.Require().NoError(err)
+	}
+	s.Equal([]byte("0"), <-messageC)
+	s.Equal([]byte("1"), <-messageC)
+	for i := 2; i < 4; i++ {
+		s.Equal([]byte(strconv.Itoa(i)), <-rejectedC)
+		err = <-errC
+		var violationErr LimitViolationError
+		s.Require().ErrorAs(err, &violationErr)
+		s.Equal(path.Base(testPath), violationErr.ClientID)
+		s.Equal(RateLimitViolation, violationErr.Violation)
+		s.Equal(RejectMessage, violationErr.Action)
+	}
+	s.Len(messageC, 0)
+	s.True(s.client.IsConnected())
+	// Violations are recorded as metrics
+	var metrics metricdata.ResourceMetrics
+	s.Require().NoError(reader.Collect(context.Background(), &metrics))
+	var violations int64
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == limitViolationsMetric {
+				for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+					violations += point.Value
+				}
+			}
+		}
+	}
+	s.Equal(int64(2), violations)
+}
+
+func (s *WebSocketSuite) TestServerRateLimitClose() {
+	WithRateLimit(RateLimitConfig{MessagesPerSecond: 0.01, Burst: 1, Action: CloseConnection})(s.server)
+	messageC := make(chan []byte, 2)
+	s.server.SetMessageHandler(func(ws Channel, data []byte) error {
+		messageC <- data
+		return nil
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	disconnectedC := make(chan error, 1)
+	s.client.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	s.Require().NoError(s.client.Write([]byte("1")))
+	s.Require().NoError(s.client.Write([]byte("2")))
+	s.Equal([]byte("1"), <-messageC)
+	select {
+	case err = <-disconnectedC:
+		var closeErr *websocket.CloseError
+		s.Require().ErrorAs(err, &closeErr)
+		s.Equal(websocket.ClosePolicyViolation, closeErr.Code)
+		s.Equal("rate limit exceeded", closeErr.Text)
+	case <-time.After(time.Second):
+		s.FailNow("connection wasn't closed")
+	}
+	s.Len(messageC, 0)
+}
+
+func (s *WebSocketSuite) TestServerMaxMessageSize() {
+	WithMaxMessageSize(16)(s.server)
+	messageC := make(chan []byte, 2)
+	s.server.SetMessageHandler(func(ws Channel, data []byte) error {
+		messageC <- data
+		return nil
+	})
+	errC := s.server.Errors()
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	disconnectedC := make(chan error, 1)
+	s.client.SetDisconnectedHandler(func(err error) {
+		disconnectedC <- err
+	})
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	s.Require().NoError(s.client.Write([]byte("short")))
+	s.Equal([]byte("short"), <-messageC)
+	s.Require().NoError(s.client.Write([]byte("a message exceeding the limit")))
+	err = <-errC
+	var violationErr LimitViolationError
+	s.Require().ErrorAs(err, &violationErr)
+	s.Equal(MessageSizeViolation, violationErr.Violation)
+	s.Equal(CloseConnection, violationErr.Action)
+	select {
+	case err = <-disconnectedC:
+		var closeErr *websocket.CloseError
+		s.Require().ErrorAs(err, &closeErr)
+		s.Equal(websocket.CloseMessageTooBig, closeErr.Code)
+	case <-time.After(time.Second):
+		s.FailNow("connection wasn't closed")
+	}
+	s.Len(messageC, 0)
+}
+
+func (s *WebSocketSuite) TestServerTrustedProxy() {
+	certFilename := "/tmp/client.pem"
+	keyFilename := "/tmp/client.key"
+	err := createTLSCertificate(certFilename, keyFilename, "CP001", nil, nil)
+	s.Require().NoError(err)
+	defer os.Remove(certFilename)
+	defer os.Remove(keyFilename)
+	certPEM, err := os.ReadFile(certFilename)
+	s.Require().NoError(err)
+	WithTrustedProxies(TrustedProxyConfig{
+		Proxies:          []string{"127.0.0.1", "10.0.0.0/8"},
+		ClientCertHeader: "X-Forwarded-Client-Cert",
+	})(s.server)
+	peerC := make(chan Peer, 1)
+	s.server.SetCheckClientHandler(func(id string, r *http.Request) bool {
+		peer, ok := PeerFromRequest(r)
+		s.True(ok)
+		peerC <- peer
+		return true
+	})
+	connectedC := make(chan Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	// The client is the first untrusted hop, as seen from the server
+	s.client.SetHeaderValue("X-Forwarded-For", "198.51.100.1, 203.0.113.7, 10.1.2.3")
+	s.client.SetHeaderValue("X-Forwarded-Client-Cert", url.PathEscape(string(certPEM)))
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err = s.client.Start(u.String())
+	s.Require().NoError(err)
+	peer := <-peerC
+	s.Equal("203.0.113.7:0", peer.Addr.String())
+	s.Require().NotNil(peer.Proxy)
+	s.Equal("127.0.0.1", peer.Proxy.(*net.TCPAddr).IP.String())
+	s.Require().Len(peer.Certificates, 1)
+	s.Equal("CP001", peer.Certificates[0].Subject.CommonName)
+	channel := <-connectedC
+	s.Equal("203.0.113.7:0", channel.RemoteAddr().String())
+	provider, ok := channel.(PeerProvider)
+	s.Require().True(ok)
+	s.Equal(peer, provider.Peer())
+	// An invalid forwarded certificate is rejected
+	wsClient := newWebsocketClient(s.T(), nil)
+	wsClient.SetHeaderValue("X-Forwarded-Client-Cert", "invalid")
+	u.Path = "/ws/invalid"
+	err = wsClient.Start(u.String())
+	var httpErr HttpConnectionError
+	s.Require().ErrorAs(err, &httpErr)
+	s.Equal(http.StatusBadRequest, httpErr.HttpCode)
+}
+
+func (s *WebSocketSuite) TestServerUntrustedProxy() {
+	WithTrustedProxies(TrustedProxyConfig{
+		Proxies:          []string{"10.0.0.0/8", "invalid"},
+		ClientCertHeader: "X-Forwarded-Client-Cert",
+	})(s.server)
+	s.Len(s.server.trustedProxies, 1)
+	s.Len(s.server.trustedProxyErrors, 1)
+	connectedC := make(chan Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	// Forwarded headers are ignored, since the connection doesn't come from a trusted proxy
+	s.client.SetHeaderValue("X-Forwarded-For", "203.0.113.7")
+	s.client.SetHeaderValue("X-Forwarded-Client-Cert", "invalid")
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	channel := <-connectedC
+	peer := channel.(PeerProvider).Peer()
+	s.Equal("127.0.0.1", peer.Addr.(*net.TCPAddr).IP.String())
+	s.Nil(peer.Proxy)
+	s.Nil(peer.Certificates)
+}
+
+func (s *WebSocketSuite) TestForwardedHeaders() {
+	WithTrustedProxies(TrustedProxyConfig{Proxies: []string{"10.0.0.0/8", "2001:db8::/32"}})(s.server)
+	proxyAddr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1234}
+	testTable := []struct {
+		header   string
+		value    string
+		expected string
+	}{
+		{"Forwarded", `for=192.0.2.60;proto=http;by=203.0.113.43`, "192.0.2.60:0"},
+		{"Forwarded", `for="[2001:db8:cafe::17]:4711", for=10.1.1.1`, "[2001:db8:cafe::17]:4711"},
+		{"Forwarded", `for=192.0.2.60, for="_hidden", for=10.1.1.1`, "10.1.1.1:0"},
+		{"Forwarded", `for=unknown`, "10.0.0.1:1234"},
+		{"X-Forwarded-For", "192.0.2.60, 10.1.1.1", "192.0.2.60:0"},
+		{"X-Forwarded-For", "10.2.2.2, 10.1.1.1", "10.2.2.2:0"},
+	}
+	for _, tc := range testTable {
+		r := httptest.NewRequest(http.MethodGet, "/ws/test", nil)
+		r.Header.Set(tc.header, tc.value)
+		s.Equal(tc.expected, s.server.forwardedAddr(r, proxyAddr).String(), tc.value)
+	}
+}
+
+func (s *WebSocketSuite) TestForwardedCertificates() {
+	certFilename := "/tmp/client.pem"
+	keyFilename := "/tmp/client.key"
+	err := createTLSCertificate(certFilename, keyFilename, "CP001", nil, nil)
+	s.Require().NoError(err)
+	defer os.Remove(certFilename)
+	defer os.Remove(keyFilename)
+	certPEM, err := os.ReadFile(certFilename)
+	s.Require().NoError(err)
+	// Plain PEM
+	certificates, err := parseForwardedCertificates(string(certPEM))
+	s.Require().NoError(err)
+	s.Require().Len(certificates, 1)
+	s.Equal("CP001", certificates[0].Subject.CommonName)
+	// Envoy format, with the leaf certificate and the chain
+	escaped := url.QueryEscape(string(certPEM))
+	escaped = strings.ReplaceAll(escaped, "+", "%20")
+	certificates, err = parseForwardedCertificates(fmt.Sprintf(`By=spiffe://example.com;Hash=abc;Cert="%v";Chain="%v%v"`, escaped, escaped, escaped))
+	s.Require().NoError(err)
+	s.Len(certificates, 2)
+	// Invalid values
+	_, err = parseForwardedCertificates("By=spiffe://example.com;Hash=abc")
+	s.Error(err)
+	_, err = parseForwardedCertificates("-----BEGIN CERTIFICATE-----\ninvalid\n-----END CERTIFICATE-----")
+	s.Error(err)
+}
+
+func (s *WebSocketSuite) TestServerEvents() {
+	s.server.AddSupportedSubprotocol(defaultSubProtocol)
+	s.server.SetBasicAuthHandler(func(username string, password string) bool {
+		return username == "testuser" && password == "testpass"
+	})
+	eventC, unsubscribe := s.server.SubscribeEvents(10)
+	nextEvent := func() Event {
+		select {
+		case event := <-eventC:
+			return event
+		case <-time.After(1 * time.Second):
+			s.FailNow("timeout waiting for server event")
+		}
+		return Event{}
+	}
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	s.client.SetBasicAuth("testuser", "testpass")
+	s.client.SetHeaderValue("X-Test", "value")
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	event := nextEvent()
+	s.Equal(ConnectedEvent, event.Type)
+	s.Equal("testws", event.ClientID)
+	s.False(event.Time.IsZero())
+	s.NotNil(event.RemoteAddr)
+	channel := event.Channel
+	s.Require().NotNil(channel)
+	s.Equal(defaultSubProtocol, channel.(SubProtocolProvider).SubProtocol())
+	s.Equal("value", channel.(HeaderProvider).Header().Get("X-Test"))
+	// Exchange messages and check the statistics
+	err = s.client.Write([]byte("ping"))
+	s.Require().NoError(err)
+	err = s.server.Write(channel.ID(), []byte("pong!"))
+	s.Require().NoError(err)
+	statsProvider, ok := channel.(ChannelStatsProvider)
+	s.Require().True(ok)
+	s.Eventually(func() bool {
+		stats := statsProvider.Stats()
+		return stats.MessagesIn == 1 && stats.MessagesOut == 1
+	}, 1*time.Second, 10*time.Millisecond)
+	stats := statsProvider.Stats()
+	s.Equal(int64(4), stats.BytesIn)
+	s.Equal(int64(5), stats.BytesOut)
+	s.False(stats.ConnectedAt.IsZero())
+	s.False(stats.LastMessageAt.Before(stats.ConnectedAt))
+	// Rejected connections
+	wsClient := newWebsocketClient(s.T(), nil)
+	wsClient.SetBasicAuth("testuser", "invalid")
+	err = wsClient.Start(u.String())
+	s.Require().Error(err)
+	event = nextEvent()
+	s.Equal(AuthRejectedEvent, event.Type)
+	s.Equal("testws", event.ClientID)
+	s.Nil(event.Channel)
+	wsClient.SetBasicAuth("testuser", "testpass")
+	_ = wsClient.Start(u.String())
+	event = nextEvent()
+	s.Equal(DuplicateRejectedEvent, event.Type)
+	s.Equal("testws", event.ClientID)
+	s.Nil(event.Channel)
+	// Close the connection from the server
+	err = s.server.StopConnection(channel.ID(), websocket.CloseError{Code: websocket.CloseGoingAway, Text: "maintenance"})
+	s.Require().NoError(err)
+	event = nextEvent()
+	s.Equal(DisconnectedEvent, event.Type)
+	s.Equal("testws", event.ClientID)
+	s.Equal(channel, event.Channel)
+	s.Equal(websocket.CloseGoingAway, event.CloseCode)
+	s.Equal("maintenance", event.Reason)
+	// The channel is closed once unsubscribed
+	unsubscribe()
+	unsubscribe()
+	_, ok = <-eventC
+	s.False(ok)
+}
+
+func (s *WebSocketSuite) TestServerPingTimeoutEvent() {
+	config := NewServerTimeoutConfig()
+	config.PingWait = 200 * time.Millisecond
+	s.server.SetTimeoutConfig(config)
+	eventC, unsubscribe := s.server.SubscribeEvents(10)
+	defer unsubscribe()
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	var events []EventType
+	timeout := time.After(1 * time.Second)
+	for len(events) < 3 {
+		select {
+		case event := <-eventC:
+			events = append(events, event.Type)
+			if event.Type == DisconnectedEvent {
+				s.Equal(websocket.CloseAbnormalClosure, event.CloseCode)
+			}
+		case <-timeout:
+			s.FailNow("timeout waiting for server events", "received: %v", events)
+		}
+	}
+	s.Equal([]EventType{ConnectedEvent, PingTimeoutEvent, DisconnectedEvent}, events)
+}
+
 func (s *WebSocketSuite) TestServerStopConnection() {
 	triggerC := make(chan struct{}, 1)
 	disconnectedClientC := make(chan struct{}, 1)
@@ -724,6 +1463,268 @@ func (s *WebSocketSuite) TestWebsocketClientConnectionBreak() {
 	}
 }
 
+func (s *WebSocketSuite) TestClientHTTPProxy() {
+	proxy := newTestProxy(s.T(), httpConnectHandshake("proxyUser", "proxyPass"))
+	defer proxy.Close()
+	connectedC := make(chan Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	// Invalid proxy credentials
+	wsClient := newWebsocketClient(s.T(), nil)
+	WithClientHTTPProxy(proxy.Addr(), "proxyUser", "invalid")(wsClient)
+	err := wsClient.Start(u.String())
+	s.Require().Error(err)
+	s.Contains(err.Error(), "Proxy Authentication Required")
+	s.Equal(int32(0), proxy.tunnels.Load())
+	// Valid proxy credentials
+	WithClientHTTPProxy(proxy.Addr(), "proxyUser", "proxyPass")(s.client)
+	timeoutConfig := NewClientTimeoutConfig()
+	timeoutConfig.RetryBackOffWaitMinimum = 100 * time.Millisecond
+	timeoutConfig.RetryBackOffRandomRange = 0
+	s.client.SetTimeoutConfig(timeoutConfig)
+	reconnectedC := make(chan struct{}, 1)
+	s.client.SetReconnectedHandler(func() {
+		reconnectedC <- struct{}{}
+	})
+	s.client.StartWithRetries(u.String())
+	s.Equal(path.Base(testPath), (<-connectedC).ID())
+	s.Equal(int32(1), proxy.tunnels.Load())
+	// Reconnection goes through the proxy as well
+	err = s.server.StopConnection(path.Base(testPath), websocket.CloseError{Code: websocket.CloseGoingAway, Text: "reconnect"})
+	s.Require().NoError(err)
+	select {
+	case <-reconnectedC:
+	case <-time.After(2 * time.Second):
+		s.FailNow("client didn't reconnect")
+	}
+	s.Equal(path.Base(testPath), (<-connectedC).ID())
+	s.Equal(int32(2), proxy.tunnels.Load())
+}
+
+func (s *WebSocketSuite) TestClientEndpointFailover() {
+	// The first endpoint closes all connections right away
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	s.Require().NoError(err)
+	defer listener.Close()
+	var refused atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			refused.Add(1)
+			_ = conn.Close()
+		}
+	}()
+	connectedC := make(chan Channel, 1)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connectedC <- ws
+	})
+	s.server.SetBasicAuthHandler(func(username string, password string) bool {
+		return username == "user" && password == "pass"
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	timeoutConfig := NewClientTimeoutConfig()
+	timeoutConfig.RetryBackOffWaitMinimum = 50 * time.Millisecond
+	timeoutConfig.RetryBackOffRandomRange = 0
+	s.client.SetTimeoutConfig(timeoutConfig)
+	activeC := make(chan int, 1)
+	s.client.SetActiveEndpointHandler(func(endpoint Endpoint, index int) {
+		activeC <- index
+	})
+	s.client.StartWithEndpoints([]Endpoint{
+		{URL: fmt.Sprintf("ws://%v%v", listener.Addr(), testPath), ConnectionAttempts: 2},
+		{URL: fmt.Sprintf("ws://localhost:%v%v", serverPort, testPath), Username: "user", Password: "pass"},
+	})
+	s.Equal(1, <-activeC)
+	s.Equal(int32(2), refused.Load())
+	s.Equal(path.Base(testPath), (<-connectedC).ID())
+	// Reconnections start with the endpoint that was connected last
+	err = s.server.StopConnection(path.Base(testPath), websocket.CloseError{Code: websocket.CloseGoingAway, Text: "reconnect"})
+	s.Require().NoError(err)
+	select {
+	case index := <-activeC:
+		s.Equal(1, index)
+	case <-time.After(time.Second):
+		s.FailNow("client didn't reconnect")
+	}
+	s.Equal(int32(2), refused.Load())
+}
+
+func (s *WebSocketSuite) TestBackoffStrategies() {
+	// OCPP backoff doubles the delay RepeatTimes times, adding a random part every time
+	ocppBackoff := NewOCPPBackoff(ClientTimeoutConfig{RetryBackOffWaitMinimum: 10 * time.Second, RetryBackOffRandomRange: 2, RetryBackOffRepeatTimes: 2})
+	delay := ocppBackoff.NextDelay(1, 0)
+	s.GreaterOrEqual(delay, 10*time.Second)
+	s.LessOrEqual(delay, 12*time.Second)
+	delay = ocppBackoff.NextDelay(2, 10*time.Second)
+	s.GreaterOrEqual(delay, 20*time.Second)
+	s.LessOrEqual(delay, 22*time.Second)
+	delay = ocppBackoff.NextDelay(3, 20*time.Second)
+	s.GreaterOrEqual(delay, 40*time.Second)
+	s.LessOrEqual(delay, 42*time.Second)
+	s.Equal(40*time.Second, ocppBackoff.NextDelay(4, 40*time.Second))
+	// Exponential backoff is capped, and jittered downward
+	exponential := ExponentialBackoff{InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+	s.Equal(time.Second, exponential.NextDelay(1, 0))
+	s.Equal(4*time.Second, exponential.NextDelay(3, 0))
+	s.Equal(5*time.Second, exponential.NextDelay(10, 0))
+	exponential.Jitter = 0.5
+	for attempt := 1; attempt < 10; attempt++ {
+		delay = exponential.NextDelay(attempt, 0)
+		s.GreaterOrEqual(delay, 500*time.Millisecond)
+		s.LessOrEqual(delay, 5*time.Second)
+	}
+	// Decorrelated jitter grows up to three times the previous delay
+	decorrelated := DecorrelatedJitterBackoff{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	s.Equal(time.Second, decorrelated.NextDelay(1, 0))
+	for attempt := 2; attempt < 10; attempt++ {
+		delay = decorrelated.NextDelay(attempt, 2*time.Second)
+		s.GreaterOrEqual(delay, time.Second)
+		s.LessOrEqual(delay, 6*time.Second)
+	}
+	s.LessOrEqual(decorrelated.NextDelay(2, time.Minute), 10*time.Second)
+}
+
+func (s *WebSocketSuite) TestClientFatalHTTPStatus() {
+	var attempts atomic.Int32
+	s.server.SetBasicAuthHandler(func(username string, password string) bool {
+		attempts.Add(1)
+		return false
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	WithClientBackoff(ExponentialBackoff{InitialDelay: 10 * time.Millisecond})(s.client)
+	WithClientRetryClassifier(FatalHTTPStatusCodes(http.StatusUnauthorized))(s.client)
+	s.client.SetBasicAuth("user", "invalid")
+	errC := s.client.Errors()
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	// The client doesn't retry, since the server rejected the credentials
+	s.client.StartWithRetries(u.String())
+	s.False(s.client.IsConnected())
+	s.Equal(int32(1), attempts.Load())
+	err := <-errC
+	var stoppedErr ReconnectionStoppedError
+	s.Require().ErrorAs(err, &stoppedErr)
+	s.Equal(0, stoppedErr.Attempts)
+	var httpErr HttpConnectionError
+	s.Require().ErrorAs(err, &httpErr)
+	s.Equal(http.StatusUnauthorized, httpErr.HttpCode)
+}
+
+func (s *WebSocketSuite) TestClientMaxReconnectAttempts() {
+	var attempts atomic.Int32
+	s.server.SetCheckClientHandler(func(id string, r *http.Request) bool {
+		attempts.Add(1)
+		return false
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	WithClientBackoff(ExponentialBackoff{InitialDelay: 10 * time.Millisecond})(s.client)
+	WithClientMaxReconnectAttempts(2)(s.client)
+	errC := s.client.Errors()
+	var errs []error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for err := range errC {
+			errs = append(errs, err)
+			if _, ok := err.(ReconnectionStoppedError); ok {
+				return
+			}
+		}
+	}()
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	s.client.StartWithRetries(u.String())
+	s.False(s.client.IsConnected())
+	<-done
+	// Initial attempt + 2 reconnection attempts
+	s.Equal(int32(3), attempts.Load())
+	s.Require().Len(errs, 3)
+	stoppedErr, ok := errs[2].(ReconnectionStoppedError)
+	s.Require().True(ok)
+	s.Equal(2, stoppedErr.Attempts)
+}
+
+func (s *WebSocketSuite) TestClientSOCKS5Proxy() {
+	proxy := newTestProxy(s.T(), socks5Handshake)
+	defer proxy.Close()
+	messageC := make(chan []byte, 1)
+	s.server.SetMessageHandler(func(ws Channel, data []byte) error {
+		messageC <- data
+		return nil
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	WithClientSOCKS5Proxy(proxy.Addr(), "", "")(s.client)
+	u := url.URL{Scheme: "ws", Host: fmt.Sprintf("localhost:%v", serverPort), Path: testPath}
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	s.Equal(int32(1), proxy.tunnels.Load())
+	err = s.client.Write([]byte("hello"))
+	s.Require().NoError(err)
+	s.Equal([]byte("hello"), <-messageC)
+}
+
+func (s *WebSocketSuite) TestWebsocketConnectionSpans() {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	connected := make(chan Channel, 1)
+	disconnected := make(chan struct{}, 1)
+	s.server = NewServer(WithServerTracerProvider(provider)).(*server)
+	s.server.SetNewClientHandler(func(ws Channel) {
+		connected <- ws
+	})
+	s.server.SetDisconnectedClientHandler(func(ws Channel) {
+		disconnected <- struct{}{}
+	})
+	go s.server.Start(serverPort, serverPath)
+	time.Sleep(100 * time.Millisecond)
+	s.client = NewClient(WithClientTracerProvider(provider)).(*client)
+	s.client.SetRequestedSubProtocol(defaultSubProtocol)
+	s.Require().False(s.client.SpanContext().IsValid())
+	host := fmt.Sprintf("localhost:%v", serverPort)
+	u := url.URL{Scheme: "ws", Host: host, Path: testPath}
+	err := s.client.Start(u.String())
+	s.Require().NoError(err)
+	var channel Channel
+	select {
+	case channel = <-connected:
+	case <-time.After(1 * time.Second):
+		s.Require().Fail("timeout waiting for client to connect")
+	}
+	// Both ends of the connection are traced
+	serverSpan := channel.(SpanContextProvider).SpanContext()
+	s.Assert().True(serverSpan.IsValid())
+	s.Assert().True(s.client.SpanContext().IsValid())
+	s.Assert().Empty(exporter.GetSpans())
+	// Spans end once the connection is closed
+	s.client.Stop()
+	select {
+	case <-disconnected:
+	case <-time.After(1 * time.Second):
+		s.Require().Fail("timeout waiting for client disconnect")
+	}
+	s.Require().Eventually(func() bool {
+		return len(exporter.GetSpans()) == 2
+	}, time.Second, 10*time.Millisecond)
+	kinds := map[trace.SpanKind]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		s.Assert().Equal(connectionSpanName, span.Name)
+		s.Assert().Contains(span.Attributes, attribute.String(attributeClientID, "testws"))
+		kinds[span.SpanKind] = span
+	}
+	s.Assert().Equal(serverSpan.SpanID(), kinds[trace.SpanKindServer].SpanContext.SpanID())
+	s.Assert().Contains(kinds[trace.SpanKindServer].Attributes, attribute.String(attributeProtocol, defaultSubProtocol))
+	s.Assert().Contains(kinds, trace.SpanKindClient)
+}
+
 func (s *WebSocketSuite) TestWebsocketServerConnectionBreak() {
 	disconnected := make(chan struct{}, 1)
 	s.server = newWebsocketServer(s.T(), nil)
@@ -1431,6 +2432,130 @@ func createCACertificate(certificateFilename string, keyFilename string) (*x509.
 	return &template, privateKey, nil
 }
 
+// testProxy is a minimal in-process proxy, which tunnels connections to the target requested by the client.
+type testProxy struct {
+	listener net.Listener
+	tunnels  atomic.Int32 // number of tunnels established so far
+}
+
+// proxyHandshake runs the proxy protocol on a new client connection and returns the connection to the target.
+type proxyHandshake func(conn net.Conn) (net.Conn, error)
+
+func newTestProxy(t *testing.T, handshake proxyHandshake) *testProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	p := &testProxy{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				upstream, err := handshake(conn)
+				if err != nil {
+					return
+				}
+				defer upstream.Close()
+				p.tunnels.Add(1)
+				go func() {
+					_, _ = io.Copy(upstream, conn)
+					_ = upstream.Close()
+				}()
+				_, _ = io.Copy(conn, upstream)
+			}()
+		}
+	}()
+	return p
+}
+
+func (p *testProxy) Addr() string {
+	return p.listener.Addr().String()
+}
+
+func (p *testProxy) Close() {
+	_ = p.listener.Close()
+}
+
+// httpConnectHandshake accepts HTTP CONNECT requests. If username is set, clients must authenticate via basic auth.
+func httpConnectHandshake(username string, password string) proxyHandshake {
+	return func(conn net.Conn) (net.Conn, error) {
+		req, err := http.ReadRequest(bufio.NewReader(conn))
+		if err != nil {
+			return nil, err
+		}
+		if req.Method != http.MethodConnect {
+			_, _ = conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+			return nil, fmt.Errorf("unexpected method %v", req.Method)
+		}
+		credentials := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		if username != "" && req.Header.Get("Proxy-Authorization") != credentials {
+			_, _ = conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+			return nil, fmt.Errorf("invalid proxy credentials")
+		}
+		upstream, err := net.Dial("tcp", req.Host)
+		if err != nil {
+			_, _ = conn.Write([]byte("HTTP/1.1 502 Bad Gateway\r\n\r\n"))
+			return nil, err
+		}
+		_, err = conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		return upstream, err
+	}
+}
+
+// socks5Handshake accepts SOCKS5 CONNECT requests without authentication.
+func socks5Handshake(conn net.Conn) (net.Conn, error) {
+	// Greeting: version, number of methods, methods
+	greeting := make([]byte, 2)
+	if _, err := io.ReadFull(conn, greeting); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(conn, make([]byte, greeting[1])); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+		return nil, err
+	}
+	// Request: version, command, reserved, address type, address, port
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return nil, err
+	}
+	var host string
+	switch request[3] {
+	case 0x01:
+		ip := make([]byte, net.IPv4len)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 0x03:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, err
+		}
+		name := make([]byte, length[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		return nil, fmt.Errorf("unsupported address type %v", request[3])
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return nil, err
+	}
+	upstream, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		_, _ = conn.Write([]byte{0x05, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	_, err = conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	return upstream, err
+}
+
 func createTLSCertificate(certificateFilename string, keyFilename string, cn string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) error {
 	// Generate ed25519 key-pair
 	privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)